@@ -1,12 +1,15 @@
 package main
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/acorn-io/cmd"
 	"github.com/gptscript-ai/gptscript/pkg/cli"
 	"github.com/gptscript-ai/gptscript/pkg/daemon"
+	"github.com/gptscript-ai/gptscript/pkg/landlock"
 	"github.com/gptscript-ai/gptscript/pkg/mvl"
+	"github.com/gptscript-ai/gptscript/pkg/rlimit"
 
 	// Load all VCS
 	_ "github.com/gptscript-ai/gptscript/pkg/loader/vcs"
@@ -24,5 +27,17 @@ func main() {
 		}
 		os.Exit(0)
 	}
+	if len(os.Args) > 3 && os.Args[1] == landlock.Command {
+		// Only returns if the tool couldn't be started
+		err := landlock.SysLandlock()
+		_, _ = fmt.Fprintf(os.Stderr, "failed to run tool with landlock: %v\n", err)
+		os.Exit(1)
+	}
+	if len(os.Args) > 3 && os.Args[1] == rlimit.Command {
+		// Only returns if the tool couldn't be started
+		err := rlimit.SysRlimit()
+		_, _ = fmt.Fprintf(os.Stderr, "failed to run tool with resource limits: %v\n", err)
+		os.Exit(1)
+	}
 	cmd.Main(cli.New())
 }
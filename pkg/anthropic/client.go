@@ -0,0 +1,289 @@
+package anthropic
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/cache"
+	"github.com/gptscript-ai/gptscript/pkg/counter"
+	"github.com/gptscript-ai/gptscript/pkg/hash"
+	"github.com/gptscript-ai/gptscript/pkg/redact"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+const (
+	DefaultBaseURL   = "https://api.anthropic.com/v1"
+	apiVersion       = "2023-06-01"
+	defaultMaxTokens = 4096
+	modelPrefix      = "claude-"
+)
+
+type Options struct {
+	BaseURL string `usage:"Anthropic base URL" name:"anthropic-base-url" env:"ANTHROPIC_BASE_URL"`
+	APIKey  string `usage:"Anthropic API KEY" name:"anthropic-api-key" env:"ANTHROPIC_API_KEY"`
+	Cache   *cache.Client
+}
+
+func complete(opts ...Options) (result Options) {
+	for _, opt := range opts {
+		result.BaseURL = types.FirstSet(opt.BaseURL, result.BaseURL)
+		result.APIKey = types.FirstSet(opt.APIKey, result.APIKey)
+		result.Cache = types.FirstSet(opt.Cache, result.Cache)
+	}
+
+	if result.BaseURL == "" {
+		result.BaseURL = DefaultBaseURL
+	}
+
+	if result.APIKey == "" {
+		result.APIKey = os.Getenv("ANTHROPIC_API_KEY")
+	}
+
+	return result
+}
+
+// Client calls models with the Anthropic Messages API. It serves models whose name starts with "claude-", once an API
+// key is set. Without one, those models are left to the other clients, such as an OpenAI compatible proxy.
+type Client struct {
+	baseURL      string
+	apiKey       string
+	cache        *cache.Client
+	cacheKeyBase string
+}
+
+func NewClient(opts ...Options) *Client {
+	opt := complete(opts...)
+	redact.AddValues(opt.APIKey)
+	return &Client{
+		baseURL:      strings.TrimSuffix(opt.BaseURL, "/"),
+		apiKey:       opt.APIKey,
+		cache:        opt.Cache,
+		cacheKeyBase: hash.ID(opt.APIKey, opt.BaseURL),
+	}
+}
+
+func (c *Client) Supports(_ context.Context, modelName string) (bool, error) {
+	// Models of a provider tool are named "<model> from <provider>", and belong to that provider
+	return c.apiKey != "" && strings.HasPrefix(modelName, modelPrefix) && !strings.Contains(modelName, " from "), nil
+}
+
+func (c *Client) ListModels(ctx context.Context, providers ...string) (result []string, _ error) {
+	// Only serve if providers is empty or "" is in the list
+	if len(providers) != 0 && !slices.Contains(providers, "") {
+		return nil, nil
+	}
+	if c.apiKey == "" {
+		return nil, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/models", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var models struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&models); err != nil {
+		return nil, fmt.Errorf("failed to decode Anthropic models: %w", err)
+	}
+	for _, model := range models.Data {
+		result = append(result, model.ID)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	req.Header.Set("x-api-key", c.apiKey)
+	req.Header.Set("anthropic-version", apiVersion)
+	if req.Body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		var apiErr struct {
+			Error *apiError `json:"error"`
+		}
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Error != nil {
+			return nil, fmt.Errorf("anthropic request failed with status code [%d]: %w", resp.StatusCode, apiErr.Error)
+		}
+		return nil, fmt.Errorf("anthropic request failed with status code [%d]: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+func (c *Client) cacheKey(request messagesRequest) any {
+	return map[string]any{
+		"base":    c.cacheKeyBase,
+		"request": request,
+	}
+}
+
+func (c *Client) Call(ctx context.Context, messageRequest types.CompletionRequest, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	if c.apiKey == "" {
+		return nil, fmt.Errorf("ANTHROPIC_API_KEY is not set. Please set the ANTHROPIC_API_KEY environment variable")
+	}
+
+	request, err := toRequest(messageRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	id := counter.Next()
+	status <- types.CompletionStatus{
+		CompletionID: id,
+		Request:      request,
+	}
+
+	var (
+		result types.CompletionMessage
+		cached bool
+	)
+	if messageRequest.GetCache() {
+		cached, err = c.cache.Get(ctx, c.cacheKey(request), &result)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cached {
+		// The response is cached complete, so it is replayed as one partial response
+		status <- types.CompletionStatus{
+			CompletionID:    id,
+			PartialResponse: ptr(clone(result)),
+		}
+	}
+	if !cached {
+		result, err = c.call(ctx, request, id, status)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.cache.Store(ctx, c.cacheKey(request), result); err != nil {
+			return nil, err
+		}
+	}
+
+	var usage types.Usage
+	if !cached {
+		usage = result.Usage
+	}
+
+	status <- types.CompletionStatus{
+		CompletionID: id,
+		Response:     result,
+		Usage:        usage,
+		Cached:       cached,
+	}
+
+	return &result, nil
+}
+
+func (c *Client) call(ctx context.Context, request messagesRequest, transactionID string, partial chan<- types.CompletionStatus) (types.CompletionMessage, error) {
+	partial <- types.CompletionStatus{
+		CompletionID: transactionID,
+		PartialResponse: &types.CompletionMessage{
+			Role:    types.CompletionMessageRoleTypeAssistant,
+			Content: types.Text("Waiting for model response..."),
+		},
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return types.CompletionMessage{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/messages", bytes.NewReader(body))
+	if err != nil {
+		return types.CompletionMessage{}, err
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return types.CompletionMessage{}, err
+	}
+	defer resp.Body.Close()
+
+	return readStream(resp.Body, func(msg types.CompletionMessage) {
+		partial <- types.CompletionStatus{
+			CompletionID:    transactionID,
+			PartialResponse: &msg,
+		}
+	})
+}
+
+// readStream reads the server sent events of a streamed response, calling partial with the message so far after each
+// event.
+func readStream(body io.Reader, partial func(types.CompletionMessage)) (types.CompletionMessage, error) {
+	var (
+		msg = types.CompletionMessage{
+			Role: types.CompletionMessageRoleTypeAssistant,
+		}
+		blocks  = map[int]int{}
+		scanner = bufio.NewScanner(body)
+		err     error
+	)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+
+		var event streamEvent
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &event); err != nil {
+			return msg, fmt.Errorf("failed to decode Anthropic stream event: %w", err)
+		}
+
+		msg, err = appendEvent(msg, blocks, event)
+		if err != nil {
+			return msg, err
+		}
+		if event.Type == "content_block_delta" {
+			partial(clone(msg))
+		}
+		if event.Type == "message_stop" {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return msg, err
+	}
+
+	return finish(msg), nil
+}
+
+// clone copies the content of msg, so that a partial response is not changed by the events that follow it.
+func clone(msg types.CompletionMessage) types.CompletionMessage {
+	msg.Content = slices.Clone(msg.Content)
+	for i, part := range msg.Content {
+		if part.ToolCall != nil {
+			toolCall := *part.ToolCall
+			msg.Content[i].ToolCall = &toolCall
+		}
+	}
+	return msg
+}
@@ -0,0 +1,147 @@
+package anthropic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToRequest(t *testing.T) {
+	request, err := toRequest(types.CompletionRequest{
+		Model:                "claude-3-5-sonnet-latest",
+		InternalSystemPrompt: new(bool),
+		Tools: []types.CompletionTool{{
+			Function: types.CompletionFunctionDefinition{
+				Name:        "ls",
+				Description: "List files",
+			},
+		}},
+		Messages: []types.CompletionMessage{
+			{Role: types.CompletionMessageRoleTypeSystem, Content: types.Text("You are helpful.")},
+			{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("List the files")},
+			{Role: types.CompletionMessageRoleTypeAssistant, Content: []types.ContentPart{
+				{ToolCall: &types.CompletionToolCall{ID: "call_1", Function: types.CompletionFunctionCall{Name: "ls", Arguments: "not json"}}},
+				{ToolCall: &types.CompletionToolCall{ID: "call_2", Function: types.CompletionFunctionCall{Name: "ls", Arguments: `{"dir":"/"}`}}},
+			}},
+			{Role: types.CompletionMessageRoleTypeTool, Content: types.Text("a.txt"), ToolCall: &types.CompletionToolCall{ID: "call_1"}},
+			{Role: types.CompletionMessageRoleTypeTool, Content: types.Text("etc"), ToolCall: &types.CompletionToolCall{ID: "call_2"}},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "You are helpful.", request.System)
+	assert.Equal(t, defaultMaxTokens, request.MaxTokens)
+	require.Len(t, request.Tools, 1)
+	assert.Equal(t, map[string]any{"type": "object", "properties": map[string]any{}}, request.Tools[0].InputSchema)
+
+	require.Len(t, request.Messages, 3)
+	assert.Equal(t, "user", request.Messages[0].Role)
+	assert.Equal(t, "assistant", request.Messages[1].Role)
+	assert.JSONEq(t, "{}", string(request.Messages[1].Content[0].Input))
+	assert.JSONEq(t, `{"dir":"/"}`, string(request.Messages[1].Content[1].Input))
+
+	// Both tool results are sent in one user message
+	assert.Equal(t, "user", request.Messages[2].Role)
+	assert.Equal(t, []contentBlock{
+		{Type: "tool_result", ToolUseID: "call_1", Content: "a.txt"},
+		{Type: "tool_result", ToolUseID: "call_2", Content: "etc"},
+	}, request.Messages[2].Content)
+}
+
+func TestToRequestOnlySystem(t *testing.T) {
+	request, err := toRequest(types.CompletionRequest{
+		InternalSystemPrompt: new(bool),
+		Messages: []types.CompletionMessage{
+			{Role: types.CompletionMessageRoleTypeSystem, Content: types.Text("Say hi")},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Empty(t, request.System)
+	assert.Equal(t, []message{{Role: "user", Content: []contentBlock{{Type: "text", Text: "Say hi"}}}}, request.Messages)
+}
+
+func TestCall(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"usage":{"input_tokens":10,"output_tokens":1}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Let me "}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"look."}}`,
+		`{"type":"content_block_stop","index":0}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"ls","input":{}}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"dir\":"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"\"/\"}"}}`,
+		`{"type":"content_block_stop","index":1}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":20}}`,
+		`{"type":"message_stop"}`,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/messages", r.URL.Path)
+		assert.Equal(t, "key", r.Header.Get("x-api-key"))
+		assert.Equal(t, apiVersion, r.Header.Get("anthropic-version"))
+
+		var request messagesRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		assert.True(t, request.Stream)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			_, _ = fmt.Fprintf(w, "event: x\ndata: %s\n\n", event)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(Options{BaseURL: server.URL, APIKey: "key"})
+
+	ok, err := client.Supports(context.Background(), "claude-3-5-sonnet-latest")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = client.Supports(context.Background(), "claude-3-5-sonnet-latest from github.com/example/provider")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	status := make(chan types.CompletionStatus, 100)
+	resp, err := client.Call(context.Background(), types.CompletionRequest{
+		Model:    "claude-3-5-sonnet-latest",
+		Messages: []types.CompletionMessage{{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("ls /")}},
+	}, status)
+	require.NoError(t, err)
+	close(status)
+
+	require.Len(t, resp.Content, 2)
+	assert.Equal(t, "Let me look.", resp.Content[0].Text)
+	assert.Equal(t, "toolu_1", resp.Content[1].ToolCall.ID)
+	assert.Equal(t, "ls", resp.Content[1].ToolCall.Function.Name)
+	assert.Equal(t, `{"dir":"/"}`, resp.Content[1].ToolCall.Function.Arguments)
+	assert.Equal(t, 1, *resp.Content[1].ToolCall.Index)
+	assert.Equal(t, types.Usage{PromptTokens: 10, CompletionTokens: 20, TotalTokens: 30}, resp.Usage)
+
+	var last types.CompletionStatus
+	for s := range status {
+		last = s
+	}
+	assert.Equal(t, resp.Usage, last.Usage)
+}
+
+func TestCallError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(Options{BaseURL: server.URL, APIKey: "key"})
+	_, err := client.Call(context.Background(), types.CompletionRequest{
+		Model:    "claude-3-5-sonnet-latest",
+		Messages: []types.CompletionMessage{{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("hi")}},
+	}, make(chan types.CompletionStatus, 100))
+	assert.ErrorContains(t, err, "authentication_error: invalid x-api-key")
+}
@@ -0,0 +1,274 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/system"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+type messagesRequest struct {
+	Model       string    `json:"model"`
+	System      string    `json:"system,omitempty"`
+	Messages    []message `json:"messages"`
+	Tools       []tool    `json:"tools,omitempty"`
+	MaxTokens   int       `json:"max_tokens"`
+	Temperature *float32  `json:"temperature,omitempty"`
+	Stream      bool      `json:"stream"`
+}
+
+type message struct {
+	Role    string         `json:"role"`
+	Content []contentBlock `json:"content"`
+}
+
+type contentBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"`
+}
+
+type tool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	InputSchema any    `json:"input_schema"`
+}
+
+type apiError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+func (a *apiError) Error() string {
+	return a.Type + ": " + a.Message
+}
+
+// toRequest translates a completion request to the Messages API. System messages become the separate system prompt,
+// tool results are sent as tool_result blocks of user messages, and consecutive messages of the same role are merged,
+// as the API requires user and assistant messages to alternate.
+func toRequest(request types.CompletionRequest) (messagesRequest, error) {
+	result := messagesRequest{
+		Model:       request.Model,
+		MaxTokens:   request.MaxTokens,
+		Temperature: request.Temperature,
+		Stream:      true,
+	}
+	if result.MaxTokens == 0 {
+		result.MaxTokens = defaultMaxTokens
+	}
+	if result.Temperature == nil {
+		result.Temperature = new(float32)
+	}
+
+	var systemPrompts []string
+	if request.InternalSystemPrompt == nil || *request.InternalSystemPrompt {
+		systemPrompts = append(systemPrompts, system.InternalSystemPrompt)
+	}
+
+	for _, msg := range request.Messages {
+		if msg.Role == types.CompletionMessageRoleTypeSystem {
+			systemPrompts = append(systemPrompts, msg.ChatText())
+			continue
+		}
+
+		role, blocks := toContentBlocks(msg)
+		if len(blocks) == 0 {
+			continue
+		}
+		if last := len(result.Messages) - 1; last >= 0 && result.Messages[last].Role == role {
+			result.Messages[last].Content = append(result.Messages[last].Content, blocks...)
+		} else {
+			result.Messages = append(result.Messages, message{
+				Role:    role,
+				Content: blocks,
+			})
+		}
+	}
+
+	if request.OutputSchema != nil {
+		systemPrompts = append(systemPrompts, system.JSONSchemaPrompt(request.OutputSchema))
+	} else if request.JSONResponse {
+		systemPrompts = append(systemPrompts, "Respond only with a valid JSON object.")
+	}
+	result.System = strings.Join(systemPrompts, "\n")
+
+	if len(result.Messages) == 0 {
+		if len(request.Messages) == 0 {
+			return messagesRequest{}, errors.New("invalid request, no messages to send to LLM")
+		}
+		// A conversation has to start with a user message, so a tool with only instructions sends them as one
+		result.Messages = []message{{
+			Role:    "user",
+			Content: []contentBlock{{Type: "text", Text: result.System}},
+		}}
+		result.System = ""
+	}
+
+	for _, t := range request.Tools {
+		var schema any = t.Function.Parameters
+		if t.Function.Parameters == nil || len(t.Function.Parameters.Properties) == 0 {
+			schema = map[string]any{
+				"type":       "object",
+				"properties": map[string]any{},
+			}
+		}
+		result.Tools = append(result.Tools, tool{
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+			InputSchema: schema,
+		})
+	}
+
+	return result, nil
+}
+
+func toContentBlocks(msg types.CompletionMessage) (string, []contentBlock) {
+	if msg.Role == types.CompletionMessageRoleTypeTool && msg.ToolCall != nil {
+		return "user", []contentBlock{{
+			Type:      "tool_result",
+			ToolUseID: msg.ToolCall.ID,
+			Content:   msg.ChatText(),
+		}}
+	}
+
+	role := "user"
+	if msg.Role == types.CompletionMessageRoleTypeAssistant {
+		role = "assistant"
+	}
+
+	var blocks []contentBlock
+	for _, content := range msg.Content {
+		if text := content.Text; text != "" {
+			if prompt, ok := system.IsDefaultPrompt(text); ok {
+				text = prompt
+			}
+			blocks = append(blocks, contentBlock{
+				Type: "text",
+				Text: text,
+			})
+		}
+		if content.ToolCall != nil {
+			blocks = append(blocks, contentBlock{
+				Type:  "tool_use",
+				ID:    content.ToolCall.ID,
+				Name:  content.ToolCall.Function.Name,
+				Input: toolInput(content.ToolCall.Function.Arguments),
+			})
+		}
+	}
+	return role, blocks
+}
+
+// toolInput returns the arguments of a tool call as the JSON object the API expects, which is empty if the model
+// passed none or invalid ones.
+func toolInput(arguments string) json.RawMessage {
+	var args map[string]any
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil || args == nil {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(arguments)
+}
+
+type streamEvent struct {
+	Type    string `json:"type"`
+	Index   int    `json:"index"`
+	Message *struct {
+		Usage usage `json:"usage"`
+	} `json:"message"`
+	ContentBlock *contentBlock `json:"content_block"`
+	Delta        *struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+	} `json:"delta"`
+	Usage *usage    `json:"usage"`
+	Error *apiError `json:"error"`
+}
+
+type usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// appendEvent adds a server sent event of a streamed response to msg. blocks maps the index of each content block of
+// the response to its index in the content of msg.
+func appendEvent(msg types.CompletionMessage, blocks map[int]int, event streamEvent) (types.CompletionMessage, error) {
+	switch event.Type {
+	case "message_start":
+		if event.Message != nil {
+			msg.Usage.PromptTokens = event.Message.Usage.InputTokens
+			msg.Usage.CompletionTokens = event.Message.Usage.OutputTokens
+		}
+	case "content_block_start":
+		if event.ContentBlock == nil {
+			break
+		}
+		blocks[event.Index] = len(msg.Content)
+		part := types.ContentPart{
+			Text: event.ContentBlock.Text,
+		}
+		if event.ContentBlock.Type == "tool_use" {
+			part = types.ContentPart{
+				ToolCall: &types.CompletionToolCall{
+					Index: ptr(len(msg.Content)),
+					ID:    event.ContentBlock.ID,
+					Function: types.CompletionFunctionCall{
+						Name: event.ContentBlock.Name,
+					},
+				},
+			}
+		}
+		msg.Content = append(msg.Content, part)
+	case "content_block_delta":
+		i, ok := blocks[event.Index]
+		if !ok || event.Delta == nil {
+			break
+		}
+		if msg.Content[i].ToolCall != nil {
+			msg.Content[i].ToolCall.Function.Arguments += event.Delta.PartialJSON
+		} else {
+			msg.Content[i].Text += event.Delta.Text
+		}
+	case "message_delta":
+		if event.Usage != nil {
+			msg.Usage.CompletionTokens = event.Usage.OutputTokens
+		}
+	case "error":
+		if event.Error != nil {
+			return msg, fmt.Errorf("anthropic stream failed: %w", event.Error)
+		}
+		return msg, errors.New("anthropic stream failed")
+	}
+
+	msg.Usage.TotalTokens = msg.Usage.PromptTokens + msg.Usage.CompletionTokens
+	return msg, nil
+}
+
+// finish cleans up a streamed response: text blocks that stayed empty are dropped, and tool calls without arguments
+// get an empty object.
+func finish(msg types.CompletionMessage) types.CompletionMessage {
+	msg.Content = slices.DeleteFunc(msg.Content, func(part types.ContentPart) bool {
+		return part.ToolCall == nil && part.Text == ""
+	})
+	for i, part := range msg.Content {
+		if part.ToolCall != nil {
+			part.ToolCall.Index = ptr(i)
+			if part.ToolCall.Function.Arguments == "" {
+				part.ToolCall.Function.Arguments = "{}"
+			}
+		}
+	}
+	return msg
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
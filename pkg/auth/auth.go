@@ -12,6 +12,12 @@ import (
 	"github.com/gptscript-ai/gptscript/pkg/runner"
 )
 
+const (
+	allow       = "Allow"
+	alwaysAllow = "Always allow this tool"
+	deny        = "Deny"
+)
+
 func Authorize(ctx engine.Context, input string) (runner.AuthorizerResponse, error) {
 	defer context.GetPauseFuncFromCtx(ctx.Ctx)()()
 
@@ -21,10 +27,11 @@ func Authorize(ctx engine.Context, input string) (runner.AuthorizerResponse, err
 		}, nil
 	}
 
-	var result bool
-	err := survey.AskOne(&survey.Confirm{
+	var result string
+	err := survey.AskOne(&survey.Select{
 		Help:    fmt.Sprintf("The full source of the tools is as follows:\n\n%s", ctx.Tool.String()),
-		Default: true,
+		Options: []string{allow, alwaysAllow, deny},
+		Default: allow,
 		Message: ConfirmMessage(ctx, input),
 	}, &result)
 	if err != nil {
@@ -32,7 +39,8 @@ func Authorize(ctx engine.Context, input string) (runner.AuthorizerResponse, err
 	}
 
 	return runner.AuthorizerResponse{
-		Accept:  result,
+		Accept:  result != deny,
+		Always:  result == alwaysAllow,
 		Message: "Request denied, blocking execution.",
 	}, nil
 }
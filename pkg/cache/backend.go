@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Backend stores the encoded entries of the cache by key. Keys are hex encoded hashes, so they are safe to use as
+// file names.
+type Backend interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte) error
+	Delete(ctx context.Context, key string) error
+}
+
+// fileBackend keeps each entry in a file of the directory, named by its key.
+type fileBackend string
+
+func (f fileBackend) Get(_ context.Context, key string) ([]byte, bool, error) {
+	data, err := os.ReadFile(filepath.Join(string(f), key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+func (f fileBackend) Set(_ context.Context, key string, value []byte) error {
+	return os.WriteFile(filepath.Join(string(f), key), value, 0644)
+}
+
+func (f fileBackend) Delete(_ context.Context, key string) error {
+	err := os.Remove(filepath.Join(string(f), key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
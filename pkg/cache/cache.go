@@ -1,15 +1,16 @@
 package cache
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/gob"
 	"encoding/hex"
 	"encoding/json"
-	"errors"
-	"io/fs"
+	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/adrg/xdg"
 	"github.com/getkin/kin-openapi/openapi3"
@@ -19,13 +20,19 @@ import (
 )
 
 type Client struct {
-	dir  string
-	noop bool
+	dir       string
+	noop      bool
+	responses bool
+	ttl       time.Duration
+	backend   Backend
 }
 
 type Options struct {
-	DisableCache bool   `usage:"Disable caching of LLM API responses"`
-	CacheDir     string `usage:"Directory to store cache (default: $XDG_CACHE_HOME/gptscript)"`
+	DisableCache   bool    `usage:"Disable caching"`
+	CacheDir       string  `usage:"Directory to store cache (default: $XDG_CACHE_HOME/gptscript)"`
+	CacheResponses bool    `usage:"Cache LLM responses, and return the cached response for an identical request"`
+	CacheTTL       string  `usage:"How long cached entries are used, such as 24h (default: no limit)"`
+	Backend        Backend `usage:"-" json:"-"`
 }
 
 func init() {
@@ -37,6 +44,9 @@ func Complete(opts ...Options) (result Options) {
 	for _, opt := range opts {
 		result.CacheDir = types.FirstSet(opt.CacheDir, result.CacheDir)
 		result.DisableCache = types.FirstSet(opt.DisableCache, result.DisableCache)
+		result.CacheResponses = types.FirstSet(opt.CacheResponses, result.CacheResponses)
+		result.CacheTTL = types.FirstSet(opt.CacheTTL, result.CacheTTL)
+		result.Backend = types.FirstSet(opt.Backend, result.Backend)
 	}
 	if result.CacheDir == "" {
 		result.CacheDir = filepath.Join(xdg.CacheHome, version.ProgramName)
@@ -60,9 +70,27 @@ func New(opts ...Options) (*Client, error) {
 	if err := os.MkdirAll(opt.CacheDir, 0755); err != nil {
 		return nil, err
 	}
+
+	var ttl time.Duration
+	if opt.CacheTTL != "" {
+		var err error
+		ttl, err = time.ParseDuration(opt.CacheTTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cache TTL %q: %w", opt.CacheTTL, err)
+		}
+	}
+
+	backend := opt.Backend
+	if backend == nil {
+		backend = fileBackend(opt.CacheDir)
+	}
+
 	return &Client{
-		dir:  opt.CacheDir,
-		noop: opt.DisableCache,
+		dir:       opt.CacheDir,
+		noop:      opt.DisableCache,
+		responses: opt.CacheResponses,
+		ttl:       ttl,
+		backend:   backend,
 	}, nil
 }
 
@@ -70,6 +98,15 @@ func (c *Client) CacheDir() string {
 	return c.dir
 }
 
+// Responses returns the client to cache LLM responses with. It is nil, which caches nothing, unless caching responses
+// was turned on: replaying a response makes a run deterministic, which is surprising if it wasn't asked for.
+func (c *Client) Responses() *Client {
+	if c == nil || !c.responses {
+		return nil
+	}
+	return c
+}
+
 func (c *Client) cacheKey(key any) (string, error) {
 	hash := sha256.New()
 	if err := json.NewEncoder(hash).Encode(key); err != nil {
@@ -79,6 +116,12 @@ func (c *Client) cacheKey(key any) (string, error) {
 	return hex.EncodeToString(digest), nil
 }
 
+// entry is how values are encoded for the backend, with the time they were stored to expire them.
+type entry struct {
+	Created time.Time
+	Value   []byte
+}
+
 func (c *Client) Store(ctx context.Context, key, value any) error {
 	if c == nil {
 		return nil
@@ -87,10 +130,7 @@ func (c *Client) Store(ctx context.Context, key, value any) error {
 	if c.noop || IsNoCache(ctx) {
 		keyValue, err := c.cacheKey(key)
 		if err == nil {
-			p := filepath.Join(c.dir, keyValue)
-			if _, err := os.Stat(p); err == nil {
-				_ = os.Remove(p)
-			}
+			_ = c.backend.Delete(ctx, keyValue)
 		}
 		return nil
 	}
@@ -100,13 +140,18 @@ func (c *Client) Store(ctx context.Context, key, value any) error {
 		return err
 	}
 
-	f, err := os.Create(filepath.Join(c.dir, keyValue))
-	if err != nil {
+	var valueData, entryData bytes.Buffer
+	if err := gob.NewEncoder(&valueData).Encode(value); err != nil {
+		return err
+	}
+	if err := gob.NewEncoder(&entryData).Encode(entry{
+		Created: time.Now(),
+		Value:   valueData.Bytes(),
+	}); err != nil {
 		return err
 	}
-	defer f.Close()
 
-	return gob.NewEncoder(f).Encode(value)
+	return c.backend.Set(ctx, keyValue, entryData.Bytes())
 }
 
 func (c *Client) Get(ctx context.Context, key, out any) (bool, error) {
@@ -119,13 +164,19 @@ func (c *Client) Get(ctx context.Context, key, out any) (bool, error) {
 		return false, err
 	}
 
-	f, err := os.Open(filepath.Join(c.dir, keyValue))
-	if errors.Is(err, fs.ErrNotExist) {
-		return false, nil
-	} else if err != nil {
+	data, ok, err := c.backend.Get(ctx, keyValue)
+	if err != nil || !ok {
 		return false, err
 	}
-	defer f.Close()
 
-	return gob.NewDecoder(f).Decode(out) == nil, nil
+	// Entries that can't be decoded, such as ones written by older versions, are misses
+	var e entry
+	if gob.NewDecoder(bytes.NewReader(data)).Decode(&e) != nil {
+		return false, nil
+	}
+	if c.ttl > 0 && time.Since(e.Created) > c.ttl {
+		return false, nil
+	}
+
+	return gob.NewDecoder(bytes.NewReader(e.Value)).Decode(out) == nil, nil
 }
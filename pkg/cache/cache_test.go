@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryBackend map[string][]byte
+
+func (m memoryBackend) Get(_ context.Context, key string) ([]byte, bool, error) {
+	data, ok := m[key]
+	return data, ok, nil
+}
+
+func (m memoryBackend) Set(_ context.Context, key string, value []byte) error {
+	m[key] = value
+	return nil
+}
+
+func (m memoryBackend) Delete(_ context.Context, key string) error {
+	delete(m, key)
+	return nil
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	c, err := New(Options{CacheDir: t.TempDir()})
+	require.NoError(t, err)
+
+	var out string
+	ok, err := c.Get(ctx, "key", &out)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, c.Store(ctx, "key", "value"))
+	ok, err = c.Get(ctx, "key", &out)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "value", out)
+
+	// Bypassing the cache removes the entry
+	require.NoError(t, c.Store(WithNoCache(ctx), "key", "other"))
+	ok, err = c.Get(ctx, "key", &out)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestClientTTL(t *testing.T) {
+	ctx := context.Background()
+	backend := memoryBackend{}
+	c, err := New(Options{CacheDir: t.TempDir(), CacheTTL: "50ms", Backend: backend})
+	require.NoError(t, err)
+
+	require.NoError(t, c.Store(ctx, "key", "value"))
+	assert.Len(t, backend, 1)
+
+	var out string
+	ok, err := c.Get(ctx, "key", &out)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	time.Sleep(100 * time.Millisecond)
+	ok, err = c.Get(ctx, "key", &out)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = New(Options{CacheDir: t.TempDir(), CacheTTL: "a while"})
+	assert.Error(t, err)
+}
+
+func TestClientResponses(t *testing.T) {
+	c, err := New(Options{CacheDir: t.TempDir()})
+	require.NoError(t, err)
+	assert.Nil(t, c.Responses())
+
+	c, err = New(Options{CacheDir: t.TempDir(), CacheResponses: true})
+	require.NoError(t, err)
+	assert.Same(t, c, c.Responses())
+}
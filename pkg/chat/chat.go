@@ -21,6 +21,13 @@ type Chatter interface {
 
 type GetProgram func() (types.Program, error)
 
+type Options struct {
+	// Sessions, if set, saves the chat as Session after every turn. Session is started with a new ID if it is nil,
+	// and is otherwise resumed from its state.
+	Sessions *Sessions
+	Session  *Session
+}
+
 func getPrompt(prg types.Program, resp runner.ChatResponse) string {
 	name := prg.ChatName()
 	if newName := prg.ToolSet[resp.ToolID].Name; newName != "" {
@@ -30,11 +37,23 @@ func getPrompt(prg types.Program, resp runner.ChatResponse) string {
 	return color.GreenString("%s> ", name)
 }
 
-func Start(ctx context.Context, prevState runner.ChatState, chatter Chatter, prg GetProgram, env []string, startInput string) error {
+func Start(ctx context.Context, prevState runner.ChatState, chatter Chatter, prg GetProgram, env []string, startInput string, opts ...Options) error {
 	var (
 		prompter Prompter
+		sessions *Sessions
+		session  *Session
 	)
 
+	for _, opt := range opts {
+		sessions = types.FirstSet(opt.Sessions, sessions)
+		session = types.FirstSet(opt.Session, session)
+	}
+	if sessions != nil && session == nil {
+		session = &Session{
+			ID: NewSessionID(),
+		}
+	}
+
 	prompter, err := newReadlinePrompter(prg)
 	if err != nil {
 		return err
@@ -43,6 +62,16 @@ func Start(ctx context.Context, prevState runner.ChatState, chatter Chatter, prg
 
 	// We will want the tool name to be displayed in the prompt
 	var prevResp runner.ChatResponse
+	if session != nil && session.ChatState() != nil {
+		prevState = session.ChatState()
+		prevResp.ToolID = session.ToolID
+		if len(session.Turns) > 0 {
+			if _, err := prompter.Printf("%s", color.RedString("< %s\n", session.Turns[len(session.Turns)-1].Output)); err != nil {
+				return err
+			}
+		}
+	}
+
 	for {
 		var (
 			input string
@@ -69,6 +98,9 @@ func Start(ctx context.Context, prevState runner.ChatState, chatter Chatter, prg
 		}
 
 		resp, err = chatter.Chat(ctx, prevState, prg, env, input)
+		if err == nil && sessions != nil {
+			saveSession(sessions, session, input, resp)
+		}
 		if err != nil || resp.Done {
 			return err
 		}
@@ -84,3 +116,15 @@ func Start(ctx context.Context, prevState runner.ChatState, chatter Chatter, prg
 		prevResp = resp
 	}
 }
+
+// saveSession records the turn in the session and saves it. A chat continues if it can't be saved, as it only can't be
+// resumed later.
+func saveSession(sessions *Sessions, session *Session, input string, resp runner.ChatResponse) {
+	if err := session.update(input, resp); err != nil {
+		log.Warnf("Failed to save chat session %s: %v", session.ID, err)
+		return
+	}
+	if err := sessions.Save(session); err != nil {
+		log.Warnf("Failed to save chat session %s: %v", session.ID, err)
+	}
+}
@@ -0,0 +1,143 @@
+package chat
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/gptscript-ai/gptscript/pkg/runner"
+)
+
+// Session is a chat that is saved after every turn, so that it can be resumed after the process exits. State is the
+// runner state of the chat, which has the messages and tool calls of the conversation so far.
+type Session struct {
+	ID      string          `json:"id"`
+	Program string          `json:"program,omitempty"`
+	ToolID  string          `json:"toolID,omitempty"`
+	State   json.RawMessage `json:"state,omitempty"`
+	Turns   []Turn          `json:"turns,omitempty"`
+	Done    bool            `json:"done,omitempty"`
+	Updated time.Time       `json:"updated"`
+}
+
+// Turn is an input of the user and the response to it.
+type Turn struct {
+	Input  string    `json:"input,omitempty"`
+	Output string    `json:"output,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// ChatState returns the state to continue the chat of the session with, or nil if it has not started.
+func (s *Session) ChatState() runner.ChatState {
+	if len(s.State) == 0 {
+		return nil
+	}
+	// The runner parses states given as a string, like the --chat-state flag
+	return string(s.State)
+}
+
+func (s *Session) update(input string, resp runner.ChatResponse) error {
+	state, err := json.Marshal(resp.State)
+	if err != nil {
+		return err
+	}
+	s.State = state
+	s.ToolID = resp.ToolID
+	s.Done = resp.Done
+	s.Turns = append(s.Turns, Turn{
+		Input:  input,
+		Output: resp.Content,
+		Time:   time.Now(),
+	})
+	return nil
+}
+
+var validSessionID = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// NewSessionID returns a random ID for a new session.
+func NewSessionID() string {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Sessions stores sessions as JSON files in a directory.
+type Sessions struct {
+	dir string
+}
+
+// NewSessions returns a store of sessions in dir, or in the gptscript/sessions directory of the user's data directory
+// if dir is empty.
+func NewSessions(dir string) *Sessions {
+	if dir == "" {
+		dir = filepath.Join(xdg.DataHome, "gptscript", "sessions")
+	}
+	return &Sessions{
+		dir: dir,
+	}
+}
+
+// Load returns the session with the id, or nil if there is none.
+func (s *Sessions) Load(id string) (*Session, error) {
+	if !validSessionID.MatchString(id) {
+		return nil, fmt.Errorf("invalid chat session ID %q, it can only contain letters, digits, - and _", id)
+	}
+
+	data, err := os.ReadFile(s.path(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	session := &Session{}
+	if err := json.Unmarshal(data, session); err != nil {
+		return nil, fmt.Errorf("failed to read chat session %s: %w", id, err)
+	}
+	return session, nil
+}
+
+// Save writes the session. It replaces the saved session at once, so a crash while saving leaves the previous one.
+// Sessions can contain credentials that tools returned, so only the user can read them.
+func (s *Sessions) Save(session *Session) error {
+	if !validSessionID.MatchString(session.ID) {
+		return fmt.Errorf("invalid chat session ID %q, it can only contain letters, digits, - and _", session.ID)
+	}
+
+	session.Updated = time.Now()
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, session.ID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(session.ID))
+}
+
+func (s *Sessions) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
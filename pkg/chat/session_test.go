@@ -0,0 +1,53 @@
+package chat
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/runner"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessions(t *testing.T) {
+	sessions := NewSessions(t.TempDir())
+
+	session, err := sessions.Load("missing")
+	require.NoError(t, err)
+	assert.Nil(t, session)
+
+	_, err = sessions.Load("../escape")
+	assert.ErrorContains(t, err, "invalid chat session ID")
+
+	result := "Hello, Bob"
+	session = &Session{
+		ID:      NewSessionID(),
+		Program: "chat.gpt",
+	}
+	assert.Nil(t, session.ChatState())
+	require.NoError(t, session.update("I am Bob", runner.ChatResponse{
+		Content: result,
+		ToolID:  "chat.gpt:",
+		State: &runner.State{
+			Result: &result,
+		},
+	}))
+	require.NoError(t, sessions.Save(session))
+
+	stat, err := os.Stat(filepath.Join(sessions.dir, session.ID+".json"))
+	require.NoError(t, err)
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, os.FileMode(0600), stat.Mode().Perm())
+	}
+
+	loaded, err := sessions.Load(session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "chat.gpt", loaded.Program)
+	assert.Equal(t, "chat.gpt:", loaded.ToolID)
+	assert.Equal(t, `{"result":"Hello, Bob"}`, loaded.ChatState())
+	require.Len(t, loaded.Turns, 1)
+	assert.Equal(t, "I am Bob", loaded.Turns[0].Input)
+	assert.Equal(t, result, loaded.Turns[0].Output)
+}
@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/gptscript-ai/gptscript/pkg/gptscript"
+	"github.com/spf13/cobra"
+)
+
+type CleanCache struct {
+	All bool `usage:"Remove all cached tools and runtimes, not only unused runtimes"`
+
+	gptscript *GPTScript
+}
+
+func (c *CleanCache) Customize(cmd *cobra.Command) {
+	cmd.Use = "clean-cache"
+	cmd.Short = "Remove downloaded runtimes that no tool uses"
+	cmd.Args = cobra.NoArgs
+}
+
+func (c *CleanCache) Run(cmd *cobra.Command, _ []string) error {
+	opts, err := c.gptscript.NewGPTScriptOpts()
+	if err != nil {
+		return err
+	}
+
+	runner, err := gptscript.New(&opts)
+	if err != nil {
+		return err
+	}
+	defer runner.Close(false)
+
+	removed, err := runner.EvictRuntimes(cmd.Context(), c.All)
+	for _, path := range removed {
+		fmt.Printf("Removed %s\n", path)
+	}
+	return err
+}
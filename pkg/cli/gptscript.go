@@ -10,14 +10,18 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/acorn-io/cmd"
 	"github.com/fatih/color"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gptscript-ai/gptscript/pkg/anthropic"
 	"github.com/gptscript-ai/gptscript/pkg/assemble"
 	"github.com/gptscript-ai/gptscript/pkg/auth"
 	"github.com/gptscript-ai/gptscript/pkg/builtin"
 	"github.com/gptscript-ai/gptscript/pkg/cache"
 	"github.com/gptscript-ai/gptscript/pkg/chat"
+	"github.com/gptscript-ai/gptscript/pkg/engine"
 	"github.com/gptscript-ai/gptscript/pkg/env"
 	"github.com/gptscript-ai/gptscript/pkg/gptscript"
 	"github.com/gptscript-ai/gptscript/pkg/input"
@@ -25,9 +29,11 @@ import (
 	"github.com/gptscript-ai/gptscript/pkg/monitor"
 	"github.com/gptscript-ai/gptscript/pkg/mvl"
 	"github.com/gptscript-ai/gptscript/pkg/openai"
+	"github.com/gptscript-ai/gptscript/pkg/rlimit"
 	"github.com/gptscript-ai/gptscript/pkg/runner"
 	"github.com/gptscript-ai/gptscript/pkg/server"
 	"github.com/gptscript-ai/gptscript/pkg/system"
+	"github.com/gptscript-ai/gptscript/pkg/trace"
 	"github.com/gptscript-ai/gptscript/pkg/types"
 	"github.com/gptscript-ai/gptscript/pkg/version"
 	"github.com/gptscript-ai/tui"
@@ -37,17 +43,20 @@ import (
 )
 
 type (
-	DisplayOptions monitor.Options
-	CacheOptions   cache.Options
-	OpenAIOptions  openai.Options
+	DisplayOptions   monitor.Options
+	CacheOptions     cache.Options
+	OpenAIOptions    openai.Options
+	AnthropicOptions anthropic.Options
 )
 
 type GPTScript struct {
 	CacheOptions
 	OpenAIOptions
+	AnthropicOptions
 	DisplayOptions
 	Color              *bool  `usage:"Use color in output (default true)" default:"true"`
 	Confirm            bool   `usage:"Prompt before running potentially dangerous commands"`
+	ConfirmTrusted     string `usage:"Comma separated tools that run without a prompt with --confirm, by ID or source, where a trailing ... matches a prefix (ex: github.com/gptscript-ai/...)"`
 	Debug              bool   `usage:"Enable debug logging"`
 	NoTrunc            bool   `usage:"Do not truncate long log messages"`
 	Quiet              *bool  `usage:"No output logging (set --quiet=false to force on even when there is no TTY)" short:"q"`
@@ -63,12 +72,37 @@ type GPTScript struct {
 	Chdir              string `usage:"Change current working directory" short:"C"`
 	Daemon             bool   `usage:"Run tool as a daemon" local:"true" hidden:"true"`
 	Ports              string `usage:"The port range to use for ephemeral daemon ports (ex: 11000-12000)" hidden:"true"`
+	DaemonGracePeriod  string `usage:"How long daemon tools have to exit when they are stopped, before they are killed (ex: 30s)"`
 	CredentialContext  string `usage:"Context name in which to store credentials" default:"default"`
 	CredentialOverride string `usage:"Credentials to override (ex: --credential-override github.com/example/cred-tool:API_TOKEN=1234)"`
 	ChatState          string `usage:"The chat state to continue, or null to start a new chat and return the state"`
 	ForceChat          bool   `usage:"Force an interactive chat session if even the top level tool is not a chat tool"`
+	ChatSession        string `usage:"ID of a saved interactive chat session to resume, or to save a new one as"`
+	SaveChat           bool   `usage:"Save interactive chat sessions after every turn, so that they can be resumed with --chat-session"`
 	ForceSequential    bool   `usage:"Force parallel calls to run sequentially"`
+	MaxConcurrency     int    `usage:"Maximum number of parallel calls of a turn to run at the same time, 0 for no limit"`
+	HistoryStrategy    string `usage:"Shorten long conversations before each LLM call: drop-oldest, keep-recent or summarize"`
+	HistoryMaxTokens   int    `usage:"Estimated number of tokens the messages of a conversation may have with --history-strategy"`
+	HistoryKeepRecent  int    `usage:"Number of messages to keep with --history-strategy=keep-recent"`
+	HistoryModel       string `usage:"Model to summarize conversations with for --history-strategy=summarize, the model of the tool by default"`
+	StreamToolOutput   bool   `usage:"Report the output of command tools line by line as it is written, instead of when they exit"`
+	Offline            bool   `usage:"Only use tools and runtimes that are already downloaded, fail instead of using the network to set them up"`
+	Sandbox            bool   `usage:"Run command tools in a container, with a read-only root filesystem and no network"`
+	SandboxImage       string `usage:"Image to run command tools in with --sandbox" default:"debian:stable-slim"`
+	SandboxRuntime     string `usage:"Container CLI to run command tools with --sandbox, docker or podman" default:"docker"`
+	SandboxNetwork     bool   `usage:"Allow command tools run with --sandbox to use the network"`
+	Landlock           bool   `usage:"Restrict command tools on Linux with landlock to their tool directory, the workspace and the paths they allow"`
+	ToolMaxMemory      string `usage:"Memory limit of command tools on Linux that don't set \"Max Memory\", 0 for none (default 4GB)"`
+	ToolMaxCPUTime     string `usage:"CPU time limit of command tools on Linux that don't set \"Max CPU Time\", 0 for none (default 30m)" name:"tool-max-cpu-time"`
+	Watch              bool   `usage:"Rebuild local tools when their files change and, unless in a chat, run the program again"`
 	Workspace          string `usage:"Directory to use for the workspace, if specified it will not be deleted on exit"`
+	Timeout            string `usage:"Stop the run if it takes longer than this duration (ex: 120s)"`
+	OutputSchema       string `usage:"JSON schema, or a file with one, that the output of the program must be valid against"`
+	ModelAliases       string `usage:"JSON object of model aliases and the models they stand for, or a file with one, for tools to refer to as @alias"`
+	Record             string `usage:"Record the responses of the LLM and the results of command tools to this file"`
+	Replay             string `usage:"Replay a run from a file written with --record, without calling the LLM or running tools"`
+	AuditLog           string `usage:"Append an entry for every command tool run and LLM call to this file, as JSON lines"`
+	OTLPEndpoint       string `usage:"Export traces of runs to this OpenTelemetry collector with OTLP over HTTP, in place of OTEL_EXPORTER_OTLP_ENDPOINT (ex: http://localhost:4318)" name:"otlp-endpoint"`
 	UI                 bool   `usage:"Launch the UI" local:"true" name:"ui"`
 	TUI                bool   `usage:"Launch the TUI" local:"true" name:"tui"`
 
@@ -83,6 +117,10 @@ func New() *cobra.Command {
 		&Credential{root: root},
 		&Parse{},
 		&Fmt{},
+		&Prefetch{gptscript: root},
+		&Plan{gptscript: root},
+		&CleanCache{gptscript: root},
+		&MCPServer{gptscript: root},
 		&SDKServer{
 			GPTScript: root,
 		},
@@ -126,12 +164,16 @@ func New() *cobra.Command {
 
 func (r *GPTScript) NewGPTScriptOpts() (gptscript.Options, error) {
 	opts := gptscript.Options{
-		Cache:   cache.Options(r.CacheOptions),
-		OpenAI:  openai.Options(r.OpenAIOptions),
-		Monitor: monitor.Options(r.DisplayOptions),
+		Cache:     cache.Options(r.CacheOptions),
+		OpenAI:    openai.Options(r.OpenAIOptions),
+		Anthropic: anthropic.Options(r.AnthropicOptions),
+		Monitor:   monitor.Options(r.DisplayOptions),
 		Runner: runner.Options{
 			CredentialOverride: r.CredentialOverride,
 			Sequential:         r.ForceSequential,
+			MaxConcurrency:     r.MaxConcurrency,
+			StreamToolOutput:   r.StreamToolOutput,
+			Landlock:           r.Landlock,
 		},
 		Quiet:             r.Quiet,
 		Env:               os.Environ(),
@@ -141,8 +183,87 @@ func (r *GPTScript) NewGPTScriptOpts() (gptscript.Options, error) {
 
 	if r.Confirm {
 		opts.Runner.Authorizer = auth.Authorize
+		for _, tool := range strings.Split(r.ConfirmTrusted, ",") {
+			if tool = strings.TrimSpace(tool); tool != "" {
+				opts.Runner.TrustedTools = append(opts.Runner.TrustedTools, tool)
+			}
+		}
+	}
+
+	if r.offline() {
+		opts.Env = append(opts.Env, "GPTSCRIPT_OFFLINE=true")
+	}
+
+	if r.Watch {
+		opts.Env = append(opts.Env, "GPTSCRIPT_BUILD_LOCAL_TOOLS=true")
+	}
+
+	if r.HistoryStrategy != "" {
+		opts.Runner.History = &engine.HistoryOptions{
+			Strategy:     r.HistoryStrategy,
+			MaxTokens:    r.HistoryMaxTokens,
+			KeepRecent:   r.HistoryKeepRecent,
+			SummaryModel: r.HistoryModel,
+		}
+	}
+
+	if r.Sandbox {
+		opts.Runner.Sandbox = &engine.SandboxOptions{
+			Runtime: r.SandboxRuntime,
+			Image:   r.SandboxImage,
+			Network: r.SandboxNetwork,
+		}
+	}
+
+	if r.Timeout != "" {
+		timeout, err := time.ParseDuration(r.Timeout)
+		if err != nil {
+			return gptscript.Options{}, fmt.Errorf("invalid timeout: %s", r.Timeout)
+		}
+		opts.Timeout = timeout
+	}
+
+	if r.OutputSchema != "" {
+		schema, err := readOutputSchema(r.OutputSchema)
+		if err != nil {
+			return gptscript.Options{}, err
+		}
+		opts.OutputSchema = schema
+	}
+
+	if r.ModelAliases != "" {
+		aliases, err := readModelAliases(r.ModelAliases)
+		if err != nil {
+			return gptscript.Options{}, err
+		}
+		opts.ModelAliases = aliases
+	}
+
+	if r.Record != "" && r.Replay != "" {
+		return gptscript.Options{}, fmt.Errorf("--record and --replay can't be used together")
+	}
+	if r.Record != "" || r.Replay != "" {
+		recording, err := engine.NewRecording(types.FirstSet(r.Replay, r.Record), r.Replay != "")
+		if err != nil {
+			return gptscript.Options{}, err
+		}
+		opts.Runner.Recording = recording
+	}
+
+	if r.AuditLog != "" {
+		auditLog, err := engine.NewAuditLog(r.AuditLog)
+		if err != nil {
+			return gptscript.Options{}, err
+		}
+		opts.Runner.AuditLog = auditLog
 	}
 
+	tracer, err := trace.NewTracerFromEnv(r.OTLPEndpoint, opts.Env)
+	if err != nil {
+		return gptscript.Options{}, err
+	}
+	opts.Runner.Tracer = tracer
+
 	if r.Ports != "" {
 		start, end, _ := strings.Cut(r.Ports, "-")
 		startNum, err := strconv.ParseInt(strings.TrimSpace(start), 10, 64)
@@ -160,6 +281,31 @@ func (r *GPTScript) NewGPTScriptOpts() (gptscript.Options, error) {
 		opts.Runner.EndPort = endNum
 	}
 
+	if r.DaemonGracePeriod != "" {
+		gracePeriod, err := time.ParseDuration(r.DaemonGracePeriod)
+		if err != nil || gracePeriod <= 0 {
+			return gptscript.Options{}, fmt.Errorf("invalid daemon grace period: %s", r.DaemonGracePeriod)
+		}
+		opts.Runner.DaemonGracePeriod = gracePeriod
+	}
+
+	opts.Runner.ToolLimits = rlimit.DefaultLimits
+	if r.ToolMaxMemory != "" {
+		memory, err := rlimit.ParseMemory(r.ToolMaxMemory)
+		if err != nil {
+			return gptscript.Options{}, err
+		}
+		opts.Runner.ToolLimits.Memory = memory
+	}
+
+	if r.ToolMaxCPUTime != "" {
+		cpuTime, err := time.ParseDuration(r.ToolMaxCPUTime)
+		if err != nil || cpuTime < 0 {
+			return gptscript.Options{}, fmt.Errorf("invalid tool CPU time limit: %s", r.ToolMaxCPUTime)
+		}
+		opts.Runner.ToolLimits.CPUTime = cpuTime
+	}
+
 	if r.EventsStreamTo != "" {
 		mf, err := monitor.NewFileFactory(r.EventsStreamTo)
 		if err != nil {
@@ -172,6 +318,41 @@ func (r *GPTScript) NewGPTScriptOpts() (gptscript.Options, error) {
 	return opts, nil
 }
 
+// readOutputSchema parses value as a JSON schema, or reads the schema from the file value if it is not JSON.
+func readOutputSchema(value string) (*openapi3.Schema, error) {
+	data := []byte(value)
+	if !strings.HasPrefix(strings.TrimSpace(value), "{") {
+		var err error
+		if data, err = os.ReadFile(value); err != nil {
+			return nil, fmt.Errorf("failed to read output schema: %w", err)
+		}
+	}
+
+	schema := &openapi3.Schema{}
+	if err := json.Unmarshal(data, schema); err != nil {
+		return nil, fmt.Errorf("invalid output schema: %w", err)
+	}
+	return schema, nil
+}
+
+// readModelAliases reads the model aliases from value, a JSON object of the names of the aliases and their models, or
+// a file with one, one file for each environment to run the same tools with different models.
+func readModelAliases(value string) (map[string]string, error) {
+	data := []byte(value)
+	if !strings.HasPrefix(strings.TrimSpace(value), "{") {
+		var err error
+		if data, err = os.ReadFile(value); err != nil {
+			return nil, fmt.Errorf("failed to read model aliases: %w", err)
+		}
+	}
+
+	var aliases map[string]string
+	if err := json.Unmarshal(data, &aliases); err != nil {
+		return nil, fmt.Errorf("invalid model aliases: %w", err)
+	}
+	return aliases, nil
+}
+
 func (r *GPTScript) Customize(cmd *cobra.Command) {
 	cmd.Flags().SetInterspersed(false)
 	cmd.Use = version.ProgramName + " [flags] PROGRAM_FILE [INPUT...]"
@@ -289,15 +470,23 @@ func (r *GPTScript) readProgram(ctx context.Context, runner *gptscript.GPTScript
 			r.readData = data
 		}
 		return loader.ProgramFromSource(ctx, string(data), r.SubTool, loader.Options{
-			Cache: runner.Cache,
+			Cache:   runner.Cache,
+			Offline: r.offline(),
 		})
 	}
 
 	return loader.Program(ctx, args[0], r.SubTool, loader.Options{
-		Cache: runner.Cache,
+		Cache:   runner.Cache,
+		Offline: r.offline(),
 	})
 }
 
+// offline returns true if tools and runtimes are only used if they don't need the network, with --offline or
+// GPTSCRIPT_OFFLINE=true.
+func (r *GPTScript) offline() bool {
+	return r.Offline || os.Getenv("GPTSCRIPT_OFFLINE") == "true"
+}
+
 func (r *GPTScript) PrintOutput(toolInput, toolOutput string) (err error) {
 	if r.Output != "" && r.Output != "-" {
 		err = os.WriteFile(r.Output, []byte(toolOutput), 0644)
@@ -443,9 +632,24 @@ func (r *GPTScript) Run(cmd *cobra.Command, args []string) (retErr error) {
 				TrustedRepoPrefixes: []string{"github.com/gptscript-ai/context"},
 			})
 		}
+		if r.Watch {
+			go r.watchInChat(ctx, gptScript, prg, gptOpt.Env)
+		}
+		var chatOpts chat.Options
+		// Chats can have credentials that tools returned, so they are only saved if the user asks for it
+		if r.SaveChat || r.ChatSession != "" {
+			chatOpts.Sessions = chat.NewSessions("")
+			if chatOpts.Session, err = r.chatSession(chatOpts.Sessions, args[0]); err != nil {
+				return err
+			}
+		}
 		return chat.Start(cmd.Context(), nil, gptScript, func() (types.Program, error) {
 			return r.readProgram(ctx, gptScript, args)
-		}, gptOpt.Env, toolInput)
+		}, gptOpt.Env, toolInput, chatOpts)
+	}
+
+	if r.Watch {
+		return r.runAndWatch(ctx, gptScript, prg, args, gptOpt.Env, toolInput)
 	}
 
 	s, err := gptScript.Run(cmd.Context(), prg, gptOpt.Env, toolInput)
@@ -455,3 +659,96 @@ func (r *GPTScript) Run(cmd *cobra.Command, args []string) (retErr error) {
 
 	return r.PrintOutput(toolInput, s)
 }
+
+// chatSession returns the session of --chat-session to resume, or a new session to save the chat of the program as.
+func (r *GPTScript) chatSession(sessions *chat.Sessions, program string) (*chat.Session, error) {
+	id := r.ChatSession
+	if id == "" {
+		id = chat.NewSessionID()
+	}
+
+	session, err := sessions.Load(id)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case session == nil:
+		session = &chat.Session{
+			ID:      id,
+			Program: program,
+		}
+	case session.Done:
+		return nil, fmt.Errorf("chat session %s has ended and can't be resumed", id)
+	case session.Program != program:
+		log.Warnf("Chat session %s was started with %s, resuming it with %s", id, session.Program, program)
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "Saving chat session %s, resume it with --chat-session=%s\n", id, id)
+	return session, nil
+}
+
+// runAndWatch runs the program, and again each time the files of its local tools change, until ctx is done. Errors of
+// a run are printed instead of returned, so that they can be fixed while watching.
+func (r *GPTScript) runAndWatch(ctx context.Context, gptScript *gptscript.GPTScript, prg types.Program, args, env []string, toolInput string) error {
+	for {
+		s, err := gptScript.Run(ctx, prg, env, toolInput)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "\nERROR: %v\n", err)
+		} else if err := r.PrintOutput(toolInput, s); err != nil {
+			return err
+		}
+
+		_, _ = fmt.Fprintln(os.Stderr, "\nWatching for changes to local tools...")
+		if err := waitForChange(ctx, gptScript, prg, env); err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		newPrg, err := r.readProgram(ctx, gptScript, args)
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "\nERROR: %v\n", err)
+			continue
+		}
+		prg = newPrg
+	}
+}
+
+// waitForChange returns once the local tools of the program changed and were built without errors, or ctx is done.
+func waitForChange(ctx context.Context, gptScript *gptscript.GPTScript, prg types.Program, env []string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	return gptScript.Watch(ctx, prg, env, func(tools []types.Tool, err error) {
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "\nERROR: %v\n", err)
+			return
+		}
+		cancel()
+	})
+}
+
+// watchInChat builds the local tools of the program each time their files change and reports the result, while the
+// chat picks up the changes itself as it loads the program again every turn.
+func (r *GPTScript) watchInChat(ctx context.Context, gptScript *gptscript.GPTScript, prg types.Program, env []string) {
+	err := gptScript.Watch(ctx, prg, env, func(tools []types.Tool, err error) {
+		if err != nil {
+			_, _ = fmt.Fprintf(os.Stderr, "\nERROR: %v\n", err)
+			return
+		}
+		names := make([]string, 0, len(tools))
+		for _, tool := range tools {
+			if tool.Name == "" {
+				names = append(names, tool.ID)
+			} else {
+				names = append(names, tool.Name)
+			}
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "\nRebuilt %s\n", strings.Join(names, ", "))
+	})
+	if err != nil {
+		log.Debugf("not watching for changes: %v", err)
+	}
+}
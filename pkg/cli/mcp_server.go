@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/gptscript"
+	"github.com/gptscript-ai/gptscript/pkg/mcp"
+	"github.com/gptscript-ai/gptscript/pkg/system"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/gptscript-ai/gptscript/pkg/version"
+	"github.com/spf13/cobra"
+)
+
+type MCPServer struct {
+	gptscript *GPTScript
+}
+
+func (m *MCPServer) Customize(cmd *cobra.Command) {
+	cmd.Use = "mcp-server <file>"
+	cmd.Short = "Serve the top-level tools of a program as an MCP server over stdio"
+	cmd.Args = cobra.ExactArgs(1)
+}
+
+func (m *MCPServer) Run(cmd *cobra.Command, args []string) error {
+	if m.gptscript.Confirm {
+		return fmt.Errorf("--confirm can not be used with mcp-server, stdin is used for the MCP protocol")
+	}
+	if args[0] == "-" {
+		return fmt.Errorf("mcp-server only supports files, cannot read from stdin")
+	}
+
+	opts, err := m.gptscript.NewGPTScriptOpts()
+	if err != nil {
+		return err
+	}
+
+	runner, err := gptscript.New(&opts)
+	if err != nil {
+		return err
+	}
+	defer runner.Close(true)
+
+	prg, err := m.gptscript.readProgram(cmd.Context(), runner, args)
+	if err != nil {
+		return err
+	}
+
+	handler := newProgramHandler(runner, prg, opts.Env)
+	server := &mcp.Server{
+		Name:         strings.TrimSuffix(filepath.Base(args[0]), filepath.Ext(args[0])),
+		Version:      version.Get().String(),
+		Instructions: prg.ToolSet[prg.EntryToolID].Description,
+		Handler:      handler,
+	}
+	return server.Serve(cmd.Context(), os.Stdin, os.Stdout)
+}
+
+// programHandler runs the top-level tools of a program for the MCP server.
+type programHandler struct {
+	runner  *gptscript.GPTScript
+	prg     types.Program
+	env     []string
+	tools   []mcp.Tool
+	toolIDs map[string]string
+}
+
+func newProgramHandler(runner *gptscript.GPTScript, prg types.Program, env []string) *programHandler {
+	h := &programHandler{
+		runner:  runner,
+		prg:     prg,
+		env:     env,
+		toolIDs: map[string]string{},
+	}
+
+	for _, tool := range prg.TopLevelTools() {
+		// Tools without instructions, such as the tool that exports the tools of an OpenAPI definition, can't be run
+		if tool.Instructions == "" {
+			continue
+		}
+
+		name := tool.Name
+		if name == "" {
+			// The entry tool of a file is often unnamed, so it is named after the file
+			name = strings.TrimSuffix(filepath.Base(prg.Name), filepath.Ext(prg.Name))
+		}
+		name = types.ToolNormalizer(name)
+		for base, i := name, 1; h.toolIDs[name] != ""; i++ {
+			name = fmt.Sprintf("%s%d", base, i)
+		}
+
+		args := tool.Parameters.Arguments
+		if args == nil {
+			args = &system.DefaultToolSchema
+		}
+		schema, err := json.Marshal(args)
+		if err != nil {
+			log.Errorf("failed to marshal arguments of tool %s: %v", name, err)
+			continue
+		}
+
+		h.toolIDs[name] = tool.ID
+		h.tools = append(h.tools, mcp.Tool{
+			Name:        name,
+			Description: tool.Description,
+			InputSchema: schema,
+		})
+	}
+
+	return h
+}
+
+func (h *programHandler) ListTools(context.Context) ([]mcp.Tool, error) {
+	return h.tools, nil
+}
+
+func (h *programHandler) CallTool(ctx context.Context, name string, arguments json.RawMessage) (*mcp.CallToolResult, error) {
+	toolID, ok := h.toolIDs[name]
+	if !ok {
+		return nil, types.NewErrToolNotFound(name)
+	}
+
+	prg := h.prg
+	prg.EntryToolID = toolID
+
+	out, err := h.runner.Run(ctx, prg, h.env, string(arguments))
+	if err != nil {
+		return nil, err
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{{Type: "text", Text: out}},
+	}, nil
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/gptscript"
+	"github.com/spf13/cobra"
+)
+
+type Plan struct {
+	JSON bool `usage:"Output the plan as JSON"`
+
+	gptscript *GPTScript
+}
+
+func (p *Plan) Customize(cmd *cobra.Command) {
+	cmd.Use = "plan <file>"
+	cmd.Short = "List the tools, runtimes, credentials, models and hosts a program needs, without running it"
+	cmd.Args = cobra.ExactArgs(1)
+}
+
+func (p *Plan) Run(cmd *cobra.Command, args []string) error {
+	opts, err := p.gptscript.NewGPTScriptOpts()
+	if err != nil {
+		return err
+	}
+
+	runner, err := gptscript.New(&opts)
+	if err != nil {
+		return err
+	}
+	defer runner.Close(false)
+
+	prg, err := p.gptscript.readProgram(cmd.Context(), runner, args)
+	if err != nil {
+		return err
+	}
+
+	plan, err := runner.Plan(prg, opts.Env)
+	if err != nil {
+		return err
+	}
+
+	if p.JSON {
+		return json.NewEncoder(os.Stdout).Encode(plan)
+	}
+
+	fmt.Println("Tools:")
+	for _, tool := range plan.Tools {
+		line := fmt.Sprintf("  %s (%s)", tool.ToolID, tool.Type)
+		if len(tool.Command) > 0 {
+			line += ": " + strings.Join(tool.Command, " ")
+		}
+		if tool.Runtime != "" {
+			line += ", runtime " + tool.Runtime
+		}
+		if tool.Model != "" {
+			line += ", model " + tool.Model
+		}
+		fmt.Println(line)
+	}
+	printList("Runtimes", plan.Runtimes)
+	var credentials []string
+	for _, cred := range plan.Credentials {
+		credentials = append(credentials, cred.Reference)
+	}
+	printList("Credentials", credentials)
+	printList("Models", plan.Models)
+	printList("Hosts", plan.Hosts)
+	return nil
+}
+
+func printList(title string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Printf("%s:\n", title)
+	for _, item := range items {
+		fmt.Printf("  %s\n", item)
+	}
+}
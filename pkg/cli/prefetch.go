@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/gptscript-ai/gptscript/pkg/gptscript"
+	"github.com/spf13/cobra"
+)
+
+type Prefetch struct {
+	JSON bool `usage:"Output the result of each tool as JSON"`
+
+	gptscript *GPTScript
+}
+
+func (p *Prefetch) Customize(cmd *cobra.Command) {
+	cmd.Use = "prefetch <file>"
+	cmd.Short = "Download the repos and runtimes of a program's tools without running it"
+	cmd.Args = cobra.ExactArgs(1)
+}
+
+func (p *Prefetch) Run(cmd *cobra.Command, args []string) error {
+	opts, err := p.gptscript.NewGPTScriptOpts()
+	if err != nil {
+		return err
+	}
+
+	runner, err := gptscript.New(&opts)
+	if err != nil {
+		return err
+	}
+	defer runner.Close(false)
+
+	prg, err := p.gptscript.readProgram(cmd.Context(), runner, args)
+	if err != nil {
+		return err
+	}
+
+	results, err := runner.Prefetch(cmd.Context(), prg, opts.Env)
+	if p.JSON {
+		if encErr := json.NewEncoder(os.Stdout).Encode(results); encErr != nil {
+			return encErr
+		}
+		return err
+	}
+
+	for _, result := range results {
+		status := "fetched"
+		if result.Error != "" {
+			status = "failed: " + result.Error
+		} else if result.Cached {
+			status = "cached"
+		}
+		fmt.Printf("%s: %s\n", result.ToolID, status)
+	}
+	return err
+}
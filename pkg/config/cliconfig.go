@@ -45,9 +45,11 @@ func (a *AuthConfig) UnmarshalJSON(data []byte) error {
 }
 
 type CLIConfig struct {
-	Auths               map[string]AuthConfig `json:"auths,omitempty"`
-	CredentialsStore    string                `json:"credsStore,omitempty"`
-	GPTScriptConfigFile string                `json:"gptscriptConfig,omitempty"`
+	Auths            map[string]AuthConfig `json:"auths,omitempty"`
+	CredentialsStore string                `json:"credsStore,omitempty"`
+	// CredentialsEncryption is how the file credential store encrypts secrets, empty for no encryption.
+	CredentialsEncryption string `json:"credsEncryption,omitempty"`
+	GPTScriptConfigFile   string `json:"gptscriptConfig,omitempty"`
 
 	auths     map[string]types.AuthConfig
 	authsLock *sync.Mutex
@@ -46,3 +46,19 @@ func GetLogger(ctx context.Context) mvl.Logger {
 
 	return l
 }
+
+type progressKey struct{}
+
+// AddProgressFuncToCtx sets the function that long running setup work, such as downloading a runtime, uses to report
+// progress as a human readable message.
+func AddProgressFuncToCtx(ctx context.Context, progressF func(message string)) context.Context {
+	return context.WithValue(ctx, progressKey{}, progressF)
+}
+
+func GetProgressFuncFromCtx(ctx context.Context) func(message string) {
+	progressF, ok := ctx.Value(progressKey{}).(func(string))
+	if !ok {
+		return func(string) {}
+	}
+	return progressF
+}
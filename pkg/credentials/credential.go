@@ -1,21 +1,71 @@
 package credentials
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"strings"
+	"time"
 
 	"github.com/docker/cli/cli/config/types"
 )
 
+// expiryMargin is how long before it expires that a credential is renewed, so it doesn't expire while a tool uses it.
+const expiryMargin = 5 * time.Minute
+
 type Credential struct {
-	Context  string            `json:"context"`
-	ToolName string            `json:"toolName"`
-	Env      map[string]string `json:"env"`
+	Context      string            `json:"context"`
+	ToolName     string            `json:"toolName"`
+	Env          map[string]string `json:"env"`
+	ExpiresAt    *time.Time        `json:"expiresAt,omitempty"`
+	RefreshToken string            `json:"refreshToken,omitempty"`
+}
+
+// IsExpired returns true if the credential expires within expiryMargin. The credential tool has to be run again then,
+// which can use RefreshToken to renew it.
+func (c Credential) IsExpired() bool {
+	return c.ExpiresAt != nil && time.Now().Add(expiryMargin).After(*c.ExpiresAt)
+}
+
+// Refreshable returns true if the credential can be renewed without the user, because it has a refresh token or an
+// expiry, which its tool renews it at.
+func (c Credential) Refreshable() bool {
+	return c.RefreshToken != "" || c.ExpiresAt != nil
+}
+
+// IsUnauthorized returns true if err is from a request that was rejected with HTTP status 401, or from a tool that
+// reports it was unauthorized otherwise, which means that the credential it was called with expired or was revoked
+// before its expiry.
+func IsUnauthorized(err error) bool {
+	var statusErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &statusErr) && statusErr.HTTPStatusCode() == http.StatusUnauthorized {
+		return true
+	}
+	var unauthorizedErr interface{ Unauthorized() bool }
+	return errors.As(err, &unauthorizedErr) && unauthorizedErr.Unauthorized()
+}
+
+// storedSecret is how a credential that expires is stored. Other credentials are stored as only their env, as they
+// always have been.
+type storedSecret struct {
+	Env          map[string]string `json:"env"`
+	ExpiresAt    *time.Time        `json:"expiresAt,omitempty"`
+	RefreshToken string            `json:"refreshToken,omitempty"`
 }
 
 func (c Credential) toDockerAuthConfig() (types.AuthConfig, error) {
-	env, err := json.Marshal(c.Env)
+	var secret any = c.Env
+	if c.ExpiresAt != nil || c.RefreshToken != "" {
+		secret = storedSecret{
+			Env:          c.Env,
+			ExpiresAt:    c.ExpiresAt,
+			RefreshToken: c.RefreshToken,
+		}
+	}
+
+	env, err := json.Marshal(secret)
 	if err != nil {
 		return types.AuthConfig{}, err
 	}
@@ -28,8 +78,8 @@ func (c Credential) toDockerAuthConfig() (types.AuthConfig, error) {
 }
 
 func credentialFromDockerAuthConfig(authCfg types.AuthConfig) (Credential, error) {
-	var env map[string]string
-	if err := json.Unmarshal([]byte(authCfg.Password), &env); err != nil {
+	secret, err := parseSecret(authCfg.Password)
+	if err != nil {
 		return Credential{}, err
 	}
 
@@ -39,12 +89,31 @@ func credentialFromDockerAuthConfig(authCfg types.AuthConfig) (Credential, error
 	}
 
 	return Credential{
-		Context:  ctx,
-		ToolName: tool,
-		Env:      env,
+		Context:      ctx,
+		ToolName:     tool,
+		Env:          secret.Env,
+		ExpiresAt:    secret.ExpiresAt,
+		RefreshToken: secret.RefreshToken,
 	}, nil
 }
 
+// parseSecret reads a stored secret, which is either a storedSecret or, for credentials that don't expire, only the
+// env. The env values are strings, so an "env" key holding an object tells a storedSecret apart.
+func parseSecret(data string) (storedSecret, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(data), &fields); err != nil {
+		return storedSecret{}, err
+	}
+
+	var secret storedSecret
+	if env, ok := fields["env"]; ok && bytes.HasPrefix(bytes.TrimSpace(env), []byte("{")) {
+		err := json.Unmarshal([]byte(data), &secret)
+		return secret, err
+	}
+	err := json.Unmarshal([]byte(data), &secret.Env)
+	return secret, err
+}
+
 func toolNameWithCtx(toolName, credCtx string) string {
 	return toolName + "///" + credCtx
 }
@@ -0,0 +1,226 @@
+package credentials
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/docker/cli/cli/config/credentials"
+	"github.com/docker/cli/cli/config/types"
+	"golang.org/x/term"
+)
+
+const (
+	// PassphraseEncryption encrypts the secrets of the file store with a key derived from a passphrase.
+	PassphraseEncryption = "passphrase"
+
+	encryptedPrefix = "gptscript-encrypted-v1:"
+	saltSize        = 16
+	keyIterations   = 600_000
+	// saltServerAddress is the entry of the store that keeps its salt
+	saltServerAddress = "gptscript-credential-encryption-salt"
+)
+
+// encryptedStore keeps the secrets of the credentials in store encrypted with AES-256-GCM. The key is derived from the
+// passphrase and the salt of the store with PBKDF2-HMAC-SHA256, once, and each secret is sealed with its own nonce.
+// Secrets stored before encryption was turned on are still read, and are encrypted the next time they are stored.
+type encryptedStore struct {
+	store      credentials.Store
+	passphrase func() (string, error)
+
+	gcmLock sync.Mutex
+	gcm     cipher.AEAD
+}
+
+func newEncryptedStore(store credentials.Store) *encryptedStore {
+	return &encryptedStore{
+		store:      store,
+		passphrase: sync.OnceValues(readPassphrase),
+	}
+}
+
+// readPassphrase reads the passphrase from GPTSCRIPT_CREDENTIAL_PASSPHRASE, or else asks for it on the terminal.
+func readPassphrase() (string, error) {
+	if passphrase := os.Getenv("GPTSCRIPT_CREDENTIAL_PASSPHRASE"); passphrase != "" {
+		return passphrase, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", errors.New("credentials are encrypted, set GPTSCRIPT_CREDENTIAL_PASSPHRASE to the passphrase")
+	}
+
+	_, _ = fmt.Fprint(os.Stderr, "Credential passphrase: ")
+	passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+	_, _ = fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read credential passphrase: %w", err)
+	}
+	if len(passphrase) == 0 {
+		return "", errors.New("credential passphrase cannot be empty")
+	}
+	return string(passphrase), nil
+}
+
+func (e *encryptedStore) Erase(serverAddress string) error {
+	return e.store.Erase(serverAddress)
+}
+
+func (e *encryptedStore) Get(serverAddress string) (types.AuthConfig, error) {
+	auth, err := e.store.Get(serverAddress)
+	if err != nil {
+		return auth, err
+	}
+	return e.decrypt(auth)
+}
+
+func (e *encryptedStore) GetAll() (map[string]types.AuthConfig, error) {
+	auths, err := e.store.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]types.AuthConfig, len(auths))
+	for serverAddress, auth := range auths {
+		if serverAddress == saltServerAddress {
+			continue
+		}
+		if result[serverAddress], err = e.decrypt(auth); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (e *encryptedStore) Store(authConfig types.AuthConfig) error {
+	gcm, err := e.cipher(true)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	// The server address is authenticated with the secret, so a secret can't be moved to another credential
+	sealed := gcm.Seal(nil, nonce, []byte(authConfig.Password), []byte(authConfig.ServerAddress))
+	authConfig.Password = encryptedPrefix + base64.StdEncoding.EncodeToString(append(nonce, sealed...))
+	return e.store.Store(authConfig)
+}
+
+func (e *encryptedStore) decrypt(auth types.AuthConfig) (types.AuthConfig, error) {
+	encoded, ok := strings.CutPrefix(auth.Password, encryptedPrefix)
+	if !ok {
+		return auth, nil
+	}
+
+	gcm, err := e.cipher(false)
+	if err != nil {
+		return types.AuthConfig{}, err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(data) < gcm.NonceSize() {
+		return types.AuthConfig{}, fmt.Errorf("invalid encrypted credential %s", auth.ServerAddress)
+	}
+
+	secret, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(auth.ServerAddress))
+	if err != nil {
+		return types.AuthConfig{}, fmt.Errorf("failed to decrypt credential %s, the passphrase may be wrong", auth.ServerAddress)
+	}
+
+	auth.Password = string(secret)
+	return auth, nil
+}
+
+// cipher returns the cipher the secrets are sealed with. Deriving its key is slow on purpose, so it is only done once.
+// If create is set, the salt of the store is created if it does not have one yet.
+func (e *encryptedStore) cipher(create bool) (cipher.AEAD, error) {
+	e.gcmLock.Lock()
+	defer e.gcmLock.Unlock()
+
+	if e.gcm != nil {
+		return e.gcm, nil
+	}
+
+	passphrase, err := e.passphrase()
+	if err != nil {
+		return nil, err
+	}
+
+	salt, err := e.salt(create)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(pbkdf2SHA256([]byte(passphrase), salt, keyIterations, 32))
+	if err != nil {
+		return nil, err
+	}
+	e.gcm, err = cipher.NewGCM(block)
+	return e.gcm, err
+}
+
+// salt returns the salt of the store, and creates it if create is set and the store does not have one.
+func (e *encryptedStore) salt(create bool) ([]byte, error) {
+	auth, err := e.store.Get(saltServerAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	if auth.Password != "" {
+		salt, err := base64.StdEncoding.DecodeString(auth.Password)
+		if err != nil || len(salt) != saltSize {
+			return nil, errors.New("invalid salt of the encrypted credentials")
+		}
+		return salt, nil
+	} else if !create {
+		return nil, errors.New("the salt of the encrypted credentials is missing")
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, e.store.Store(types.AuthConfig{
+		ServerAddress: saltServerAddress,
+		Password:      base64.StdEncoding.EncodeToString(salt),
+	})
+}
+
+// pbkdf2SHA256 derives a key of keyLen bytes from password and salt as described in RFC 8018.
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var (
+		key   []byte
+		block = make([]byte, 4)
+	)
+	for i := uint32(1); len(key) < keyLen; i++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(block, i)
+		prf.Write(block)
+		u := prf.Sum(nil)
+
+		t := make([]byte, len(u))
+		copy(t, u)
+		for n := 1; n < iterations; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
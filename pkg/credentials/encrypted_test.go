@@ -0,0 +1,87 @@
+package credentials
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/docker/cli/cli/config/types"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryStore map[string]types.AuthConfig
+
+func (m memoryStore) Erase(serverAddress string) error {
+	delete(m, serverAddress)
+	return nil
+}
+
+func (m memoryStore) Get(serverAddress string) (types.AuthConfig, error) {
+	return m[serverAddress], nil
+}
+
+func (m memoryStore) GetAll() (map[string]types.AuthConfig, error) {
+	return m, nil
+}
+
+func (m memoryStore) Store(authConfig types.AuthConfig) error {
+	m[authConfig.ServerAddress] = authConfig
+	return nil
+}
+
+func TestPBKDF2SHA256(t *testing.T) {
+	// Test vector from RFC 7914
+	key := pbkdf2SHA256([]byte("passwd"), []byte("salt"), 1, 64)
+	require.Equal(t, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783", hex.EncodeToString(key))
+}
+
+func TestEncryptedStore(t *testing.T) {
+	files := memoryStore{
+		"plain": {ServerAddress: "plain", Username: "gptscript", Password: `{"A":"a"}`},
+	}
+	store := newEncryptedStore(files)
+	store.passphrase = func() (string, error) {
+		return "secret", nil
+	}
+
+	require.NoError(t, store.Store(types.AuthConfig{ServerAddress: "tool", Username: "gptscript", Password: `{"B":"b"}`}))
+	require.True(t, strings.HasPrefix(files["tool"].Password, encryptedPrefix))
+	require.NotContains(t, files["tool"].Password, `"b"`)
+
+	auth, err := store.Get("tool")
+	require.NoError(t, err)
+	require.Equal(t, `{"B":"b"}`, auth.Password)
+
+	// Secrets stored before encryption was turned on are still read
+	auth, err = store.Get("plain")
+	require.NoError(t, err)
+	require.Equal(t, `{"A":"a"}`, auth.Password)
+
+	// The salt is created once for the store, and each secret only has its own nonce
+	salt := files[saltServerAddress].Password
+	require.NotEmpty(t, salt)
+	require.NoError(t, store.Store(types.AuthConfig{ServerAddress: "tool2", Username: "gptscript", Password: `{"B":"b"}`}))
+	require.Equal(t, salt, files[saltServerAddress].Password)
+	require.NotEqual(t, files["tool"].Password, files["tool2"].Password)
+
+	all, err := store.GetAll()
+	require.NoError(t, err)
+	require.Len(t, all, 3)
+	require.Equal(t, `{"B":"b"}`, all["tool"].Password)
+	require.Equal(t, `{"B":"b"}`, all["tool2"].Password)
+	require.Equal(t, `{"A":"a"}`, all["plain"].Password)
+
+	// A secret can't be read with another passphrase or under another server address
+	wrong := newEncryptedStore(files)
+	wrong.passphrase = func() (string, error) {
+		return "wrong", nil
+	}
+	_, err = wrong.Get("tool")
+	require.Error(t, err)
+
+	moved := files["tool"]
+	moved.ServerAddress = "other"
+	files["other"] = moved
+	_, err = store.Get("other")
+	require.Error(t, err)
+}
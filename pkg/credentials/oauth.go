@@ -0,0 +1,242 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// OAuthDeviceConfig configures a credential that is acquired with the OAuth 2.0 device authorization grant (RFC 8628).
+type OAuthDeviceConfig struct {
+	ClientID               string   `json:"clientID"`
+	DeviceAuthorizationURL string   `json:"deviceAuthorizationURL"`
+	TokenURL               string   `json:"tokenURL"`
+	Scopes                 []string `json:"scopes,omitempty"`
+	// Env is the name of the environment variable the access token is set in.
+	Env string `json:"env"`
+}
+
+func (o OAuthDeviceConfig) Validate() error {
+	var missing []string
+	for _, field := range []struct {
+		name, value string
+	}{
+		{"clientID", o.ClientID},
+		{"deviceAuthorizationURL", o.DeviceAuthorizationURL},
+		{"tokenURL", o.TokenURL},
+		{"env", o.Env},
+	} {
+		if field.value == "" {
+			missing = append(missing, field.name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("invalid OAuth device configuration, missing %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// OAuthToken is the result of a successful token request.
+type OAuthToken struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    *time.Time
+}
+
+type deviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Authorize runs the device authorization grant. It calls display with the URL the user has to visit and the code to
+// enter there, then polls for the token until the user has approved or denied the request, or the code expires.
+func (o OAuthDeviceConfig) Authorize(ctx context.Context, display func(verificationURI, userCode string)) (*OAuthToken, error) {
+	form := url.Values{"client_id": {o.ClientID}}
+	if len(o.Scopes) > 0 {
+		form.Set("scope", strings.Join(o.Scopes, " "))
+	}
+
+	var auth deviceAuthorization
+	if err := postForm(ctx, o.DeviceAuthorizationURL, form, &auth); err != nil {
+		return nil, fmt.Errorf("failed to start OAuth device authorization: %w", err)
+	}
+	if auth.DeviceCode == "" || auth.UserCode == "" || auth.VerificationURI == "" {
+		return nil, errors.New("invalid OAuth device authorization response")
+	}
+
+	verificationURI := auth.VerificationURI
+	if auth.VerificationURIComplete != "" {
+		verificationURI = auth.VerificationURIComplete
+	}
+	display(verificationURI, auth.UserCode)
+
+	interval := time.Duration(auth.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	expiresIn := time.Duration(auth.ExpiresIn) * time.Second
+	if expiresIn <= 0 {
+		expiresIn = 15 * time.Minute
+	}
+	ctx, cancel := context.WithTimeout(ctx, expiresIn)
+	defer cancel()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("OAuth device authorization was not approved in time: %w", ctx.Err())
+		case <-time.After(interval):
+		}
+
+		resp, err := o.requestToken(ctx, url.Values{
+			"grant_type":  {deviceCodeGrantType},
+			"device_code": {auth.DeviceCode},
+			"client_id":   {o.ClientID},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		switch resp.Error {
+		case "":
+			return resp.token(), nil
+		case "authorization_pending":
+		case "slow_down":
+			interval += 5 * time.Second
+		default:
+			return nil, resp.err()
+		}
+	}
+}
+
+// Refresh gets a new access token with refreshToken. The new token keeps refreshToken if the server does not issue a
+// new one.
+func (o OAuthDeviceConfig) Refresh(ctx context.Context, refreshToken string) (*OAuthToken, error) {
+	resp, err := o.requestToken(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+		"client_id":     {o.ClientID},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, resp.err()
+	}
+
+	token := resp.token()
+	if token.RefreshToken == "" {
+		token.RefreshToken = refreshToken
+	}
+	return token, nil
+}
+
+func (o OAuthDeviceConfig) requestToken(ctx context.Context, form url.Values) (*tokenResponse, error) {
+	var resp tokenResponse
+	if err := postForm(ctx, o.TokenURL, form, &resp); err != nil {
+		return nil, fmt.Errorf("failed to request OAuth token: %w", err)
+	}
+	if resp.Error == "" && resp.AccessToken == "" {
+		return nil, errors.New("invalid OAuth token response, no access token")
+	}
+	return &resp, nil
+}
+
+func (t *tokenResponse) token() *OAuthToken {
+	token := &OAuthToken{
+		AccessToken:  t.AccessToken,
+		RefreshToken: t.RefreshToken,
+	}
+	if t.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(t.ExpiresIn) * time.Second)
+		token.ExpiresAt = &expiresAt
+	}
+	return token
+}
+
+func (t *tokenResponse) err() error {
+	if t.ErrorDescription != "" {
+		return fmt.Errorf("OAuth token request failed: %s: %s", t.Error, t.ErrorDescription)
+	}
+	return fmt.Errorf("OAuth token request failed: %s", t.Error)
+}
+
+// ClientCredentialsToken gets an access token with the OAuth 2.0 client credentials grant, authenticating the client
+// with HTTP basic authentication.
+func ClientCredentialsToken(ctx context.Context, tokenURL, clientID, clientSecret string, scopes []string) (*OAuthToken, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(scopes) > 0 {
+		form.Set("scope", strings.Join(scopes, " "))
+	}
+
+	var resp tokenResponse
+	if err := postFormAuth(ctx, tokenURL, form, url.UserPassword(url.QueryEscape(clientID), url.QueryEscape(clientSecret)), &resp); err != nil {
+		return nil, fmt.Errorf("failed to request OAuth token: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, resp.err()
+	}
+	if resp.AccessToken == "" {
+		return nil, errors.New("invalid OAuth token response, no access token")
+	}
+	return resp.token(), nil
+}
+
+// postForm posts form to u and decodes the JSON response into out. Error responses of token endpoints are JSON too, so
+// they are decoded rather than returned as errors, as long as they have a body.
+func postForm(ctx context.Context, u string, form url.Values, out any) error {
+	return postFormAuth(ctx, u, form, nil, out)
+}
+
+// postFormAuth is postForm with the client authenticated by HTTP basic authentication, if client is set. The client ID
+// and secret are form encoded first, as RFC 6749 requires.
+func postFormAuth(ctx context.Context, u string, form url.Values, client *url.Userinfo, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if client != nil {
+		password, _ := client.Password()
+		req.SetBasicAuth(client.Username(), password)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("invalid status code [%d], expected 200", resp.StatusCode)
+		}
+		return err
+	}
+	return nil
+}
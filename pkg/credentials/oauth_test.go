@@ -0,0 +1,112 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOAuthDevice(t *testing.T) {
+	var polls int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/device", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		require.Equal(t, "client", r.Form.Get("client_id"))
+		require.Equal(t, "read write", r.Form.Get("scope"))
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"device_code":      "device",
+			"user_code":        "ABCD-EFGH",
+			"verification_uri": "https://example.com/device",
+			"expires_in":       60,
+			"interval":         1,
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		switch r.Form.Get("grant_type") {
+		case deviceCodeGrantType:
+			require.Equal(t, "device", r.Form.Get("device_code"))
+			if polls++; polls == 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				_ = json.NewEncoder(w).Encode(map[string]any{"error": "authorization_pending"})
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"access_token":  "access",
+				"refresh_token": "refresh",
+				"expires_in":    3600,
+			})
+		case "refresh_token":
+			if r.Form.Get("refresh_token") != "refresh" {
+				w.WriteHeader(http.StatusBadRequest)
+				_ = json.NewEncoder(w).Encode(map[string]any{"error": "invalid_grant"})
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"access_token": "refreshed",
+				"expires_in":   3600,
+			})
+		}
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	config := OAuthDeviceConfig{
+		ClientID:               "client",
+		DeviceAuthorizationURL: s.URL + "/device",
+		TokenURL:               s.URL + "/token",
+		Scopes:                 []string{"read", "write"},
+		Env:                    "TOKEN",
+	}
+	require.NoError(t, config.Validate())
+
+	var displayed string
+	token, err := config.Authorize(context.Background(), func(verificationURI, userCode string) {
+		displayed = verificationURI + " " + userCode
+	})
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com/device ABCD-EFGH", displayed)
+	require.Equal(t, 2, polls)
+	require.Equal(t, "access", token.AccessToken)
+	require.Equal(t, "refresh", token.RefreshToken)
+	require.NotNil(t, token.ExpiresAt)
+
+	token, err = config.Refresh(context.Background(), "refresh")
+	require.NoError(t, err)
+	require.Equal(t, "refreshed", token.AccessToken)
+	// The refresh token is kept when the server doesn't issue a new one
+	require.Equal(t, "refresh", token.RefreshToken)
+
+	_, err = config.Refresh(context.Background(), "revoked")
+	require.ErrorContains(t, err, "invalid_grant")
+
+	require.ErrorContains(t, OAuthDeviceConfig{ClientID: "client"}.Validate(), "missing deviceAuthorizationURL, tokenURL, env")
+}
+
+func TestCredentialExpiry(t *testing.T) {
+	// Credentials that don't expire are stored as only their env, like before
+	auth, err := Credential{ToolName: "tool", Context: "default", Env: map[string]string{"A": "a"}}.toDockerAuthConfig()
+	require.NoError(t, err)
+	require.JSONEq(t, `{"A": "a"}`, auth.Password)
+
+	cred, err := credentialFromDockerAuthConfig(auth)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"A": "a"}, cred.Env)
+	require.False(t, cred.IsExpired())
+
+	expiresAt := time.Now().Add(time.Minute)
+	auth, err = Credential{ToolName: "tool", Context: "default", Env: map[string]string{"A": "a"}, ExpiresAt: &expiresAt, RefreshToken: "refresh"}.toDockerAuthConfig()
+	require.NoError(t, err)
+
+	cred, err = credentialFromDockerAuthConfig(auth)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"A": "a"}, cred.Env)
+	require.Equal(t, "refresh", cred.RefreshToken)
+	// It expires within the margin, so it is renewed already
+	require.True(t, cred.IsExpired())
+}
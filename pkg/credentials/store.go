@@ -101,7 +101,14 @@ func (s *Store) getStore() (credentials.Store, error) {
 
 func (s *Store) getStoreByHelper(helper string) (credentials.Store, error) {
 	if helper == "" || helper == config.GPTScriptHelperPrefix+"file" {
-		return credentials.NewFileStore(s.cfg), nil
+		switch s.cfg.CredentialsEncryption {
+		case "":
+			return credentials.NewFileStore(s.cfg), nil
+		case PassphraseEncryption:
+			return newEncryptedStore(credentials.NewFileStore(s.cfg)), nil
+		default:
+			return nil, fmt.Errorf("unknown credential encryption %q", s.cfg.CredentialsEncryption)
+		}
 	}
 	return NewHelper(s.cfg, helper)
 }
@@ -5,8 +5,16 @@ import (
 	"io"
 	"os"
 	"os/exec"
+	"time"
 )
 
+// GracePeriodEnvVar is the env var the engine sets to how long a daemon has to exit after it is asked to stop.
+const GracePeriodEnvVar = "GPTSCRIPT_DAEMON_GRACE_PERIOD"
+
+const defaultGracePeriod = 10 * time.Second
+
+// SysDaemon supervises the daemon command in os.Args. When stdin is closed, because gptscript stops its daemons or
+// exited, the daemon and its children are asked to stop, and killed if they don't exit within the grace period.
 func SysDaemon() error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -16,9 +24,52 @@ func SysDaemon() error {
 		cancel()
 	}()
 
-	cmd := exec.CommandContext(ctx, os.Args[2], os.Args[3:]...)
+	gracePeriod := defaultGracePeriod
+	if d, err := time.ParseDuration(os.Getenv(GracePeriodEnvVar)); err == nil {
+		gracePeriod = d
+	}
+
+	cmd := exec.Command(os.Args[2], os.Args[3:]...)
 	cmd.Stdin = os.Stdin
 	cmd.Stderr = os.Stderr
 	cmd.Stdout = os.Stdout
-	return cmd.Run()
+	return supervise(ctx, cmd, gracePeriod)
+}
+
+// supervise runs cmd until it exits or ctx is done. cmd is then asked to stop and killed if it does not exit within
+// gracePeriod.
+func supervise(ctx context.Context, cmd *exec.Cmd, gracePeriod time.Duration) error {
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Debugf("stopping daemon %v, waiting up to %s for it to exit", cmd.Args, gracePeriod)
+	if err := terminate(cmd); err != nil {
+		log.Debugf("failed to ask daemon %v to stop: %v", cmd.Args, err)
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(gracePeriod):
+	}
+
+	log.Debugf("daemon %v did not exit within %s, killing it", cmd.Args, gracePeriod)
+	if err := kill(cmd); err != nil {
+		log.Debugf("failed to kill daemon %v: %v", cmd.Args, err)
+	}
+	// Waiting reaps the daemon, so that it doesn't stay a zombie
+	return <-done
 }
@@ -0,0 +1,45 @@
+package daemon
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupervise(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+
+	// A daemon that exits on SIGTERM is given the time to clean up
+	stopped := filepath.Join(t.TempDir(), "stopped")
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	start := time.Now()
+	err := supervise(ctx, exec.Command("sh", "-c", `trap 'echo done > "$0"; exit 0' TERM; while true; do sleep 0.1; done`, stopped), 5*time.Second)
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.FileExists(t, stopped)
+
+	// A daemon that ignores SIGTERM is killed after the grace period
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	start = time.Now()
+	err = supervise(ctx, exec.Command("sh", "-c", `trap '' TERM; while true; do sleep 0.1; done`), 500*time.Millisecond)
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.GreaterOrEqual(t, time.Since(start), 700*time.Millisecond)
+
+	// A daemon that exits by itself is not signaled
+	err = supervise(context.Background(), exec.Command("sh", "-c", "exit 3"), time.Second)
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 3, exitErr.ExitCode())
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+
+package daemon
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+func setProcessGroup(c *exec.Cmd) {
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func terminate(c *exec.Cmd) error {
+	// A negative pid signals the whole process group
+	return syscall.Kill(-c.Process.Pid, syscall.SIGTERM)
+}
+
+func kill(c *exec.Cmd) error {
+	return syscall.Kill(-c.Process.Pid, syscall.SIGKILL)
+}
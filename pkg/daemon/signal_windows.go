@@ -0,0 +1,19 @@
+//go:build windows
+
+package daemon
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+func setProcessGroup(*exec.Cmd) {
+}
+
+func terminate(c *exec.Cmd) error {
+	return exec.Command("taskkill", "/T", "/PID", strconv.Itoa(c.Process.Pid)).Run()
+}
+
+func kill(c *exec.Cmd) error {
+	return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(c.Process.Pid)).Run()
+}
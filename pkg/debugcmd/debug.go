@@ -3,23 +3,45 @@ package debugcmd
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/gptscript-ai/gptscript/pkg/redact"
 )
 
 type WrappedCmd struct {
-	c   *exec.Cmd
-	r   recorder
-	Env []string
-	Dir string
+	c     *exec.Cmd
+	r     recorder
+	debug bool
+	Env   []string
+	Dir   string
 }
 
 func (w *WrappedCmd) Stdout() string {
 	return w.r.Stdout()
 }
 
+func (w *WrappedCmd) Stderr() string {
+	return redact.String(w.r.Stderr())
+}
+
+// KillTreeOnCancel makes cancellation of the command's context kill the command and all of its children, instead of
+// only the command itself.
+func (w *WrappedCmd) KillTreeOnCancel() {
+	KillTreeOnCancel(w.c)
+}
+
+// KillTreeOnCancel makes cancellation of the context of c kill c and all of its children, instead of only c itself.
+func KillTreeOnCancel(c *exec.Cmd) {
+	killTreeOnCancel(c)
+	// Don't wait forever on output pipes held open by children that could not be killed
+	c.WaitDelay = 10 * time.Second
+}
+
 func (w *WrappedCmd) Run() error {
 	if len(w.Env) > 0 {
 		w.c.Env = w.Env
@@ -28,8 +50,14 @@ func (w *WrappedCmd) Run() error {
 		w.c.Dir = w.Dir
 	}
 	if err := w.c.Run(); err != nil {
-		msg := w.r.dump()
-		if msg != "" {
+		var msg string
+		if w.debug {
+			// Output was already written to the console as it happened
+			msg = w.r.Stderr()
+		} else {
+			msg = w.r.dump()
+		}
+		if msg = tail(redact.String(msg)); msg != "" {
 			return fmt.Errorf("%w: %s", err, msg)
 		}
 		return err
@@ -37,6 +65,30 @@ func (w *WrappedCmd) Run() error {
 	return nil
 }
 
+const (
+	maxErrorLines = 20
+	maxErrorBytes = 4096
+)
+
+// tail returns the end of the output of a failed command, which is where compilers and most other tools print the
+// reason they failed.
+func tail(msg string) string {
+	msg = strings.TrimSpace(msg)
+	truncated := false
+	if lines := strings.Split(msg, "\n"); len(lines) > maxErrorLines {
+		msg = strings.Join(lines[len(lines)-maxErrorLines:], "\n")
+		truncated = true
+	}
+	if len(msg) > maxErrorBytes {
+		msg = msg[len(msg)-maxErrorBytes:]
+		truncated = true
+	}
+	if truncated {
+		return "...\n" + msg
+	}
+	return msg
+}
+
 func New(ctx context.Context, arg string, args ...string) *WrappedCmd {
 	w := &WrappedCmd{
 		c: exec.CommandContext(ctx, arg, args...),
@@ -65,14 +117,24 @@ func (r *recorder) Stdout() string {
 	return buf.String()
 }
 
+func (r *recorder) Stderr() string {
+	buf := strings.Builder{}
+	for _, e := range r.entries {
+		if e.err {
+			buf.Write(e.data)
+		}
+	}
+	return buf.String()
+}
+
 func (r *recorder) dump() string {
 	var errMessage strings.Builder
 	for _, entry := range r.entries {
 		if entry.err {
 			errMessage.Write(entry.data)
-			_, _ = os.Stderr.Write(entry.data)
+			_, _ = os.Stderr.Write(redact.Bytes(entry.data))
 		} else {
-			_, _ = os.Stdout.Write(entry.data)
+			_, _ = os.Stdout.Write(redact.Bytes(entry.data))
 		}
 	}
 	return errMessage.String()
@@ -100,8 +162,15 @@ func (w *writer) Write(data []byte) (int, error) {
 
 func setupDebug(w *WrappedCmd) {
 	if log.IsDebug() {
-		w.c.Stdout = os.Stdout
-		w.c.Stderr = os.Stderr
+		w.debug = true
+		// Stdout is still recorded, for the commands whose output is read with Stdout
+		w.c.Stdout = io.MultiWriter(redactingWriter{os.Stdout}, &writer{
+			r: &w.r,
+		})
+		w.c.Stderr = io.MultiWriter(redactingWriter{os.Stderr}, &writer{
+			err: true,
+			r:   &w.r,
+		})
 	} else {
 		w.c.Stdout = &writer{
 			r: &w.r,
@@ -112,3 +181,16 @@ func setupDebug(w *WrappedCmd) {
 		}
 	}
 }
+
+// redactingWriter removes secrets from what is written to the console. A secret that is split between two writes is not
+// found.
+type redactingWriter struct {
+	w io.Writer
+}
+
+func (r redactingWriter) Write(data []byte) (int, error) {
+	if _, err := r.w.Write(redact.Bytes(data)); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package debugcmd
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+func killTreeOnCancel(c *exec.Cmd) {
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	c.Cancel = func() error {
+		// A negative pid signals the whole process group
+		return syscall.Kill(-c.Process.Pid, syscall.SIGKILL)
+	}
+}
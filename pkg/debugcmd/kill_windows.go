@@ -0,0 +1,14 @@
+//go:build windows
+
+package debugcmd
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+func killTreeOnCancel(c *exec.Cmd) {
+	c.Cancel = func() error {
+		return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(c.Process.Pid)).Run()
+	}
+}
@@ -0,0 +1,157 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/gptscript-ai/gptscript/pkg/redact"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+const (
+	AuditTypeTool  = "tool"
+	AuditTypeModel = "model"
+
+	AuditStatusOK       = "ok"
+	AuditStatusError    = "error"
+	AuditStatusCanceled = "canceled"
+)
+
+// AuditLog appends an entry for every run of a command tool and every call of the model to a file, as a line of JSON,
+// for an audit trail of runs that is kept apart from the logs. Inputs and errors are redacted, and outputs are left
+// out. Each entry is written and synced before the call returns, so the entries of a run that crashes or is
+// cancelled are kept up to its last call.
+type AuditLog struct {
+	file string
+	lock sync.Mutex
+}
+
+type AuditEntry struct {
+	Time         time.Time `json:"time"`
+	Type         string    `json:"type"`
+	CallID       string    `json:"callID,omitempty"`
+	ParentCallID string    `json:"parentCallID,omitempty"`
+	ToolID       string    `json:"toolID,omitempty"`
+	ToolName     string    `json:"toolName,omitempty"`
+	// Input is the redacted input of a tool
+	Input    string `json:"input,omitempty"`
+	Status   string `json:"status"`
+	ExitCode *int   `json:"exitCode,omitempty"`
+	// Error is the redacted error of the call
+	Error string       `json:"error,omitempty"`
+	Model string       `json:"model,omitempty"`
+	Usage *types.Usage `json:"usage,omitempty"`
+	// Credentials are the references of the credentials of the tool, not their values
+	Credentials []string `json:"credentials,omitempty"`
+	DurationMS  int64    `json:"durationMs"`
+}
+
+// NewAuditLog returns an audit log that appends to file, which is created if it doesn't exist. Only the user can read a
+// file it creates.
+func NewAuditLog(file string) (*AuditLog, error) {
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &AuditLog{
+		file: file,
+	}, nil
+}
+
+// write appends the entry to the file. The file is opened for each entry, so that nothing is buffered in the process
+// and other processes can append to the same file.
+func (a *AuditLog) write(entry AuditEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Errorf("failed to marshal audit log entry: %v", err)
+		return
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	f, err := os.OpenFile(a.file, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		log.Errorf("failed to open audit log: %v", err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		log.Errorf("failed to write audit log: %v", err)
+		return
+	}
+	if err := f.Sync(); err != nil {
+		log.Errorf("failed to sync audit log: %v", err)
+	}
+}
+
+func (a *AuditLog) runTool(ctx Context, input string, run func() (*Return, error)) (*Return, error) {
+	entry := a.entry(AuditTypeTool, &ctx)
+	entry.Input = redact.String(input)
+	entry.Credentials = ctx.Tool.Credentials
+
+	ret, err := run()
+	if exitErr := (*exec.ExitError)(nil); errors.As(err, &exitErr) {
+		exitCode := exitErr.ExitCode()
+		entry.ExitCode = &exitCode
+	} else if ret != nil {
+		entry.ExitCode = ret.ExitCode
+	}
+	a.finish(ctx.Ctx, &entry, err)
+	return ret, err
+}
+
+func (a *AuditLog) callModel(ctx context.Context, req types.CompletionRequest, call func() (*types.CompletionMessage, error)) (*types.CompletionMessage, error) {
+	callCtx, _ := FromContext(ctx)
+	entry := a.entry(AuditTypeModel, callCtx)
+	entry.Model = req.Model
+
+	resp, err := call()
+	if resp != nil && resp.Usage != (types.Usage{}) {
+		entry.Usage = &resp.Usage
+	}
+	a.finish(ctx, &entry, err)
+	return resp, err
+}
+
+func (a *AuditLog) entry(auditType string, ctx *Context) AuditEntry {
+	entry := AuditEntry{
+		Time: time.Now(),
+		Type: auditType,
+	}
+	if ctx != nil {
+		entry.CallID = ctx.ID
+		entry.ToolID = ctx.Tool.ID
+		entry.ToolName = ctx.Tool.Name
+		if ctx.Parent != nil {
+			entry.ParentCallID = ctx.Parent.ID
+		}
+	}
+	return entry
+}
+
+func (a *AuditLog) finish(ctx context.Context, entry *AuditEntry, err error) {
+	entry.DurationMS = time.Since(entry.Time).Milliseconds()
+	entry.Status = AuditStatusOK
+	if err != nil {
+		entry.Status = AuditStatusError
+		entry.Error = redact.String(err.Error())
+	}
+	if err != nil && (errors.Is(err, context.Canceled) || ctx.Err() != nil) {
+		entry.Status = AuditStatusCanceled
+	} else if err == nil && entry.ExitCode != nil && *entry.ExitCode != 0 {
+		// The failure of a command tool called by the model is its result, not an error of the call
+		entry.Status = AuditStatusError
+	}
+	a.write(*entry)
+}
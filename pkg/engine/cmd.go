@@ -10,38 +10,67 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/google/shlex"
+	gcontext "github.com/gptscript-ai/gptscript/pkg/context"
 	"github.com/gptscript-ai/gptscript/pkg/counter"
+	"github.com/gptscript-ai/gptscript/pkg/debugcmd"
 	"github.com/gptscript-ai/gptscript/pkg/env"
 	"github.com/gptscript-ai/gptscript/pkg/types"
 	"github.com/gptscript-ai/gptscript/pkg/version"
+	"golang.org/x/term"
 )
 
-func (e *Engine) runCommand(ctx Context, tool types.Tool, input string, toolCategory ToolCategory) (cmdOut string, cmdErr error) {
+// UnauthorizedExitCode is the exit code of a command tool that was denied with its credentials, EX_NOPERM of
+// sysexits.h. Its credentials are then refreshed and it is run once more, like an HTTP tool that gets a 401.
+const UnauthorizedExitCode = 77
+
+// CommandUnauthorizedError is returned for a command tool with credentials that exited with UnauthorizedExitCode.
+type CommandUnauthorizedError struct {
+	Tool   string
+	Output string
+	Err    error
+}
+
+func (e *CommandUnauthorizedError) Error() string {
+	return fmt.Sprintf("tool %s was unauthorized with its credentials: %v", e.Tool, e.Err)
+}
+
+func (e *CommandUnauthorizedError) Unwrap() error {
+	return e.Err
+}
+
+func (e *CommandUnauthorizedError) Unauthorized() bool {
+	return true
+}
+
+func (e *Engine) runCommand(ctx Context, tool types.Tool, input string, toolCategory ToolCategory) (cmdOut string, exitCode *int, cmdErr error) {
 	id := counter.Next()
 
 	defer func() {
-		e.Progress <- types.CompletionStatus{
+		e.progress(types.CompletionStatus{
 			CompletionID: id,
 			Response: map[string]any{
 				"output": cmdOut,
 				"err":    cmdErr,
 			},
-		}
+		})
 	}()
 
 	if tool.BuiltinFunc != nil {
-		e.Progress <- types.CompletionStatus{
+		e.progress(types.CompletionStatus{
 			CompletionID: id,
 			Request: map[string]any{
 				"command": []string{tool.ID},
 				"input":   input,
 			},
-		}
-		return tool.BuiltinFunc(ctx.WrappedContext(), e.Env, input)
+		})
+		cmdOut, cmdErr = tool.BuiltinFunc(ctx.WrappedContext(), e.toolEnv(), input)
+		return cmdOut, nil, cmdErr
 	}
 
 	var instructions []string
@@ -52,36 +81,82 @@ func (e *Engine) runCommand(ctx Context, tool types.Tool, input string, toolCate
 		strings.TrimSpace(fmt.Sprintf("GPTSCRIPT_CONTEXT=%s", strings.Join(instructions, "\n"))),
 	}
 
-	cmd, stop, err := e.newCommand(ctx.Ctx, extraEnv, tool, input)
+	// Report progress of runtime downloads and other setup work for the tool as partial output of the call
+	var setupProgress strings.Builder
+	setupCtx := gcontext.AddProgressFuncToCtx(ctx.Ctx, func(message string) {
+		setupProgress.WriteString(message + "\n")
+		e.progress(types.CompletionStatus{
+			CompletionID: id,
+			PartialResponse: &types.CompletionMessage{
+				Role:    types.CompletionMessageRoleTypeAssistant,
+				Content: types.Text(setupProgress.String()),
+			},
+		})
+	})
+
+	cmd, stop, err := e.newCommand(setupCtx, extraEnv, tool, input)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 	defer stop()
 
-	e.Progress <- types.CompletionStatus{
+	e.progress(types.CompletionStatus{
 		CompletionID: id,
 		Request: map[string]any{
 			"command": cmd.Args,
 			"input":   input,
 		},
-	}
+	})
 
 	output := &bytes.Buffer{}
 	all := &bytes.Buffer{}
 	cmd.Stdin = os.Stdin
 	cmd.Stderr = io.MultiWriter(all, os.Stderr)
-	cmd.Stdout = io.MultiWriter(all, output)
+	if e.StreamOutput && e.Progress != nil {
+		cmd.Stdout = io.MultiWriter(all, output, &lineStreamer{
+			ctx:      ctx.Ctx,
+			id:       id,
+			progress: e.Progress,
+			output:   output,
+		})
+	} else {
+		cmd.Stdout = io.MultiWriter(all, output)
+	}
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		// A tool reading from the terminal has to stay in its process group, so only the tool itself is killed on cancel
+		cmd.WaitDelay = 10 * time.Second
+	} else {
+		debugcmd.KillTreeOnCancel(cmd)
+	}
 
-	if err := cmd.Run(); err != nil {
+	err = cmd.Run()
+	if cmd.ProcessState != nil {
+		code := cmd.ProcessState.ExitCode()
+		exitCode = &code
+	}
+	if err != nil {
+		err = e.limitError(ctx.Ctx, tool, err)
+		if len(tool.Credentials) > 0 && exitCode != nil && *exitCode == UnauthorizedExitCode {
+			return "", exitCode, &CommandUnauthorizedError{
+				Tool:   tool.Parameters.Name,
+				Output: all.String(),
+				Err:    err,
+			}
+		}
 		if toolCategory == NoCategory {
-			return fmt.Sprintf("ERROR: got (%v) while running tool, OUTPUT: %s", err, all), nil
+			return fmt.Sprintf("ERROR: got (%v) while running tool, OUTPUT: %s", err, all), exitCode, nil
 		}
 		_, _ = os.Stderr.Write(output.Bytes())
 		log.Errorf("failed to run tool [%s] cmd %v: %v", tool.Parameters.Name, cmd.Args, err)
-		return "", fmt.Errorf("ERROR: %s: %w", all, err)
+		return "", exitCode, fmt.Errorf("ERROR: %s: %w", all, err)
 	}
 
-	return output.String(), nil
+	return output.String(), exitCode, nil
+}
+
+// toolEnv returns the env of the tool, including its credentials.
+func (e *Engine) toolEnv() []string {
+	return slices.Concat(e.Env, e.CredentialEnv)
 }
 
 func (e *Engine) getRuntimeEnv(ctx context.Context, tool types.Tool, cmd, env []string) ([]string, error) {
@@ -162,7 +237,8 @@ func appendInputAsEnv(env []string, input string) []string {
 }
 
 func (e *Engine) newCommand(ctx context.Context, extraEnv []string, tool types.Tool, input string) (*exec.Cmd, func(), error) {
-	envvars := append(e.Env[:], extraEnv...)
+	// Parallel calls share e.Env, so it must be copied before anything is appended to it
+	envvars := slices.Concat(e.Env, extraEnv)
 	envvars = appendInputAsEnv(envvars, input)
 	if log.IsDebug() {
 		envvars = append(envvars, "GPTSCRIPT_DEBUG=true")
@@ -180,12 +256,14 @@ func (e *Engine) newCommand(ctx context.Context, extraEnv []string, tool types.T
 	if err != nil {
 		return nil, nil, err
 	}
+	// Credentials are added last, so they can't be replaced by inputs of the tool
+	envvars = append(envvars, e.CredentialEnv...)
 
 	envvars, envMap := envAsMapAndDeDup(envvars)
 	for i, arg := range args {
-		args[i] = os.Expand(arg, func(s string) string {
-			return envMap[s]
-		})
+		if args[i], err = env.Expand(arg, env.LookupMap(envMap)); err != nil {
+			return nil, nil, fmt.Errorf("invalid command of tool %s: %w", tool.Name, err)
+		}
 	}
 
 	if runtime.GOOS == "windows" && (args[0] == "/usr/bin/env" || args[0] == "/bin/env") {
@@ -194,6 +272,7 @@ func (e *Engine) newCommand(ctx context.Context, extraEnv []string, tool types.T
 
 	var (
 		cmdArgs = args[1:]
+		script  string
 		stop    = func() {}
 	)
 
@@ -212,7 +291,21 @@ func (e *Engine) newCommand(ctx context.Context, extraEnv []string, tool types.T
 			stop()
 			return nil, nil, err
 		}
-		cmdArgs = append(cmdArgs, f.Name())
+		script = f.Name()
+		cmdArgs = append(cmdArgs, script)
+	}
+
+	if e.Sandbox != nil {
+		var mounts []string
+		if script != "" {
+			mounts = append(mounts, script)
+		}
+		cmd, stopSandbox := e.Sandbox.sandboxCommand(ctx, append([]string{args[0]}, cmdArgs...), sandboxEnv(e.Env, extraEnv, e.CredentialEnv, envMap, input),
+			envMap["GPTSCRIPT_TOOL_DIR"], envMap["GPTSCRIPT_WORKSPACE_DIR"], mounts)
+		return cmd, func() {
+			stopSandbox()
+			stop()
+		}, nil
 	}
 
 	// This is a workaround for Windows, where the command interpreter is constructed with unix style paths
@@ -228,5 +321,71 @@ func (e *Engine) newCommand(ctx context.Context, extraEnv []string, tool types.T
 
 	cmd := exec.CommandContext(ctx, env.Lookup(envvars, args[0]), cmdArgs...)
 	cmd.Env = envvars
+	if e.Landlock {
+		if err := e.landlockCommand(cmd, tool, envMap); err != nil {
+			stop()
+			return nil, nil, err
+		}
+	}
+	// Limits are set last, so that their wrapper runs gptscript before landlock restricts what can be executed
+	if err := e.limitCommand(cmd, tool); err != nil {
+		stop()
+		return nil, nil, err
+	}
 	return cmd, stop, nil
 }
+
+// sandboxEnv returns the environment of a tool in the sandbox: what gptscript sets for the tool, but not the environment
+// of the host or of the runtime of the tool.
+func sandboxEnv(hostEnv, extraEnv, credentialEnv []string, envMap map[string]string, input string) []string {
+	env := slices.Clone(extraEnv)
+	for _, kv := range hostEnv {
+		if strings.HasPrefix(kv, "GPTSCRIPT_WORKSPACE_") {
+			env = append(env, kv)
+		}
+	}
+	env = appendInputAsEnv(env, input)
+	env = append(env, "GPTSCRIPT_TOOL_DIR="+envMap["GPTSCRIPT_TOOL_DIR"])
+	if log.IsDebug() {
+		env = append(env, "GPTSCRIPT_DEBUG=true")
+	}
+	env, _ = envAsMapAndDeDup(append(env, credentialEnv...))
+	return env
+}
+
+// progress sends status to the Progress of the engine, if it has one.
+func (e *Engine) progress(status types.CompletionStatus) {
+	if e.Progress != nil {
+		e.Progress <- status
+	}
+}
+
+// lineStreamer reports the output of a command as partial output of its call each time the command finishes a line. It
+// has to be written to after output, which holds all that the command wrote so far. Sending blocks until the progress
+// is taken, which holds back a command that writes faster than its output can be delivered.
+type lineStreamer struct {
+	ctx      context.Context
+	id       string
+	progress chan<- types.CompletionStatus
+	output   *bytes.Buffer
+}
+
+func (l *lineStreamer) Write(p []byte) (int, error) {
+	if bytes.IndexByte(p, '\n') == -1 {
+		return len(p), nil
+	}
+
+	content := l.output.Bytes()
+	content = content[:bytes.LastIndexByte(content, '\n')+1]
+	select {
+	case l.progress <- types.CompletionStatus{
+		CompletionID: l.id,
+		PartialResponse: &types.CompletionMessage{
+			Role:    types.CompletionMessageRoleTypeAssistant,
+			Content: types.Text(string(content)),
+		},
+	}:
+	case <-l.ctx.Done():
+	}
+	return len(p), nil
+}
@@ -0,0 +1,130 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gptscript-ai/gptscript/pkg/rlimit"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLineStreamer(t *testing.T) {
+	progress := make(chan types.CompletionStatus, 10)
+	output := &bytes.Buffer{}
+	w := io.MultiWriter(output, &lineStreamer{
+		ctx:      context.Background(),
+		id:       "1",
+		progress: progress,
+		output:   output,
+	})
+
+	for _, write := range []string{"one", "\ntwo\nthr", "ee", "\n"} {
+		_, err := w.Write([]byte(write))
+		require.NoError(t, err)
+	}
+	close(progress)
+
+	var partials []string
+	for status := range progress {
+		require.Equal(t, "1", status.CompletionID)
+		partials = append(partials, status.PartialResponse.String())
+	}
+	require.Equal(t, []string{"one\ntwo\n", "one\ntwo\nthree\n"}, partials)
+}
+
+func TestLineStreamerCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	output := bytes.NewBufferString("line\n")
+	// Nothing takes from progress, so only the canceled context keeps Write from blocking
+	n, err := (&lineStreamer{
+		ctx:      ctx,
+		progress: make(chan types.CompletionStatus),
+		output:   output,
+	}).Write([]byte("line\n"))
+	require.NoError(t, err)
+	require.Equal(t, 5, n)
+}
+
+func TestRunCommandWithoutProgress(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Without a Progress channel the output is not streamed, and nothing waits for it to be taken
+	e := &Engine{StreamOutput: true}
+	out, _, err := e.runCommand(Context{Ctx: ctx}, types.Tool{
+		ToolDef: types.ToolDef{Instructions: "#!/bin/sh\necho one\necho two"},
+	}, "", NoCategory)
+	require.NoError(t, err)
+	assert.Equal(t, "one\ntwo\n", out)
+}
+
+func TestSandboxCommand(t *testing.T) {
+	e := &Engine{
+		Env:           []string{"HOST_SECRET=host", "GPTSCRIPT_WORKSPACE_DIR=/workspace"},
+		CredentialEnv: []string{"TOKEN=token"},
+		Sandbox:       &SandboxOptions{Runtime: "podman", Image: "python:3-slim"},
+	}
+	tool := types.Tool{
+		ToolDef: types.ToolDef{
+			Instructions: "#!/usr/bin/env python3 ${GPTSCRIPT_TOOL_DIR}/main.py\n",
+		},
+		WorkingDir: "/tools/example",
+	}
+
+	cmd, stop, err := e.newCommand(context.Background(), []string{"GPTSCRIPT_CONTEXT="}, tool, `{"name":"value"}`)
+	require.NoError(t, err)
+	defer stop()
+
+	require.Equal(t, "podman", cmd.Args[0])
+	args := strings.Join(cmd.Args, " ")
+	require.Contains(t, args, "--read-only")
+	require.Contains(t, args, "--network none")
+	require.Contains(t, args, "--mount type=bind,src=/tools/example,dst=/tools/example,readonly -w /tools/example")
+	require.Contains(t, args, "--mount type=bind,src=/workspace,dst=/workspace ")
+	require.Contains(t, args, "-e TOKEN")
+	require.Contains(t, args, "-e name")
+	require.NotContains(t, args, "HOST_SECRET")
+	require.NotContains(t, args, "token", "values are not in the arguments")
+	require.True(t, strings.HasSuffix(args, "python:3-slim /usr/bin/env python3 /tools/example/main.py"))
+	require.Contains(t, cmd.Env, "TOKEN=token")
+}
+
+func TestBindMount(t *testing.T) {
+	assert.Equal(t, `type=bind,src=C:\tools\example,dst=C:\tools\example,readonly`, bindMount(`C:\tools\example`, true))
+	assert.Equal(t, `type=bind,"src=/work,space","dst=/work,space"`, bindMount("/work,space", false))
+}
+
+func TestToolLimits(t *testing.T) {
+	e := &Engine{
+		ToolLimits: rlimit.Limits{Memory: 1 << 30, CPUTime: time.Minute},
+	}
+
+	limits, err := e.toolLimits(types.Tool{})
+	require.NoError(t, err)
+	assert.Equal(t, e.ToolLimits, limits)
+
+	limits, err = e.toolLimits(types.Tool{ToolDef: types.ToolDef{Parameters: types.Parameters{MaxMemory: "256MB", MaxCPUTime: "0"}}})
+	require.NoError(t, err)
+	assert.Equal(t, rlimit.Limits{Memory: 256 << 20}, limits)
+
+	limits, err = e.toolLimits(types.Tool{ToolDef: types.ToolDef{Instructions: "#!sys.daemon /usr/bin/server"}})
+	require.NoError(t, err)
+	assert.Equal(t, rlimit.Limits{Memory: 1 << 30}, limits)
+
+	err = e.limitError(context.Background(), types.Tool{}, errors.New("failed"))
+	assert.EqualError(t, err, "failed")
+}
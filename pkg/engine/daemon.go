@@ -4,13 +4,18 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"maps"
 	"math/rand"
 	"net/http"
 	"os"
+	"os/exec"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/google/shlex"
+	"github.com/gptscript-ai/gptscript/pkg/daemon"
+	"github.com/gptscript-ai/gptscript/pkg/env"
 	"github.com/gptscript-ai/gptscript/pkg/system"
 	"github.com/gptscript-ai/gptscript/pkg/types"
 )
@@ -18,14 +23,54 @@ import (
 var ports Ports
 
 type Ports struct {
-	daemonPorts map[string]int64
-	daemonLock  sync.Mutex
+	daemons    map[string]*daemonProcess
+	daemonLock sync.Mutex
 
 	startPort, endPort int64
 	usedPorts          map[int64]struct{}
 	daemonCtx          context.Context
 	daemonClose        func()
 	daemonWG           sync.WaitGroup
+
+	gracePeriod time.Duration
+	// closing is set while the daemons are stopped, so that no more calls are made to them
+	closing bool
+	// calls are the calls to daemons in flight, which are finished before the daemons are stopped
+	calls sync.WaitGroup
+
+	listenersLock sync.Mutex
+	listeners     map[int]func(DaemonEvent)
+	nextListener  int
+}
+
+type daemonProcess struct {
+	port     int64
+	toolName string
+	// ready is closed once the daemon passed its readiness probe, or failed it with err
+	ready chan struct{}
+	err   error
+}
+
+type DaemonEventType string
+
+const (
+	// DaemonStarted is emitted once a daemon passed its readiness probe.
+	DaemonStarted DaemonEventType = "daemonStarted"
+	// DaemonStopping is emitted when a daemon is asked to stop.
+	DaemonStopping DaemonEventType = "daemonStopping"
+	// DaemonStopped is emitted when the process of a daemon exited, with the error it exited with.
+	DaemonStopped DaemonEventType = "daemonStopped"
+)
+
+type DaemonEvent struct {
+	Time     time.Time       `json:"time"`
+	Type     DaemonEventType `json:"type"`
+	ToolID   string          `json:"toolID"`
+	ToolName string          `json:"toolName,omitempty"`
+	Port     int64           `json:"port"`
+	Err      error           `json:"-"`
+	// Error is the message of Err, for the events of runs
+	Error string `json:"error,omitempty"`
 }
 
 func SetPorts(start, end int64) {
@@ -37,14 +82,92 @@ func SetPorts(start, end int64) {
 	}
 }
 
+// SetDaemonGracePeriod sets how long daemons have to exit after they are asked to stop, before they are killed.
+func SetDaemonGracePeriod(gracePeriod time.Duration) {
+	ports.daemonLock.Lock()
+	defer ports.daemonLock.Unlock()
+	ports.gracePeriod = gracePeriod
+}
+
+func daemonGracePeriod() time.Duration {
+	if ports.gracePeriod > 0 {
+		return ports.gracePeriod
+	}
+	return defaultDaemonGracePeriod
+}
+
+// AddDaemonListener calls listener with the lifecycle events of daemons until the returned function is called. It is
+// called synchronously, so it must not block. Runs add a listener to send the events of the daemons of their tools to
+// their monitor.
+func AddDaemonListener(listener func(DaemonEvent)) (remove func()) {
+	ports.listenersLock.Lock()
+	defer ports.listenersLock.Unlock()
+	if ports.listeners == nil {
+		ports.listeners = map[int]func(DaemonEvent){}
+	}
+	id := ports.nextListener
+	ports.nextListener++
+	ports.listeners[id] = listener
+
+	return func() {
+		ports.listenersLock.Lock()
+		defer ports.listenersLock.Unlock()
+		delete(ports.listeners, id)
+	}
+}
+
+func emitDaemonEvent(event DaemonEvent) {
+	event.Time = time.Now()
+	if event.Err != nil {
+		event.Error = event.Err.Error()
+	}
+	ports.listenersLock.Lock()
+	defer ports.listenersLock.Unlock()
+	for _, listener := range ports.listeners {
+		listener(event)
+	}
+}
+
+// CloseDaemons stops all daemons, in order: no more calls are made to them, the calls in flight are given the grace
+// period to finish, then each daemon is asked to stop and killed if it does not exit within the grace period.
 func CloseDaemons() {
 	ports.daemonLock.Lock()
 	if ports.daemonCtx == nil {
 		ports.daemonLock.Unlock()
 		return
 	}
+	ports.closing = true
+	gracePeriod := daemonGracePeriod()
+	running := maps.Clone(ports.daemons)
 	ports.daemonLock.Unlock()
 
+	defer func() {
+		ports.daemonLock.Lock()
+		defer ports.daemonLock.Unlock()
+		ports.closing = false
+	}()
+
+	calls := make(chan struct{})
+	go func() {
+		ports.calls.Wait()
+		close(calls)
+	}()
+	select {
+	case <-calls:
+	case <-time.After(gracePeriod):
+		log.Infof("calls to daemons did not finish within %s, stopping the daemons anyway", gracePeriod)
+	}
+
+	for toolID, d := range running {
+		log.Infof("stopping daemon [%s][%s] port [%d]", d.toolName, toolID, d.port)
+		emitDaemonEvent(DaemonEvent{
+			Type:     DaemonStopping,
+			ToolID:   toolID,
+			ToolName: d.toolName,
+			Port:     d.port,
+		})
+	}
+
 	ports.daemonClose()
 	ports.daemonWG.Wait()
 }
@@ -79,41 +202,142 @@ func nextPort() int64 {
 	panic("Ran out of usable ports")
 }
 
-func getPath(instructions string) (string, string) {
+const (
+	defaultReadyTimeout      = 2 * time.Minute
+	maxProbeInterval         = 2 * time.Second
+	defaultDaemonGracePeriod = 10 * time.Second
+)
+
+// daemonOptions are the options of a daemon tool, given in parentheses before its command, like
+// #!sys.daemon (path=/api, ready=/healthz, readyTimeout=30s) command.
+type daemonOptions struct {
+	// path is the path of the URL that calls of the tool are made to.
+	path string
+	// ready is the path of the URL that must respond with 200 before the daemon is used, path by default.
+	ready string
+	// readyCommand is run instead of requesting ready until it exits with 0, if it is set.
+	readyCommand []string
+	// readyTimeout is how long the daemon has to become ready.
+	readyTimeout time.Duration
+}
+
+// DaemonNotReadyError is returned when the readiness probe of a daemon did not pass before its timeout.
+type DaemonNotReadyError struct {
+	Tool    string
+	Probe   string
+	Timeout time.Duration
+	Err     error
+}
+
+func (e *DaemonNotReadyError) Error() string {
+	return fmt.Sprintf("daemon %s was not ready after %s, the last readiness probe %s failed: %v", e.Tool, e.Timeout, e.Probe, e.Err)
+}
+
+func (e *DaemonNotReadyError) Unwrap() error {
+	return e.Err
+}
+
+func getDaemonOptions(instructions string) (string, daemonOptions, error) {
 	instructions = strings.TrimSpace(instructions)
-	line := strings.TrimSpace(instructions)
+	opts := daemonOptions{
+		readyTimeout: defaultReadyTimeout,
+	}
 
-	if !strings.HasPrefix(line, "(") {
-		return instructions, ""
+	if !strings.HasPrefix(instructions, "(") {
+		return instructions, opts, nil
 	}
 
-	line, rest, ok := strings.Cut(line[1:], ")")
+	line, rest, ok := strings.Cut(instructions[1:], ")")
 	if !ok {
-		return instructions, ""
+		return instructions, opts, nil
 	}
 
-	path, value, ok := strings.Cut(strings.TrimSpace(line), "=")
-	if !ok || strings.TrimSpace(path) != "path" {
-		return instructions, ""
+	for _, option := range strings.Split(line, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(option), "=")
+		if !ok {
+			return "", opts, fmt.Errorf("invalid daemon option %q, must be key=value", option)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch key {
+		case "path":
+			opts.path = value
+		case "ready":
+			opts.ready = value
+		case "readyCommand":
+			args, err := shlex.Split(value)
+			if err != nil || len(args) == 0 {
+				return "", opts, fmt.Errorf("invalid daemon readyCommand %q", value)
+			}
+			opts.readyCommand = args
+		case "readyTimeout":
+			timeout, err := time.ParseDuration(value)
+			if err != nil || timeout <= 0 {
+				return "", opts, fmt.Errorf("invalid daemon readyTimeout %q", value)
+			}
+			opts.readyTimeout = timeout
+		default:
+			return "", opts, fmt.Errorf("unknown daemon option %q, must be path, ready, readyCommand or readyTimeout", key)
+		}
 	}
 
-	return strings.TrimSpace(rest), strings.TrimSpace(value)
-}
+	if opts.ready == "" {
+		opts.ready = opts.path
+	}
 
-func (e *Engine) startDaemon(tool types.Tool) (string, error) {
-	ports.daemonLock.Lock()
-	defer ports.daemonLock.Unlock()
+	return strings.TrimSpace(rest), opts, nil
+}
 
+// startDaemon returns the URL of the daemon of the tool, which is started if it is not running, and a function to call
+// when the call to the daemon is done.
+func (e *Engine) startDaemon(tool types.Tool) (string, func(), error) {
 	instructions := strings.TrimPrefix(tool.Instructions, types.DaemonPrefix)
-	instructions, path := getPath(instructions)
+	instructions, opts, err := getDaemonOptions(instructions)
+	if err != nil {
+		return "", nil, err
+	}
 	tool.Instructions = types.CommandPrefix + instructions
 
-	port, ok := ports.daemonPorts[tool.ID]
-	url := fmt.Sprintf("http://127.0.0.1:%d%s", port, path)
-	if ok {
-		return url, nil
+	ports.daemonLock.Lock()
+	if ports.closing {
+		ports.daemonLock.Unlock()
+		return "", nil, fmt.Errorf("daemon [%s] can't be called, daemons are being stopped", tool.Parameters.Name)
 	}
 
+	if d, ok := ports.daemons[tool.ID]; ok {
+		ports.daemonLock.Unlock()
+		return d.call(tool, opts)
+	}
+
+	d, err := e.launchDaemon(tool, opts)
+	ports.daemonLock.Unlock()
+	if err != nil {
+		return "", nil, err
+	}
+	return d.call(tool, opts)
+}
+
+// call waits for the daemon to be ready and returns its URL and the func that ends the call, for which the daemon is
+// not stopped until it ends.
+func (d *daemonProcess) call(tool types.Tool, opts daemonOptions) (string, func(), error) {
+	url := fmt.Sprintf("http://127.0.0.1:%d%s", d.port, opts.path)
+	<-d.ready
+	if d.err != nil {
+		return url, nil, d.err
+	}
+
+	ports.daemonLock.Lock()
+	defer ports.daemonLock.Unlock()
+	if ports.closing {
+		return "", nil, fmt.Errorf("daemon [%s] can't be called, daemons are being stopped", tool.Parameters.Name)
+	}
+	ports.calls.Add(1)
+	return url, ports.calls.Done, nil
+}
+
+// launchDaemon starts the daemon of tool and adds it to the daemons. It must be called with ports.daemonLock held,
+// which the readiness probe of the daemon runs without, in the background. A daemon that fails its probe is removed
+// from the daemons and stopped.
+func (e *Engine) launchDaemon(tool types.Tool, opts daemonOptions) (*daemonProcess, error) {
 	if ports.daemonCtx == nil {
 		var cancel func()
 		ports.daemonCtx, cancel = context.WithCancel(context.Background())
@@ -124,23 +348,25 @@ func (e *Engine) startDaemon(tool types.Tool) (string, error) {
 	}
 
 	ctx := ports.daemonCtx
-	port = nextPort()
-	url = fmt.Sprintf("http://127.0.0.1:%d%s", port, path)
+	port := nextPort()
+	gracePeriod := daemonGracePeriod()
 
 	cmd, stop, err := e.newCommand(ctx, []string{
 		fmt.Sprintf("PORT=%d", port),
 		fmt.Sprintf("GPTSCRIPT_PORT=%d", port),
+		fmt.Sprintf("%s=%s", daemon.GracePeriodEnvVar, gracePeriod),
 	},
 		tool,
 		"{}",
 	)
 	if err != nil {
-		return url, err
+		return nil, err
 	}
 
 	r, w, err := os.Pipe()
 	if err != nil {
-		return "", err
+		stop()
+		return nil, err
 	}
 
 	// Loop back to gptscript to help with process supervision
@@ -150,24 +376,33 @@ func (e *Engine) startDaemon(tool types.Tool) (string, error) {
 	cmd.Stdin = r
 	cmd.Stderr = os.Stderr
 	cmd.Stdout = os.Stdout
+	// Closing stdin asks sys.daemon to stop the daemon, which it kills after the grace period. It is only killed here
+	// if sys.daemon itself does not exit by then.
 	cmd.Cancel = func() error {
 		_ = r.Close()
 		return w.Close()
 	}
+	cmd.WaitDelay = gracePeriod + 5*time.Second
 
 	log.Infof("launched [%s][%s] port [%d] %v", tool.Parameters.Name, tool.ID, port, cmd.Args)
 	if err := cmd.Start(); err != nil {
+		_ = r.Close()
+		_ = w.Close()
 		stop()
-		return url, err
+		return nil, err
 	}
 
-	if ports.daemonPorts == nil {
-		ports.daemonPorts = map[string]int64{}
+	d := &daemonProcess{
+		port:     port,
+		toolName: tool.Parameters.Name,
+		ready:    make(chan struct{}),
 	}
-	ports.daemonPorts[tool.ID] = port
+	if ports.daemons == nil {
+		ports.daemons = map[string]*daemonProcess{}
+	}
+	ports.daemons[tool.ID] = d
 
 	killedCtx, cancel := context.WithCancelCause(ctx)
-	defer cancel(nil)
 
 	ports.daemonWG.Add(1)
 	go func() {
@@ -180,37 +415,160 @@ func (e *Engine) startDaemon(tool types.Tool) (string, error) {
 
 		cancel(err)
 		stop()
-		ports.daemonLock.Lock()
-		defer ports.daemonLock.Unlock()
-
-		delete(ports.daemonPorts, tool.ID)
+		d.remove(tool.ID)
+
+		log.Infof("stopped daemon [%s][%s] port [%d]", tool.Parameters.Name, tool.ID, port)
+		emitDaemonEvent(DaemonEvent{
+			Type:     DaemonStopped,
+			ToolID:   tool.ID,
+			ToolName: tool.Parameters.Name,
+			Port:     port,
+			Err:      err,
+		})
 		ports.daemonWG.Done()
 	}()
 
-	for i := 0; i < 120; i++ {
-		resp, err := http.Get(url)
-		if err == nil && resp.StatusCode == http.StatusOK {
-			go func() {
-				_, _ = io.ReadAll(resp.Body)
-				_ = resp.Body.Close()
-			}()
-			return url, nil
+	probe := &readinessProbe{
+		url: fmt.Sprintf("http://127.0.0.1:%d%s", port, opts.ready),
+	}
+	if len(opts.readyCommand) > 0 {
+		probe.cmd = opts.readyCommand
+		probe.env = cmd.Env
+		probe.dir = cmd.Dir
+	}
+
+	go func() {
+		defer cancel(nil)
+		defer close(d.ready)
+
+		if err := probe.wait(killedCtx, tool.Parameters.Name, opts.readyTimeout); err != nil {
+			if killedCtx.Err() != nil {
+				err = fmt.Errorf("daemon failed to start: %w", context.Cause(killedCtx))
+			}
+			d.err = err
+			// No more calls are made to a daemon that isn't ready, and it is stopped like when gptscript exits
+			d.remove(tool.ID)
+			_ = w.Close()
+			return
 		}
+
+		emitDaemonEvent(DaemonEvent{
+			Type:     DaemonStarted,
+			ToolID:   tool.ID,
+			ToolName: tool.Parameters.Name,
+			Port:     port,
+		})
+	}()
+
+	return d, nil
+}
+
+// remove removes the daemon from the daemons, unless another daemon of the tool was started since.
+func (d *daemonProcess) remove(toolID string) {
+	ports.daemonLock.Lock()
+	defer ports.daemonLock.Unlock()
+	if ports.daemons[toolID] == d {
+		delete(ports.daemons, toolID)
+	}
+}
+
+// readinessProbe checks that a daemon is ready, by running cmd until it exits with 0 if it is set, or by requesting
+// url until it responds with 200.
+type readinessProbe struct {
+	url string
+	cmd []string
+	env []string
+	dir string
+}
+
+func (p *readinessProbe) String() string {
+	if len(p.cmd) > 0 {
+		return strings.Join(p.cmd, " ")
+	}
+	return "GET " + p.url
+}
+
+// wait runs the probe with exponential backoff, from 100ms up to maxProbeInterval between attempts, until it passes,
+// ctx is done or timeout passes.
+func (p *readinessProbe) wait(ctx context.Context, toolName string, timeout time.Duration) error {
+	var (
+		deadline = time.Now().Add(timeout)
+		interval = 100 * time.Millisecond
+		lastErr  error
+	)
+
+	for {
+		if lastErr = p.check(ctx); lastErr == nil {
+			return nil
+		}
+		log.Debugf("daemon [%s] is not ready, readiness probe %s failed: %v", toolName, p, lastErr)
+
+		wait := min(interval, time.Until(deadline))
+		if wait <= 0 {
+			return &DaemonNotReadyError{
+				Tool:    toolName,
+				Probe:   p.String(),
+				Timeout: timeout,
+				Err:     lastErr,
+			}
+		}
+
 		select {
-		case <-killedCtx.Done():
-			return url, fmt.Errorf("daemon failed to start: %w", context.Cause(killedCtx))
-		case <-time.After(time.Second):
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		interval = min(interval*2, maxProbeInterval)
+	}
+}
+
+func (p *readinessProbe) check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, maxProbeInterval+3*time.Second)
+	defer cancel()
+
+	if len(p.cmd) > 0 {
+		// The command is not run by a shell, so variables like ${PORT} are expanded with the env of the daemon
+		args := make([]string, len(p.cmd))
+		for i, arg := range p.cmd {
+			var err error
+			if args[i], err = env.Expand(arg, env.LookupEnv(p.env)); err != nil {
+				return err
+			}
+		}
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Env = p.env
+		cmd.Dir = p.dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			if len(out) > 0 {
+				return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+			}
+			return err
 		}
+		return nil
 	}
 
-	return url, fmt.Errorf("timeout waiting for 200 response from GET %s", url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("expected status 200, got %s", resp.Status)
+	}
+	return nil
 }
 
 func (e *Engine) runDaemon(ctx context.Context, prg *types.Program, tool types.Tool, input string) (cmdRet *Return, cmdErr error) {
-	url, err := e.startDaemon(tool)
+	url, done, err := e.startDaemon(tool)
 	if err != nil {
 		return nil, err
 	}
+	defer done()
 
 	tool.Instructions = strings.Join(append([]string{
 		types.CommandPrefix + url,
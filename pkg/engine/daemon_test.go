@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetDaemonOptions(t *testing.T) {
+	rest, opts, err := getDaemonOptions("(path=/api) ./daemon")
+	require.NoError(t, err)
+	assert.Equal(t, "./daemon", rest)
+	assert.Equal(t, daemonOptions{path: "/api", ready: "/api", readyTimeout: defaultReadyTimeout}, opts)
+
+	rest, opts, err = getDaemonOptions(`(path=/api, ready=/healthz, readyTimeout=30s, readyCommand=curl -f "http://localhost:${PORT}/ready") ./daemon --flag`)
+	require.NoError(t, err)
+	assert.Equal(t, "./daemon --flag", rest)
+	assert.Equal(t, daemonOptions{
+		path:         "/api",
+		ready:        "/healthz",
+		readyCommand: []string{"curl", "-f", "http://localhost:${PORT}/ready"},
+		readyTimeout: 30 * time.Second,
+	}, opts)
+
+	rest, opts, err = getDaemonOptions("./daemon")
+	require.NoError(t, err)
+	assert.Equal(t, "./daemon", rest)
+	assert.Equal(t, daemonOptions{readyTimeout: defaultReadyTimeout}, opts)
+
+	for _, invalid := range []string{"(path) ./daemon", "(readyTimeout=soon) ./daemon", "(port=8080) ./daemon"} {
+		_, _, err := getDaemonOptions(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestReadinessProbe(t *testing.T) {
+	var requests int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/healthz" || requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer s.Close()
+
+	probe := &readinessProbe{url: s.URL + "/healthz"}
+	require.NoError(t, probe.wait(context.Background(), "test", 10*time.Second))
+	assert.Equal(t, 3, requests)
+
+	probe = &readinessProbe{url: s.URL + "/other"}
+	err := probe.wait(context.Background(), "test", 300*time.Millisecond)
+	var notReady *DaemonNotReadyError
+	require.ErrorAs(t, err, &notReady)
+	assert.Equal(t, "GET "+s.URL+"/other", notReady.Probe)
+	assert.ErrorContains(t, err, "expected status 200, got 503 Service Unavailable")
+}
+
+func TestReadinessProbeCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+
+	probe := &readinessProbe{cmd: []string{"sh", "-c", "echo not ready; exit 1"}}
+	err := probe.wait(context.Background(), "test", 200*time.Millisecond)
+	var notReady *DaemonNotReadyError
+	require.ErrorAs(t, err, &notReady)
+	assert.ErrorContains(t, err, "not ready")
+
+	probe = &readinessProbe{cmd: []string{"test", "${PORT}", "=", "8080"}, env: []string{"PORT=80", "PORT=8080"}}
+	require.NoError(t, probe.wait(context.Background(), "test", time.Second))
+}
+
+func TestStartDaemonWhileClosing(t *testing.T) {
+	ports.daemonLock.Lock()
+	ports.closing = true
+	ports.daemonLock.Unlock()
+	defer func() {
+		ports.daemonLock.Lock()
+		ports.closing = false
+		ports.daemonLock.Unlock()
+	}()
+
+	tool := types.Tool{ToolDef: types.ToolDef{Parameters: types.Parameters{Name: "search"}, Instructions: types.DaemonPrefix + " ./daemon"}}
+	_, _, err := (&Engine{}).startDaemon(tool)
+	assert.ErrorContains(t, err, "daemons are being stopped")
+}
+
+func TestDaemonListener(t *testing.T) {
+	var events []DaemonEvent
+	remove := AddDaemonListener(func(event DaemonEvent) {
+		events = append(events, event)
+	})
+
+	emitDaemonEvent(DaemonEvent{Type: DaemonStopped, ToolID: "tool", Port: 10240})
+	remove()
+	emitDaemonEvent(DaemonEvent{Type: DaemonStopped, ToolID: "tool", Port: 10240})
+
+	require.Len(t, events, 1)
+	assert.Equal(t, DaemonStopped, events[0].Type)
+	assert.False(t, events[0].Time.IsZero())
+}
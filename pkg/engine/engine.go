@@ -8,6 +8,7 @@ import (
 	"sync"
 
 	"github.com/gptscript-ai/gptscript/pkg/counter"
+	"github.com/gptscript-ai/gptscript/pkg/rlimit"
 	"github.com/gptscript-ai/gptscript/pkg/system"
 	"github.com/gptscript-ai/gptscript/pkg/types"
 	"github.com/gptscript-ai/gptscript/pkg/version"
@@ -25,7 +26,26 @@ type Engine struct {
 	Model          Model
 	RuntimeManager RuntimeManager
 	Env            []string
-	Progress       chan<- types.CompletionStatus
+	// CredentialEnv is the env of the credentials of the tool. Unlike Env, it is not given to the setup of the
+	// runtime of the tool.
+	CredentialEnv []string
+	Progress      chan<- types.CompletionStatus
+	// StreamOutput reports the stdout of command tools as partial output of their call as each line is written,
+	// instead of only once the command exits.
+	StreamOutput bool
+	// Sandbox runs command tools in a container, if set.
+	Sandbox *SandboxOptions
+	// Landlock restricts command tools on Linux to their tool directory, the workspace and the paths they allow.
+	Landlock bool
+	// ToolLimits are the default resource limits of command tools on Linux, which tools change with "Max Memory" and
+	// "Max CPU Time".
+	ToolLimits rlimit.Limits
+	// History shortens the messages sent to the model, if set.
+	History *HistoryOptions
+	// Recording records the responses of the model and the results of command tools, or replays them, if set.
+	Recording *Recording
+	// Audit writes an entry for every command tool and call of the model to an audit log, if set.
+	Audit *AuditLog
 }
 
 type State struct {
@@ -39,6 +59,8 @@ type Return struct {
 	State  *State          `json:"state,omitempty"`
 	Calls  map[string]Call `json:"calls,omitempty"`
 	Result *string         `json:"result,omitempty"`
+	// ExitCode is the exit code of the process of a command tool
+	ExitCode *int `json:"exitCode,omitempty"`
 }
 
 type Call struct {
@@ -75,6 +97,9 @@ type Context struct {
 	Program    *types.Program
 	// Input is saved only so that we can render display text, don't use otherwise
 	Input string
+	// CredentialEnv is the env of the credentials of the tool, which is given to the tools it shares its credentials
+	// with
+	CredentialEnv []string
 }
 
 type ChatHistory struct {
@@ -204,22 +229,18 @@ func (e *Engine) Start(ctx Context, input string) (ret *Return, _ error) {
 	}()
 
 	if tool.IsCommand() {
-		if tool.IsHTTP() {
-			return e.runHTTP(ctx.Ctx, ctx.Program, tool, input)
-		} else if tool.IsDaemon() {
-			return e.runDaemon(ctx.Ctx, ctx.Program, tool, input)
-		} else if tool.IsOpenAPI() {
-			return e.runOpenAPI(tool, input)
-		} else if tool.IsEcho() {
-			return e.runEcho(tool)
+		run := func() (*Return, error) {
+			if e.Recording != nil {
+				return e.Recording.runTool(ctx, tool, input, func() (*Return, error) {
+					return e.runCommandTool(ctx, tool, input)
+				})
+			}
+			return e.runCommandTool(ctx, tool, input)
 		}
-		s, err := e.runCommand(ctx, tool, input, ctx.ToolCategory)
-		if err != nil {
-			return nil, err
+		if e.Audit != nil {
+			return e.Audit.runTool(ctx, input, run)
 		}
-		return &Return{
-			Result: &s,
-		}, nil
+		return run()
 	}
 
 	if ctx.ToolCategory == CredentialToolCategory {
@@ -230,6 +251,7 @@ func (e *Engine) Start(ctx Context, input string) (ret *Return, _ error) {
 		Model:                tool.Parameters.ModelName,
 		MaxTokens:            tool.Parameters.MaxTokens,
 		JSONResponse:         tool.Parameters.JSONResponse,
+		OutputSchema:         tool.Parameters.OutputSchema,
 		Cache:                tool.Parameters.Cache,
 		Temperature:          tool.Parameters.Temperature,
 		InternalSystemPrompt: tool.Parameters.InternalPrompt,
@@ -263,11 +285,37 @@ func (e *Engine) Start(ctx Context, input string) (ret *Return, _ error) {
 		})
 	}
 
-	return e.complete(ctx.Ctx, &State{
+	return e.complete(ctx.WrappedContext(), &State{
 		Completion: completion,
 	})
 }
 
+func (e *Engine) runCommandTool(ctx Context, tool types.Tool, input string) (*Return, error) {
+	if tool.IsHTTP() {
+		return e.runHTTP(ctx.Ctx, ctx.Program, tool, input)
+	} else if tool.IsDaemon() {
+		return e.runDaemon(ctx.Ctx, ctx.Program, tool, input)
+	} else if tool.IsOpenAPI() {
+		return e.runOpenAPI(tool, input)
+	} else if tool.IsEcho() {
+		return e.runEcho(tool)
+	} else if tool.IsOAuthDevice() {
+		return e.runOAuthDevice(ctx, tool)
+	} else if tool.IsMCP() {
+		return e.runMCP(ctx.Ctx, tool, input)
+	} else if tool.IsOpenAPICredential() {
+		return e.runOpenAPICredential(ctx, tool)
+	}
+	s, exitCode, err := e.runCommand(ctx, tool, input, ctx.ToolCategory)
+	if err != nil {
+		return nil, err
+	}
+	return &Return{
+		Result:   &s,
+		ExitCode: exitCode,
+	}, nil
+}
+
 func addUpdateSystem(ctx Context, tool types.Tool, msgs []types.CompletionMessage) []types.CompletionMessage {
 	var instructions []string
 
@@ -296,6 +344,32 @@ func addUpdateSystem(ctx Context, tool types.Tool, msgs []types.CompletionMessag
 }
 
 func (e *Engine) complete(ctx context.Context, state *State) (*Return, error) {
+	for repairs := 0; ; repairs++ {
+		ret, err := e.completeOnce(ctx, state)
+		if err != nil || len(ret.Calls) > 0 || ret.Result == nil || state.Completion.OutputSchema == nil {
+			return ret, err
+		}
+
+		err = validateOutput(state.Completion.OutputSchema, *ret.Result)
+		if err == nil {
+			return ret, nil
+		}
+		if repairs >= maxOutputRepairs {
+			return nil, &OutputSchemaError{
+				Output: *ret.Result,
+				Err:    err,
+			}
+		}
+
+		log.Debugf("response does not match the output schema, asking the model to repair it: %v", err)
+		state.Completion.Messages = append(state.Completion.Messages, types.CompletionMessage{
+			Role:    types.CompletionMessageRoleTypeUser,
+			Content: types.Text(repairPrompt(err)),
+		})
+	}
+}
+
+func (e *Engine) completeOnce(ctx context.Context, state *State) (*Return, error) {
 	var (
 		progress = make(chan types.CompletionStatus)
 		ret      = Return{
@@ -319,7 +393,11 @@ func (e *Engine) complete(ctx context.Context, state *State) (*Return, error) {
 		}
 	}()
 
-	resp, err := e.Model.Call(ctx, state.Completion, progress)
+	if err := e.fitHistory(ctx, state); err != nil {
+		return nil, err
+	}
+
+	resp, err := e.callModel(ctx, state.Completion, progress)
 	if err != nil {
 		return nil, err
 	}
@@ -358,6 +436,22 @@ func (e *Engine) complete(ctx context.Context, state *State) (*Return, error) {
 	return &ret, nil
 }
 
+// callModel calls the model, through the recording if there is one.
+func (e *Engine) callModel(ctx context.Context, req types.CompletionRequest, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	call := func() (*types.CompletionMessage, error) {
+		return traceModel(ctx, req, status, func(ctx context.Context, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+			if e.Recording != nil {
+				return e.Recording.callModel(ctx, e.Model, req, status)
+			}
+			return e.Model.Call(ctx, req, status)
+		})
+	}
+	if e.Audit != nil {
+		return e.Audit.callModel(ctx, req, call)
+	}
+	return call()
+}
+
 func (e *Engine) Continue(ctx Context, state *State, results ...CallResult) (*Return, error) {
 	if state == nil {
 		return nil, fmt.Errorf("invalid continue call, missing state")
@@ -432,5 +526,5 @@ func (e *Engine) Continue(ctx Context, state *State, results ...CallResult) (*Re
 	}
 
 	state.Completion.Messages = addUpdateSystem(ctx, ctx.Tool, state.Completion.Messages)
-	return e.complete(ctx.Ctx, state)
+	return e.complete(ctx.WrappedContext(), state)
 }
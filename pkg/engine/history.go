@@ -0,0 +1,179 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+const (
+	// HistoryDropOldest drops the oldest messages until the history fits HistoryOptions.MaxTokens.
+	HistoryDropOldest = "drop-oldest"
+	// HistoryKeepRecent keeps only the system prompt and the last HistoryOptions.KeepRecent messages, and drops older
+	// messages too if the rest does not fit HistoryOptions.MaxTokens.
+	HistoryKeepRecent = "keep-recent"
+	// HistorySummarize replaces the oldest messages that don't fit HistoryOptions.MaxTokens with a summary of them,
+	// written by HistoryOptions.SummaryModel.
+	HistorySummarize = "summarize"
+)
+
+const summaryPrefix = "Summary of the earlier conversation:\n"
+
+const summaryPrompt = "Summarize the conversation below for yourself, to continue it later without the messages it has. " +
+	"Keep the facts, decisions, results of tool calls and open tasks that later messages could need, and leave out " +
+	"anything else. Respond with only the summary."
+
+// HistoryOptions configures how the messages of a tool's conversation with the model are shortened before each call,
+// so that long conversations keep fitting the context window of the model. The system prompt and the last message are
+// always kept, and a message with tool calls is only kept or dropped together with the results of the calls.
+type HistoryOptions struct {
+	// Strategy is HistoryDropOldest, HistoryKeepRecent or HistorySummarize.
+	Strategy string `json:"strategy,omitempty"`
+	// MaxTokens is the estimated number of tokens the messages may have.
+	MaxTokens int `json:"maxTokens,omitempty"`
+	// KeepRecent is the number of messages HistoryKeepRecent keeps.
+	KeepRecent int `json:"keepRecent,omitempty"`
+	// SummaryModel is the model HistorySummarize asks for summaries, the model of the tool if empty.
+	SummaryModel string `json:"summaryModel,omitempty"`
+}
+
+func (h HistoryOptions) Validate() error {
+	switch h.Strategy {
+	case HistoryDropOldest, HistorySummarize:
+		if h.MaxTokens <= 0 {
+			return fmt.Errorf("history strategy %s needs a token budget", h.Strategy)
+		}
+	case HistoryKeepRecent:
+		if h.KeepRecent <= 0 {
+			return fmt.Errorf("history strategy %s needs a number of messages to keep", h.Strategy)
+		}
+	default:
+		return fmt.Errorf("invalid history strategy %q, must be %s, %s or %s", h.Strategy, HistoryDropOldest, HistoryKeepRecent, HistorySummarize)
+	}
+	return nil
+}
+
+// fitHistory shortens the messages of the state as the history options of the engine say. The messages of the state
+// are replaced, so that what was dropped or summarized once is not sent again in later calls of the conversation.
+func (e *Engine) fitHistory(ctx context.Context, state *State) error {
+	if e.History == nil {
+		return nil
+	}
+
+	var (
+		msgs    = state.Completion.Messages
+		head    []types.CompletionMessage
+		summary string
+	)
+	for len(msgs) > 0 && msgs[0].Role == types.CompletionMessageRoleTypeSystem {
+		if text, ok := strings.CutPrefix(msgs[0].ChatText(), summaryPrefix); ok {
+			summary = text
+		} else {
+			head = append(head, msgs[0])
+		}
+		msgs = msgs[1:]
+	}
+
+	groups := types.GroupMessages(msgs)
+	keep := len(groups)
+
+	if e.History.Strategy == HistoryKeepRecent {
+		for count, i := 0, len(groups)-1; i >= 0; i-- {
+			count += len(groups[i])
+			if count > e.History.KeepRecent && i < len(groups)-1 {
+				break
+			}
+			keep = len(groups) - i
+		}
+	}
+
+	if e.History.MaxTokens > 0 {
+		budget := e.History.MaxTokens - types.EstimateTokens(head...) - types.EstimateTokens(types.CompletionMessage{
+			Content: types.Text(summaryPrefix + summary),
+		})
+		keep = types.FitGroups(groups[len(groups)-keep:], budget)
+	}
+
+	if keep == len(groups) {
+		return nil
+	}
+
+	dropped := groups[:len(groups)-keep]
+	if e.History.Strategy == HistorySummarize {
+		var err error
+		if summary, err = e.summarize(ctx, state.Completion.Model, summary, dropped); err != nil {
+			return fmt.Errorf("failed to summarize the conversation: %w", err)
+		}
+	}
+
+	var result []types.CompletionMessage
+	result = append(result, head...)
+	if summary != "" {
+		result = append(result, types.CompletionMessage{
+			Role:    types.CompletionMessageRoleTypeSystem,
+			Content: types.Text(summaryPrefix + summary),
+		})
+	}
+	for _, group := range groups[len(groups)-keep:] {
+		result = append(result, group...)
+	}
+
+	log.Debugf("shortened the history from %d to %d messages with strategy %s", len(state.Completion.Messages), len(result), e.History.Strategy)
+	state.Completion.Messages = result
+	return nil
+}
+
+// summarize asks the model for a summary of the previous summary and the messages.
+func (e *Engine) summarize(ctx context.Context, model, previous string, groups [][]types.CompletionMessage) (string, error) {
+	var transcript strings.Builder
+	if previous != "" {
+		transcript.WriteString(summaryPrefix + previous + "\n\n")
+	}
+	for _, group := range groups {
+		for _, msg := range group {
+			writeTranscript(&transcript, msg)
+		}
+	}
+
+	progress := make(chan types.CompletionStatus)
+	defer close(progress)
+	go func() {
+		for range progress {
+		}
+	}()
+
+	resp, err := e.callModel(ctx, types.CompletionRequest{
+		Model:                types.FirstSet(e.History.SummaryModel, model),
+		InternalSystemPrompt: new(bool),
+		Messages: []types.CompletionMessage{
+			{
+				Role:    types.CompletionMessageRoleTypeSystem,
+				Content: types.Text(summaryPrompt),
+			},
+			{
+				Role:    types.CompletionMessageRoleTypeUser,
+				Content: types.Text(transcript.String()),
+			},
+		},
+	}, progress)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(resp.ChatText()), nil
+}
+
+func writeTranscript(out *strings.Builder, msg types.CompletionMessage) {
+	if msg.Role == types.CompletionMessageRoleTypeTool && msg.ToolCall != nil {
+		_, _ = fmt.Fprintf(out, "result of %s: %s\n", msg.ToolCall.Function.Name, msg.ChatText())
+		return
+	}
+	for _, part := range msg.Content {
+		if part.ToolCall != nil {
+			_, _ = fmt.Fprintf(out, "%s called %s with %s\n", msg.Role, part.ToolCall.Function.Name, part.ToolCall.Function.Arguments)
+		} else if part.Text != "" {
+			_, _ = fmt.Fprintf(out, "%s: %s\n", msg.Role, part.Text)
+		}
+	}
+}
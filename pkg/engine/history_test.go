@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type summaryModel struct {
+	requests []types.CompletionRequest
+}
+
+func (s *summaryModel) Call(_ context.Context, req types.CompletionRequest, _ chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	s.requests = append(s.requests, req)
+	return &types.CompletionMessage{
+		Role:    types.CompletionMessageRoleTypeAssistant,
+		Content: types.Text("the user is Bob"),
+	}, nil
+}
+
+// testHistory is a conversation of a system prompt, a question, a tool call with its result and a final question.
+func testHistory() []types.CompletionMessage {
+	text := func(role types.CompletionMessageRoleType, text string) types.CompletionMessage {
+		return types.CompletionMessage{Role: role, Content: types.Text(text)}
+	}
+	call := &types.CompletionToolCall{ID: "call_1", Function: types.CompletionFunctionCall{Name: "lookup", Arguments: `{"name": "Bob"}`}}
+	return []types.CompletionMessage{
+		text(types.CompletionMessageRoleTypeSystem, "You are helpful"),
+		text(types.CompletionMessageRoleTypeUser, "I am Bob "+strings.Repeat("and I like long messages ", 20)),
+		{Role: types.CompletionMessageRoleTypeAssistant, Content: []types.ContentPart{{ToolCall: call}}},
+		{Role: types.CompletionMessageRoleTypeTool, ToolCall: call, Content: types.Text("Bob is a user")},
+		text(types.CompletionMessageRoleTypeUser, "Who am I?"),
+	}
+}
+
+func roles(msgs []types.CompletionMessage) (result []types.CompletionMessageRoleType) {
+	for _, msg := range msgs {
+		result = append(result, msg.Role)
+	}
+	return
+}
+
+func TestFitHistory(t *testing.T) {
+	e := &Engine{History: &HistoryOptions{Strategy: HistoryDropOldest, MaxTokens: 1000}}
+	state := &State{Completion: types.CompletionRequest{Messages: testHistory()}}
+	require.NoError(t, e.fitHistory(context.Background(), state))
+	assert.Len(t, state.Completion.Messages, 5)
+
+	// The tool call is dropped together with its result
+	e.History.MaxTokens = 20
+	require.NoError(t, e.fitHistory(context.Background(), state))
+	assert.Equal(t, []types.CompletionMessageRoleType{types.CompletionMessageRoleTypeSystem, types.CompletionMessageRoleTypeUser}, roles(state.Completion.Messages))
+	assert.Equal(t, "Who am I?", state.Completion.Messages[1].ChatText())
+
+	e.History = &HistoryOptions{Strategy: HistoryKeepRecent, KeepRecent: 2}
+	state = &State{Completion: types.CompletionRequest{Messages: testHistory()}}
+	require.NoError(t, e.fitHistory(context.Background(), state))
+	assert.Equal(t, []types.CompletionMessageRoleType{types.CompletionMessageRoleTypeSystem, types.CompletionMessageRoleTypeUser}, roles(state.Completion.Messages))
+
+	e.History.KeepRecent = 3
+	state = &State{Completion: types.CompletionRequest{Messages: testHistory()}}
+	require.NoError(t, e.fitHistory(context.Background(), state))
+	assert.Equal(t, []types.CompletionMessageRoleType{
+		types.CompletionMessageRoleTypeSystem,
+		types.CompletionMessageRoleTypeAssistant,
+		types.CompletionMessageRoleTypeTool,
+		types.CompletionMessageRoleTypeUser,
+	}, roles(state.Completion.Messages))
+}
+
+func TestFitHistorySummarize(t *testing.T) {
+	model := &summaryModel{}
+	e := &Engine{
+		Model:   model,
+		History: &HistoryOptions{Strategy: HistorySummarize, MaxTokens: 60, SummaryModel: "small-model"},
+	}
+	state := &State{Completion: types.CompletionRequest{Messages: testHistory()}}
+	require.NoError(t, e.fitHistory(context.Background(), state))
+
+	require.Len(t, model.requests, 1)
+	assert.Equal(t, "small-model", model.requests[0].Model)
+	assert.Contains(t, model.requests[0].Messages[1].ChatText(), "user: I am Bob")
+
+	msgs := state.Completion.Messages
+	require.Len(t, msgs, 5)
+	assert.Equal(t, "You are helpful", msgs[0].ChatText())
+	assert.Equal(t, summaryPrefix+"the user is Bob", msgs[1].ChatText())
+	assert.Equal(t, types.CompletionMessageRoleTypeAssistant, msgs[2].Role)
+
+	// The summary is summarized again with the next messages that are dropped
+	state.Completion.Messages = append(state.Completion.Messages, types.CompletionMessage{
+		Role:    types.CompletionMessageRoleTypeUser,
+		Content: types.Text(strings.Repeat("more ", 100)),
+	})
+	require.NoError(t, e.fitHistory(context.Background(), state))
+	require.Len(t, model.requests, 2)
+	assert.Contains(t, model.requests[1].Messages[1].ChatText(), summaryPrefix+"the user is Bob")
+}
+
+func TestHistoryOptionsValidate(t *testing.T) {
+	assert.NoError(t, HistoryOptions{Strategy: HistoryDropOldest, MaxTokens: 1000}.Validate())
+	assert.Error(t, HistoryOptions{Strategy: HistorySummarize}.Validate())
+	assert.Error(t, HistoryOptions{Strategy: HistoryKeepRecent}.Validate())
+	assert.Error(t, HistoryOptions{Strategy: "truncate"}.Validate())
+}
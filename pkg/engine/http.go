@@ -7,26 +7,43 @@ import (
 	"io"
 	"net/http"
 	"net/url"
-	"os"
 	"strings"
 
+	"github.com/gptscript-ai/gptscript/pkg/env"
 	"github.com/gptscript-ai/gptscript/pkg/types"
 )
 
 const DaemonURLSuffix = ".daemon.gptscript.local"
 
+// HTTPStatusError is returned for a request of an HTTP or OpenAPI tool that failed with an HTTP status.
+type HTTPStatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("error in request to [%s] [%d]: %s", e.URL, e.StatusCode, e.Status)
+}
+
+func (e *HTTPStatusError) HTTPStatusCode() int {
+	return e.StatusCode
+}
+
 func (e *Engine) runHTTP(ctx context.Context, prg *types.Program, tool types.Tool, input string) (cmdRet *Return, cmdErr error) {
 	envMap := map[string]string{}
 
-	for _, env := range e.Env {
+	for _, env := range e.toolEnv() {
 		k, v, _ := strings.Cut(env, "=")
 		envMap[k] = v
 	}
 
 	toolURL := strings.Split(tool.Instructions, "\n")[0][2:]
-	toolURL = os.Expand(toolURL, func(s string) string {
-		return envMap[s]
-	})
+	toolURL, err := env.Expand(toolURL, env.LookupMap(envMap))
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL of tool %s: %w", tool.Name, err)
+	}
 
 	parsed, err := url.Parse(toolURL)
 	if err != nil {
@@ -43,10 +60,12 @@ func (e *Engine) runHTTP(ctx context.Context, prg *types.Program, tool types.Too
 		if !ok {
 			return nil, fmt.Errorf("failed to find tool [%s] for [%s]", referencedToolName, parsed.Hostname())
 		}
-		toolURL, err = e.startDaemon(referencedTool)
+		var done func()
+		toolURL, done, err = e.startDaemon(referencedTool)
 		if err != nil {
 			return nil, err
 		}
+		defer done()
 		toolURLParsed, err := url.Parse(toolURL)
 		if err != nil {
 			return nil, err
@@ -81,8 +100,13 @@ func (e *Engine) runHTTP(ctx context.Context, prg *types.Program, tool types.Too
 	defer resp.Body.Close()
 
 	if resp.StatusCode > 299 {
-		_, _ = io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("error in request to [%s] [%d]: %s", toolURL, resp.StatusCode, resp.Status)
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &HTTPStatusError{
+			URL:        toolURL,
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Body:       string(body),
+		}
 	}
 
 	content, err := io.ReadAll(resp.Body)
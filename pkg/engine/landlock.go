@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/gptscript-ai/gptscript/pkg/env"
+	"github.com/gptscript-ai/gptscript/pkg/landlock"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+var (
+	landlockUnsupported sync.Once
+	landlockNoNetwork   sync.Once
+)
+
+// landlockCommand changes cmd to run restricted by landlock. The command can read and execute the directories of the
+// system and those on its PATH, and can write to the tool directory, the workspace, the temporary directory and the
+// allowed paths of the tool. The network is denied if the tool sets "Network: false". If the kernel doesn't support
+// landlock, the command runs without restrictions, with a warning.
+func (e *Engine) landlockCommand(cmd *exec.Cmd, tool types.Tool, envMap map[string]string) error {
+	abi := landlock.ABI()
+	if abi == 0 {
+		landlockUnsupported.Do(func() {
+			log.Warnf("landlock is not supported by this system, command tools run without restrictions")
+		})
+		return nil
+	}
+
+	rules := landlock.Rules{
+		ReadOnly:  slices.Clone(landlock.SystemReadOnly),
+		ReadWrite: slices.Clone(landlock.SystemReadWrite),
+		NoNetwork: tool.Network != nil && !*tool.Network,
+	}
+	if rules.NoNetwork && abi < 4 {
+		landlockNoNetwork.Do(func() {
+			log.Warnf("landlock of this kernel can't restrict the network, tools with \"Network: false\" can still use it")
+		})
+	}
+
+	_, hostEnv := envAsMapAndDeDup(e.Env)
+	hostPath := filepath.SplitList(hostEnv["PATH"])
+	for _, dir := range filepath.SplitList(envMap["PATH"]) {
+		rules.ReadOnly = append(rules.ReadOnly, dir)
+		// Runtimes set up for the tool, such as virtual environments, keep their libraries next to their bin directory
+		if filepath.Base(dir) == "bin" && !slices.Contains(hostPath, dir) {
+			rules.ReadOnly = append(rules.ReadOnly, filepath.Dir(dir))
+		}
+	}
+
+	for _, dir := range []string{envMap["GPTSCRIPT_TOOL_DIR"], envMap["GPTSCRIPT_WORKSPACE_DIR"], os.TempDir()} {
+		if dir != "" {
+			rules.ReadWrite = append(rules.ReadWrite, dir)
+		}
+	}
+	for _, path := range tool.AllowedPaths {
+		path, err := env.Expand(path, env.LookupMap(envMap))
+		if err != nil {
+			return fmt.Errorf("invalid allowed path of tool %s: %w", tool.Name, err)
+		}
+		path, err = filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		rules.ReadWrite = append(rules.ReadWrite, path)
+	}
+
+	return landlock.Wrap(cmd, rules)
+}
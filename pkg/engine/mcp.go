@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/mcp"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// mcpCall is the input of the tool of an MCP server: the tool of the server to call and its arguments, a resource to
+// read, or neither to list the tools and resources of the server.
+type mcpCall struct {
+	Tool string `json:"tool"`
+	// Arguments is the JSON object of the arguments, or a string with it
+	Arguments json.RawMessage `json:"arguments"`
+	URI       string          `json:"uri"`
+}
+
+// runMCP runs the tool that was generated for an MCP server. Its instructions are in the format
+// "#!sys.mcp {Instructions JSON}", where {Instructions JSON} is the JSON of mcp.ToolInstructions. The server is started,
+// or connected to, by the first call of its tool.
+func (e *Engine) runMCP(ctx context.Context, tool types.Tool, input string) (*Return, error) {
+	var instructions mcp.ToolInstructions
+	if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(tool.Instructions, types.MCPPrefix))), &instructions); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal tool instructions: %w", err)
+	}
+
+	var call mcpCall
+	if strings.TrimSpace(input) != "" {
+		if err := json.Unmarshal([]byte(input), &call); err != nil {
+			return nil, fmt.Errorf("invalid input for MCP server %s, must be a JSON object: %w", instructions.Server, err)
+		}
+	}
+	args, err := mcpArguments(call.Arguments)
+	if err != nil {
+		return nil, fmt.Errorf("invalid arguments for tool %s of MCP server %s, must be a JSON object: %w", call.Tool, instructions.Server, err)
+	}
+
+	session, err := mcp.GetSession(ctx, instructions.Server, instructions.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	var result string
+	switch {
+	case call.URI != "":
+		contents, err := session.ReadResource(ctx, call.URI)
+		if err != nil {
+			return nil, err
+		}
+		result = mcp.ResourcesText(contents)
+	case call.Tool != "":
+		callResult, err := session.CallTool(ctx, call.Tool, args)
+		if err != nil {
+			return nil, err
+		}
+		// Errors of the tool itself are returned to the model, so that it can correct its call
+		result = callResult.Text()
+		if callResult.IsError {
+			result = "ERROR: " + result
+		}
+	default:
+		result, err = session.Describe(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Return{
+		Result: &result,
+	}, nil
+}
+
+// mcpArguments returns the arguments of a call of a tool of an MCP server, which models give as a JSON object or as a
+// string with one.
+func mcpArguments(data json.RawMessage) (map[string]any, error) {
+	args := map[string]any{}
+	if len(data) == 0 || string(data) == "null" {
+		return args, nil
+	}
+
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		if strings.TrimSpace(text) == "" {
+			return args, nil
+		}
+		data = []byte(text)
+	}
+	if err := json.Unmarshal(data, &args); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/mcp"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunMCP(t *testing.T) {
+	var initialized atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     *int64 `json:"id"`
+			Method string `json:"method"`
+			Params struct {
+				Name      string         `json:"name"`
+				Arguments map[string]any `json:"arguments"`
+			} `json:"params"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		if req.ID == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		var result any
+		switch req.Method {
+		case "initialize":
+			initialized.Add(1)
+			result = map[string]any{"protocolVersion": "2025-03-26", "capabilities": map[string]any{"tools": map[string]any{}}}
+		case "tools/list":
+			result = map[string]any{"tools": []map[string]any{{"name": "echo", "description": "Echoes the input"}}}
+		case "tools/call":
+			result = map[string]any{"content": []map[string]any{{"type": "text", "text": req.Params.Name + " " + req.Params.Arguments["input"].(string)}}}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	}))
+	defer server.Close()
+	defer mcp.CloseSessions()
+
+	data, err := json.Marshal(mcp.ToolInstructions{Server: "test", Config: mcp.ServerConfig{URL: server.URL}})
+	require.NoError(t, err)
+	tool := types.Tool{
+		ToolDef: types.ToolDef{
+			Parameters:   types.Parameters{Name: "test"},
+			Instructions: types.MCPPrefix + " " + string(data),
+		},
+	}
+
+	// The server is only connected to when its tool is called
+	var e Engine
+	assert.Zero(t, initialized.Load())
+
+	ret, err := e.runMCP(context.Background(), tool, "")
+	require.NoError(t, err)
+	assert.Equal(t, "The tools of the test MCP server are:\n- echo: Echoes the input", *ret.Result)
+
+	for _, input := range []string{
+		`{"tool": "echo", "arguments": {"input": "hello"}}`,
+		`{"tool": "echo", "arguments": "{\"input\": \"hello\"}"}`,
+	} {
+		ret, err = e.runMCP(context.Background(), tool, input)
+		require.NoError(t, err)
+		assert.Equal(t, "echo hello", *ret.Result)
+	}
+	assert.EqualValues(t, 1, initialized.Load())
+
+	_, err = e.runMCP(context.Background(), tool, `{"tool": "echo", "arguments": "hello"}`)
+	assert.ErrorContains(t, err, "invalid arguments for tool echo of MCP server test")
+}
@@ -0,0 +1,95 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gptscript-ai/gptscript/pkg/counter"
+	"github.com/gptscript-ai/gptscript/pkg/credentials"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// runOAuthDevice runs a credential tool that gets an OAuth access token with the device authorization grant. If the
+// tool is run to renew an expired credential that has a refresh token, the token is refreshed instead, and the user
+// is only asked to authorize again if that fails.
+func (e *Engine) runOAuthDevice(ctx Context, tool types.Tool) (cmdOut *Return, cmdErr error) {
+	id := counter.Next()
+
+	defer func() {
+		e.Progress <- types.CompletionStatus{
+			CompletionID: id,
+			Response: map[string]any{
+				"err": cmdErr,
+			},
+		}
+	}()
+
+	var config credentials.OAuthDeviceConfig
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(tool.Instructions, types.OAuthDevicePrefix)), &config); err != nil {
+		return nil, fmt.Errorf("invalid OAuth device configuration for tool %s: %w", tool.Parameters.Name, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	var token *credentials.OAuthToken
+	if refreshToken := existingRefreshToken(e.Env); refreshToken != "" {
+		var err error
+		if token, err = config.Refresh(ctx.Ctx, refreshToken); err != nil {
+			log.Warnf("Failed to refresh OAuth token for tool %s, authorizing again: %v", tool.Parameters.Name, err)
+		}
+	}
+
+	if token == nil {
+		var err error
+		token, err = config.Authorize(ctx.Ctx, func(verificationURI, userCode string) {
+			message := fmt.Sprintf("To authorize %s, open %s and enter the code %s\n", tool.Parameters.Name, verificationURI, userCode)
+			log.Infof("%s", strings.TrimSpace(message))
+			e.Progress <- types.CompletionStatus{
+				CompletionID: id,
+				PartialResponse: &types.CompletionMessage{
+					Role:    types.CompletionMessageRoleTypeAssistant,
+					Content: types.Text(message),
+				},
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	out, err := json.Marshal(struct {
+		Env          map[string]string `json:"env"`
+		ExpiresAt    *time.Time        `json:"expiresAt,omitempty"`
+		RefreshToken string            `json:"refreshToken,omitempty"`
+	}{
+		Env:          map[string]string{config.Env: token.AccessToken},
+		ExpiresAt:    token.ExpiresAt,
+		RefreshToken: token.RefreshToken,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := string(out)
+	return &Return{
+		Result: &result,
+	}, nil
+}
+
+// existingRefreshToken returns the refresh token of the credential that is being renewed, if there is one.
+func existingRefreshToken(env []string) string {
+	for _, e := range env {
+		existing, ok := strings.CutPrefix(e, types.ExistingCredentialEnvVar+"=")
+		if !ok {
+			continue
+		}
+		var cred credentials.Credential
+		if err := json.Unmarshal([]byte(existing), &cred); err == nil {
+			return cred.RefreshToken
+		}
+	}
+	return ""
+}
@@ -17,7 +17,7 @@ import (
 
 var (
 	SupportedMIMETypes     = []string{"application/json", "text/plain", "multipart/form-data"}
-	SupportedSecurityTypes = []string{"apiKey", "http"}
+	SupportedSecurityTypes = []string{"apiKey", "http", "oauth2"}
 )
 
 type Parameter struct {
@@ -28,11 +28,22 @@ type Parameter struct {
 
 // A SecurityInfo represents a security scheme in OpenAPI.
 type SecurityInfo struct {
-	Name       string `json:"name"`       // name as defined in the security schemes
-	Type       string `json:"type"`       // http or apiKey
-	Scheme     string `json:"scheme"`     // bearer or basic, for type==http
-	APIKeyName string `json:"apiKeyName"` // name of the API key, for type==apiKey
-	In         string `json:"in"`         // header, query, or cookie, for type==apiKey
+	Name       string   `json:"name"`               // name as defined in the security schemes
+	Type       string   `json:"type"`               // http, apiKey, or oauth2
+	Scheme     string   `json:"scheme"`             // bearer or basic, for type==http
+	APIKeyName string   `json:"apiKeyName"`         // name of the API key, for type==apiKey
+	In         string   `json:"in"`                 // header, query, or cookie, for type==apiKey
+	TokenURL   string   `json:"tokenURL,omitempty"` // token URL of the client credentials flow, for type==oauth2
+	Scopes     []string `json:"scopes,omitempty"`   // scopes the operation requires, for type==oauth2
+}
+
+// envNames returns the names of the environment variables that hold the secrets of the security scheme for host.
+func (s SecurityInfo) envNames(host string) []string {
+	envName := "GPTSCRIPT_" + env.ToEnvLike(host) + "_" + env.ToEnvLike(s.Name)
+	if s.Type == "http" && s.Scheme == "basic" {
+		return []string{envName + "_USERNAME", envName + "_PASSWORD"}
+	}
+	return []string{envName}
 }
 
 type OpenAPIInstructions struct {
@@ -54,7 +65,7 @@ type OpenAPIInstructions struct {
 func (e *Engine) runOpenAPI(tool types.Tool, input string) (*Return, error) {
 	envMap := map[string]string{}
 
-	for _, env := range e.Env {
+	for _, env := range e.toolEnv() {
 		k, v, _ := strings.Cut(env, "=")
 		envMap[k] = v
 	}
@@ -167,6 +178,17 @@ func (e *Engine) runOpenAPI(tool types.Tool, input string) (*Return, error) {
 	}
 	resultStr := string(result)
 
+	// The response of any other status is the result, for the LLM to handle, but one that is unauthorized with the
+	// credentials of the tool is an error, so that the runner can refresh them and make the request again.
+	if resp.StatusCode == http.StatusUnauthorized && len(tool.Credentials) > 0 {
+		return nil, &HTTPStatusError{
+			URL:        u.String(),
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Body:       resultStr,
+		}
+	}
+
 	return &Return{
 		Result: &resultStr,
 	}, nil
@@ -181,15 +203,7 @@ func handleAuths(req *http.Request, envMap map[string]string, infoSets [][]Secur
 	for _, infoSet := range infoSets {
 		var missing []string // Keep track of any missing environment variables
 		for _, info := range infoSet {
-			envNames := []string{"GPTSCRIPT_" + env.ToEnvLike(req.URL.Hostname()) + "_" + env.ToEnvLike(info.Name)}
-			if info.Type == "http" && info.Scheme == "basic" {
-				envNames = []string{
-					"GPTSCRIPT_" + env.ToEnvLike(req.URL.Hostname()) + "_" + env.ToEnvLike(info.Name) + "_USERNAME",
-					"GPTSCRIPT_" + env.ToEnvLike(req.URL.Hostname()) + "_" + env.ToEnvLike(info.Name) + "_PASSWORD",
-				}
-			}
-
-			for _, envName := range envNames {
+			for _, envName := range info.envNames(req.URL.Hostname()) {
 				if _, ok := envMap[envName]; !ok {
 					missing = append(missing, envName)
 				}
@@ -226,6 +240,8 @@ func handleAuths(req *http.Request, envMap map[string]string, infoSets [][]Secur
 				case "basic":
 					req.SetBasicAuth(envMap[envName+"_USERNAME"], envMap[envName+"_PASSWORD"])
 				}
+			case "oauth2":
+				req.Header.Set("Authorization", "Bearer "+envMap[envName])
 			}
 		}
 		return nil
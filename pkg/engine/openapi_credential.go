@@ -0,0 +1,203 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gptscript-ai/gptscript/pkg/credentials"
+	"github.com/gptscript-ai/gptscript/pkg/prompt"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// OpenAPICredentialInstructions are the instructions of a credential tool that was generated for the security
+// requirements of operations in an OpenAPI definition. They follow types.OpenAPICredentialPrefix in the instructions of
+// the tool.
+type OpenAPICredentialInstructions struct {
+	Server        string           `json:"server"`
+	SecurityInfos [][]SecurityInfo `json:"securityInfos"`
+}
+
+type openAPICredential struct {
+	Env       map[string]string `json:"env"`
+	ExpiresAt *time.Time        `json:"expiresAt,omitempty"`
+	// values are the secrets the credential was made with, which renew it without asking the user again
+	values map[string]string
+}
+
+// openAPICredentials keeps the credentials of OpenAPI credential tools for the life of the process, by their
+// instructions, as the credentials of tools that are not on GitHub are not stored.
+var openAPICredentials struct {
+	lock        sync.Mutex
+	credentials map[string]openAPICredential
+}
+
+// runOpenAPICredential runs a credential tool for an operation of an OpenAPI definition. It returns the secrets of the
+// first set of security schemes whose environment variables are all set, and otherwise asks the user for the secrets of
+// the first set. For OAuth 2.0 schemes with a client credentials flow, the user is asked for the client ID and secret,
+// and the access token is requested with them.
+func (e *Engine) runOpenAPICredential(ctx Context, tool types.Tool) (*Return, error) {
+	var instructions OpenAPICredentialInstructions
+	if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(tool.Instructions, types.OpenAPICredentialPrefix))), &instructions); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal tool instructions: %w", err)
+	}
+	if len(instructions.SecurityInfos) == 0 {
+		return nil, fmt.Errorf("no security schemes for credential tool %s", tool.Parameters.Name)
+	}
+
+	u, err := url.Parse(instructions.Server)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse server URL %s: %w", instructions.Server, err)
+	}
+	host := u.Hostname()
+
+	openAPICredentials.lock.Lock()
+	cred, ok := openAPICredentials.credentials[tool.Instructions]
+	openAPICredentials.lock.Unlock()
+	// A credential tool that is run again with the existing credential renews it, because a call was unauthorized
+	renew := slices.ContainsFunc(e.Env, func(env string) bool {
+		return strings.HasPrefix(env, types.ExistingCredentialEnvVar+"=")
+	})
+	if ok && !renew && (cred.ExpiresAt == nil || time.Until(*cred.ExpiresAt) > time.Minute) {
+		return credentialReturn(cred)
+	}
+
+	envMap := map[string]string{}
+	for _, env := range e.Env {
+		k, v, _ := strings.Cut(env, "=")
+		envMap[k] = v
+	}
+
+	infoSet, values := instructions.SecurityInfos[0], map[string]string{}
+	for _, set := range instructions.SecurityInfos {
+		setValues, found := securityEnv(host, set, envMap)
+		if !found && ok {
+			setValues, found = securityEnv(host, set, cred.values)
+		}
+		if found {
+			infoSet, values = set, setValues
+			break
+		}
+	}
+
+	if len(values) == 0 {
+		if values, err = e.promptSecurity(ctx, host, infoSet); err != nil {
+			return nil, err
+		}
+	}
+
+	cred = openAPICredential{
+		Env:    map[string]string{},
+		values: values,
+	}
+	for _, info := range infoSet {
+		envName := info.envNames(host)[0]
+		if info.Type != "oauth2" || info.TokenURL == "" || values[envName] != "" {
+			for _, name := range info.envNames(host) {
+				cred.Env[name] = values[name]
+			}
+			continue
+		}
+
+		token, err := credentials.ClientCredentialsToken(ctx.Ctx, info.TokenURL, values[envName+"_CLIENT_ID"], values[envName+"_CLIENT_SECRET"], info.Scopes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get OAuth token for %s: %w", info.Name, err)
+		}
+		cred.Env[envName] = token.AccessToken
+		if token.ExpiresAt != nil && (cred.ExpiresAt == nil || token.ExpiresAt.Before(*cred.ExpiresAt)) {
+			cred.ExpiresAt = token.ExpiresAt
+		}
+	}
+
+	openAPICredentials.lock.Lock()
+	if openAPICredentials.credentials == nil {
+		openAPICredentials.credentials = map[string]openAPICredential{}
+	}
+	openAPICredentials.credentials[tool.Instructions] = cred
+	openAPICredentials.lock.Unlock()
+
+	return credentialReturn(cred)
+}
+
+// securityEnv returns the values of the environment variables of a set of security schemes, and false if any is not
+// set. OAuth 2.0 schemes with a client credentials flow are also satisfied by a client ID and secret.
+func securityEnv(host string, infoSet []SecurityInfo, envMap map[string]string) (map[string]string, bool) {
+	values := map[string]string{}
+	for _, info := range infoSet {
+		names := info.envNames(host)
+		if info.Type == "oauth2" && info.TokenURL != "" && envMap[names[0]] == "" {
+			names = []string{names[0] + "_CLIENT_ID", names[0] + "_CLIENT_SECRET"}
+		}
+		for _, name := range names {
+			value, ok := envMap[name]
+			if !ok || value == "" {
+				return nil, false
+			}
+			values[name] = value
+		}
+	}
+	return values, true
+}
+
+// promptSecurity asks the user for the secrets of a set of security schemes, and returns them by the names of their
+// environment variables.
+func (e *Engine) promptSecurity(ctx Context, host string, infoSet []SecurityInfo) (map[string]string, error) {
+	var fields, envNames []string
+	for _, info := range infoSet {
+		envName := info.envNames(host)[0]
+		switch {
+		case info.Type == "apiKey":
+			fields = append(fields, info.Name+" API key")
+			envNames = append(envNames, envName)
+		case info.Type == "http" && info.Scheme == "basic":
+			fields = append(fields, info.Name+" username", info.Name+" password")
+			envNames = append(envNames, info.envNames(host)...)
+		case info.Type == "oauth2" && info.TokenURL != "":
+			fields = append(fields, info.Name+" client ID", info.Name+" client secret")
+			envNames = append(envNames, envName+"_CLIENT_ID", envName+"_CLIENT_SECRET")
+		default:
+			fields = append(fields, info.Name+" token")
+			envNames = append(envNames, envName)
+		}
+	}
+
+	input, err := json.Marshal(map[string]string{
+		"message":   fmt.Sprintf("Please enter the credentials for %s.", host),
+		"fields":    strings.Join(fields, ","),
+		"sensitive": "true",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := prompt.SysPrompt(ctx.Ctx, e.Env, string(input))
+	if err != nil {
+		return nil, fmt.Errorf("failed to prompt for the credentials of %s: %w", host, err)
+	}
+
+	var answers map[string]string
+	if err := json.Unmarshal([]byte(out), &answers); err != nil {
+		return nil, fmt.Errorf("invalid prompt response: %w", err)
+	}
+
+	values := map[string]string{}
+	for i, field := range fields {
+		values[envNames[i]] = answers[field]
+	}
+	return values, nil
+}
+
+func credentialReturn(cred openAPICredential) (*Return, error) {
+	out, err := json.Marshal(cred)
+	if err != nil {
+		return nil, err
+	}
+	result := string(out)
+	return &Return{
+		Result: &result,
+	}, nil
+}
@@ -0,0 +1,86 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunOpenAPICredential(t *testing.T) {
+	var prompts, tokens int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/prompt", func(w http.ResponseWriter, r *http.Request) {
+		prompts++
+		var p types.Prompt
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&p))
+		require.Equal(t, []string{"oauth client ID", "oauth client secret", "key API key"}, p.Fields)
+		require.True(t, p.Sensitive)
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"oauth client ID":     "client",
+			"oauth client secret": "secret",
+			"key API key":         "api-key",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		tokens++
+		require.NoError(t, r.ParseForm())
+		require.Equal(t, "client_credentials", r.Form.Get("grant_type"))
+		require.Equal(t, "read", r.Form.Get("scope"))
+		user, password, _ := r.BasicAuth()
+		require.Equal(t, "client", user)
+		require.Equal(t, "secret", password)
+		_ = json.NewEncoder(w).Encode(map[string]any{"access_token": "access", "expires_in": 3600})
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	inst, err := json.Marshal(OpenAPICredentialInstructions{
+		Server: "https://api.example.com/v1",
+		SecurityInfos: [][]SecurityInfo{
+			{
+				{Name: "oauth", Type: "oauth2", TokenURL: s.URL + "/token", Scopes: []string{"read"}},
+				{Name: "key", Type: "apiKey", In: "header", APIKeyName: "X-API-Key"},
+			},
+			{{Name: "basic", Type: "http", Scheme: "basic"}},
+		},
+	})
+	require.NoError(t, err)
+
+	run := func(tool types.Tool, env ...string) map[string]string {
+		e := &Engine{Env: append(env, types.PromptURLEnvVar+"="+s.URL+"/prompt")}
+		ret, err := e.runOpenAPICredential(Context{Ctx: context.Background()}, tool)
+		require.NoError(t, err)
+
+		var cred openAPICredential
+		require.NoError(t, json.Unmarshal([]byte(*ret.Result), &cred))
+		return cred.Env
+	}
+
+	// The second set is used without asking, as its variables are set
+	tool := types.Tool{ToolDef: types.ToolDef{Instructions: types.OpenAPICredentialPrefix + " " + string(inst)}}
+	require.Equal(t, map[string]string{
+		"GPTSCRIPT_API_EXAMPLE_COM_BASIC_USERNAME": "user",
+		"GPTSCRIPT_API_EXAMPLE_COM_BASIC_PASSWORD": "password",
+	}, run(tool, "GPTSCRIPT_API_EXAMPLE_COM_BASIC_USERNAME=user", "GPTSCRIPT_API_EXAMPLE_COM_BASIC_PASSWORD=password"))
+	require.Zero(t, prompts)
+
+	// Otherwise the user is asked for the first set, and the token is requested with the client credentials
+	openAPICredentials.credentials = nil
+	expected := map[string]string{
+		"GPTSCRIPT_API_EXAMPLE_COM_OAUTH": "access",
+		"GPTSCRIPT_API_EXAMPLE_COM_KEY":   "api-key",
+	}
+	require.Equal(t, expected, run(tool))
+	require.Equal(t, 1, prompts)
+	require.Equal(t, 1, tokens)
+
+	// The credential is kept until the token expires
+	require.Equal(t, expected, run(tool))
+	require.Equal(t, 1, prompts)
+	require.Equal(t, 1, tokens)
+}
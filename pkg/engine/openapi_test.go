@@ -2,9 +2,13 @@ package engine
 
 import (
 	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
 
+	"github.com/gptscript-ai/gptscript/pkg/credentials"
+	"github.com/gptscript-ai/gptscript/pkg/types"
 	"github.com/stretchr/testify/require"
 )
 
@@ -253,3 +257,34 @@ func getParameters(style string, explode bool) []Parameter {
 func boolPointer(b bool) *bool {
 	return &b
 }
+
+func TestRunOpenAPIUnauthorized(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error": "token expired"}`))
+	}))
+	defer s.Close()
+
+	inst, err := json.Marshal(OpenAPIInstructions{
+		Server: s.URL,
+		Path:   "/items",
+		Method: http.MethodGet,
+	})
+	require.NoError(t, err)
+
+	tool := types.Tool{ToolDef: types.ToolDef{Instructions: types.OpenAPIPrefix + " " + string(inst)}}
+
+	// Without credentials the response is the result, for the LLM to handle
+	ret, err := (&Engine{}).runOpenAPI(tool, "{}")
+	require.NoError(t, err)
+	require.Equal(t, `{"error": "token expired"}`, *ret.Result)
+
+	// With credentials it is an error, so that they can be refreshed
+	tool.Credentials = []string{"github.com/example/cred"}
+	_, err = (&Engine{}).runOpenAPI(tool, "{}")
+	require.True(t, credentials.IsUnauthorized(err))
+
+	var statusErr *HTTPStatusError
+	require.ErrorAs(t, err, &statusErr)
+	require.Equal(t, `{"error": "token expired"}`, statusErr.Body)
+}
@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// maxOutputRepairs is how often the model is asked to fix a response that does not match the output schema of the
+// tool, before giving up.
+const maxOutputRepairs = 2
+
+// OutputSchemaError is returned when the final response of a tool still does not match its output schema after asking
+// the model to repair it.
+type OutputSchemaError struct {
+	Output string
+	Err    error
+}
+
+func (o *OutputSchemaError) Error() string {
+	return fmt.Sprintf("response does not match the output schema: %v", o.Err)
+}
+
+func (o *OutputSchemaError) Unwrap() error {
+	return o.Err
+}
+
+// ValidateOutput returns an *OutputSchemaError if output is not JSON that is valid against schema.
+func ValidateOutput(schema *openapi3.Schema, output string) error {
+	if err := validateOutput(schema, output); err != nil {
+		return &OutputSchemaError{
+			Output: output,
+			Err:    err,
+		}
+	}
+	return nil
+}
+
+func validateOutput(schema *openapi3.Schema, output string) error {
+	var value any
+	if err := json.Unmarshal([]byte(output), &value); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return schema.VisitJSON(value, openapi3.SetSchemaErrorMessageCustomizer(schemaErrorMessage))
+}
+
+// schemaErrorMessage leaves the schema and value out of validation errors, the model has both already.
+func schemaErrorMessage(err *openapi3.SchemaError) string {
+	reason := err.Reason
+	if reason == "" {
+		reason = fmt.Sprintf("does not match the %q of the schema", err.SchemaField)
+	}
+	if path := err.JSONPointer(); len(path) > 0 {
+		return fmt.Sprintf("at /%s: %s", strings.Join(path, "/"), reason)
+	}
+	return reason
+}
+
+func repairPrompt(err error) string {
+	return fmt.Sprintf("Your response is not valid against the JSON schema: %v\n"+
+		"Respond again with only JSON, without any other text, that is valid against the schema.", err)
+}
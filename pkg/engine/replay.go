@@ -0,0 +1,245 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/gptscript-ai/gptscript/pkg/hash"
+	"github.com/gptscript-ai/gptscript/pkg/redact"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// Recording records the responses of the model and the results of command tools during a run to a file, or replays a
+// run from such a file without calling the model or running any tool. Interactions are keyed by a hash of their request,
+// which leaves out the IDs of tools, because they have the path of the program. The same request made several times
+// is replayed in the order the responses were recorded.
+//
+// The file has a line of JSON for each interaction, which is appended as it happens. Secrets, such as the credentials a
+// credential tool returns, are redacted from the entries and from the requests they are keyed by, so a replay gets the
+// redacted values instead.
+type Recording struct {
+	file   string
+	replay bool
+
+	lock    sync.Mutex
+	entries map[string][]recordedEntry
+	// replayed is the number of entries of each key that were replayed
+	replayed map[string]int
+}
+
+type recordedEntry struct {
+	Key      string                   `json:"key"`
+	Response *types.CompletionMessage `json:"response,omitempty"`
+	Result   *string                  `json:"result,omitempty"`
+	Error    string                   `json:"error,omitempty"`
+}
+
+// ReplayMissError is returned in replay mode for an interaction that is not in the recording.
+type ReplayMissError struct {
+	Kind string
+	Name string
+	Key  string
+}
+
+func (e *ReplayMissError) Error() string {
+	return fmt.Sprintf("no recorded %s for %s (key %s) to replay", e.Kind, e.Name, e.Key)
+}
+
+// NewRecording returns a recording that writes to file, which is truncated, or with replay, one that replays the
+// interactions recorded in file. Only the user can read a file it creates.
+func NewRecording(file string, replay bool) (*Recording, error) {
+	r := &Recording{
+		file:     file,
+		replay:   replay,
+		entries:  map[string][]recordedEntry{},
+		replayed: map[string]int{},
+	}
+
+	if replay {
+		return r, r.load()
+	}
+
+	f, err := os.OpenFile(file, os.O_TRUNC|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recording: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("failed to create recording: %w", err)
+	}
+	return r, nil
+}
+
+func (r *Recording) load() error {
+	f, err := os.Open(r.file)
+	if err != nil {
+		return fmt.Errorf("failed to read recording: %w", err)
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	for {
+		var entry recordedEntry
+		if err := dec.Decode(&entry); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("invalid recording %s: %w", r.file, err)
+		}
+		r.entries[entry.Key] = append(r.entries[entry.Key], entry)
+	}
+}
+
+// Replay returns true if the recording replays a run instead of recording it.
+func (r *Recording) Replay() bool {
+	return r.replay
+}
+
+func (r *Recording) callModel(ctx context.Context, model Model, req types.CompletionRequest, status chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	key := modelKey(req)
+	if r.replay {
+		entry, err := r.next("model response", req.Model, key)
+		if err != nil {
+			return nil, err
+		}
+		if entry.Error != "" {
+			return nil, errors.New(entry.Error)
+		}
+		return entry.Response, nil
+	}
+
+	resp, err := model.Call(ctx, req, status)
+	entry := recordedEntry{
+		Key: key,
+	}
+	if err != nil {
+		entry.Error = redact.String(err.Error())
+	} else if resp != nil {
+		entry.Response, err = redactMessage(*resp)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := r.add(entry); err != nil {
+		return nil, err
+	}
+	return resp, err
+}
+
+func (r *Recording) runTool(ctx Context, tool types.Tool, input string, run func() (*Return, error)) (*Return, error) {
+	key := hash.ID("tool", tool.Name, tool.Instructions, redact.String(input))
+	if r.replay {
+		entry, err := r.next("tool result", tool.Name, key)
+		if err != nil {
+			return nil, err
+		}
+		if entry.Error != "" {
+			return nil, errors.New(entry.Error)
+		}
+		return &Return{
+			Result: entry.Result,
+		}, nil
+	}
+
+	ret, err := run()
+	entry := recordedEntry{
+		Key: key,
+	}
+	if err != nil {
+		entry.Error = redact.String(err.Error())
+	} else if ret != nil && ret.Result != nil {
+		if ctx.ToolCategory == CredentialToolCategory {
+			redactCredential(ctx, *ret.Result)
+		}
+		result := redact.String(*ret.Result)
+		entry.Result = &result
+	}
+	if err := r.add(entry); err != nil {
+		return nil, err
+	}
+	return ret, err
+}
+
+// redactCredential redacts the values of the env a credential tool returned for the rest of the run, which the runner
+// only does after the tool returns, when its result was already recorded.
+func redactCredential(ctx Context, result string) {
+	var output struct {
+		Env map[string]string `json:"env"`
+	}
+	if err := json.Unmarshal([]byte(result), &output); err != nil {
+		return
+	}
+	for _, value := range output.Env {
+		redact.AddContextValues(ctx.Ctx, value)
+	}
+}
+
+// redactMessage returns msg with the secrets in its JSON redacted.
+func redactMessage(msg types.CompletionMessage) (*types.CompletionMessage, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	var redacted types.CompletionMessage
+	if err := json.Unmarshal(redact.Bytes(data), &redacted); err != nil {
+		return nil, err
+	}
+	return &redacted, nil
+}
+
+// modelKey is the hash of the redacted JSON of the request, which has the keys of maps sorted, without the IDs of tools.
+func modelKey(req types.CompletionRequest) string {
+	req.Tools = append([]types.CompletionTool(nil), req.Tools...)
+	for i := range req.Tools {
+		req.Tools[i].Function.ToolID = ""
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		panic(err)
+	}
+	return hash.ID("model", redact.String(string(data)))
+}
+
+func (r *Recording) next(kind, name, key string) (recordedEntry, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	i := r.replayed[key]
+	if i >= len(r.entries[key]) {
+		return recordedEntry{}, &ReplayMissError{
+			Kind: kind,
+			Name: name,
+			Key:  key,
+		}
+	}
+	r.replayed[key]++
+	return r.entries[key][i], nil
+}
+
+// add appends the entry to the file. The file is opened for each entry, so that nothing is buffered in the process and
+// a run that crashes keeps the entries up to that point.
+func (r *Recording) add(entry recordedEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	f, err := os.OpenFile(r.file, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write recording: %w", err)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write recording: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write recording: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/gptscript-ai/gptscript/pkg/rlimit"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+var rlimitUnsupported sync.Once
+
+// ResourceLimitError is returned for a command tool that was killed, or crashed, because it hit one of its resource
+// limits.
+type ResourceLimitError struct {
+	Tool  string
+	Limit string
+	Value string
+	Err   error
+}
+
+func (e *ResourceLimitError) Error() string {
+	return fmt.Sprintf("tool %s exceeded its %s limit of %s: %v", e.Tool, e.Limit, e.Value, e.Err)
+}
+
+func (e *ResourceLimitError) Unwrap() error {
+	return e.Err
+}
+
+// toolLimits returns the resource limits of a command tool, the default limits of the engine with those that the tool
+// sets with "Max Memory" and "Max CPU Time" in their place. A tool can set a limit to 0 to not have it. Daemons run for
+// as long as the program does, so they only have a CPU time limit if they set one themselves.
+func (e *Engine) toolLimits(tool types.Tool) (rlimit.Limits, error) {
+	limits := e.ToolLimits
+	if tool.IsDaemon() {
+		limits.CPUTime = 0
+	}
+	if tool.MaxMemory != "" {
+		memory, err := rlimit.ParseMemory(tool.MaxMemory)
+		if err != nil {
+			return limits, err
+		}
+		limits.Memory = memory
+	}
+	if tool.MaxCPUTime != "" {
+		cpuTime, err := time.ParseDuration(tool.MaxCPUTime)
+		if err != nil {
+			return limits, fmt.Errorf("invalid max CPU time %q of tool %s: %w", tool.MaxCPUTime, tool.Name, err)
+		}
+		limits.CPUTime = cpuTime
+	}
+	return limits, nil
+}
+
+// limitCommand changes cmd to run with the resource limits of the tool. On systems other than Linux the command runs
+// without limits, with a warning.
+func (e *Engine) limitCommand(cmd *exec.Cmd, tool types.Tool) error {
+	limits, err := e.toolLimits(tool)
+	if err != nil || limits.IsZero() {
+		return err
+	}
+	if !rlimit.Supported() {
+		rlimitUnsupported.Do(func() {
+			log.Warnf("resource limits are only supported on Linux, command tools run without them")
+		})
+		return nil
+	}
+	return rlimit.Wrap(cmd, limits)
+}
+
+// limitError returns a ResourceLimitError for err, the error of the command of the tool, if the command hit one of the
+// limits of the tool, and err otherwise. A command that was killed because ctx was canceled did not hit a limit.
+func (e *Engine) limitError(ctx context.Context, tool types.Tool, err error) error {
+	limits, limitsErr := e.toolLimits(tool)
+	if limitsErr != nil || ctx.Err() != nil {
+		return err
+	}
+	limit, ok := rlimit.Exceeded(limits, err)
+	if !ok {
+		return err
+	}
+
+	value := rlimit.FormatMemory(limits.Memory)
+	if limit == "CPU time" {
+		value = limits.CPUTime.String()
+	}
+	return &ResourceLimitError{
+		Tool:  tool.Parameters.Name,
+		Limit: limit,
+		Value: value,
+		Err:   err,
+	}
+}
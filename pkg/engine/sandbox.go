@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/counter"
+)
+
+const (
+	DefaultSandboxRuntime = "docker"
+	DefaultSandboxImage   = "debian:stable-slim"
+)
+
+// SandboxOptions configures running command tools in a container instead of directly on the host. The container has a
+// read-only root filesystem, no network unless Network is set, and only the tool directory, the workspace and the
+// script of the tool mounted. It only gets the environment gptscript sets for the tool, such as its arguments and
+// credentials, not the environment of the host.
+type SandboxOptions struct {
+	// Runtime is the container CLI, docker or podman.
+	Runtime string
+	// Image is the image the tool runs in. Interpreters such as python or node have to be in the image.
+	Image   string
+	Network bool
+}
+
+// sandboxCommand returns the command that runs args in a container. env is the environment of the tool in the
+// container, and mounts are host paths that are mounted at the same path, read-only unless they are the workspace.
+func (s SandboxOptions) sandboxCommand(ctx context.Context, args, env []string, toolDir, workspace string, mounts []string) (*exec.Cmd, func()) {
+	containerRuntime := s.Runtime
+	if containerRuntime == "" {
+		containerRuntime = DefaultSandboxRuntime
+	}
+	image := s.Image
+	if image == "" {
+		image = DefaultSandboxImage
+	}
+
+	name := fmt.Sprintf("gptscript-%d-%s", os.Getpid(), counter.Next())
+	runArgs := []string{
+		"run", "--rm", "-i",
+		"--name", name,
+		"--read-only",
+		"--tmpfs", "/tmp",
+		"--cap-drop", "ALL",
+		"--security-opt", "no-new-privileges",
+	}
+	if !s.Network {
+		runArgs = append(runArgs, "--network", "none")
+	}
+	if runtime.GOOS == "linux" {
+		// Files written to the workspace belong to the user running gptscript
+		runArgs = append(runArgs, "--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()))
+	}
+
+	if toolDir != "" {
+		runArgs = append(runArgs, "--mount", bindMount(toolDir, true), "-w", toolDir)
+	}
+	if workspace != "" {
+		runArgs = append(runArgs, "--mount", bindMount(workspace, false))
+	}
+	for _, mount := range mounts {
+		runArgs = append(runArgs, "--mount", bindMount(mount, true))
+	}
+
+	// Values are passed in the environment of the container CLI rather than its arguments, which other processes can
+	// see.
+	for _, kv := range env {
+		k, _, _ := strings.Cut(kv, "=")
+		runArgs = append(runArgs, "-e", k)
+	}
+
+	runArgs = append(runArgs, image)
+	runArgs = append(runArgs, args...)
+
+	cmd := exec.CommandContext(ctx, containerRuntime, runArgs...)
+	cmd.Env = append(os.Environ(), env...)
+
+	// Killing the container CLI when the call is canceled does not always stop the container
+	stop := func() {
+		if ctx.Err() != nil {
+			_ = exec.Command(containerRuntime, "rm", "-f", name).Run()
+		}
+	}
+	return cmd, stop
+}
+
+// bindMount returns the --mount option that mounts path at the same path in the container. Unlike -v, it has no
+// separator that can be in a path, such as the colon of a Windows drive, and fields with a comma or quote are quoted.
+func bindMount(path string, readonly bool) string {
+	fields := []string{"type=bind", "src=" + path, "dst=" + path}
+	if readonly {
+		fields = append(fields, "readonly")
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write(fields)
+	w.Flush()
+	return strings.TrimSuffix(buf.String(), "\n")
+}
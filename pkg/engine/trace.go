@@ -0,0 +1,55 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/gptscript-ai/gptscript/pkg/trace"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+type modelCall func(ctx context.Context, status chan<- types.CompletionStatus) (*types.CompletionMessage, error)
+
+// traceModel calls the model in a span with the model, the tokens it used and whether the response came from the
+// cache. The statuses of the call are passed on to status as they are.
+func traceModel(ctx context.Context, req types.CompletionRequest, status chan<- types.CompletionStatus, call modelCall) (*types.CompletionMessage, error) {
+	if !trace.Enabled(ctx) {
+		return call(ctx, status)
+	}
+
+	ctx, span := trace.Start(ctx, strings.TrimSpace("model "+req.Model), trace.SpanKindClient,
+		trace.String("gen_ai.request.model", req.Model))
+
+	var (
+		cached  bool
+		wg      sync.WaitGroup
+		proxied = make(chan types.CompletionStatus)
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for s := range proxied {
+			if s.Response != nil && s.Cached {
+				cached = true
+			}
+			if status != nil {
+				status <- s
+			}
+		}
+	}()
+
+	resp, err := call(ctx, proxied)
+	close(proxied)
+	wg.Wait()
+
+	span.SetAttributes(trace.Bool("gptscript.model.cache_hit", cached))
+	if resp != nil {
+		span.SetAttributes(
+			trace.Int("gen_ai.usage.input_tokens", resp.Usage.PromptTokens),
+			trace.Int("gen_ai.usage.output_tokens", resp.Usage.CompletionTokens),
+			trace.Int("gen_ai.usage.total_tokens", resp.Usage.TotalTokens))
+	}
+	span.End(err)
+	return resp, err
+}
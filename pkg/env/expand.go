@@ -0,0 +1,157 @@
+package env
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MissingVariableError is returned by Expand for a required variable, ${NAME:?message}, that is not set or empty.
+type MissingVariableError struct {
+	Name    string
+	Message string
+}
+
+func (e *MissingVariableError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("required variable %s is not set", e.Name)
+	}
+	return fmt.Sprintf("required variable %s is not set: %s", e.Name, e.Message)
+}
+
+// Expand replaces the variables in s with their values from lookup. It supports:
+//
+//	$NAME             the value of NAME, empty if it is not set
+//	${NAME}           the same, NAME can have any character but ':' and '}'
+//	${NAME:-default}  the value of NAME, or default if it is not set or empty
+//	${NAME:?message}  the value of NAME, or a MissingVariableError with message if it is not set or empty
+//	$$                a literal $
+//
+// Defaults can have variables themselves. Values are never expanded again, and a $ that doesn't start one of the
+// forms above, such as in $1 or an unclosed ${, is kept as it is, so that text like shell scripts passes through.
+func Expand(s string, lookup func(string) (string, bool)) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+
+	var (
+		result strings.Builder
+		i      int
+	)
+	for i < len(s) {
+		next := strings.IndexByte(s[i:], '$')
+		if next < 0 {
+			result.WriteString(s[i:])
+			break
+		}
+		result.WriteString(s[i : i+next])
+		i += next
+
+		switch {
+		case i+1 < len(s) && s[i+1] == '$':
+			result.WriteByte('$')
+			i += 2
+		case i+1 < len(s) && s[i+1] == '{':
+			end := closingBrace(s, i+2)
+			if end < 0 || end == i+2 {
+				result.WriteString("${")
+				i += 2
+				continue
+			}
+			value, err := expandBraced(s[i+2:end], lookup)
+			if err != nil {
+				return "", err
+			}
+			result.WriteString(value)
+			i = end + 1
+		default:
+			end := i + 1
+			for end < len(s) && isNameChar(s[end], end == i+1) {
+				end++
+			}
+			if end == i+1 {
+				result.WriteByte('$')
+				i++
+				continue
+			}
+			value, _ := lookup(s[i+1 : end])
+			result.WriteString(value)
+			i = end
+		}
+	}
+
+	return result.String(), nil
+}
+
+// LookupMap returns a lookup for Expand of the variables in env.
+func LookupMap(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+}
+
+// LookupEnv returns a lookup for Expand of the variables in env, a list of KEY=VALUE, where the last one of a key is
+// used like it is for a process.
+func LookupEnv(env []string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		for i := len(env) - 1; i >= 0; i-- {
+			if k, v, _ := strings.Cut(env[i], "="); k == key {
+				return v, true
+			}
+		}
+		return "", false
+	}
+}
+
+func expandBraced(expr string, lookup func(string) (string, bool)) (string, error) {
+	name, op, hasOp := strings.Cut(expr, ":")
+	value, ok := lookup(name)
+	if !hasOp {
+		return value, nil
+	}
+
+	switch {
+	case strings.HasPrefix(op, "-"):
+		if ok && value != "" {
+			return value, nil
+		}
+		return Expand(op[1:], lookup)
+	case strings.HasPrefix(op, "?"):
+		if ok && value != "" {
+			return value, nil
+		}
+		message, err := Expand(op[1:], lookup)
+		if err != nil {
+			return "", err
+		}
+		return "", &MissingVariableError{
+			Name:    name,
+			Message: message,
+		}
+	}
+	// Not an operator, so the colon is part of the name, as it would be before
+	value, _ = lookup(expr)
+	return value, nil
+}
+
+// closingBrace returns the index of the brace that closes the one before start, counting nested ${ in defaults.
+func closingBrace(s string, start int) int {
+	depth := 0
+	for i := start; i < len(s); i++ {
+		switch {
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '{':
+			depth++
+			i++
+		case s[i] == '}':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+func isNameChar(c byte, first bool) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || !first && '0' <= c && c <= '9'
+}
@@ -0,0 +1,76 @@
+package env
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpand(t *testing.T) {
+	lookup := LookupMap(map[string]string{
+		"FOO":      "foo",
+		"EMPTY":    "",
+		"my-input": "input",
+		"DOLLAR":   "$FOO ${FOO}",
+	})
+
+	for in, out := range map[string]string{
+		"plain":                   "plain",
+		"$FOO/bin":                "foo/bin",
+		"${FOO}bar":               "foobar",
+		"$FOO_BAR":                "",
+		"${my-input}":             "input",
+		"${MISSING:-default}":     "default",
+		"${EMPTY:-default}":       "default",
+		"${FOO:-default}":         "foo",
+		"${MISSING:-$FOO/x}":      "foo/x",
+		"${MISSING:-${FOO:-y}}":   "foo",
+		"${MISSING:-}":            "",
+		"${FOO:?must be set}":     "foo",
+		"$$FOO":                   "$FOO",
+		"$1 $* $ ${":              "$1 $* $ ${",
+		"${}":                     "${}",
+		"${FOO":                   "${FOO",
+		"$DOLLAR":                 "$FOO ${FOO}",
+		"echo ${DOLLAR:-default}": "echo $FOO ${FOO}",
+	} {
+		result, err := Expand(in, lookup)
+		require.NoError(t, err, in)
+		assert.Equal(t, out, result, in)
+	}
+}
+
+func TestExpandRequired(t *testing.T) {
+	lookup := LookupEnv([]string{"FOO=bar", "EMPTY="})
+
+	for in, expected := range map[string]*MissingVariableError{
+		"${MISSING:?must be set}":        {Name: "MISSING", Message: "must be set"},
+		"a ${EMPTY:?} b":                 {Name: "EMPTY"},
+		"${MISSING:?FOO is $FOO}":        {Name: "MISSING", Message: "FOO is bar"},
+		"${EMPTY:-${MISSING:?inner}} ok": {Name: "MISSING", Message: "inner"},
+	} {
+		_, err := Expand(in, lookup)
+		var missing *MissingVariableError
+		require.ErrorAs(t, err, &missing, in)
+		assert.Equal(t, expected, missing, in)
+	}
+
+	_, err := Expand("${MISSING:?must be set}", lookup)
+	assert.EqualError(t, err, "required variable MISSING is not set: must be set")
+}
+
+func TestLookupEnv(t *testing.T) {
+	lookup := LookupEnv([]string{"FOO=a", "BAR=b=c", "FOO=d"})
+
+	v, ok := lookup("FOO")
+	assert.True(t, ok)
+	assert.Equal(t, "d", v)
+
+	v, ok = lookup("BAR")
+	assert.True(t, ok)
+	assert.Equal(t, "b=c", v)
+
+	_, ok = lookup("MISSING")
+	assert.False(t, ok)
+}
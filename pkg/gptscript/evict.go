@@ -0,0 +1,21 @@
+package gptscript
+
+import (
+	"context"
+	"fmt"
+)
+
+// Evicter is implemented by runtime managers that can remove the runtimes and tools they have cached.
+type Evicter interface {
+	Evict(ctx context.Context, all bool) ([]string, error)
+}
+
+// EvictRuntimes removes the downloaded runtimes that no tool that is set up uses, or, if all is true, every cached
+// runtime and tool. It returns the removed paths.
+func (g *GPTScript) EvictRuntimes(ctx context.Context, all bool) ([]string, error) {
+	e, ok := g.runtimeManager.(Evicter)
+	if !ok {
+		return nil, fmt.Errorf("runtime manager %T does not support evicting its cache", g.runtimeManager)
+	}
+	return e.Evict(ctx, all)
+}
@@ -6,19 +6,24 @@ import (
 	"os"
 	"path/filepath"
 	"slices"
+	"time"
 
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gptscript-ai/gptscript/pkg/anthropic"
 	"github.com/gptscript-ai/gptscript/pkg/builtin"
 	"github.com/gptscript-ai/gptscript/pkg/cache"
 	context2 "github.com/gptscript-ai/gptscript/pkg/context"
 	"github.com/gptscript-ai/gptscript/pkg/engine"
 	"github.com/gptscript-ai/gptscript/pkg/hash"
 	"github.com/gptscript-ai/gptscript/pkg/llm"
+	"github.com/gptscript-ai/gptscript/pkg/mcp"
 	"github.com/gptscript-ai/gptscript/pkg/monitor"
 	"github.com/gptscript-ai/gptscript/pkg/mvl"
 	"github.com/gptscript-ai/gptscript/pkg/openai"
 	"github.com/gptscript-ai/gptscript/pkg/prompt"
 	"github.com/gptscript-ai/gptscript/pkg/remote"
 	"github.com/gptscript-ai/gptscript/pkg/repos/runtimes"
+	"github.com/gptscript-ai/gptscript/pkg/repos/runtimes/golang"
 	"github.com/gptscript-ai/gptscript/pkg/runner"
 	"github.com/gptscript-ai/gptscript/pkg/types"
 )
@@ -32,18 +37,32 @@ type GPTScript struct {
 	WorkspacePath          string
 	DeleteWorkspaceOnClose bool
 	extraEnv               []string
+	runtimeManager         engine.RuntimeManager
+	timeout                time.Duration
+	outputSchema           *openapi3.Schema
 	close                  func()
 }
 
 type Options struct {
 	Cache             cache.Options
 	OpenAI            openai.Options
+	Anthropic         anthropic.Options
 	Monitor           monitor.Options
 	Runner            runner.Options
 	CredentialContext string
 	Quiet             *bool
 	Workspace         string
 	Env               []string
+	// Timeout bounds how long Run and Chat take, for the whole run. Zero means no timeout.
+	Timeout time.Duration
+	// OutputSchema is the JSON schema the result of Run must be valid against, in place of the output schema of the
+	// entry tool of the program.
+	OutputSchema *openapi3.Schema
+	// ModelAliases are the models that tools can refer to by the names of the aliases, like @fast.
+	ModelAliases map[string]string
+	// GoMetrics receives an event for every Go toolchain download and Go tool build of the default runtime manager.
+	// It is not used if Runner.RuntimeManager is set.
+	GoMetrics golang.Metrics
 }
 
 func complete(opts *Options) (result *Options) {
@@ -64,14 +83,24 @@ func New(opts *Options) (*GPTScript, error) {
 	opts = complete(opts)
 
 	registry := llm.NewRegistry()
+	if err := registry.SetAliases(opts.ModelAliases); err != nil {
+		return nil, err
+	}
 
 	cacheClient, err := cache.New(opts.Cache)
 	if err != nil {
 		return nil, err
 	}
 
+	// Claude models are served by Anthropic directly when there is an API key for it
+	if err := registry.AddClient(anthropic.NewClient(opts.Anthropic, anthropic.Options{
+		Cache: cacheClient.Responses(),
+	})); err != nil {
+		return nil, err
+	}
+
 	oAIClient, err := openai.NewClient(opts.OpenAI, openai.Options{
-		Cache:   cacheClient,
+		Cache:   cacheClient.Responses(),
 		SetSeed: true,
 	})
 	if err != nil {
@@ -87,7 +116,9 @@ func New(opts *Options) (*GPTScript, error) {
 	}
 
 	if opts.Runner.RuntimeManager == nil {
-		opts.Runner.RuntimeManager = runtimes.Default(cacheClient.CacheDir())
+		opts.Runner.RuntimeManager = runtimes.Default(cacheClient.CacheDir(), runtimes.Options{
+			GoMetrics: opts.GoMetrics,
+		})
 	}
 
 	runner, err := runner.New(registry, opts.CredentialContext, opts.Runner)
@@ -115,6 +146,9 @@ func New(opts *Options) (*GPTScript, error) {
 		WorkspacePath:          opts.Workspace,
 		DeleteWorkspaceOnClose: opts.Workspace == "",
 		extraEnv:               extraEnv,
+		runtimeManager:         opts.Runner.RuntimeManager,
+		timeout:                opts.Timeout,
+		outputSchema:           opts.OutputSchema,
 		close:                  closeServer,
 	}, nil
 }
@@ -148,7 +182,11 @@ func (g *GPTScript) Chat(ctx context.Context, prevState runner.ChatState, prg ty
 		return runner.ChatResponse{}, err
 	}
 
-	return g.Runner.Chat(ctx, prevState, prg, envs, input)
+	ctx, cancel := g.withTimeout(ctx)
+	defer cancel()
+
+	resp, err := g.Runner.Chat(ctx, prevState, prg, envs, input)
+	return resp, timeoutError(ctx, err)
 }
 
 func (g *GPTScript) Run(ctx context.Context, prg types.Program, envs []string, input string) (string, error) {
@@ -157,7 +195,15 @@ func (g *GPTScript) Run(ctx context.Context, prg types.Program, envs []string, i
 		return "", err
 	}
 
-	return g.Runner.Run(ctx, prg, envs, input)
+	ctx, cancel := g.withTimeout(ctx)
+	defer cancel()
+
+	prg = g.withOutputSchema(prg)
+	out, err := g.Runner.Run(ctx, prg, envs, input)
+	if err != nil {
+		return out, timeoutError(ctx, err)
+	}
+	return out, g.validateOutput(out)
 }
 
 func (g *GPTScript) Close(closeDaemons bool) {
@@ -171,6 +217,7 @@ func (g *GPTScript) Close(closeDaemons bool) {
 
 	if closeDaemons {
 		engine.CloseDaemons()
+		mcp.CloseSessions()
 	}
 }
 
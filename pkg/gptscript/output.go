@@ -0,0 +1,24 @@
+package gptscript
+
+import (
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// withOutputSchema gives the entry tool of the program the output schema of g, so that a model asked for the result is
+// told the schema and asked to repair a response that does not match it, as for tools with an output schema.
+func (g *GPTScript) withOutputSchema(prg types.Program) types.Program {
+	if g.outputSchema == nil {
+		return prg
+	}
+	return prg.SetOutputSchema(g.outputSchema)
+}
+
+// validateOutput checks the result of a run against the output schema of g. This is what catches results of entry
+// tools that are not answered by a model, such as commands, which can't be repaired.
+func (g *GPTScript) validateOutput(output string) error {
+	if g.outputSchema == nil {
+		return nil
+	}
+	return engine.ValidateOutput(g.outputSchema, output)
+}
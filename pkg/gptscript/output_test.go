@@ -0,0 +1,48 @@
+package gptscript
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gptscript-ai/gptscript/pkg/cache"
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/loader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunOutputSchema(t *testing.T) {
+	schema := &openapi3.Schema{}
+	require.NoError(t, json.Unmarshal([]byte(`{"type": "object", "properties": {"name": {"type": "string"}}, "required": ["name"]}`), schema))
+
+	quiet := true
+	g, err := New(&Options{
+		Cache:        cache.Options{CacheDir: t.TempDir()},
+		Quiet:        &quiet,
+		OutputSchema: schema,
+	})
+	require.NoError(t, err)
+	defer g.Close(false)
+
+	run := func(output string) (string, error) {
+		prg, err := loader.ProgramFromSource(context.Background(), "#!sys.echo\n"+output, "")
+		require.NoError(t, err)
+		return g.Run(context.Background(), prg, nil, "")
+	}
+
+	// The entry tool is not answered by a model, so its result is only checked after the run
+	_, err = run("I am Bob")
+	var schemaErr *engine.OutputSchemaError
+	require.ErrorAs(t, err, &schemaErr)
+	assert.Equal(t, "I am Bob", schemaErr.Output)
+
+	_, err = run(`{"age": 42}`)
+	require.ErrorAs(t, err, &schemaErr)
+	assert.ErrorContains(t, err, `property "name" is missing`)
+
+	out, err := run(`{"name": "Bob"}`)
+	require.NoError(t, err)
+	assert.Equal(t, `{"name": "Bob"}`, out)
+}
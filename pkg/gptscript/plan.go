@@ -0,0 +1,224 @@
+package gptscript
+
+import (
+	"encoding/json"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/credentials"
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/mcp"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// Planner is implemented by runtime managers that can tell which runtime a tool is run with, without setting it up.
+type Planner interface {
+	Runtime(tool types.Tool, cmd, env []string) (string, bool)
+}
+
+// Plan is what a program needs to run: its tools, the runtimes that are downloaded for them, the credentials they ask
+// for, the models they call and the hosts they contact.
+type Plan struct {
+	Tools       []PlanTool       `json:"tools,omitempty"`
+	Runtimes    []string         `json:"runtimes,omitempty"`
+	Credentials []PlanCredential `json:"credentials,omitempty"`
+	Models      []string         `json:"models,omitempty"`
+	Hosts       []string         `json:"hosts,omitempty"`
+}
+
+type PlanTool struct {
+	ToolID string `json:"toolID,omitempty"`
+	Name   string `json:"name,omitempty"`
+	// Type is prompt, builtin, command, daemon, http, openapi, mcp, echo or credential
+	Type        string   `json:"type,omitempty"`
+	Source      string   `json:"source,omitempty"`
+	Repo        string   `json:"repo,omitempty"`
+	Command     []string `json:"command,omitempty"`
+	Runtime     string   `json:"runtime,omitempty"`
+	Model       string   `json:"model,omitempty"`
+	Credentials []string `json:"credentials,omitempty"`
+	Hosts       []string `json:"hosts,omitempty"`
+}
+
+type PlanCredential struct {
+	// Reference is the credential as the tools that ask for it reference it
+	Reference string `json:"reference,omitempty"`
+	// ToolIDs are the credential tools it resolves to
+	ToolIDs []string `json:"toolIDs,omitempty"`
+	// RequestedBy are the tools that ask for it
+	RequestedBy []string `json:"requestedBy,omitempty"`
+}
+
+// Plan returns what the program needs to run, from its tools alone, without running any of them, calling a model or
+// setting up a runtime.
+func (g *GPTScript) Plan(prg types.Program, envs []string) (Plan, error) {
+	envs, err := g.getEnv(envs)
+	if err != nil {
+		return Plan{}, err
+	}
+
+	planner, _ := g.runtimeManager.(Planner)
+
+	var (
+		plan        Plan
+		runtimes    = map[string]struct{}{}
+		models      = map[string]struct{}{}
+		hosts       = map[string]struct{}{}
+		credentials = map[string]*PlanCredential{}
+	)
+	for _, tool := range sortedTools(prg) {
+		planTool := planTool(tool)
+
+		if tool.IsCommand() && tool.BuiltinFunc == nil && !tool.IsHTTP() && !tool.IsOpenAPI() && !tool.IsEcho() &&
+			!tool.IsMCP() && !tool.IsOAuthDevice() && !tool.IsOpenAPICredential() {
+			// Tools whose command can't be split fail when they are run, which is not for the plan to report
+			planTool.Command, _ = interpreter(tool)
+			if planner != nil && len(planTool.Command) > 0 {
+				planTool.Runtime, _ = planner.Runtime(tool, planTool.Command, envs)
+			}
+		}
+
+		for _, ref := range tool.Credentials {
+			cred, ok := credentials[ref]
+			if !ok {
+				cred = &PlanCredential{
+					Reference: ref,
+				}
+				for _, credRef := range tool.ToolMapping[ref] {
+					cred.ToolIDs = append(cred.ToolIDs, credRef.ToolID)
+				}
+				credentials[ref] = cred
+			}
+			cred.RequestedBy = append(cred.RequestedBy, tool.ID)
+		}
+
+		if planTool.Runtime != "" {
+			runtimes[planTool.Runtime] = struct{}{}
+		}
+		if planTool.Model != "" {
+			models[planTool.Model] = struct{}{}
+		}
+		for _, host := range planTool.Hosts {
+			hosts[host] = struct{}{}
+		}
+		plan.Tools = append(plan.Tools, planTool)
+	}
+
+	plan.Runtimes = sortedKeys(runtimes)
+	plan.Models = sortedKeys(models)
+	plan.Hosts = sortedKeys(hosts)
+	for _, ref := range sortedKeys(credentials) {
+		plan.Credentials = append(plan.Credentials, *credentials[ref])
+	}
+	return plan, nil
+}
+
+func planTool(tool types.Tool) PlanTool {
+	result := PlanTool{
+		ToolID:      tool.ID,
+		Name:        tool.Name,
+		Source:      tool.Source.Location,
+		Credentials: tool.Credentials,
+	}
+
+	var hosts []string
+	if tool.Source.Repo != nil {
+		result.Repo = tool.Source.Repo.Root
+		hosts = append(hosts, repoHost(tool.Source.Repo.Root))
+	} else {
+		hosts = append(hosts, urlHost(tool.Source.Location))
+	}
+
+	line, _, _ := strings.Cut(tool.Instructions, "\n")
+	switch {
+	case tool.BuiltinFunc != nil:
+		result.Type = "builtin"
+	case tool.IsHTTP():
+		result.Type = "http"
+		if host := urlHost(strings.TrimPrefix(line, types.CommandPrefix)); !strings.HasSuffix(host, engine.DaemonURLSuffix) {
+			hosts = append(hosts, host)
+		}
+	case tool.IsDaemon():
+		result.Type = "daemon"
+	case tool.IsOpenAPI():
+		result.Type = "openapi"
+		var instructions engine.OpenAPIInstructions
+		_, inst, _ := strings.Cut(tool.Instructions, types.OpenAPIPrefix+" ")
+		if json.Unmarshal([]byte(strings.Trim(inst, "'")), &instructions) == nil {
+			hosts = append(hosts, urlHost(instructions.Server))
+		}
+	case tool.IsOpenAPICredential():
+		result.Type = "credential"
+		var instructions engine.OpenAPICredentialInstructions
+		if json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(tool.Instructions, types.OpenAPICredentialPrefix))), &instructions) == nil {
+			hosts = append(hosts, urlHost(instructions.Server))
+		}
+	case tool.IsOAuthDevice():
+		result.Type = "credential"
+		var config credentials.OAuthDeviceConfig
+		if json.Unmarshal([]byte(strings.TrimPrefix(tool.Instructions, types.OAuthDevicePrefix)), &config) == nil {
+			hosts = append(hosts, urlHost(config.DeviceAuthorizationURL), urlHost(config.TokenURL))
+		}
+	case tool.IsMCP():
+		result.Type = "mcp"
+		var instructions mcp.ToolInstructions
+		if json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(tool.Instructions, types.MCPPrefix))), &instructions) == nil {
+			if instructions.Config.URL != "" {
+				hosts = append(hosts, urlHost(instructions.Config.URL))
+			} else {
+				result.Command = append([]string{instructions.Config.Command}, instructions.Config.Args...)
+			}
+		}
+	case tool.IsEcho():
+		result.Type = "echo"
+	case tool.IsCommand():
+		result.Type = "command"
+	default:
+		result.Type = "prompt"
+		result.Model = tool.Parameters.ModelName
+	}
+
+	for _, host := range hosts {
+		if host != "" && !slices.Contains(result.Hosts, host) {
+			result.Hosts = append(result.Hosts, host)
+		}
+	}
+	return result
+}
+
+// urlHost returns the host of rawURL, or nothing if it is not a URL with a host, such as a local path.
+func urlHost(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// repoHost returns the host of the root of a repo, which can also be without a scheme, like github.com/org/repo or
+// git@github.com:org/repo.
+func repoHost(root string) string {
+	if host := urlHost(root); host != "" {
+		return host
+	}
+	host, _, _ := strings.Cut(root, "/")
+	if _, after, ok := strings.Cut(host, "@"); ok {
+		host = after
+	}
+	host, _, _ = strings.Cut(host, ":")
+	if !strings.Contains(host, ".") {
+		return ""
+	}
+	return host
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,61 @@
+package gptscript
+
+import (
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanTool(t *testing.T) {
+	tool := planTool(types.Tool{
+		ToolDef: types.ToolDef{
+			Parameters: types.Parameters{
+				Name: "fetch",
+			},
+			Instructions: "#!https://api.example.com/fetch",
+		},
+		ID: "fetch.gpt:fetch",
+		Source: types.ToolSource{
+			Location: "https://raw.example.com/tools/fetch.gpt",
+		},
+	})
+	assert.Equal(t, "http", tool.Type)
+	assert.Equal(t, []string{"raw.example.com", "api.example.com"}, tool.Hosts)
+
+	tool = planTool(types.Tool{
+		ToolDef: types.ToolDef{
+			Instructions: "#!http://search.daemon.gptscript.local/search",
+		},
+		Source: types.ToolSource{
+			Location: "./tools/search.gpt",
+		},
+	})
+	assert.Equal(t, "http", tool.Type)
+	assert.Empty(t, tool.Hosts)
+
+	tool = planTool(types.Tool{
+		ToolDef: types.ToolDef{
+			Parameters: types.Parameters{
+				ModelName:   "gpt-4o",
+				Credentials: []string{"github.com/gptscript-ai/credential as github"},
+			},
+			Instructions: "Summarize the input",
+		},
+	})
+	assert.Equal(t, "prompt", tool.Type)
+	assert.Equal(t, "gpt-4o", tool.Model)
+	assert.Equal(t, []string{"github.com/gptscript-ai/credential as github"}, tool.Credentials)
+}
+
+func TestRepoHost(t *testing.T) {
+	for root, host := range map[string]string{
+		"https://github.com/gptscript-ai/dalle-image-generation.git": "github.com",
+		"github.com/gptscript-ai/search":                             "github.com",
+		"git@gitlab.example.com:tools/search.git":                    "gitlab.example.com",
+		"ghcr.io/gptscript-ai/tools":                                 "ghcr.io",
+		"local/repo":                                                 "",
+	} {
+		assert.Equal(t, host, repoHost(root), root)
+	}
+}
@@ -0,0 +1,95 @@
+package gptscript
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/shlex"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// Prefetcher is implemented by runtime managers that can set up a tool without running it.
+type Prefetcher interface {
+	Prefetch(ctx context.Context, tool types.Tool, cmd, env []string) (bool, error)
+}
+
+type PrefetchResult struct {
+	ToolID string `json:"toolID,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Cached bool   `json:"cached,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Prefetch fetches the repos and sets up the runtimes of all the command and daemon tools in the program, without
+// running any of them, so that later runs can start right away or with GPTSCRIPT_OFFLINE set. Tools that fail to set
+// up are reported in their result and the returned error, and don't stop the other tools from being fetched.
+func (g *GPTScript) Prefetch(ctx context.Context, prg types.Program, envs []string) ([]PrefetchResult, error) {
+	p, ok := g.runtimeManager.(Prefetcher)
+	if !ok {
+		return nil, fmt.Errorf("runtime manager %T does not support prefetching", g.runtimeManager)
+	}
+
+	envs, err := g.getEnv(envs)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		results []PrefetchResult
+		errs    []error
+	)
+	for _, tool := range sortedTools(prg) {
+		if tool.Source.Repo == nil || !tool.IsCommand() || tool.IsHTTP() || tool.IsOpenAPI() || tool.IsEcho() {
+			continue
+		}
+
+		result := PrefetchResult{
+			ToolID: tool.ID,
+			Name:   tool.Name,
+		}
+
+		cmd, err := interpreter(tool)
+		if err == nil {
+			result.Cached, err = p.Prefetch(ctx, tool, cmd, envs)
+		}
+		if err != nil {
+			result.Error = err.Error()
+			errs = append(errs, fmt.Errorf("failed to prefetch %s: %w", tool.ID, err))
+		}
+
+		results = append(results, result)
+	}
+
+	return results, errors.Join(errs...)
+}
+
+func sortedTools(prg types.Program) []types.Tool {
+	tools := make([]types.Tool, 0, len(prg.ToolSet))
+	for _, tool := range prg.ToolSet {
+		tools = append(tools, tool)
+	}
+	sort.Slice(tools, func(i, j int) bool {
+		return tools[i].ID < tools[j].ID
+	})
+	return tools
+}
+
+// interpreter returns the command from the first line of the tool's instructions, the same way the engine splits it
+// before asking the runtime manager for the tool's context. Daemons have their prefix and optional (path=...) removed.
+func interpreter(tool types.Tool) ([]string, error) {
+	line, _, _ := strings.Cut(tool.Instructions, "\n")
+	line = strings.TrimSpace(line)
+	if tool.IsDaemon() {
+		line = strings.TrimSpace(strings.TrimPrefix(line, types.DaemonPrefix))
+		if strings.HasPrefix(line, "(") {
+			if _, rest, ok := strings.Cut(line, ")"); ok {
+				line = rest
+			}
+		}
+		return shlex.Split(line)
+	}
+	return shlex.Split(strings.TrimPrefix(line, types.CommandPrefix))
+}
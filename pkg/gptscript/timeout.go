@@ -0,0 +1,35 @@
+package gptscript
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TimeoutError is returned by Run and Chat when a run takes longer than Options.Timeout.
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+func (t *TimeoutError) Error() string {
+	return fmt.Sprintf("run did not finish within the timeout of %s", t.Timeout)
+}
+
+// withTimeout bounds the run in ctx by the timeout of g, if it has one. Cancelling the returned context stops the model
+// calls, tool commands and runtime setup of the run.
+func (g *GPTScript) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if g.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, g.timeout, &TimeoutError{Timeout: g.timeout})
+}
+
+// timeoutError returns the timeout error of ctx in place of err if the run failed because it timed out.
+func timeoutError(ctx context.Context, err error) error {
+	var timeoutErr *TimeoutError
+	if err != nil && errors.As(context.Cause(ctx), &timeoutErr) {
+		return timeoutErr
+	}
+	return err
+}
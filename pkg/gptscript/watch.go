@@ -0,0 +1,68 @@
+package gptscript
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/gptscript-ai/gptscript/pkg/watch"
+)
+
+const (
+	watchInterval = 200 * time.Millisecond
+	watchDebounce = 500 * time.Millisecond
+)
+
+// Watch watches the directories of the tools of the program that are not from a repo, and when files of one of them
+// change, builds its command tools again with GPTSCRIPT_BUILD_LOCAL_TOOLS set and calls changed with the tools and
+// the errors of the builds. It returns when ctx is done.
+func (g *GPTScript) Watch(ctx context.Context, prg types.Program, envs []string, changed func(tools []types.Tool, err error)) error {
+	envs, err := g.getEnv(envs)
+	if err != nil {
+		return err
+	}
+	envs = append(envs, "GPTSCRIPT_BUILD_LOCAL_TOOLS=true")
+
+	var (
+		dirs  []string
+		tools = sortedTools(prg)
+	)
+	for _, tool := range tools {
+		if tool.Source.Repo == nil && tool.WorkingDir != "" && !slices.Contains(dirs, tool.WorkingDir) {
+			dirs = append(dirs, tool.WorkingDir)
+		}
+	}
+	if len(dirs) == 0 {
+		return fmt.Errorf("program has no local tools to watch")
+	}
+
+	watch.Dirs(ctx, dirs, watchInterval, watchDebounce, func(dirs []string) {
+		var (
+			changedTools []types.Tool
+			errs         []error
+		)
+		for _, tool := range tools {
+			if tool.Source.Repo != nil || !slices.Contains(dirs, tool.WorkingDir) {
+				continue
+			}
+			changedTools = append(changedTools, tool)
+			if !tool.IsCommand() || tool.IsHTTP() || tool.IsOpenAPI() || tool.IsEcho() {
+				continue
+			}
+
+			cmd, err := interpreter(tool)
+			if err == nil {
+				_, _, err = g.runtimeManager.GetContext(ctx, tool, cmd, envs)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to build %s: %w", tool.ID, err))
+			}
+		}
+		changed(changedTools, errors.Join(errs...))
+	})
+
+	return nil
+}
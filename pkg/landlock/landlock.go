@@ -0,0 +1,56 @@
+// Package landlock restricts the files and network a command can access with the landlock LSM of Linux. A restricted
+// command is run through gptscript itself, which applies the restrictions to its own process and then executes the
+// command, as Go can't run code between fork and exec.
+package landlock
+
+import (
+	"encoding/json"
+	"os/exec"
+
+	"github.com/gptscript-ai/gptscript/pkg/system"
+)
+
+// Command is the argument that runs gptscript as the wrapper of a restricted command.
+const Command = "sys.landlock"
+
+// SystemReadOnly are the paths most programs need to be able to read and execute, such as interpreters, libraries and
+// configuration of the system.
+var SystemReadOnly = []string{
+	"/bin",
+	"/sbin",
+	"/usr",
+	"/lib",
+	"/lib32",
+	"/lib64",
+	"/etc",
+	"/opt",
+	"/nix",
+	"/proc",
+	"/sys",
+}
+
+// SystemReadWrite are the paths most programs need to be able to write, such as /dev/null and /dev/tty.
+var SystemReadWrite = []string{
+	"/dev",
+}
+
+// Rules are what a restricted command can access. Paths that don't exist are ignored.
+type Rules struct {
+	// ReadOnly are paths whose files the command can read and execute.
+	ReadOnly []string `json:"readOnly,omitempty"`
+	// ReadWrite are paths the command can also create, change and remove files in.
+	ReadWrite []string `json:"readWrite,omitempty"`
+	// NoNetwork denies the command to connect to or listen on TCP ports.
+	NoNetwork bool `json:"noNetwork,omitempty"`
+}
+
+// Wrap changes cmd to run through gptscript, which restricts itself by the rules before executing the command.
+func Wrap(cmd *exec.Cmd, rules Rules) error {
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	cmd.Args = append([]string{system.Bin(), Command, string(data), cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = system.Bin()
+	return nil
+}
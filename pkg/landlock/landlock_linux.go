@@ -0,0 +1,135 @@
+package landlock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	readAccess = unix.LANDLOCK_ACCESS_FS_EXECUTE | unix.LANDLOCK_ACCESS_FS_READ_FILE | unix.LANDLOCK_ACCESS_FS_READ_DIR
+	// fileAccess are the rights that apply to files, the only ones a rule for a file, rather than a directory, can have
+	fileAccess = unix.LANDLOCK_ACCESS_FS_EXECUTE | unix.LANDLOCK_ACCESS_FS_WRITE_FILE | unix.LANDLOCK_ACCESS_FS_READ_FILE |
+		unix.LANDLOCK_ACCESS_FS_TRUNCATE
+	netAccess = unix.LANDLOCK_ACCESS_NET_BIND_TCP | unix.LANDLOCK_ACCESS_NET_CONNECT_TCP
+)
+
+// ABI returns the version of landlock the kernel supports, and 0 if it doesn't support landlock. Restricting the
+// network needs version 4.
+func ABI() int {
+	version, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, 0, 0, unix.LANDLOCK_CREATE_RULESET_VERSION)
+	if errno != 0 {
+		return 0
+	}
+	return int(version)
+}
+
+// fsAccess returns the file system rights a kernel with the landlock version knows, which are all denied unless a rule
+// allows them.
+func fsAccess(abi int) uint64 {
+	access := uint64(unix.LANDLOCK_ACCESS_FS_EXECUTE | unix.LANDLOCK_ACCESS_FS_WRITE_FILE | unix.LANDLOCK_ACCESS_FS_READ_FILE |
+		unix.LANDLOCK_ACCESS_FS_READ_DIR | unix.LANDLOCK_ACCESS_FS_REMOVE_DIR | unix.LANDLOCK_ACCESS_FS_REMOVE_FILE |
+		unix.LANDLOCK_ACCESS_FS_MAKE_CHAR | unix.LANDLOCK_ACCESS_FS_MAKE_DIR | unix.LANDLOCK_ACCESS_FS_MAKE_REG |
+		unix.LANDLOCK_ACCESS_FS_MAKE_SOCK | unix.LANDLOCK_ACCESS_FS_MAKE_FIFO | unix.LANDLOCK_ACCESS_FS_MAKE_BLOCK |
+		unix.LANDLOCK_ACCESS_FS_MAKE_SYM)
+	if abi >= 2 {
+		access |= unix.LANDLOCK_ACCESS_FS_REFER
+	}
+	if abi >= 3 {
+		access |= unix.LANDLOCK_ACCESS_FS_TRUNCATE
+	}
+	return access
+}
+
+// SysLandlock is the wrapper of a restricted command, run as "gptscript sys.landlock <rules> <command> <args>...". It
+// restricts its process by the rules and replaces it with the command, which keeps the restrictions.
+func SysLandlock() error {
+	var rules Rules
+	if err := json.Unmarshal([]byte(os.Args[2]), &rules); err != nil {
+		return fmt.Errorf("invalid landlock rules: %w", err)
+	}
+
+	// The restrictions apply to the thread that makes them, which has to be the one that executes the command
+	runtime.LockOSThread()
+	if err := restrict(rules); err != nil {
+		return err
+	}
+	return syscall.Exec(os.Args[3], os.Args[3:], os.Environ())
+}
+
+func restrict(rules Rules) error {
+	abi := ABI()
+	if abi == 0 {
+		return fmt.Errorf("landlock is not supported by the kernel")
+	}
+
+	attr := unix.LandlockRulesetAttr{
+		Access_fs: fsAccess(abi),
+	}
+	size := unsafe.Sizeof(attr.Access_fs)
+	if abi >= 4 {
+		size = unsafe.Sizeof(attr)
+		if rules.NoNetwork {
+			attr.Access_net = netAccess
+		}
+	}
+
+	fd, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, uintptr(unsafe.Pointer(&attr)), size, 0)
+	if errno != 0 {
+		return fmt.Errorf("failed to create landlock ruleset: %w", errno)
+	}
+	defer unix.Close(int(fd))
+
+	for _, path := range rules.ReadOnly {
+		if err := addPathRule(int(fd), path, readAccess&attr.Access_fs); err != nil {
+			return err
+		}
+	}
+	for _, path := range rules.ReadWrite {
+		if err := addPathRule(int(fd), path, attr.Access_fs); err != nil {
+			return err
+		}
+	}
+
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to set no new privileges: %w", err)
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_LANDLOCK_RESTRICT_SELF, fd, 0, 0); errno != 0 {
+		return fmt.Errorf("failed to apply landlock ruleset: %w", errno)
+	}
+	return nil
+}
+
+func addPathRule(rulesetFD int, path string, access uint64) error {
+	fd, err := unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+	if errors.Is(err, unix.ENOENT) || errors.Is(err, unix.ENOTDIR) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to open %s for landlock rule: %w", path, err)
+	}
+	defer unix.Close(fd)
+
+	var stat unix.Stat_t
+	if err := unix.Fstat(fd, &stat); err != nil {
+		return fmt.Errorf("failed to stat %s for landlock rule: %w", path, err)
+	}
+	if stat.Mode&unix.S_IFMT != unix.S_IFDIR {
+		access &= fileAccess
+	}
+
+	attr := unix.LandlockPathBeneathAttr{
+		Allowed_access: access,
+		Parent_fd:      int32(fd),
+	}
+	if _, _, errno := unix.Syscall6(unix.SYS_LANDLOCK_ADD_RULE, uintptr(rulesetFD), unix.LANDLOCK_RULE_PATH_BENEATH,
+		uintptr(unsafe.Pointer(&attr)), 0, 0, 0); errno != 0 {
+		return fmt.Errorf("failed to add landlock rule for %s: %w", path, errno)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package landlock
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMain restricts the test binary by the rules in GPTSCRIPT_TEST_LANDLOCK and reports which of the files in its
+// arguments it can read and write, as a process can't be unrestricted again.
+func TestMain(m *testing.M) {
+	if data := os.Getenv("GPTSCRIPT_TEST_LANDLOCK"); data != "" {
+		var rules Rules
+		if err := json.Unmarshal([]byte(data), &rules); err != nil {
+			panic(err)
+		}
+		if err := restrict(rules); err != nil {
+			panic(err)
+		}
+		for _, file := range os.Args[1:] {
+			_, readErr := os.ReadFile(file)
+			writeErr := os.WriteFile(file, []byte("written"), 0644)
+			fmt.Printf("%s read=%t write=%t\n", filepath.Base(file), readErr == nil, writeErr == nil)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func TestRestrict(t *testing.T) {
+	if ABI() == 0 {
+		t.Skip("landlock is not supported by the kernel")
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"ro", "rw", "denied"} {
+		require.NoError(t, os.Mkdir(filepath.Join(dir, name), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name, name), []byte(name), 0644))
+	}
+
+	rules, err := json.Marshal(Rules{
+		ReadOnly:  []string{filepath.Join(dir, "ro"), filepath.Join(dir, "missing")},
+		ReadWrite: []string{filepath.Join(dir, "rw")},
+	})
+	require.NoError(t, err)
+
+	cmd := exec.Command(os.Args[0], filepath.Join(dir, "ro", "ro"), filepath.Join(dir, "rw", "rw"), filepath.Join(dir, "denied", "denied"))
+	cmd.Env = append(os.Environ(), "GPTSCRIPT_TEST_LANDLOCK="+string(rules))
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	assert.Equal(t, []string{
+		"ro read=true write=false",
+		"rw read=true write=true",
+		"denied read=false write=false",
+	}, strings.Split(strings.TrimSpace(string(out)), "\n"))
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package landlock
+
+import "fmt"
+
+// ABI returns 0, as landlock is only supported on Linux.
+func ABI() int {
+	return 0
+}
+
+func SysLandlock() error {
+	return fmt.Errorf("landlock is only supported on Linux")
+}
@@ -0,0 +1,66 @@
+package llm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AliasPrefix starts the model name of a tool that refers to a model alias, like @fast, instead of a model.
+const AliasPrefix = "@"
+
+// maxAliasDepth is how many aliases can refer to each other before the model they stand for is found
+const maxAliasDepth = 10
+
+// UnknownModelAliasError is returned by Call when the model of a request is an alias that is not defined.
+type UnknownModelAliasError struct {
+	Alias   string
+	Defined []string
+}
+
+func (u *UnknownModelAliasError) Error() string {
+	if len(u.Defined) == 0 {
+		return fmt.Sprintf("model alias %s%s is not defined, no model aliases are configured", AliasPrefix, u.Alias)
+	}
+	return fmt.Sprintf("model alias %s%s is not defined, the defined aliases are %s", AliasPrefix, u.Alias, strings.Join(u.Defined, ", "))
+}
+
+// SetAliases sets the aliases that models of requests are resolved with, by the names of the aliases without the
+// AliasPrefix. An alias stands for a model, such as gpt-4o-mini or llama3 from github.com/gptscript-ai/ollama-provider,
+// or for another alias.
+func (r *Registry) SetAliases(aliases map[string]string) error {
+	for name, model := range aliases {
+		if name == "" || strings.HasPrefix(name, AliasPrefix) || strings.TrimSpace(name) != name {
+			return fmt.Errorf("invalid model alias name %q", name)
+		}
+		if strings.TrimSpace(model) == "" {
+			return fmt.Errorf("invalid model alias %s, the model is empty", name)
+		}
+	}
+	r.aliases = aliases
+	return nil
+}
+
+// resolve returns the model that model stands for, if it is an alias, or model as it is.
+func (r *Registry) resolve(model string) (string, error) {
+	for depth := 0; ; depth++ {
+		name, ok := strings.CutPrefix(model, AliasPrefix)
+		if !ok {
+			return model, nil
+		}
+		if depth >= maxAliasDepth {
+			return "", fmt.Errorf("model alias %s refers to aliases more than %d times, it may refer to itself", model, maxAliasDepth)
+		}
+
+		resolved, ok := r.aliases[name]
+		if !ok {
+			defined := make([]string, 0, len(r.aliases))
+			for name := range r.aliases {
+				defined = append(defined, AliasPrefix+name)
+			}
+			sort.Strings(defined)
+			return "", &UnknownModelAliasError{Alias: name, Defined: defined}
+		}
+		model = strings.TrimSpace(resolved)
+	}
+}
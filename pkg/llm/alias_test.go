@@ -0,0 +1,87 @@
+package llm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type modelClient struct {
+	model  string
+	called string
+}
+
+func (m *modelClient) Call(_ context.Context, messageRequest types.CompletionRequest, _ chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	m.called = messageRequest.Model
+	return &types.CompletionMessage{}, nil
+}
+
+func (m *modelClient) ListModels(context.Context, ...string) ([]string, error) {
+	return []string{m.model}, nil
+}
+
+func (m *modelClient) Supports(_ context.Context, modelName string) (bool, error) {
+	return modelName == m.model, nil
+}
+
+func TestSetAliases(t *testing.T) {
+	r := NewRegistry()
+	assert.Error(t, r.SetAliases(map[string]string{"": "gpt-4o"}))
+	assert.Error(t, r.SetAliases(map[string]string{"@fast": "gpt-4o-mini"}))
+	assert.Error(t, r.SetAliases(map[string]string{" fast": "gpt-4o-mini"}))
+	assert.Error(t, r.SetAliases(map[string]string{"fast": " "}))
+	assert.NoError(t, r.SetAliases(nil))
+}
+
+func TestResolveAlias(t *testing.T) {
+	r := NewRegistry()
+	require.NoError(t, r.SetAliases(map[string]string{
+		"fast":  "gpt-4o-mini",
+		"cheap": "@fast",
+		"smart": "claude-3-5-sonnet from github.com/gptscript-ai/claude3-anthropic-provider",
+		"loop":  "@loop",
+	}))
+
+	model, err := r.resolve("gpt-4o")
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4o", model)
+
+	model, err = r.resolve("@cheap")
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4o-mini", model)
+
+	model, err = r.resolve("@smart")
+	require.NoError(t, err)
+	assert.Equal(t, "claude-3-5-sonnet from github.com/gptscript-ai/claude3-anthropic-provider", model)
+
+	_, err = r.resolve("@loop")
+	assert.ErrorContains(t, err, "may refer to itself")
+
+	_, err = r.resolve("@slow")
+	var unknown *UnknownModelAliasError
+	require.ErrorAs(t, err, &unknown)
+	assert.Equal(t, "slow", unknown.Alias)
+	assert.Equal(t, "model alias @slow is not defined, the defined aliases are @cheap, @fast, @loop, @smart", err.Error())
+
+	_, err = NewRegistry().resolve("@fast")
+	assert.EqualError(t, err, "model alias @fast is not defined, no model aliases are configured")
+}
+
+func TestCallAlias(t *testing.T) {
+	client := &modelClient{model: "gpt-4o-mini"}
+	r := NewRegistry()
+	require.NoError(t, r.AddClient(client))
+	require.NoError(t, r.SetAliases(map[string]string{"fast": "gpt-4o-mini"}))
+
+	_, err := r.Call(context.Background(), types.CompletionRequest{Model: "@fast"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4o-mini", client.called)
+
+	client.called = ""
+	_, err = r.Call(context.Background(), types.CompletionRequest{Model: "@smart"}, nil)
+	assert.ErrorAs(t, err, new(*UnknownModelAliasError))
+	assert.Empty(t, client.called)
+}
@@ -17,6 +17,7 @@ type Client interface {
 
 type Registry struct {
 	clients []Client
+	aliases map[string]string
 }
 
 func NewRegistry() *Registry {
@@ -44,6 +45,12 @@ func (r *Registry) Call(ctx context.Context, messageRequest types.CompletionRequ
 	if messageRequest.Model == "" {
 		return nil, fmt.Errorf("model is required")
 	}
+	model, err := r.resolve(messageRequest.Model)
+	if err != nil {
+		return nil, err
+	}
+	messageRequest.Model = model
+
 	var errs []error
 	for _, client := range r.clients {
 		ok, err := client.Supports(ctx, messageRequest.Model)
@@ -93,6 +93,9 @@ func Load(ctx context.Context, _ *cache.Client, urlName string) (string, *types.
 	if !strings.HasPrefix(urlName, GithubPrefix) {
 		return "", nil, false, nil
 	}
+	if loader.IsOffline(ctx) {
+		return "", nil, false, &loader.OfflineError{Name: urlName}
+	}
 
 	url, ref, _ := strings.Cut(urlName, "@")
 	if ref == "" {
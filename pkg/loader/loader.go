@@ -24,6 +24,7 @@ import (
 	"github.com/gptscript-ai/gptscript/pkg/builtin"
 	"github.com/gptscript-ai/gptscript/pkg/cache"
 	"github.com/gptscript-ai/gptscript/pkg/hash"
+	"github.com/gptscript-ai/gptscript/pkg/mcp"
 	"github.com/gptscript-ai/gptscript/pkg/parser"
 	"github.com/gptscript-ai/gptscript/pkg/system"
 	"github.com/gptscript-ai/gptscript/pkg/types"
@@ -172,7 +173,11 @@ func loadOpenAPI(prg *types.Program, data []byte) *openapi3.T {
 			return nil
 		}
 	case 3:
-		// Use OpenAPI v3 as is
+		// Use OpenAPI v3.0 as is, v3.1 is rewritten to v3.0 first
+		data, err = downgradeOpenAPI31(data)
+		if err != nil {
+			return nil
+		}
 		openAPIDocument, err = openapi3.NewLoader().LoadFromData(data)
 		if err != nil {
 			return nil
@@ -210,6 +215,14 @@ func readTool(ctx context.Context, cache *cache.Client, prg *types.Program, base
 		}
 	}
 
+	if config, ok := mcp.ParseConfig(data); ok && len(tools) == 0 {
+		var err error
+		tools, err = getMCPTools(config)
+		if err != nil {
+			return nil, fmt.Errorf("error loading MCP servers: %w", err)
+		}
+	}
+
 	if ext := path.Ext(base.Name); len(tools) == 0 && ext != "" && ext != system.Suffix && utf8.Valid(data) {
 		tools = []types.Tool{
 			{
@@ -324,7 +337,8 @@ func link(ctx context.Context, cache *cache.Client, prg *types.Program, base *so
 		tool.Parameters.Export,
 		tool.Parameters.ExportContext,
 		tool.Parameters.Context,
-		tool.Parameters.Credentials) {
+		tool.Parameters.Credentials,
+		tool.Parameters.ShareCredentials) {
 		noArgs, _ := types.SplitArg(targetToolName)
 		localTool, ok := localTools[strings.ToLower(noArgs)]
 		if ok {
@@ -371,6 +385,9 @@ func ProgramFromSource(ctx context.Context, content, subToolName string, opts ..
 		}()
 	}
 	opt := complete(opts...)
+	if opt.Offline {
+		ctx = WithOffline(ctx)
+	}
 
 	prg := types.Program{
 		ToolSet: types.ToolSet{},
@@ -388,16 +405,44 @@ func ProgramFromSource(ctx context.Context, content, subToolName string, opts ..
 
 type Options struct {
 	Cache *cache.Client
+	// Offline fails to load tools that would have to be fetched over the network, instead of fetching them. Remote
+	// tools that are in the cache are still loaded from it.
+	Offline bool
 }
 
 func complete(opts ...Options) (result Options) {
 	for _, opt := range opts {
 		result.Cache = types.FirstSet(opt.Cache, result.Cache)
+		result.Offline = types.FirstSet(opt.Offline, result.Offline)
 	}
 
 	return
 }
 
+// OfflineError is returned for a tool that is not in the cache and would have to be fetched over the network to load
+// it while offline.
+type OfflineError struct {
+	Name string
+}
+
+func (o *OfflineError) Error() string {
+	return fmt.Sprintf("loading %s needs the network, but GPTSCRIPT_OFFLINE is set", o.Name)
+}
+
+type offlineKey struct{}
+
+// WithOffline returns a context for loading tools offline, see Options.Offline.
+func WithOffline(ctx context.Context) context.Context {
+	return context.WithValue(ctx, offlineKey{}, true)
+}
+
+// IsOffline returns true if tools are loaded offline with ctx. The VCS lookups that resolve tools over the network
+// return an OfflineError instead.
+func IsOffline(ctx context.Context) bool {
+	offline, _ := ctx.Value(offlineKey{}).(bool)
+	return offline
+}
+
 func Program(ctx context.Context, name, subToolName string, opts ...Options) (types.Program, error) {
 	// We want all paths to have / not \
 	name = strings.ReplaceAll(name, "\\", "/")
@@ -410,6 +455,9 @@ func Program(ctx context.Context, name, subToolName string, opts ...Options) (ty
 	}
 
 	opt := complete(opts...)
+	if opt.Offline {
+		ctx = WithOffline(ctx)
+	}
 
 	if subToolName == "" {
 		name, subToolName = types.SplitToolRef(name)
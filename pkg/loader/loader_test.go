@@ -8,8 +8,12 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 
+	"github.com/gptscript-ai/gptscript/pkg/cache"
+	"github.com/gptscript-ai/gptscript/pkg/engine"
 	"github.com/gptscript-ai/gptscript/pkg/types"
 	"github.com/hexops/autogold/v2"
 	"github.com/stretchr/testify/require"
@@ -51,6 +55,35 @@ Stuff
 	require.NoError(t, err)
 }
 
+func TestLoadOffline(t *testing.T) {
+	var requests atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		_, _ = fmt.Fprint(w, "#!sys.echo\n\nremote")
+	}))
+	defer s.Close()
+
+	c, err := cache.New(cache.Options{CacheDir: t.TempDir()})
+	require.NoError(t, err)
+	source := "tools: " + s.URL + "/tool.gpt\n\nUse the remote tool"
+
+	// A remote tool that is not in the cache is not fetched
+	_, err = ProgramFromSource(context.Background(), source, "", Options{Cache: c, Offline: true})
+	var offlineErr *OfflineError
+	require.ErrorAs(t, err, &offlineErr)
+	require.Equal(t, s.URL+"/tool.gpt", offlineErr.Name)
+	require.Zero(t, requests.Load())
+
+	_, err = ProgramFromSource(context.Background(), source, "", Options{Cache: c})
+	require.NoError(t, err)
+	require.EqualValues(t, 1, requests.Load())
+
+	// Once it is in the cache it is loaded from there
+	_, err = ProgramFromSource(context.Background(), source, "", Options{Cache: c, Offline: true})
+	require.NoError(t, err)
+	require.EqualValues(t, 1, requests.Load())
+}
+
 func TestIsOpenAPI(t *testing.T) {
 	datav2, err := os.ReadFile("testdata/openapi_v2.yaml")
 	require.NoError(t, err)
@@ -194,3 +227,104 @@ func TestHelloWorld(t *testing.T) {
   }
 }`).Equal(t, toString(prg))
 }
+
+func TestLoadOpenAPI31(t *testing.T) {
+	prg := types.Program{
+		ToolSet: types.ToolSet{},
+	}
+	data, err := os.ReadFile("testdata/openapi_v31.yaml")
+	require.NoError(t, err)
+	require.Equal(t, 3, isOpenAPI(data), "expected openapi v3")
+
+	_, err = readTool(context.Background(), nil, &prg, &source{Content: data}, "")
+	require.NoError(t, err, "failed to read openapi v3.1")
+
+	tools := map[string]types.Tool{}
+	for _, tool := range prg.ToolSet {
+		if tool.IsOpenAPI() {
+			tools[tool.Name] = tool
+		}
+	}
+	require.Len(t, tools, 3, "expected 3 openapi tools, webhooks are not tools")
+	require.Contains(t, tools, "showPetById")
+
+	limit := tools["listPets"].Arguments.Properties["limit"].Value
+	require.Equal(t, "integer", limit.Type)
+	require.True(t, limit.Nullable)
+	require.True(t, limit.ExclusiveMin)
+	require.Equal(t, 0.0, *limit.Min)
+	require.Equal(t, 10.0, limit.Example)
+
+	kind := tools["listPets"].Arguments.Properties["kind"].Value
+	require.Empty(t, kind.Type)
+	require.Len(t, kind.AnyOf, 2)
+
+	pet := tools["createPets"].Arguments.Properties["requestBodyContent"].Value
+	require.NotContains(t, pet.Properties, "id", "read only properties are not sent")
+	require.Equal(t, []any{"dog"}, pet.Properties["species"].Value.Enum)
+	require.Equal(t, "string", pet.Properties["tag"].Value.Type)
+	require.True(t, pet.Properties["tag"].Value.Nullable)
+
+	owner := pet.Properties["owner"].Value
+	require.Equal(t, "The owner of the pet", owner.Description)
+	require.Len(t, owner.AllOf, 1)
+	require.Contains(t, owner.AllOf[0].Value.Properties, "name")
+}
+
+func TestLoadOpenAPISecurity(t *testing.T) {
+	prg := types.Program{
+		ToolSet: types.ToolSet{},
+	}
+	data, err := os.ReadFile("testdata/openapi_v3_security.yaml")
+	require.NoError(t, err)
+	_, err = readTool(context.Background(), nil, &prg, &source{Content: data}, "")
+	require.NoError(t, err)
+
+	tools := map[string]types.Tool{}
+	for _, tool := range prg.ToolSet {
+		tools[tool.Name] = tool
+	}
+
+	require.Equal(t, []string{"credentials-apikey"}, tools["listItems"].Credentials)
+	require.Equal(t, []string{"credentials-oauth-or-basic"}, tools["createItem"].Credentials)
+	require.Empty(t, tools["getPublic"].Credentials)
+	// The same scheme for another server gets another credential tool, with other variables
+	require.Equal(t, []string{"credentials-apikey-2"}, tools["getOther"].Credentials)
+
+	credentialTool := prg.ToolSet[tools["createItem"].ToolMapping["credentials-oauth-or-basic"][0].ToolID]
+	require.True(t, credentialTool.IsOpenAPICredential())
+
+	var inst engine.OpenAPICredentialInstructions
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(credentialTool.Instructions, types.OpenAPICredentialPrefix)), &inst))
+	require.Equal(t, engine.OpenAPICredentialInstructions{
+		Server: "https://api.example.com/v1",
+		SecurityInfos: [][]engine.SecurityInfo{
+			{{Name: "oauth", Type: "oauth2", TokenURL: "https://auth.example.com/token", Scopes: []string{"write"}}},
+			{{Name: "basic", Type: "http", Scheme: "basic"}},
+		},
+	}, inst)
+
+	// Credential tools are not given to the model
+	require.Equal(t, []string{"listItems", "createItem", "getOther", "getPublic"}, tools[""].Export)
+}
+
+func TestLoadMCP(t *testing.T) {
+	prg := types.Program{
+		ToolSet: types.ToolSet{},
+	}
+	data := []byte(`{"mcpServers": {"files": {"command": "/does/not/exist", "args": ["."]}, "remote": {"url": "https://mcp.example.com/mcp"}}}`)
+	_, err := readTool(context.Background(), nil, &prg, &source{Content: data}, "")
+	require.NoError(t, err)
+
+	tools := map[string]types.Tool{}
+	for _, tool := range prg.ToolSet {
+		tools[tool.Name] = tool
+	}
+
+	// The servers were not started, or the command would have failed
+	require.Equal(t, []string{"files", "remote"}, tools[""].Export)
+	require.True(t, tools["files"].IsMCP())
+	require.Contains(t, tools["files"].Instructions, "/does/not/exist")
+	require.Contains(t, tools["remote"].Instructions, "https://mcp.example.com/mcp")
+	require.Contains(t, tools["remote"].Parameters.Arguments.Properties, "tool")
+}
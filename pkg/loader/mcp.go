@@ -0,0 +1,97 @@
+package loader
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gptscript-ai/gptscript/pkg/mcp"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// getMCPTools generates a tool for each server of an MCP configuration, named after the server, without starting or
+// connecting to it. A server is only started, or connected to, when its tool is first called, after the call was
+// authorized like for any other command. The tool lists the tools and resources of the server when it is called
+// without a tool or a URI, and otherwise calls the tool or reads the resource. The tools of a server are named by the
+// tool of the server, so that servers with tools of the same name don't collide. Like for OpenAPI definitions, the
+// first tool exports all others.
+func getMCPTools(config mcp.Config) ([]types.Tool, error) {
+	servers := make([]string, 0, len(config.MCPServers))
+	for server := range config.MCPServers {
+		servers = append(servers, server)
+	}
+	sort.Strings(servers)
+
+	tools := make([]types.Tool, 0, len(servers))
+	for _, server := range servers {
+		tool, err := serverTool(server, config.MCPServers[server])
+		if err != nil {
+			return nil, err
+		}
+		tools = append(tools, tool)
+	}
+
+	exportTool := types.Tool{
+		ToolDef: types.ToolDef{
+			Parameters: types.Parameters{
+				Description: fmt.Sprintf("This is a tool set for the MCP servers %s", strings.Join(servers, ", ")),
+				Export:      servers,
+			},
+		},
+	}
+
+	return append([]types.Tool{exportTool}, tools...), nil
+}
+
+// serverTool returns the tool that calls the tools and reads the resources of a server.
+func serverTool(server string, config mcp.ServerConfig) (types.Tool, error) {
+	tool := types.Tool{
+		ToolDef: types.ToolDef{
+			Parameters: types.Parameters{
+				Name: server,
+				Description: fmt.Sprintf("Calls the tools and reads the resources of the %s MCP server. Call it without "+
+					"a tool first to list its tools, their arguments and its resources.", server),
+				Arguments: &openapi3.Schema{
+					Type: "object",
+					Properties: openapi3.Schemas{
+						"tool": &openapi3.SchemaRef{
+							Value: &openapi3.Schema{
+								Type:        "string",
+								Description: "The name of the tool of the server to call, or nothing to list the tools of the server",
+							},
+						},
+						"arguments": &openapi3.SchemaRef{
+							Value: &openapi3.Schema{
+								Type:        "string",
+								Description: "The arguments of the tool, as a JSON object valid against the arguments the tool was listed with",
+							},
+						},
+						"uri": &openapi3.SchemaRef{
+							Value: &openapi3.Schema{
+								Type:        "string",
+								Description: "The URI of a resource of the server to read, instead of calling a tool",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	var err error
+	tool.Instructions, err = mcpInstructions(mcp.ToolInstructions{
+		Server: server,
+		Config: config,
+	})
+	return tool, err
+}
+
+func mcpInstructions(instructions mcp.ToolInstructions) (string, error) {
+	data, err := json.Marshal(instructions)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal tool instructions: %w", err)
+	}
+	return types.MCPPrefix + " " + string(data), nil
+}
@@ -0,0 +1,73 @@
+package oci
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/cache"
+	"github.com/gptscript-ai/gptscript/pkg/loader"
+	"github.com/gptscript-ai/gptscript/pkg/repos/oci"
+	"github.com/gptscript-ai/gptscript/pkg/system"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+func init() {
+	loader.AddVSC(Load)
+	loader.AddRepoReader(Read)
+}
+
+// Load resolves a tool of an OCI artifact, such as oci://registry.example.com/tools/search:v1, to the digest of the
+// artifact. The tool is tool.gpt in the root of the artifact, unless a path is given after the tag.
+func Load(ctx context.Context, _ *cache.Client, urlName string) (string, *types.Repo, bool, error) {
+	if !strings.HasPrefix(urlName, oci.Prefix) {
+		return "", nil, false, nil
+	}
+	if loader.IsOffline(ctx) {
+		return "", nil, false, &loader.OfflineError{Name: urlName}
+	}
+
+	ref, err := oci.ParseReference(urlName)
+	if err != nil {
+		return "", nil, false, err
+	}
+
+	file := ref.Path
+	if file == "" || file == "." {
+		file = "tool.gpt"
+	} else if !strings.HasSuffix(file, system.Suffix) && !strings.Contains(path.Base(file), ".") {
+		file += "/tool.gpt"
+	}
+
+	ref.Digest, err = oci.Resolve(ctx, ref)
+	if err != nil {
+		return "", nil, false, err
+	}
+	ref.Path = file
+
+	return ref.String(), &types.Repo{
+		VCS:      "oci",
+		Root:     ref.Name(),
+		Path:     path.Dir(file),
+		Name:     path.Base(file),
+		Revision: ref.Digest,
+	}, true, nil
+}
+
+// Read returns the content of the file of a repo that is an OCI artifact.
+func Read(ctx context.Context, repo types.Repo) ([]byte, string, bool, error) {
+	if repo.VCS != "oci" {
+		return nil, "", false, nil
+	}
+
+	ref, err := oci.ParseReference(oci.Prefix + repo.Root + "@" + repo.Revision + "/" + path.Join(repo.Path, repo.Name))
+	if err != nil {
+		return nil, "", false, err
+	}
+
+	data, err := oci.ReadFile(ctx, ref)
+	if err != nil {
+		return nil, "", false, err
+	}
+	return data, ref.String(), true, nil
+}
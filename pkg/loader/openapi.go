@@ -43,13 +43,13 @@ func getOpenAPITools(t *openapi3.T, defaultHost string) ([]types.Tool, error) {
 		return nil, err
 	}
 
-	var globalSecurity []map[string]struct{}
+	var globalSecurity []map[string][]string
 	if t.Security != nil {
 		for _, item := range t.Security {
-			current := map[string]struct{}{}
-			for name := range item {
+			current := map[string][]string{}
+			for name, scopes := range item {
 				if scheme, ok := t.Components.SecuritySchemes[name]; ok && slices.Contains(engine.SupportedSecurityTypes, scheme.Value.Type) {
-					current[name] = struct{}{}
+					current[name] = scopes
 				}
 			}
 			if len(current) > 0 {
@@ -63,6 +63,8 @@ func getOpenAPITools(t *openapi3.T, defaultHost string) ([]types.Tool, error) {
 		toolNames    []string
 		tools        []types.Tool
 		operationNum = 1 // Each tool gets an operation number, beginning with 1
+		// Operations with the same security requirements on the same server share a credential tool
+		credentialTools = map[string]types.Tool{}
 	)
 
 	pathMap := t.Paths.Map()
@@ -116,14 +118,15 @@ func getOpenAPITools(t *openapi3.T, defaultHost string) ([]types.Tool, error) {
 			}
 
 			var (
-				// auths are represented as a list of maps, where each map contains the names of the required security schemes.
-				// Items within the same map are a logical AND. The maps themselves are a logical OR. For example:
+				// auths are represented as a list of maps, where each map contains the names of the required security schemes,
+				// with the scopes they need. Items within the same map are a logical AND. The maps themselves are a logical OR.
+				// For example:
 				//	 security: # (A AND B) OR (C AND D)
 				//   - A
 				//     B
 				//   - C
 				//     D
-				auths            []map[string]struct{}
+				auths            []map[string][]string
 				queryParameters  []engine.Parameter
 				pathParameters   []engine.Parameter
 				headerParameters []engine.Parameter
@@ -224,9 +227,9 @@ func getOpenAPITools(t *openapi3.T, defaultHost string) ([]types.Tool, error) {
 					noAuth = true
 				}
 				for _, req := range *operation.Security {
-					current := map[string]struct{}{}
-					for name := range req {
-						current[name] = struct{}{}
+					current := map[string][]string{}
+					for name, scopes := range req {
+						current[name] = scopes
 					}
 					if len(current) > 0 {
 						auths = append(auths, current)
@@ -244,20 +247,25 @@ func getOpenAPITools(t *openapi3.T, defaultHost string) ([]types.Tool, error) {
 		outer:
 			for _, auth := range auths {
 				var current []engine.SecurityInfo
-				for name := range auth {
+				for _, name := range sortedKeys(auth) {
 					if scheme, ok := t.Components.SecuritySchemes[name]; ok {
 						if !slices.Contains(engine.SupportedSecurityTypes, scheme.Value.Type) {
 							// There is an unsupported type in this auth, so move on to the next one.
 							continue outer
 						}
 
-						current = append(current, engine.SecurityInfo{
+						info := engine.SecurityInfo{
 							Type:       scheme.Value.Type,
 							Name:       name,
 							In:         scheme.Value.In,
 							Scheme:     scheme.Value.Scheme,
 							APIKeyName: scheme.Value.Name,
-						})
+						}
+						if flows := scheme.Value.Flows; flows != nil && flows.ClientCredentials != nil {
+							info.TokenURL = flows.ClientCredentials.TokenURL
+							info.Scopes = auth[name]
+						}
+						current = append(current, info)
 					}
 				}
 
@@ -278,6 +286,15 @@ func getOpenAPITools(t *openapi3.T, defaultHost string) ([]types.Tool, error) {
 				return nil, err
 			}
 
+			// Only HTTPS requests are authenticated, so only they get a credential tool to ask for the secrets
+			if len(infos) > 0 && strings.HasPrefix(operationServer, "https://") {
+				credentialTool, err := getCredentialTool(credentialTools, operationServer, infos)
+				if err != nil {
+					return nil, err
+				}
+				tool.Parameters.Credentials = []string{credentialTool.Parameters.Name}
+			}
+
 			// Register
 			toolNames = append(toolNames, tool.Parameters.Name)
 			tools = append(tools, tool)
@@ -300,6 +317,14 @@ func getOpenAPITools(t *openapi3.T, defaultHost string) ([]types.Tool, error) {
 	// Add it to the front of the slice.
 	tools = append([]types.Tool{exportTool}, tools...)
 
+	// The credential tools come last. They are not exported, as only the operations that need them use them.
+	for _, key := range sortedKeys(credentialTools) {
+		credentialTool := credentialTools[key]
+		credentialTool.Source.LineNo = operationNum
+		tools = append(tools, credentialTool)
+		operationNum++
+	}
+
 	return tools, nil
 }
 
@@ -323,6 +348,66 @@ func instructionString(server, method, path, bodyMIME string, queryParameters, p
 	return fmt.Sprintf("%s '%s'", types.OpenAPIPrefix, string(instBytes)), nil
 }
 
+// getCredentialTool returns the credential tool for a server and security requirements, creating it if the server and
+// requirements have none yet. It is named after its security schemes, such as "credentials-apikey" or
+// "credentials-basic-or-oauth".
+func getCredentialTool(credentialTools map[string]types.Tool, server string, infos [][]engine.SecurityInfo) (types.Tool, error) {
+	inst, err := json.Marshal(engine.OpenAPICredentialInstructions{
+		Server:        server,
+		SecurityInfos: infos,
+	})
+	if err != nil {
+		return types.Tool{}, fmt.Errorf("failed to marshal credential tool instructions: %w", err)
+	}
+	instructions := types.OpenAPICredentialPrefix + " " + string(inst)
+
+	if credentialTool, ok := credentialTools[instructions]; ok {
+		return credentialTool, nil
+	}
+
+	sets := make([]string, 0, len(infos))
+	for _, infoSet := range infos {
+		names := make([]string, 0, len(infoSet))
+		for _, info := range infoSet {
+			names = append(names, strings.ToLower(info.Name))
+		}
+		sets = append(sets, strings.Join(names, "-"))
+	}
+	names := map[string]struct{}{}
+	for _, credentialTool := range credentialTools {
+		names[credentialTool.Parameters.Name] = struct{}{}
+	}
+	name := "credentials-" + strings.Join(sets, "-or-")
+	for base, i := name, 2; ; i++ {
+		if _, ok := names[name]; !ok {
+			break
+		}
+		// The same schemes for another server
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+
+	credentialTool := types.Tool{
+		ToolDef: types.ToolDef{
+			Parameters: types.Parameters{
+				Name:        name,
+				Description: "Gets the credentials for " + server,
+			},
+			Instructions: instructions,
+		},
+	}
+	credentialTools[instructions] = credentialTool
+	return credentialTool, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 func parseServer(server *openapi3.Server) (string, error) {
 	s := server.URL
 	for name, variable := range server.Variables {
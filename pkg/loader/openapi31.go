@@ -0,0 +1,188 @@
+package loader
+
+import (
+	"encoding/json"
+	"strings"
+
+	kyaml "sigs.k8s.io/yaml"
+)
+
+// downgradeOpenAPI31 rewrites an OpenAPI 3.1 definition to the OpenAPI 3.0 equivalent, so that it can be loaded with
+// openapi3, which only knows 3.0. Schemas of 3.1 are JSON Schema 2020-12, so their keywords are translated as far as
+// 3.0 can express them:
+//
+//   - type arrays become a single type and nullable, or anyOf for several types
+//   - const becomes an enum with one value, and examples becomes example
+//   - numeric exclusiveMinimum and exclusiveMaximum become minimum and maximum with the boolean flag
+//   - $ref with other keywords next to it becomes allOf with the reference, as 3.0 ignores the other keywords
+//
+// Webhooks are dropped, as they are requests the API sends, not operations that can be called. Definitions of other
+// versions are returned unchanged.
+func downgradeOpenAPI31(data []byte) ([]byte, error) {
+	jsondata := data
+	if !json.Valid(data) {
+		var err error
+		jsondata, err = kyaml.YAMLToJSON(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var doc map[string]any
+	if err := json.Unmarshal(jsondata, &doc); err != nil {
+		return nil, err
+	}
+	if version, _ := doc["openapi"].(string); !strings.HasPrefix(version, "3.1") {
+		return data, nil
+	}
+
+	doc["openapi"] = "3.0.3"
+	delete(doc, "webhooks")
+	delete(doc, "jsonSchemaDialect")
+
+	if components, ok := doc["components"].(map[string]any); ok {
+		if schemas, ok := components["schemas"].(map[string]any); ok {
+			for name, schema := range schemas {
+				schemas[name] = downgradeSchema(schema)
+			}
+		}
+		inlinePathItems(doc, components)
+		delete(components, "pathItems")
+	}
+
+	downgradeSchemas(doc)
+
+	return json.Marshal(doc)
+}
+
+// inlinePathItems replaces references of paths to components.pathItems, which 3.0 doesn't have, with the path items.
+func inlinePathItems(doc, components map[string]any) {
+	pathItems, _ := components["pathItems"].(map[string]any)
+	paths, _ := doc["paths"].(map[string]any)
+	for name, pathItem := range paths {
+		item, _ := pathItem.(map[string]any)
+		ref, _ := item["$ref"].(string)
+		if target, ok := strings.CutPrefix(ref, "#/components/pathItems/"); ok && pathItems[target] != nil {
+			paths[name] = pathItems[target]
+		}
+	}
+}
+
+// downgradeSchemas downgrades the value of every "schema" key in the document, which is where parameters, headers,
+// and media types have their schemas. Examples and extensions are skipped, as they hold arbitrary data.
+func downgradeSchemas(v any) {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			switch {
+			case key == "schema":
+				v[key] = downgradeSchema(value)
+			case key == "example" || key == "examples" || key == "schemas" || strings.HasPrefix(key, "x-"):
+			default:
+				downgradeSchemas(value)
+			}
+		}
+	case []any:
+		for _, value := range v {
+			downgradeSchemas(value)
+		}
+	}
+}
+
+func downgradeSchema(v any) any {
+	schema, ok := v.(map[string]any)
+	if !ok {
+		return v
+	}
+
+	if ref, ok := schema["$ref"]; ok && len(schema) > 1 {
+		delete(schema, "$ref")
+		schema["allOf"] = append(toSlice(schema["allOf"]), map[string]any{"$ref": ref})
+	}
+
+	switch t := schema["type"].(type) {
+	case string:
+		if t == "null" {
+			delete(schema, "type")
+			schema["nullable"] = true
+		}
+	case []any:
+		var types []any
+		for _, name := range t {
+			if name == "null" {
+				schema["nullable"] = true
+			} else {
+				types = append(types, name)
+			}
+		}
+		delete(schema, "type")
+		switch len(types) {
+		case 0:
+		case 1:
+			schema["type"] = types[0]
+		default:
+			anyOf := make([]any, 0, len(types))
+			for _, name := range types {
+				anyOf = append(anyOf, map[string]any{"type": name})
+			}
+			if _, ok := schema["anyOf"]; ok {
+				schema["allOf"] = append(toSlice(schema["allOf"]), map[string]any{"anyOf": anyOf})
+			} else {
+				schema["anyOf"] = anyOf
+			}
+		}
+	}
+
+	if value, ok := schema["const"]; ok {
+		delete(schema, "const")
+		if _, ok := schema["enum"]; !ok {
+			schema["enum"] = []any{value}
+		}
+	}
+
+	if examples, ok := schema["examples"].([]any); ok {
+		delete(schema, "examples")
+		if _, ok := schema["example"]; !ok && len(examples) > 0 {
+			schema["example"] = examples[0]
+		}
+	}
+
+	for exclusive, bound := range map[string]string{"exclusiveMinimum": "minimum", "exclusiveMaximum": "maximum"} {
+		if value, ok := schema[exclusive].(float64); ok {
+			schema[bound] = value
+			schema[exclusive] = true
+		}
+	}
+
+	// Keywords of 2020-12 that 3.0 has no equivalent for
+	for _, key := range []string{"$schema", "$id", "$anchor", "prefixItems", "unevaluatedProperties", "unevaluatedItems", "contentMediaType", "contentEncoding", "if", "then", "else"} {
+		delete(schema, key)
+	}
+
+	for _, key := range []string{"items", "not", "additionalProperties", "contains", "propertyNames"} {
+		if value, ok := schema[key]; ok {
+			schema[key] = downgradeSchema(value)
+		}
+	}
+	for _, key := range []string{"allOf", "anyOf", "oneOf"} {
+		if values, ok := schema[key].([]any); ok {
+			for i, value := range values {
+				values[i] = downgradeSchema(value)
+			}
+		}
+	}
+	for _, key := range []string{"properties", "patternProperties", "dependentSchemas", "$defs"} {
+		if values, ok := schema[key].(map[string]any); ok {
+			for name, value := range values {
+				values[name] = downgradeSchema(value)
+			}
+		}
+	}
+
+	return schema
+}
+
+func toSlice(v any) []any {
+	s, _ := v.([]any)
+	return s
+}
@@ -0,0 +1,81 @@
+// Package resolver loads tools with the source resolvers that are registered with repos.AddSourceResolver.
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/cache"
+	"github.com/gptscript-ai/gptscript/pkg/loader"
+	"github.com/gptscript-ai/gptscript/pkg/repos"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+func init() {
+	loader.AddVSC(Load)
+	loader.AddRepoReader(Read)
+}
+
+// Load resolves a tool whose URL has the scheme of a registered source resolver with the resolver.
+func Load(ctx context.Context, _ *cache.Client, urlName string) (string, *types.Repo, bool, error) {
+	for scheme, resolver := range repos.SourceResolvers() {
+		if !strings.HasPrefix(urlName, scheme+"://") {
+			continue
+		}
+		if loader.IsOffline(ctx) {
+			return "", nil, false, &loader.OfflineError{Name: urlName}
+		}
+
+		repo, err := resolver.Resolve(ctx, urlName)
+		if err != nil {
+			return "", nil, false, fmt.Errorf("failed to resolve %s: %w", urlName, err)
+		}
+		repo.VCS = scheme
+		return location(*repo), repo, true, nil
+	}
+	return "", nil, false, nil
+}
+
+// Read returns the content of the file of a repo of a source resolver, which is fetched to a temporary directory for
+// it.
+func Read(ctx context.Context, repo types.Repo) (_ []byte, _ string, _ bool, err error) {
+	resolver, ok := repos.SourceResolvers()[repo.VCS]
+	if !ok {
+		return nil, "", false, nil
+	}
+
+	dir, err := os.MkdirTemp("", "gptscript-source-*")
+	if err != nil {
+		return nil, "", false, err
+	}
+	defer func() {
+		err = errors.Join(err, os.RemoveAll(dir))
+		if cleaner, ok := resolver.(repos.SourceCleaner); ok {
+			err = errors.Join(err, cleaner.Cleanup(ctx, repo, dir))
+		}
+	}()
+
+	if err := resolver.Fetch(ctx, repo, dir); err != nil {
+		return nil, "", false, fmt.Errorf("failed to fetch %s: %w", location(repo), err)
+	}
+
+	file := filepath.FromSlash(path.Join(repo.Path, repo.Name))
+	if !filepath.IsLocal(file) {
+		return nil, "", false, fmt.Errorf("invalid path %s of %s", file, repo.Root)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, file))
+	if err != nil {
+		return nil, "", false, err
+	}
+	return data, location(repo), true, nil
+}
+
+func location(repo types.Repo) string {
+	return strings.TrimSuffix(repo.Root, "/") + "/" + path.Join(repo.Path, repo.Name)
+}
@@ -22,6 +22,16 @@ func AddVSC(lookup VCSLookup) {
 	vcsLookups = append(vcsLookups, lookup)
 }
 
+// RepoReader reads the file of a repo whose files can't be downloaded over HTTP, and returns its content and location,
+// or false if it doesn't support the VCS of the repo.
+type RepoReader func(context.Context, types.Repo) ([]byte, string, bool, error)
+
+var repoReaders []RepoReader
+
+func AddRepoReader(reader RepoReader) {
+	repoReaders = append(repoReaders, reader)
+}
+
 type cacheKey struct {
 	Name string
 	Path string
@@ -48,7 +58,7 @@ func loadURL(ctx context.Context, cache *cache.Client, base *source, name string
 
 	if ok, err := cache.Get(ctx, cachedKey, &cachedValue); err != nil {
 		return nil, false, err
-	} else if ok && time.Since(cachedValue.Time) < CacheTimeout {
+	} else if ok && (time.Since(cachedValue.Time) < CacheTimeout || IsOffline(ctx)) {
 		return cachedValue.Source, true, nil
 	}
 
@@ -78,6 +88,30 @@ func loadURL(ctx context.Context, cache *cache.Client, base *source, name string
 		}
 	}
 
+	if repo != nil && IsOffline(ctx) {
+		return nil, false, &OfflineError{Name: name}
+	}
+
+	if repo != nil {
+		for _, read := range repoReaders {
+			data, location, ok, err := read(ctx, *repo)
+			if err != nil {
+				return nil, false, err
+			} else if ok {
+				log.Debugf("opened %s", location)
+				i := strings.LastIndex(location, "/")
+				return storeSource(ctx, cache, cachedKey, &source{
+					Content:  data,
+					Remote:   true,
+					Path:     location[:i],
+					Name:     location[i+1:],
+					Location: location,
+					Repo:     repo,
+				})
+			}
+		}
+	}
+
 	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
 		return nil, false, nil
 	}
@@ -100,6 +134,10 @@ func loadURL(ctx context.Context, cache *cache.Client, base *source, name string
 		url = pathString + "/" + name
 	}
 
+	if IsOffline(ctx) {
+		return nil, false, &OfflineError{Name: url}
+	}
+
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, false, err
@@ -119,16 +157,18 @@ func loadURL(ctx context.Context, cache *cache.Client, base *source, name string
 		return nil, false, fmt.Errorf("error loading %s: %v", url, err)
 	}
 
-	result := &source{
+	return storeSource(ctx, cache, cachedKey, &source{
 		Content:  data,
 		Remote:   true,
 		Path:     pathString,
 		Name:     name,
 		Location: url,
 		Repo:     repo,
-	}
+	})
+}
 
-	if err := cache.Store(ctx, cachedKey, cacheValue{
+func storeSource(ctx context.Context, cache *cache.Client, key cacheKey, result *source) (*source, bool, error) {
+	if err := cache.Store(ctx, key, cacheValue{
 		Source: result,
 		Time:   time.Now(),
 	}); err != nil {
@@ -3,4 +3,6 @@ package vcs
 import (
 	// Load all VCS
 	_ "github.com/gptscript-ai/gptscript/pkg/loader/github"
+	_ "github.com/gptscript-ai/gptscript/pkg/loader/oci"
+	_ "github.com/gptscript-ai/gptscript/pkg/loader/resolver"
 )
@@ -0,0 +1,69 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/gptscript-ai/gptscript/pkg/env"
+)
+
+// Config configures MCP servers in the format MCP hosts commonly use:
+//
+//	{"mcpServers": {"files": {"command": "npx", "args": ["-y", "@modelcontextprotocol/server-filesystem", "."]}}}
+//
+// A server either has a command, which is run and spoken to over stdio, or the URL of a streamable HTTP endpoint.
+type Config struct {
+	MCPServers map[string]ServerConfig `json:"mcpServers"`
+}
+
+type ServerConfig struct {
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+func (s ServerConfig) Validate() error {
+	if (s.Command == "") == (s.URL == "") {
+		return fmt.Errorf("MCP server must have either a command or a URL")
+	}
+	return nil
+}
+
+// env returns the environment of a server process, the current one with the env of the config added. Values of the
+// config can refer to variables of the current environment, such as ${GITHUB_TOKEN} or ${GITHUB_TOKEN:?is required}.
+func (s ServerConfig) env() ([]string, error) {
+	result := os.Environ()
+	for k, v := range s.Env {
+		v, err := env.Expand(v, os.LookupEnv)
+		if err != nil {
+			return nil, fmt.Errorf("invalid env %s: %w", k, err)
+		}
+		result = append(result, k+"="+v)
+	}
+	return result, nil
+}
+
+// headers returns the headers of the config, with variables of the environment expanded.
+func (s ServerConfig) headers() (map[string]string, error) {
+	headers := make(map[string]string, len(s.Headers))
+	for k, v := range s.Headers {
+		v, err := env.Expand(v, os.LookupEnv)
+		if err != nil {
+			return nil, fmt.Errorf("invalid header %s: %w", k, err)
+		}
+		headers[k] = v
+	}
+	return headers, nil
+}
+
+// ParseConfig returns the MCP configuration in data, and false if data is not one.
+func ParseConfig(data []byte) (Config, bool) {
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil || len(config.MCPServers) == 0 {
+		return Config{}, false
+	}
+	return config, true
+}
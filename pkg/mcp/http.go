@@ -0,0 +1,178 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// httpTransport speaks to a server over the streamable HTTP transport: each message is posted to the endpoint, and the
+// response is returned either as JSON or as a stream of server sent events.
+type httpTransport struct {
+	name    string
+	url     string
+	headers map[string]string
+
+	sessionLock sync.Mutex
+	sessionID   string
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newHTTPTransport(name string, config ServerConfig) (*httpTransport, error) {
+	headers, err := config.headers()
+	if err != nil {
+		return nil, fmt.Errorf("invalid MCP server %s: %w", name, err)
+	}
+	return &httpTransport{
+		name:    name,
+		url:     config.URL,
+		headers: headers,
+		closed:  make(chan struct{}),
+	}, nil
+}
+
+func (t *httpTransport) newRequest(ctx context.Context, method string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, t.url, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+
+	t.sessionLock.Lock()
+	if t.sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", t.sessionID)
+	}
+	t.sessionLock.Unlock()
+	return req, nil
+}
+
+func (t *httpTransport) post(ctx context.Context, msg request) (*http.Response, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := t.newRequest(ctx, http.MethodPost, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request to MCP server %s: %w", t.name, err)
+	}
+
+	if sessionID := resp.Header.Get("Mcp-Session-Id"); sessionID != "" {
+		t.sessionLock.Lock()
+		t.sessionID = sessionID
+		t.sessionLock.Unlock()
+	}
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("MCP server %s returned status code [%d]: %s", t.name, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+func (t *httpTransport) roundTrip(ctx context.Context, req request) (message, error) {
+	resp, err := t.post(ctx, req)
+	if err != nil {
+		return message{}, err
+	}
+	defer resp.Body.Close()
+
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		var msg message
+		if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+			return message{}, fmt.Errorf("invalid response from MCP server %s: %w", t.name, err)
+		}
+		return msg, nil
+	}
+
+	// The stream can have requests and notifications of the server before the response, which are ignored
+	id := strconv.FormatInt(*req.ID, 10)
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" {
+			if value, ok := strings.CutPrefix(line, "data:"); ok {
+				data = append(data, strings.TrimPrefix(value, " "))
+			}
+			continue
+		}
+		if len(data) == 0 {
+			continue
+		}
+
+		var msg message
+		err := json.Unmarshal([]byte(strings.Join(data, "\n")), &msg)
+		data = nil
+		if err != nil {
+			log.Debugf("invalid event from MCP server %s: %v", t.name, err)
+			continue
+		}
+		if msg.isResponse() && string(msg.ID) == id {
+			return msg, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return message{}, fmt.Errorf("failed to read response of MCP server %s: %w", t.name, err)
+	}
+	return message{}, fmt.Errorf("MCP server %s closed the stream without a response", t.name)
+}
+
+func (t *httpTransport) notify(ctx context.Context, req request) error {
+	resp, err := t.post(ctx, req)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+func (t *httpTransport) done() <-chan struct{} {
+	return t.closed
+}
+
+// close ends the session on the server, if it has one.
+func (t *httpTransport) close() error {
+	t.closeOnce.Do(func() {
+		defer close(t.closed)
+
+		t.sessionLock.Lock()
+		sessionID := t.sessionID
+		t.sessionLock.Unlock()
+		if sessionID == "" {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		req, err := t.newRequest(ctx, http.MethodDelete, nil)
+		if err != nil {
+			return
+		}
+		if resp, err := http.DefaultClient.Do(req); err == nil {
+			_ = resp.Body.Close()
+		}
+	})
+	return nil
+}
@@ -0,0 +1,139 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const protocolVersion = "2025-03-26"
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// message is any JSON-RPC message from the other side: a response to a request, a request, or a notification.
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+func (m message) isResponse() bool {
+	return m.Method == "" && len(m.ID) > 0
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// Error codes of JSON-RPC.
+const (
+	errParse          = -32700
+	errMethodNotFound = -32601
+	errInvalidParams  = -32602
+	errInternal       = -32603
+)
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (r *rpcError) Error() string {
+	return fmt.Sprintf("MCP error %d: %s", r.Code, r.Message)
+}
+
+type initializeResult struct {
+	ProtocolVersion string `json:"protocolVersion"`
+	Capabilities    struct {
+		Tools     *struct{} `json:"tools,omitempty"`
+		Resources *struct{} `json:"resources,omitempty"`
+	} `json:"capabilities"`
+	ServerInfo struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"serverInfo"`
+	Instructions string `json:"instructions,omitempty"`
+}
+
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"inputSchema,omitempty"`
+}
+
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+type ResourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Blob     string `json:"blob,omitempty"`
+}
+
+// Content is an item of the content of a tool result: text, an image or audio with base64 data, or a resource.
+type Content struct {
+	Type     string            `json:"type"`
+	Text     string            `json:"text,omitempty"`
+	Data     string            `json:"data,omitempty"`
+	MimeType string            `json:"mimeType,omitempty"`
+	Resource *ResourceContents `json:"resource,omitempty"`
+	URI      string            `json:"uri,omitempty"`
+}
+
+type CallToolResult struct {
+	Content []Content `json:"content"`
+	IsError bool      `json:"isError,omitempty"`
+}
+
+// Text returns the content of the result as text, which is what tools in gptscript return. Binary content can't be
+// passed on to the model, so it is described instead.
+func (c CallToolResult) Text() string {
+	parts := make([]string, 0, len(c.Content))
+	for _, content := range c.Content {
+		switch content.Type {
+		case "text":
+			parts = append(parts, content.Text)
+		case "resource":
+			if content.Resource != nil {
+				parts = append(parts, resourceText(*content.Resource))
+			}
+		case "resource_link":
+			parts = append(parts, fmt.Sprintf("[resource %s]", content.URI))
+		default:
+			parts = append(parts, fmt.Sprintf("[%s content of type %s, %d bytes base64 encoded]", content.Type, content.MimeType, len(content.Data)))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// ResourcesText returns the contents of a resource as text, describing binary contents.
+func ResourcesText(contents []ResourceContents) string {
+	parts := make([]string, 0, len(contents))
+	for _, content := range contents {
+		parts = append(parts, resourceText(content))
+	}
+	return strings.Join(parts, "\n")
+}
+
+func resourceText(content ResourceContents) string {
+	if content.Blob != "" {
+		return fmt.Sprintf("[resource %s of type %s, %d bytes base64 encoded]", content.URI, content.MimeType, len(content.Blob))
+	}
+	return content.Text
+}
@@ -0,0 +1,199 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Handler provides the tools of a Server.
+type Handler interface {
+	ListTools(ctx context.Context) ([]Tool, error)
+	// CallTool calls a tool with the JSON object of its arguments. An error is reported to the client as the result of
+	// the tool, not as an error of the protocol, so that a model can see it.
+	CallTool(ctx context.Context, name string, arguments json.RawMessage) (*CallToolResult, error)
+}
+
+// Server is an MCP server with the tools of a Handler, speaking the stdio transport.
+type Server struct {
+	Name         string
+	Version      string
+	Instructions string
+	Handler      Handler
+
+	writeLock sync.Mutex
+	out       io.Writer
+
+	callsLock sync.Mutex
+	calls     map[string]context.CancelFunc
+}
+
+// Serve reads requests from in and writes responses to out until in is closed or ctx is done. Tool calls run
+// concurrently. Calls that are running when in is closed are finished before Serve returns, and canceled if ctx is
+// done.
+func (s *Server) Serve(ctx context.Context, in io.Reader, out io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s.out = out
+	s.calls = map[string]context.CancelFunc{}
+
+	var (
+		wg       sync.WaitGroup
+		messages = make(chan []byte)
+		readErr  = make(chan error, 1)
+	)
+	defer wg.Wait()
+
+	go func() {
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+		for scanner.Scan() {
+			select {
+			case messages <- append([]byte(nil), scanner.Bytes()...):
+			case <-ctx.Done():
+				return
+			}
+		}
+		readErr <- scanner.Err()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-readErr:
+			return err
+		case data := <-messages:
+			var msg message
+			if err := json.Unmarshal(data, &msg); err != nil {
+				s.write(response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: errParse, Message: err.Error()}})
+				continue
+			}
+			if msg.Method == "" {
+				// Responses to requests of the server, which it does not send
+				continue
+			}
+			if len(msg.ID) == 0 {
+				s.notification(msg)
+				continue
+			}
+
+			callCtx, callCancel := context.WithCancel(ctx)
+			s.callsLock.Lock()
+			s.calls[string(msg.ID)] = callCancel
+			s.callsLock.Unlock()
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() {
+					s.callsLock.Lock()
+					delete(s.calls, string(msg.ID))
+					s.callsLock.Unlock()
+					callCancel()
+				}()
+				s.write(s.handle(callCtx, msg))
+			}()
+		}
+	}
+}
+
+func (s *Server) notification(msg message) {
+	if msg.Method != "notifications/cancelled" {
+		return
+	}
+
+	var params struct {
+		RequestID json.RawMessage `json:"requestId"`
+	}
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return
+	}
+
+	s.callsLock.Lock()
+	cancel := s.calls[string(params.RequestID)]
+	s.callsLock.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+func (s *Server) handle(ctx context.Context, msg message) response {
+	resp := response{
+		JSONRPC: "2.0",
+		ID:      msg.ID,
+	}
+
+	result, err := s.result(ctx, msg)
+	if err != nil {
+		rpcErr, ok := err.(*rpcError)
+		if !ok {
+			rpcErr = &rpcError{Code: errInternal, Message: err.Error()}
+		}
+		resp.Error = rpcErr
+	} else {
+		resp.Result = result
+	}
+	return resp
+}
+
+func (s *Server) result(ctx context.Context, msg message) (any, error) {
+	switch msg.Method {
+	case "initialize":
+		var result initializeResult
+		result.ProtocolVersion = protocolVersion
+		result.Capabilities.Tools = &struct{}{}
+		result.ServerInfo.Name = s.Name
+		result.ServerInfo.Version = s.Version
+		result.Instructions = s.Instructions
+		return result, nil
+	case "ping":
+		return map[string]any{}, nil
+	case "tools/list":
+		tools, err := s.Handler.ListTools(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"tools": tools}, nil
+	case "tools/call":
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err != nil || params.Name == "" {
+			return nil, &rpcError{Code: errInvalidParams, Message: "invalid tool call"}
+		}
+		if len(params.Arguments) == 0 {
+			params.Arguments = json.RawMessage("{}")
+		}
+
+		result, err := s.Handler.CallTool(ctx, params.Name, params.Arguments)
+		if err != nil {
+			return CallToolResult{
+				Content: []Content{{Type: "text", Text: err.Error()}},
+				IsError: true,
+			}, nil
+		}
+		return result, nil
+	default:
+		return nil, &rpcError{Code: errMethodNotFound, Message: fmt.Sprintf("method not found: %s", msg.Method)}
+	}
+}
+
+func (s *Server) write(resp response) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		log.Errorf("failed to marshal MCP response: %v", err)
+		return
+	}
+
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	if _, err := s.out.Write(append(data, '\n')); err != nil {
+		log.Debugf("failed to write MCP response: %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// When this variable is set the test binary runs a Server with testHandler.
+const serverEnv = "GPTSCRIPT_TEST_MCP_SERVER"
+
+func serveTestHandler() {
+	s := &Server{
+		Name:         "test",
+		Instructions: "Testing",
+		Handler:      &testHandler{released: make(chan struct{})},
+	}
+	if err := s.Serve(context.Background(), os.Stdin, os.Stdout); err != nil {
+		os.Exit(1)
+	}
+}
+
+// testHandler has a tool that waits until another tool is called, which only returns if calls run concurrently.
+type testHandler struct {
+	releaseOnce sync.Once
+	released    chan struct{}
+}
+
+func (t *testHandler) ListTools(context.Context) ([]Tool, error) {
+	return []Tool{
+		{Name: "wait", InputSchema: json.RawMessage(`{"type":"object"}`)},
+		{Name: "release", InputSchema: json.RawMessage(`{"type":"object"}`)},
+	}, nil
+}
+
+func (t *testHandler) CallTool(ctx context.Context, name string, arguments json.RawMessage) (*CallToolResult, error) {
+	switch name {
+	case "wait":
+		select {
+		case <-t.released:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return &CallToolResult{Content: []Content{{Type: "text", Text: "released " + string(arguments)}}}, nil
+	case "release":
+		t.releaseOnce.Do(func() { close(t.released) })
+		return &CallToolResult{Content: []Content{{Type: "text", Text: "released"}}}, nil
+	default:
+		return nil, errors.New("unknown tool " + name)
+	}
+}
+
+func TestServer(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := Connect(ctx, "test", ServerConfig{
+		Command: os.Args[0],
+		Env:     map[string]string{serverEnv: "true"},
+	})
+	require.NoError(t, err)
+	defer s.Close()
+
+	assert.Equal(t, "Testing", s.Instructions())
+	assert.False(t, s.HasResources())
+
+	tools, err := s.ListTools(ctx)
+	require.NoError(t, err)
+	require.Len(t, tools, 2)
+	assert.Equal(t, "wait", tools[0].Name)
+
+	var (
+		wg         sync.WaitGroup
+		waitResult *CallToolResult
+		waitErr    error
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		waitResult, waitErr = s.CallTool(ctx, "wait", map[string]any{"a": 1})
+	}()
+
+	result, err := s.CallTool(ctx, "release", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "released", result.Text())
+
+	wg.Wait()
+	require.NoError(t, waitErr)
+	assert.Equal(t, `released {"a":1}`, waitResult.Text())
+
+	// Errors of tools are results, so that the model sees them
+	result, err = s.CallTool(ctx, "missing", nil)
+	require.NoError(t, err)
+	assert.True(t, result.IsError)
+	assert.Equal(t, "unknown tool missing", result.Text())
+
+	_, err = s.ListResources(ctx)
+	assert.ErrorContains(t, err, "method not found: resources/list")
+}
@@ -0,0 +1,304 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/BurntSushi/locker"
+	"github.com/gptscript-ai/gptscript/pkg/hash"
+	"github.com/gptscript-ai/gptscript/pkg/version"
+)
+
+// maxListedResources is how many resources of a server are listed by Describe.
+const maxListedResources = 50
+
+// Session is an initialized connection to an MCP server.
+type Session struct {
+	name      string
+	transport transport
+	nextID    atomic.Int64
+	info      initializeResult
+}
+
+// Connect starts or connects to the server and runs the initialization handshake.
+func Connect(ctx context.Context, name string, config ServerConfig) (*Session, error) {
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid MCP server %s: %w", name, err)
+	}
+
+	s := &Session{
+		name: name,
+	}
+	if config.URL != "" {
+		t, err := newHTTPTransport(name, config)
+		if err != nil {
+			return nil, err
+		}
+		s.transport = t
+	} else {
+		t, err := newStdioTransport(name, config)
+		if err != nil {
+			return nil, err
+		}
+		s.transport = t
+	}
+
+	err := s.call(ctx, "initialize", map[string]any{
+		"protocolVersion": protocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo": map[string]any{
+			"name":    version.ProgramName,
+			"version": version.Get().Tag,
+		},
+	}, &s.info)
+	if err == nil {
+		err = s.transport.notify(ctx, request{
+			JSONRPC: "2.0",
+			Method:  "notifications/initialized",
+		})
+	}
+	if err != nil {
+		_ = s.transport.close()
+		return nil, fmt.Errorf("failed to initialize MCP server %s: %w", name, err)
+	}
+
+	return s, nil
+}
+
+func (s *Session) call(ctx context.Context, method string, params, out any) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	id := s.nextID.Add(1)
+	msg, err := s.transport.roundTrip(ctx, request{
+		JSONRPC: "2.0",
+		ID:      &id,
+		Method:  method,
+		Params:  data,
+	})
+	if err != nil {
+		return err
+	}
+	if msg.Error != nil {
+		return msg.Error
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(msg.Result, out)
+}
+
+// Name is the name of the server in the configuration.
+func (s *Session) Name() string {
+	return s.name
+}
+
+// Instructions are the instructions the server gave for using it, if any.
+func (s *Session) Instructions() string {
+	return s.info.Instructions
+}
+
+// HasResources returns whether the server has resources.
+func (s *Session) HasResources() bool {
+	return s.info.Capabilities.Resources != nil
+}
+
+func (s *Session) ListTools(ctx context.Context) (result []Tool, _ error) {
+	var cursor string
+	for {
+		var page struct {
+			Tools      []Tool `json:"tools"`
+			NextCursor string `json:"nextCursor"`
+		}
+		if err := s.call(ctx, "tools/list", cursorParams(cursor), &page); err != nil {
+			return nil, fmt.Errorf("failed to list tools of MCP server %s: %w", s.name, err)
+		}
+		result = append(result, page.Tools...)
+		if page.NextCursor == "" {
+			return result, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+func (s *Session) ListResources(ctx context.Context) (result []Resource, _ error) {
+	var cursor string
+	for {
+		var page struct {
+			Resources  []Resource `json:"resources"`
+			NextCursor string     `json:"nextCursor"`
+		}
+		if err := s.call(ctx, "resources/list", cursorParams(cursor), &page); err != nil {
+			return nil, fmt.Errorf("failed to list resources of MCP server %s: %w", s.name, err)
+		}
+		result = append(result, page.Resources...)
+		if page.NextCursor == "" {
+			return result, nil
+		}
+		cursor = page.NextCursor
+	}
+}
+
+func cursorParams(cursor string) map[string]any {
+	params := map[string]any{}
+	if cursor != "" {
+		params["cursor"] = cursor
+	}
+	return params
+}
+
+func (s *Session) CallTool(ctx context.Context, name string, arguments map[string]any) (*CallToolResult, error) {
+	if arguments == nil {
+		arguments = map[string]any{}
+	}
+
+	var result CallToolResult
+	if err := s.call(ctx, "tools/call", map[string]any{
+		"name":      name,
+		"arguments": arguments,
+	}, &result); err != nil {
+		return nil, fmt.Errorf("failed to call tool %s of MCP server %s: %w", name, s.name, err)
+	}
+	return &result, nil
+}
+
+func (s *Session) ReadResource(ctx context.Context, uri string) ([]ResourceContents, error) {
+	var result struct {
+		Contents []ResourceContents `json:"contents"`
+	}
+	if err := s.call(ctx, "resources/read", map[string]any{
+		"uri": uri,
+	}, &result); err != nil {
+		return nil, fmt.Errorf("failed to read resource %s of MCP server %s: %w", uri, s.name, err)
+	}
+	return result.Contents, nil
+}
+
+// Describe returns the instructions of the server, its tools with their input schemas and its resources, as text for
+// the model to choose a tool to call or a resource to read.
+func (s *Session) Describe(ctx context.Context) (string, error) {
+	tools, err := s.ListTools(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var lines []string
+	if s.Instructions() != "" {
+		lines = append(lines, s.Instructions(), "")
+	}
+	lines = append(lines, fmt.Sprintf("The tools of the %s MCP server are:", s.name))
+	for _, tool := range tools {
+		line := "- " + tool.Name
+		if tool.Description != "" {
+			line += ": " + tool.Description
+		}
+		if len(tool.InputSchema) > 0 {
+			line += "\n  Arguments: " + string(tool.InputSchema)
+		}
+		lines = append(lines, line)
+	}
+
+	if s.HasResources() {
+		resources, err := s.ListResources(ctx)
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, "", fmt.Sprintf("The resources of the %s MCP server are:", s.name))
+		for i, resource := range resources {
+			if i == maxListedResources {
+				lines = append(lines, fmt.Sprintf("and %d more", len(resources)-maxListedResources))
+				break
+			}
+			line := "- " + resource.URI
+			if resource.Name != "" {
+				line += " (" + resource.Name + ")"
+			}
+			if resource.Description != "" {
+				line += ": " + resource.Description
+			}
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func (s *Session) Close() error {
+	return s.transport.close()
+}
+
+func (s *Session) closed() bool {
+	select {
+	case <-s.transport.done():
+		return true
+	default:
+		return false
+	}
+}
+
+var sessions struct {
+	lock     sync.Mutex
+	sessions map[string]*Session
+}
+
+// GetSession returns a session for the server, connecting to it or starting it if there is no open session yet.
+// Sessions stay open for other calls to the same server until CloseSessions is called. Only connections to the same
+// server wait for each other.
+func GetSession(ctx context.Context, name string, config ServerConfig) (*Session, error) {
+	data, err := json.Marshal(struct {
+		Name   string       `json:"name"`
+		Config ServerConfig `json:"config"`
+	}{name, config})
+	if err != nil {
+		return nil, err
+	}
+	key := hash.Digest(data)
+
+	locker.Lock(key)
+	defer locker.Unlock(key)
+
+	sessions.lock.Lock()
+	s, ok := sessions.sessions[key]
+	sessions.lock.Unlock()
+	if ok && !s.closed() {
+		return s, nil
+	}
+
+	s, err = Connect(ctx, name, config)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions.lock.Lock()
+	defer sessions.lock.Unlock()
+	if sessions.sessions == nil {
+		sessions.sessions = map[string]*Session{}
+	}
+	sessions.sessions[key] = s
+	return s, nil
+}
+
+// CloseSessions closes all sessions opened by GetSession, stopping the servers that were started for them.
+func CloseSessions() {
+	sessions.lock.Lock()
+	defer sessions.lock.Unlock()
+
+	for _, s := range sessions.sessions {
+		if err := s.Close(); err != nil {
+			log.Debugf("failed to close MCP server %s: %v", s.name, err)
+		}
+	}
+	sessions.sessions = nil
+}
+
+// ToolInstructions are the instructions of the tool that was generated for an MCP server, which calls its tools and
+// reads its resources. They follow types.MCPPrefix in the instructions of the tool.
+type ToolInstructions struct {
+	Server string       `json:"server"`
+	Config ServerConfig `json:"config"`
+}
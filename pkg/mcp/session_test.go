@@ -0,0 +1,179 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// When this variable is set the test binary runs as an MCP server over stdio, for the tests of the stdio transport.
+const stdioServerEnv = "GPTSCRIPT_TEST_MCP_STDIO_SERVER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(stdioServerEnv) != "" {
+		serveStdio()
+		os.Exit(0)
+	}
+	if os.Getenv(serverEnv) != "" {
+		serveTestHandler()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func serveStdio() {
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		var req request
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil || req.ID == nil {
+			continue
+		}
+		data, _ := json.Marshal(respond(req))
+		fmt.Println(string(data))
+	}
+}
+
+// respond is a minimal MCP server with an echo tool and one resource.
+func respond(req request) map[string]any {
+	var (
+		params struct {
+			Name      string         `json:"name"`
+			Arguments map[string]any `json:"arguments"`
+			URI       string         `json:"uri"`
+		}
+		result any
+	)
+	_ = json.Unmarshal(req.Params, &params)
+
+	switch req.Method {
+	case "initialize":
+		result = map[string]any{
+			"protocolVersion": protocolVersion,
+			"capabilities":    map[string]any{"tools": map[string]any{}, "resources": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "test", "version": "v0.0.1"},
+			"instructions":    "Use echo to echo",
+		}
+	case "tools/list":
+		result = map[string]any{"tools": []map[string]any{{
+			"name":        "echo",
+			"description": "Echoes the input",
+			"inputSchema": map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"input": map[string]any{"type": "string"}},
+			},
+		}}}
+	case "tools/call":
+		if params.Name != "echo" {
+			return map[string]any{"jsonrpc": "2.0", "id": req.ID, "error": map[string]any{"code": -32602, "message": "unknown tool " + params.Name}}
+		}
+		result = map[string]any{"content": []map[string]any{
+			{"type": "text", "text": fmt.Sprint(params.Arguments["input"])},
+			{"type": "image", "mimeType": "image/png", "data": "aGVsbG8="},
+		}}
+	case "resources/list":
+		result = map[string]any{"resources": []map[string]any{{"uri": "file:///readme", "name": "readme"}}}
+	case "resources/read":
+		result = map[string]any{"contents": []map[string]any{{"uri": params.URI, "text": "Read me"}}}
+	default:
+		return map[string]any{"jsonrpc": "2.0", "id": req.ID, "error": map[string]any{"code": -32601, "message": "method not found"}}
+	}
+	return map[string]any{"jsonrpc": "2.0", "id": req.ID, "result": result}
+}
+
+func testSession(t *testing.T, config ServerConfig) {
+	t.Helper()
+	ctx := context.Background()
+
+	s, err := Connect(ctx, "test", config)
+	require.NoError(t, err)
+	defer s.Close()
+
+	assert.Equal(t, "Use echo to echo", s.Instructions())
+	assert.True(t, s.HasResources())
+
+	tools, err := s.ListTools(ctx)
+	require.NoError(t, err)
+	require.Len(t, tools, 1)
+	assert.Equal(t, "echo", tools[0].Name)
+
+	result, err := s.CallTool(ctx, "echo", map[string]any{"input": "hello"})
+	require.NoError(t, err)
+	assert.False(t, result.IsError)
+	assert.Equal(t, "hello\n[image content of type image/png, 8 bytes base64 encoded]", result.Text())
+
+	_, err = s.CallTool(ctx, "missing", nil)
+	assert.ErrorContains(t, err, "MCP error -32602: unknown tool missing")
+
+	resources, err := s.ListResources(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []Resource{{URI: "file:///readme", Name: "readme"}}, resources)
+
+	contents, err := s.ReadResource(ctx, "file:///readme")
+	require.NoError(t, err)
+	assert.Equal(t, "Read me", ResourcesText(contents))
+}
+
+func TestStdio(t *testing.T) {
+	testSession(t, ServerConfig{
+		Command: os.Args[0],
+		Env:     map[string]string{stdioServerEnv: "true"},
+	})
+}
+
+func TestHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		if r.Method == http.MethodDelete {
+			return
+		}
+
+		var req request
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		if req.Method == "initialize" {
+			w.Header().Set("Mcp-Session-Id", "session")
+		} else {
+			assert.Equal(t, "session", r.Header.Get("Mcp-Session-Id"))
+		}
+		if req.ID == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		data, _ := json.Marshal(respond(req))
+		// Answer tool calls as a stream of events, everything else as plain JSON
+		if req.Method == "tools/call" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}))
+	defer server.Close()
+
+	t.Setenv("TEST_MCP_TOKEN", "token")
+	testSession(t, ServerConfig{
+		URL:     server.URL,
+		Headers: map[string]string{"Authorization": "Bearer ${TEST_MCP_TOKEN}"},
+	})
+}
+
+func TestParseConfig(t *testing.T) {
+	_, ok := ParseConfig([]byte(`{"openapi": "3.0.0"}`))
+	assert.False(t, ok)
+	_, ok = ParseConfig([]byte(`Say hi`))
+	assert.False(t, ok)
+
+	config, ok := ParseConfig([]byte(`{"mcpServers": {"files": {"command": "npx", "args": ["server"]}}}`))
+	require.True(t, ok)
+	assert.NoError(t, config.MCPServers["files"].Validate())
+	assert.Error(t, ServerConfig{}.Validate())
+}
@@ -0,0 +1,193 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// transport sends JSON-RPC messages to an MCP server.
+type transport interface {
+	// roundTrip sends a request and returns the response to it.
+	roundTrip(ctx context.Context, req request) (message, error)
+	// notify sends a notification, which has no response.
+	notify(ctx context.Context, req request) error
+	// done is closed once the transport can't be used anymore.
+	done() <-chan struct{}
+	close() error
+}
+
+// stdioTransport runs the server as a process and exchanges newline delimited messages over its stdin and stdout.
+type stdioTransport struct {
+	name  string
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+
+	writeLock   sync.Mutex
+	pendingLock sync.Mutex
+	pending     map[string]chan message
+
+	exited  chan struct{}
+	exitErr error
+}
+
+func newStdioTransport(name string, config ServerConfig) (*stdioTransport, error) {
+	// The server runs until it is closed, not just for the context it was started for
+	env, err := config.env()
+	if err != nil {
+		return nil, fmt.Errorf("invalid MCP server %s: %w", name, err)
+	}
+	cmd := exec.Command(config.Command, config.Args...)
+	cmd.Env = env
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start MCP server %s: %w", name, err)
+	}
+
+	t := &stdioTransport{
+		name:    name,
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: map[string]chan message{},
+		exited:  make(chan struct{}),
+	}
+
+	go t.logStderr(stderr)
+	go t.read(stdout)
+	return t, nil
+}
+
+func (t *stdioTransport) logStderr(stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		log.Debugf("MCP server %s: %s", t.name, scanner.Text())
+	}
+}
+
+func (t *stdioTransport) read(stdout io.Reader) {
+	defer func() {
+		t.exitErr = t.cmd.Wait()
+		close(t.exited)
+	}()
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var msg message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			log.Debugf("invalid message from MCP server %s: %v", t.name, err)
+			continue
+		}
+
+		switch {
+		case msg.isResponse():
+			t.pendingLock.Lock()
+			ch, ok := t.pending[string(msg.ID)]
+			delete(t.pending, string(msg.ID))
+			t.pendingLock.Unlock()
+			if ok {
+				ch <- msg
+			}
+		case msg.Method != "" && len(msg.ID) > 0:
+			t.respond(msg)
+		}
+	}
+}
+
+// respond answers requests of the server. Only pings are supported, as the client declares no capabilities.
+func (t *stdioTransport) respond(msg message) {
+	resp := response{
+		JSONRPC: "2.0",
+		ID:      msg.ID,
+	}
+	if msg.Method == "ping" {
+		resp.Result = map[string]any{}
+	} else {
+		resp.Error = &rpcError{
+			Code:    errMethodNotFound,
+			Message: "method not found: " + msg.Method,
+		}
+	}
+	if err := t.write(resp); err != nil {
+		log.Debugf("failed to respond to MCP server %s: %v", t.name, err)
+	}
+}
+
+func (t *stdioTransport) write(msg any) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	t.writeLock.Lock()
+	defer t.writeLock.Unlock()
+	_, err = t.stdin.Write(append(data, '\n'))
+	return err
+}
+
+func (t *stdioTransport) roundTrip(ctx context.Context, req request) (message, error) {
+	key := strconv.FormatInt(*req.ID, 10)
+	ch := make(chan message, 1)
+
+	t.pendingLock.Lock()
+	t.pending[key] = ch
+	t.pendingLock.Unlock()
+
+	defer func() {
+		t.pendingLock.Lock()
+		delete(t.pending, key)
+		t.pendingLock.Unlock()
+	}()
+
+	if err := t.write(req); err != nil {
+		return message{}, fmt.Errorf("failed to send request to MCP server %s: %w", t.name, err)
+	}
+
+	select {
+	case msg := <-ch:
+		return msg, nil
+	case <-ctx.Done():
+		return message{}, ctx.Err()
+	case <-t.exited:
+		return message{}, fmt.Errorf("MCP server %s exited: %v", t.name, t.exitErr)
+	}
+}
+
+func (t *stdioTransport) notify(_ context.Context, req request) error {
+	return t.write(req)
+}
+
+func (t *stdioTransport) done() <-chan struct{} {
+	return t.exited
+}
+
+// close closes stdin, which tells the server to exit, and kills it if it doesn't.
+func (t *stdioTransport) close() error {
+	_ = t.stdin.Close()
+	select {
+	case <-t.exited:
+	case <-time.After(5 * time.Second):
+		_ = t.cmd.Process.Kill()
+		<-t.exited
+	}
+	return nil
+}
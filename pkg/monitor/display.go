@@ -192,6 +192,12 @@ func (d *display) Event(event runner.Event) {
 	d.callLock.Lock()
 	defer d.callLock.Unlock()
 
+	if event.Daemon != nil {
+		log.Fields("toolID", event.Daemon.ToolID, "port", event.Daemon.Port, "err", event.Daemon.Err, "type", event.Type).
+			Debugf("daemon   [%s]", event.Daemon.ToolName)
+		return
+	}
+
 	var (
 		currentIndex = -1
 		currentCall  call
@@ -237,9 +243,8 @@ func (d *display) Event(event runner.Event) {
 		userSpecifiedToolName: event.CallContext.ToolName,
 	}
 
-	d.usage.PromptTokens += event.Usage.PromptTokens
-	d.usage.CompletionTokens += event.Usage.CompletionTokens
-	d.usage.TotalTokens += event.Usage.TotalTokens
+	d.usage = d.usage.Add(event.Usage)
+	currentCall.Usage = currentCall.Usage.Add(event.Usage)
 
 	switch event.Type {
 	case runner.EventTypeCallStart:
@@ -303,6 +308,7 @@ func (d *display) Stop(output string, err error) {
 	}
 	d.dump.Output = output
 	d.dump.Err = err
+	d.dump.Usage = d.usage
 	if d.dumpState != "" {
 		f, err := os.Create(d.dumpState)
 		if err == nil {
@@ -430,6 +436,7 @@ type dump struct {
 	Input   string         `json:"input,omitempty"`
 	Output  string         `json:"output,omitempty"`
 	Err     error          `json:"err,omitempty"`
+	Usage   types.Usage    `json:"usage,omitempty"`
 }
 
 type message struct {
@@ -448,6 +455,8 @@ type call struct {
 	End      time.Time `json:"end,omitempty"`
 	Input    string    `json:"input,omitempty"`
 	Output   string    `json:"output,omitempty"`
+	// Usage is the token usage of the model calls of this call, not counting its sub calls.
+	Usage types.Usage `json:"usage,omitempty"`
 }
 
 func (c call) String() string {
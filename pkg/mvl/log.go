@@ -1,6 +1,7 @@
 package mvl
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,6 +10,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/gptscript-ai/gptscript/pkg/redact"
 	"github.com/sirupsen/logrus"
 )
 
@@ -18,10 +20,27 @@ import (
 // So this is simple place to make a better decision later about logging frameworks. I only care about
 // the interface, not the implementation. Smarter people do that well.
 
+func init() {
+	logrus.SetFormatter(redactingFormatter{logrus.StandardLogger().Formatter})
+}
+
 func SetSimpleFormat(trunc bool) {
-	logrus.SetFormatter(&formatter{
+	logrus.SetFormatter(redactingFormatter{&formatter{
 		trunc: trunc,
-	})
+	}})
+}
+
+// redactingFormatter removes secrets from the message and fields of entries before they are formatted.
+type redactingFormatter struct {
+	logrus.Formatter
+}
+
+func (r redactingFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	entry.Message = redact.String(entry.Message)
+	for k, v := range entry.Data {
+		entry.Data[k] = redact.Value(v)
+	}
+	return r.Formatter.Format(entry)
 }
 
 type formatter struct {
@@ -56,6 +75,9 @@ func (f formatter) Format(entry *logrus.Entry) ([]byte, error) {
 	if i, ok := entry.Data["response"]; ok && i != "" {
 		msg += fmt.Sprintf(" [response=%s]", i)
 	}
+	if i, ok := entry.Data["tool"]; ok && i != "" {
+		msg += fmt.Sprintf(" [tool=%v]", i)
+	}
 	if i, ok := entry.Data["total"]; ok && i != "" {
 		msg += fmt.Sprintf(" [total=%v]", i)
 	}
@@ -71,9 +93,9 @@ func (f formatter) Format(entry *logrus.Entry) ([]byte, error) {
 }
 
 func SetDebug() {
-	logrus.SetFormatter(&logrus.JSONFormatter{
+	logrus.SetFormatter(redactingFormatter{&logrus.JSONFormatter{
 		PrettyPrint: os.Getenv("GPTSCRIPT_JSON_LOG_SINGLE_LINE") != "true",
-	})
+	}})
 	logrus.SetLevel(logrus.DebugLevel)
 }
 
@@ -180,3 +202,42 @@ func (l *Logger) Debugf(msg string, args ...any) {
 func (l *Logger) Fatalf(msg string, args ...any) {
 	l.log.WithFields(l.fields).Fatalf(msg, args...)
 }
+
+type fieldsKey struct{}
+
+// WithFields returns a context that adds the key value pairs to everything logged with it by the *Ctx functions, so
+// that log lines of different operations running at the same time can be told apart. Keys that are not strings are
+// formatted with fmt.Sprint.
+func WithFields(ctx context.Context, kv ...any) context.Context {
+	fields := map[string]any{}
+	for k, v := range fieldsFromCtx(ctx) {
+		fields[k] = v
+	}
+	for i, v := range kv {
+		if i%2 == 1 {
+			fields[fmt.Sprint(kv[i-1])] = v
+		}
+	}
+	return context.WithValue(ctx, fieldsKey{}, fields)
+}
+
+func fieldsFromCtx(ctx context.Context) map[string]any {
+	fields, _ := ctx.Value(fieldsKey{}).(map[string]any)
+	return fields
+}
+
+func (l *Logger) InfofCtx(ctx context.Context, msg string, args ...any) {
+	l.FieldsMap(fieldsFromCtx(ctx)).Infof(msg, args...)
+}
+
+func (l *Logger) ErrorfCtx(ctx context.Context, msg string, args ...any) {
+	l.FieldsMap(fieldsFromCtx(ctx)).Errorf(msg, args...)
+}
+
+func (l *Logger) WarnfCtx(ctx context.Context, msg string, args ...any) {
+	l.FieldsMap(fieldsFromCtx(ctx)).Warnf(msg, args...)
+}
+
+func (l *Logger) DebugfCtx(ctx context.Context, msg string, args ...any) {
+	l.FieldsMap(fieldsFromCtx(ctx)).Debugf(msg, args...)
+}
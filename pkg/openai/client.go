@@ -2,18 +2,22 @@ package openai
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
 	"os"
 	"slices"
 	"sort"
 	"strings"
+	"time"
 
 	openai "github.com/gptscript-ai/chat-completion-client"
 	"github.com/gptscript-ai/gptscript/pkg/cache"
 	"github.com/gptscript-ai/gptscript/pkg/counter"
 	"github.com/gptscript-ai/gptscript/pkg/hash"
+	"github.com/gptscript-ai/gptscript/pkg/redact"
 	"github.com/gptscript-ai/gptscript/pkg/system"
 	"github.com/gptscript-ai/gptscript/pkg/types"
 )
@@ -29,12 +33,15 @@ var (
 )
 
 type Client struct {
-	defaultModel string
-	c            *openai.Client
-	cache        *cache.Client
-	invalidAuth  bool
-	cacheKeyBase string
-	setSeed      bool
+	defaultModel  string
+	c             *openai.Client
+	cache         *cache.Client
+	invalidAuth   bool
+	cacheKeyBase  string
+	setSeed       bool
+	retry         retryPolicy
+	profile       string
+	contextWindow int
 }
 
 type Options struct {
@@ -45,9 +52,15 @@ type Options struct {
 	OrgID        string         `usage:"OpenAI organization ID" name:"openai-org-id" env:"OPENAI_ORG_ID"`
 	DefaultModel string         `usage:"Default LLM model to use" default:"gpt-4o"`
 	ConfigFile   string         `usage:"Path to GPTScript config file" name:"config"`
+	MaxRetries   int            `usage:"Maximum number of retries of a failed LLM request, -1 to disable (default 5)" name:"openai-max-retries" env:"OPENAI_MAX_RETRIES"`
+	RetryDelay   string         `usage:"Base delay before retrying a failed LLM request, doubled with each retry (default 1s)" name:"openai-retry-delay" env:"OPENAI_RETRY_DELAY"`
 	SetSeed      bool           `usage:"-"`
 	CacheKey     string         `usage:"-"`
-	Cache        *cache.Client
+	// Profile adapts the client to a server that is not quite OpenAI compatible, see LlamaCppProfile.
+	Profile string `usage:"-"`
+	// ContextWindow is the number of tokens the model accepts. Old messages are dropped to fit it, if set.
+	ContextWindow int `usage:"-"`
+	Cache         *cache.Client
 }
 
 func complete(opts ...Options) (result Options, err error) {
@@ -61,6 +74,10 @@ func complete(opts ...Options) (result Options, err error) {
 		result.DefaultModel = types.FirstSet(opt.DefaultModel, result.DefaultModel)
 		result.SetSeed = types.FirstSet(opt.SetSeed, result.SetSeed)
 		result.CacheKey = types.FirstSet(opt.CacheKey, result.CacheKey)
+		result.MaxRetries = types.FirstSet(opt.MaxRetries, result.MaxRetries)
+		result.RetryDelay = types.FirstSet(opt.RetryDelay, result.RetryDelay)
+		result.Profile = types.FirstSet(opt.Profile, result.Profile)
+		result.ContextWindow = types.FirstSet(opt.ContextWindow, result.ContextWindow)
 	}
 
 	if result.Cache == nil {
@@ -99,6 +116,17 @@ func NewClient(opts ...Options) (*Client, error) {
 		return nil, err
 	}
 
+	if err := validProfile(opt.Profile); err != nil {
+		return nil, err
+	}
+
+	retry, err := newRetryPolicy(opt.MaxRetries, opt.RetryDelay)
+	if err != nil {
+		return nil, fmt.Errorf("invalid retry delay %q: %w", opt.RetryDelay, err)
+	}
+
+	redact.AddValues(opt.APIKey, key)
+
 	cfg := openai.DefaultConfig(opt.APIKey)
 	if strings.Contains(string(opt.APIType), "AZURE") {
 		cfg = openai.DefaultAzureConfig(key, url)
@@ -109,6 +137,12 @@ func NewClient(opts ...Options) (*Client, error) {
 	cfg.OrgID = types.FirstSet(opt.OrgID, cfg.OrgID)
 	cfg.APIVersion = types.FirstSet(opt.APIVersion, cfg.APIVersion)
 	cfg.APIType = types.FirstSet(opt.APIType, cfg.APIType)
+	cfg.HTTPClient = &http.Client{
+		Transport: &retryTransport{
+			policy: retry,
+			next:   http.DefaultTransport,
+		},
+	}
 
 	cacheKeyBase := opt.CacheKey
 	if cacheKeyBase == "" {
@@ -116,12 +150,15 @@ func NewClient(opts ...Options) (*Client, error) {
 	}
 
 	return &Client{
-		c:            openai.NewClientWithConfig(cfg),
-		cache:        opt.Cache,
-		defaultModel: opt.DefaultModel,
-		cacheKeyBase: cacheKeyBase,
-		invalidAuth:  opt.APIKey == "" && opt.BaseURL == "",
-		setSeed:      opt.SetSeed,
+		c:             openai.NewClientWithConfig(cfg),
+		cache:         opt.Cache,
+		defaultModel:  opt.DefaultModel,
+		cacheKeyBase:  cacheKeyBase,
+		invalidAuth:   opt.APIKey == "" && opt.BaseURL == "",
+		setSeed:       opt.SetSeed,
+		retry:         retry,
+		profile:       opt.Profile,
+		contextWindow: opt.ContextWindow,
 	}, nil
 }
 
@@ -211,7 +248,8 @@ func toToolCall(call types.CompletionToolCall) openai.ToolCall {
 	}
 }
 
-func toMessages(request types.CompletionRequest, compat bool) (result []openai.ChatCompletionMessage, err error) {
+// requestMessages returns the messages of the request, with all system prompts merged into one at the start.
+func requestMessages(request types.CompletionRequest, compat bool) []types.CompletionMessage {
 	var (
 		systemPrompts []string
 		msgs          []types.CompletionMessage
@@ -229,13 +267,21 @@ func toMessages(request types.CompletionRequest, compat bool) (result []openai.C
 		msgs = append(msgs, message)
 	}
 
+	if request.OutputSchema != nil {
+		// The JSON mode of the API only ensures valid JSON, so the schema is described in the prompt
+		systemPrompts = append(systemPrompts, system.JSONSchemaPrompt(request.OutputSchema))
+	}
+
 	if len(systemPrompts) > 0 {
 		msgs = slices.Insert(msgs, 0, types.CompletionMessage{
 			Role:    types.CompletionMessageRoleTypeSystem,
 			Content: types.Text(strings.Join(systemPrompts, "\n")),
 		})
 	}
+	return msgs
+}
 
+func toMessages(msgs []types.CompletionMessage) (result []openai.ChatCompletionMessage, err error) {
 	for _, message := range msgs {
 		chatMessage := openai.ChatCompletionMessage{
 			Role: string(message.Role),
@@ -282,7 +328,7 @@ func (c *Client) Call(ctx context.Context, messageRequest types.CompletionReques
 	if messageRequest.Model == "" {
 		messageRequest.Model = c.defaultModel
 	}
-	msgs, err := toMessages(messageRequest, !c.setSeed)
+	msgs, err := toMessages(fitContextWindow(requestMessages(messageRequest, !c.setSeed), c.contextWindow, messageRequest.MaxTokens))
 	if err != nil {
 		return nil, err
 	}
@@ -303,7 +349,7 @@ func (c *Client) Call(ctx context.Context, messageRequest types.CompletionReques
 		request.Temperature = messageRequest.Temperature
 	}
 
-	if messageRequest.JSONResponse {
+	if messageRequest.JSONResponse || messageRequest.OutputSchema != nil {
 		request.ResponseFormat = &openai.ChatCompletionResponseFormat{
 			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
 		}
@@ -351,6 +397,7 @@ func (c *Client) Call(ctx context.Context, messageRequest types.CompletionReques
 		}
 	} else {
 		cacheResponse = true
+		replay(c.profile, response, id, status)
 	}
 
 	result := types.CompletionMessage{}
@@ -369,6 +416,8 @@ func (c *Client) Call(ctx context.Context, messageRequest types.CompletionReques
 		result.Role = types.CompletionMessageRoleTypeAssistant
 	}
 
+	result = applyProfile(c.profile, result)
+
 	var usage types.Usage
 	if !cacheResponse {
 		usage = result.Usage
@@ -385,6 +434,19 @@ func (c *Client) Call(ctx context.Context, messageRequest types.CompletionReques
 	return &result, nil
 }
 
+// replay sends the chunks of a cached response as partial responses, the same as when the response was streamed.
+func replay(profile string, responses []openai.ChatCompletionStreamResponse, transactionID string, partial chan<- types.CompletionStatus) {
+	var partialMessage types.CompletionMessage
+	for _, response := range responses {
+		partialMessage = appendMessage(partialMessage, response)
+		partialResponse := applyProfile(profile, partialMessage)
+		partial <- types.CompletionStatus{
+			CompletionID:    transactionID,
+			PartialResponse: &partialResponse,
+		}
+	}
+}
+
 func appendMessage(msg types.CompletionMessage, response openai.ChatCompletionStreamResponse) types.CompletionMessage {
 	msg.Usage.CompletionTokens = types.FirstSet(msg.Usage.CompletionTokens, response.Usage.CompletionTokens)
 	msg.Usage.PromptTokens = types.FirstSet(msg.Usage.PromptTokens, response.Usage.PromptTokens)
@@ -497,6 +559,46 @@ func (c *Client) call(ctx context.Context, request openai.ChatCompletionRequest,
 		}, nil
 	}
 
+	deadline := retryDeadline(ctx)
+	ctx = withRetryDeadline(ctx, deadline)
+	for attempt := 0; ; attempt++ {
+		responses, err := c.stream(ctx, request, transactionID, partial)
+		if err == nil || ctx.Err() != nil {
+			return responses, err
+		}
+
+		var streamErr *midStreamError
+		if !errors.As(err, &streamErr) {
+			return nil, err
+		}
+		if attempt >= c.retry.maxRetries {
+			return nil, fmt.Errorf("response stream failed after a partial completion: %w", streamErr.err)
+		}
+
+		// Nothing was acted upon yet, the partial response is only shown, so the request is simply sent again
+		delay := c.retry.delay(attempt, nil)
+		if time.Now().Add(delay).After(deadline) {
+			return nil, fmt.Errorf("response stream failed after a partial completion: %w", streamErr.err)
+		}
+		log.Infof("LLM response stream failed, retrying in %s: %v", delay.Round(time.Millisecond), streamErr.err)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// midStreamError is an error that happened after the response stream started.
+type midStreamError struct {
+	err error
+}
+
+func (m *midStreamError) Error() string {
+	return m.err.Error()
+}
+
+func (c *Client) stream(ctx context.Context, request openai.ChatCompletionRequest, transactionID string, partial chan<- types.CompletionStatus) (responses []openai.ChatCompletionStreamResponse, _ error) {
 	stream, err := c.c.CreateChatCompletionStream(ctx, request)
 	if err != nil {
 		return nil, err
@@ -509,16 +611,21 @@ func (c *Client) call(ctx context.Context, request openai.ChatCompletionRequest,
 		if err == io.EOF {
 			return responses, c.cache.Store(ctx, c.cacheKey(request), responses)
 		} else if err != nil {
-			return nil, err
+			var apiErr *openai.APIError
+			if errors.As(err, &apiErr) {
+				return nil, err
+			}
+			return nil, &midStreamError{err: err}
 		}
 		if len(response.Choices) > 0 {
 			slog.Debug("stream", "content", response.Choices[0].Delta.Content)
 		}
 		if partial != nil {
 			partialMessage = appendMessage(partialMessage, response)
+			partialResponse := applyProfile(c.profile, partialMessage)
 			partial <- types.CompletionStatus{
 				CompletionID:    transactionID,
-				PartialResponse: &partialMessage,
+				PartialResponse: &partialResponse,
 			}
 		}
 		responses = append(responses, response)
@@ -0,0 +1,109 @@
+package openai
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// LlamaCppProfile adapts the client to the OpenAI compatible server of llama.cpp, which emulates tool calls less
+// reliably than OpenAI: only the first tool call of a response is used, and tool call arguments that are not quite
+// valid JSON are repaired where possible.
+const LlamaCppProfile = "llamacpp"
+
+func validProfile(profile string) error {
+	switch profile {
+	case "", LlamaCppProfile:
+		return nil
+	default:
+		return fmt.Errorf("invalid provider profile %q, must be %q", profile, LlamaCppProfile)
+	}
+}
+
+// applyProfile adjusts a response, or a partial one, to the quirks of the server of the profile. The tool calls of msg
+// are not changed, so that a partial response can still be appended to.
+func applyProfile(profile string, msg types.CompletionMessage) types.CompletionMessage {
+	if profile != LlamaCppProfile {
+		return msg
+	}
+
+	var (
+		content  []types.ContentPart
+		toolCall bool
+	)
+	for _, part := range msg.Content {
+		if part.ToolCall == nil {
+			content = append(content, part)
+			continue
+		}
+		if toolCall || part.ToolCall.Function.Name == "" {
+			slog.Debug("dropping extra tool call", "name", part.ToolCall.Function.Name)
+			continue
+		}
+		toolCall = true
+		call := *part.ToolCall
+		part.ToolCall = &call
+		part.ToolCall.Index = ptr(len(content))
+		part.ToolCall.Function.Arguments = repairArguments(part.ToolCall.Function.Arguments)
+		content = append(content, part)
+	}
+	msg.Content = content
+	return msg
+}
+
+// repairArguments tries to turn the arguments of a tool call into a JSON object. Arguments are returned unchanged if
+// they are valid already or cannot be repaired.
+func repairArguments(args string) string {
+	trimmed := strings.TrimSpace(args)
+	if trimmed == "" {
+		return "{}"
+	}
+	if json.Valid([]byte(trimmed)) {
+		return trimmed
+	}
+
+	// Models like to wrap JSON in a markdown code block
+	if fenced, ok := strings.CutPrefix(trimmed, "```"); ok {
+		fenced = strings.TrimPrefix(fenced, "json")
+		fenced = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(fenced), "```"))
+		if json.Valid([]byte(fenced)) {
+			return fenced
+		}
+		trimmed = fenced
+	}
+
+	// Text around the object
+	if start, end := strings.Index(trimmed, "{"), strings.LastIndex(trimmed, "}"); start >= 0 && end > start {
+		if object := trimmed[start : end+1]; json.Valid([]byte(object)) {
+			return object
+		}
+	}
+
+	// Generation stopped before the object was closed
+	if strings.HasPrefix(trimmed, "{") {
+		if missing := strings.Count(trimmed, "{") - strings.Count(trimmed, "}"); missing > 0 {
+			if object := trimmed + strings.Repeat("}", missing); json.Valid([]byte(object)) {
+				return object
+			}
+		}
+	}
+
+	return args
+}
+
+// fitContextWindow drops the oldest messages after the system prompt with types.DropOldest, until the estimated size of
+// the request, plus maxTokens for the response, fits in contextWindow tokens.
+func fitContextWindow(msgs []types.CompletionMessage, contextWindow, maxTokens int) []types.CompletionMessage {
+	if contextWindow <= 0 {
+		return msgs
+	}
+
+	result := types.DropOldest(msgs, contextWindow-maxTokens)
+	if dropped := len(msgs) - len(result); dropped > 0 {
+		slog.Debug("dropped messages to fit the context window", "dropped", dropped, "contextWindow", contextWindow)
+	}
+	return result
+}
@@ -0,0 +1,124 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepairArguments(t *testing.T) {
+	for args, expected := range map[string]string{
+		``:                                "{}",
+		` {"a": 1} `:                      `{"a": 1}`,
+		"```json\n{\"a\": 1}\n```":        `{"a": 1}`,
+		`Calling the tool: {"a": 1}.`:     `{"a": 1}`,
+		`{"a": {"b": 1}`:                  `{"a": {"b": 1}}`,
+		`not json at all`:                 `not json at all`,
+		`{"a": "unterminated`:             `{"a": "unterminated`,
+		"```\n{\"a\": [1, 2]}\n```\n":     `{"a": [1, 2]}`,
+		`{"message": "use {braces}"} foo`: `{"message": "use {braces}"}`,
+	} {
+		assert.Equal(t, expected, repairArguments(args), args)
+	}
+}
+
+func TestApplyProfile(t *testing.T) {
+	msg := types.CompletionMessage{
+		Content: []types.ContentPart{
+			{Text: "Let me check"},
+			{ToolCall: &types.CompletionToolCall{Index: ptr(1), Function: types.CompletionFunctionCall{Name: "ls", Arguments: "```json\n{}\n```"}}},
+			{ToolCall: &types.CompletionToolCall{Index: ptr(2), Function: types.CompletionFunctionCall{Name: "cat", Arguments: `{}`}}},
+		},
+	}
+
+	assert.Equal(t, msg, applyProfile("", msg))
+
+	result := applyProfile(LlamaCppProfile, msg)
+	assert.Len(t, result.Content, 2)
+	assert.Equal(t, "ls", result.Content[1].ToolCall.Function.Name)
+	assert.Equal(t, "{}", result.Content[1].ToolCall.Function.Arguments)
+	assert.Equal(t, "```json\n{}\n```", msg.Content[1].ToolCall.Function.Arguments)
+}
+
+func TestApplyProfileStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i, name := range []string{"ls", "cat"} {
+			_, _ = fmt.Fprintf(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"tool_calls\":[{\"index\":%d,\"id\":\"%s\",\"type\":\"function\",\"function\":{\"name\":\"%s\",\"arguments\":\"{}\"}}]}}]}\n\n", i, name, name)
+		}
+		_, _ = fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	client, err := NewClient(Options{
+		BaseURL: server.URL,
+		APIKey:  "key",
+		Profile: LlamaCppProfile,
+	})
+	require.NoError(t, err)
+
+	status := make(chan types.CompletionStatus, 100)
+	resp, err := client.Call(context.Background(), types.CompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []types.CompletionMessage{{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("hello")}},
+	}, status)
+	require.NoError(t, err)
+	close(status)
+
+	// Partial responses leave out the extra tool calls as well, so they never show a call that is not made
+	var partials int
+	for s := range status {
+		if s.PartialResponse == nil {
+			continue
+		}
+		partials++
+		var calls []string
+		for _, part := range s.PartialResponse.Content {
+			if part.ToolCall != nil {
+				calls = append(calls, part.ToolCall.Function.Name)
+			}
+		}
+		assert.LessOrEqual(t, len(calls), 1, "partial response %d has tool calls %v", partials, calls)
+	}
+	assert.Greater(t, partials, 2)
+
+	require.Len(t, resp.Content, 1)
+	assert.Equal(t, "ls", resp.Content[0].ToolCall.Function.Name)
+}
+
+func TestFitContextWindow(t *testing.T) {
+	text := strings.Repeat("x", 400)
+	call := &types.CompletionToolCall{ID: "call_1"}
+	msgs := []types.CompletionMessage{
+		{Role: types.CompletionMessageRoleTypeSystem, Content: types.Text("system")},
+		{Role: types.CompletionMessageRoleTypeUser, Content: types.Text(text)},
+		{Role: types.CompletionMessageRoleTypeAssistant, Content: []types.ContentPart{{ToolCall: call}}},
+		{Role: types.CompletionMessageRoleTypeTool, Content: types.Text(text), ToolCall: call},
+		{Role: types.CompletionMessageRoleTypeUser, Content: types.Text(text)},
+	}
+
+	assert.Equal(t, msgs, fitContextWindow(msgs, 0, 0))
+	assert.Equal(t, msgs, fitContextWindow(msgs, 1000, 0))
+
+	result := fitContextWindow(msgs, 250, 0)
+	assert.Equal(t, []types.CompletionMessage{msgs[0], msgs[2], msgs[3], msgs[4]}, result)
+
+	// Dropping the tool call drops its result too
+	result = fitContextWindow(msgs, 150, 0)
+	assert.Equal(t, []types.CompletionMessage{msgs[0], msgs[4]}, result)
+
+	// Room is left for the response
+	result = fitContextWindow(msgs, 350, 100)
+	assert.Equal(t, []types.CompletionMessage{msgs[0], msgs[2], msgs[3], msgs[4]}, result)
+
+	// The last message is kept even if it does not fit
+	result = fitContextWindow(msgs, 10, 0)
+	assert.Equal(t, []types.CompletionMessage{msgs[0], msgs[4]}, result)
+}
@@ -0,0 +1,157 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultMaxRetries = 5
+	defaultRetryDelay = time.Second
+	maxRetryDelay     = 30 * time.Second
+	// maxRetryTime bounds the time spent retrying one request, including the waits between attempts.
+	maxRetryTime = 5 * time.Minute
+)
+
+type retryDeadlineKey struct{}
+
+// withRetryDeadline sets the deadline of the retries of a request, so that the retries of a response stream that failed
+// and of the requests it sends again share one deadline.
+func withRetryDeadline(ctx context.Context, deadline time.Time) context.Context {
+	return context.WithValue(ctx, retryDeadlineKey{}, deadline)
+}
+
+// retryDeadline returns the deadline of the retries of a request, which is maxRetryTime from now unless ctx has one.
+func retryDeadline(ctx context.Context) time.Time {
+	if deadline, ok := ctx.Value(retryDeadlineKey{}).(time.Time); ok {
+		return deadline
+	}
+	return time.Now().Add(maxRetryTime)
+}
+
+// retryPolicy decides how often and when requests to the LLM are retried. Retrying is safe because a completion
+// request has no side effects: tool calls in the response only run after the client returned the complete response.
+type retryPolicy struct {
+	maxRetries int
+	baseDelay  time.Duration
+}
+
+func newRetryPolicy(maxRetries int, baseDelay string) (retryPolicy, error) {
+	policy := retryPolicy{
+		maxRetries: maxRetries,
+		baseDelay:  defaultRetryDelay,
+	}
+	if maxRetries == 0 {
+		policy.maxRetries = defaultMaxRetries
+	} else if maxRetries < 0 {
+		policy.maxRetries = 0
+	}
+	if baseDelay != "" {
+		delay, err := time.ParseDuration(baseDelay)
+		if err != nil {
+			return policy, err
+		}
+		if delay < 0 {
+			return policy, errors.New("retry delay cannot be negative")
+		}
+		policy.baseDelay = delay
+	}
+	return policy, nil
+}
+
+// delay returns how long to wait before retry number attempt, counting from zero. A Retry-After header of resp is
+// honored, otherwise the delay grows exponentially from the base delay, with jitter so that concurrent clients don't
+// retry in lockstep.
+func (r retryPolicy) delay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if after, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			return after
+		}
+	}
+
+	delay := r.baseDelay << attempt
+	if delay > maxRetryDelay || delay <= 0 {
+		delay = maxRetryDelay
+	}
+	// Full jitter in the upper half, so the delay still grows with each attempt
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
+
+func retryableStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryTransport retries requests that fail with a connection error, or with a status code that says the request may
+// succeed later, such as 429 for rate limiting.
+type retryTransport struct {
+	policy retryPolicy
+	next   http.RoundTripper
+}
+
+func (r *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	deadline := retryDeadline(req.Context())
+
+	for attempt := 0; ; attempt++ {
+		attemptReq := req
+		if attempt > 0 && req.Body != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attemptReq = req.Clone(req.Context())
+			attemptReq.Body = body
+		}
+
+		resp, err := r.next.RoundTrip(attemptReq)
+		if req.Context().Err() != nil || attempt >= r.policy.maxRetries || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+		if err == nil && !retryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+
+		delay := r.policy.delay(attempt, resp)
+		if time.Now().Add(delay).After(deadline) {
+			return resp, err
+		}
+
+		if err != nil {
+			log.Infof("LLM request failed, retrying in %s: %v", delay.Round(time.Millisecond), err)
+		} else {
+			log.Infof("LLM request failed with status code [%d], retrying in %s", resp.StatusCode, delay.Round(time.Millisecond))
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
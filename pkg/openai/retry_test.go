@@ -0,0 +1,134 @@
+package openai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy, err := newRetryPolicy(0, "")
+	require.NoError(t, err)
+	assert.Equal(t, defaultMaxRetries, policy.maxRetries)
+
+	for attempt := 0; attempt < 10; attempt++ {
+		delay := policy.delay(attempt, nil)
+		expected := min(defaultRetryDelay<<attempt, maxRetryDelay)
+		assert.GreaterOrEqual(t, delay, expected/2)
+		assert.LessOrEqual(t, delay, expected)
+	}
+
+	resp := &http.Response{Header: http.Header{"Retry-After": {"7"}}}
+	assert.Equal(t, 7*time.Second, policy.delay(0, resp))
+
+	policy, err = newRetryPolicy(-1, "10ms")
+	require.NoError(t, err)
+	assert.Equal(t, 0, policy.maxRetries)
+	assert.LessOrEqual(t, policy.delay(0, nil), 10*time.Millisecond)
+
+	_, err = newRetryPolicy(0, "soon")
+	assert.Error(t, err)
+}
+
+const streamResponse = `data: {"choices":[{"index":0,"delta":{"role":"assistant","content":"hi"}}]}
+
+data: [DONE]
+
+`
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	client, err := NewClient(Options{
+		BaseURL:    server.URL,
+		APIKey:     "key",
+		RetryDelay: "1ms",
+	})
+	require.NoError(t, err)
+	return client
+}
+
+func call(client *Client) (*types.CompletionMessage, error) {
+	status := make(chan types.CompletionStatus, 100)
+	return client.Call(context.Background(), types.CompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []types.CompletionMessage{{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("hello")}},
+	}, status)
+}
+
+func TestRetryRateLimited(t *testing.T) {
+	var requests atomic.Int32
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		if requests.Add(1) <= 2 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = fmt.Fprint(w, `{"error":{"message":"rate limited"}}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, streamResponse)
+	})
+
+	resp, err := call(client)
+	require.NoError(t, err)
+	assert.Equal(t, "hi", resp.String())
+	assert.Equal(t, int32(3), requests.Load())
+}
+
+func TestRetryNotRetryable(t *testing.T) {
+	var requests atomic.Int32
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = fmt.Fprint(w, `{"error":{"message":"bad request"}}`)
+	})
+
+	_, err := call(client)
+	assert.ErrorContains(t, err, "bad request")
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestRetryMidStream(t *testing.T) {
+	var requests atomic.Int32
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		if requests.Add(1) == 1 {
+			_, _ = fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"h\"}}]}\n\ndata: {broken\n\n")
+			return
+		}
+		_, _ = fmt.Fprint(w, streamResponse)
+	})
+
+	resp, err := call(client)
+	require.NoError(t, err)
+	assert.Equal(t, "hi", resp.String())
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+func TestRetryMidStreamDeadline(t *testing.T) {
+	var requests atomic.Int32
+	client := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"h\"}}]}\n\ndata: {broken\n\n")
+	})
+
+	// The stream is not sent again once the deadline of the retries of the request passed
+	status := make(chan types.CompletionStatus, 100)
+	_, err := client.Call(withRetryDeadline(context.Background(), time.Now()), types.CompletionRequest{
+		Model:    "gpt-4o",
+		Messages: []types.CompletionMessage{{Role: types.CompletionMessageRoleTypeUser, Content: types.Text("hello")}},
+	}, status)
+	assert.ErrorContains(t, err, "response stream failed after a partial completion")
+	assert.Equal(t, int32(1), requests.Load())
+}
@@ -2,14 +2,17 @@ package parser
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"io"
 	"regexp"
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gptscript-ai/gptscript/pkg/rlimit"
 	"github.com/gptscript-ai/gptscript/pkg/types"
 )
 
@@ -130,6 +133,11 @@ func isParam(line string, tool *types.Tool) (_ bool, err error) {
 		if err != nil {
 			return false, err
 		}
+	case "outputschema":
+		tool.Parameters.OutputSchema = &openapi3.Schema{}
+		if err := json.Unmarshal([]byte(value), tool.Parameters.OutputSchema); err != nil {
+			return false, fmt.Errorf("invalid output schema, must be a JSON schema on one line: %w", err)
+		}
 	case "temperature":
 		tool.Parameters.Temperature, err = toFloatPtr(value)
 		if err != nil {
@@ -137,6 +145,26 @@ func isParam(line string, tool *types.Tool) (_ bool, err error) {
 		}
 	case "credentials", "creds", "credential", "cred":
 		tool.Parameters.Credentials = append(tool.Parameters.Credentials, csv(strings.ToLower(value))...)
+	case "sharecredentials", "sharecreds", "sharecredential", "sharecred":
+		tool.Parameters.ShareCredentials = append(tool.Parameters.ShareCredentials, csv(value)...)
+	case "allowedpath", "allowedpaths":
+		tool.Parameters.AllowedPaths = append(tool.Parameters.AllowedPaths, csv(value)...)
+	case "network":
+		v, err := toBool(value)
+		if err != nil {
+			return false, err
+		}
+		tool.Parameters.Network = &v
+	case "maxmemory":
+		if _, err := rlimit.ParseMemory(value); err != nil {
+			return false, err
+		}
+		tool.Parameters.MaxMemory = value
+	case "maxcputime":
+		if _, err := time.ParseDuration(value); err != nil {
+			return false, fmt.Errorf("invalid max CPU time %q, must be a duration such as 30s: %w", value, err)
+		}
+		tool.Parameters.MaxCPUTime = value
 	default:
 		return false, nil
 	}
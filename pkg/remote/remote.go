@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -103,16 +105,28 @@ func (c *Client) clientFromURL(apiURL string) (*openai.Client, error) {
 	if err != nil {
 		return nil, err
 	}
-	env := "GPTSCRIPT_PROVIDER_" + env2.ToEnvLike(parsed.Hostname()) + "_API_KEY"
+	envPrefix := "GPTSCRIPT_PROVIDER_" + env2.ToEnvLike(parsed.Hostname())
+	env := envPrefix + "_API_KEY"
 	apiKey := os.Getenv(env)
 	if apiKey == "" {
 		log.Warnf("No API key found for %s", env)
 		apiKey = "<unset>"
 	}
+
+	var contextWindow int
+	if v := os.Getenv(envPrefix + "_CONTEXT_WINDOW"); v != "" {
+		contextWindow, err = strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s_CONTEXT_WINDOW %q: %w", envPrefix, v, err)
+		}
+	}
+
 	return openai.NewClient(openai.Options{
-		BaseURL: apiURL,
-		Cache:   c.cache,
-		APIKey:  apiKey,
+		BaseURL:       apiURL,
+		Cache:         c.cache.Responses(),
+		APIKey:        apiKey,
+		Profile:       os.Getenv(envPrefix + "_PROFILE"),
+		ContextWindow: contextWindow,
 	})
 }
 
@@ -139,7 +153,8 @@ func (c *Client) load(ctx context.Context, toolName string) (*openai.Client, err
 	}
 
 	prg, err := loader.Program(ctx, toolName, "", loader.Options{
-		Cache: c.cache,
+		Cache:   c.cache,
+		Offline: slices.Contains(c.envs, "GPTSCRIPT_OFFLINE=true"),
 	})
 	if err != nil {
 		return nil, err
@@ -158,7 +173,7 @@ func (c *Client) load(ctx context.Context, toolName string) (*openai.Client, err
 
 	client, err = openai.NewClient(openai.Options{
 		BaseURL:  url,
-		Cache:    c.cache,
+		Cache:    c.cache.Responses(),
 		CacheKey: prg.EntryToolID,
 	})
 	if err != nil {
@@ -0,0 +1,55 @@
+package download
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+)
+
+var (
+	clientOnce sync.Once
+	client     *http.Client
+	clientErr  error
+)
+
+// HTTPClient returns the client used for all downloads of runtimes and tools. It uses the proxy configured with
+// HTTPS_PROXY, HTTP_PROXY and NO_PROXY and, if GPTSCRIPT_CA_BUNDLE is set to the path of a PEM file, trusts the
+// certificates in that file in addition to the system ones.
+func HTTPClient() (*http.Client, error) {
+	clientOnce.Do(func() {
+		client, clientErr = newHTTPClient(os.Getenv("GPTSCRIPT_CA_BUNDLE"))
+	})
+	return client, clientErr
+}
+
+func newHTTPClient(caBundle string) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+
+	if caBundle != "" {
+		pem, err := os.ReadFile(caBundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read GPTSCRIPT_CA_BUNDLE: %w", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in GPTSCRIPT_CA_BUNDLE %s", caBundle)
+		}
+
+		transport.TLSClientConfig = &tls.Config{
+			RootCAs:    pool,
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+
+	return &http.Client{
+		Transport: transport,
+	}, nil
+}
@@ -0,0 +1,36 @@
+package download
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// Digester returns the hash to verify a download with and the hex encoded sum it must match. The algorithm is taken
+// from an explicit prefix like sha512:, or else from the length of digest, with sha256 as the default so bare digests
+// like the ones in the embedded digests.txt files keep working.
+func Digester(digest string) (hash.Hash, string, error) {
+	digest = strings.ToLower(strings.TrimSpace(digest))
+
+	algorithm, sum, ok := strings.Cut(digest, ":")
+	if !ok {
+		sum = digest
+		switch len(sum) {
+		case sha512.Size * 2:
+			algorithm = "sha512"
+		default:
+			algorithm = "sha256"
+		}
+	}
+
+	switch algorithm {
+	case "sha256":
+		return sha256.New(), sum, nil
+	case "sha512":
+		return sha512.New(), sum, nil
+	default:
+		return nil, "", fmt.Errorf("unsupported digest algorithm %q, only sha256 and sha512 are supported", algorithm)
+	}
+}
@@ -0,0 +1,29 @@
+package download
+
+import "fmt"
+
+// ChecksumMismatchError is returned when downloaded content does not have the digest it was expected to have.
+type ChecksumMismatchError struct {
+	URL      string
+	Expected string
+	Actual   string
+}
+
+func (c *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("downloaded %s and expected digest %s but got %s", c.URL, c.Expected, c.Actual)
+}
+
+// DownloadError is returned when a file could not be downloaded, because of a network failure or an unexpected status
+// of the server, after all attempts to resume the download.
+type DownloadError struct {
+	URL string
+	Err error
+}
+
+func (d *DownloadError) Error() string {
+	return fmt.Sprintf("failed to download %s: %v", d.URL, d.Err)
+}
+
+func (d *DownloadError) Unwrap() error {
+	return d.Err
+}
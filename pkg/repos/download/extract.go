@@ -2,8 +2,8 @@ package download
 
 import (
 	"context"
-	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,53 +12,37 @@ import (
 	"path/filepath"
 	"time"
 
+	gcontext "github.com/gptscript-ai/gptscript/pkg/context"
 	"github.com/mholt/archiver/v4"
 )
 
+// Extract downloads the archive at downloadURL, verifies that it matches digest, and only then extracts it
+// into targetDir. Nothing is written to targetDir if the download fails or the digest does not match.
 func Extract(ctx context.Context, downloadURL, digest, targetDir string) error {
-	if err := os.RemoveAll(targetDir); err != nil {
-		return nil
-	}
-
-	if err := os.MkdirAll(targetDir, 0755); err != nil {
-		return fmt.Errorf("mkdir %s: %w", targetDir, err)
-	}
-
-	tmpFile, err := os.CreateTemp("", "gptscript-download")
+	parsedURL, err := url.Parse(downloadURL)
 	if err != nil {
 		return err
 	}
-	defer os.Remove(tmpFile.Name())
-	defer tmpFile.Close()
 
-	resp, err := http.Get(downloadURL)
+	archive, err := download(ctx, downloadURL, filepath.Base(parsedURL.Path), digest)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-
-	digester := sha256.New()
-	input := io.TeeReader(resp.Body, digester)
+	defer os.Remove(archive)
 
-	if _, err = io.Copy(tmpFile, input); err != nil {
-		return err
+	if err := os.RemoveAll(targetDir); err != nil {
+		return fmt.Errorf("remove %s: %w", targetDir, err)
 	}
 
-	resultDigest := digester.Sum(nil)
-	resultDigestString := hex.EncodeToString(resultDigest[:])
-
-	if resultDigestString != digest {
-		return fmt.Errorf("downloaded %s and expected digest %s but got %s", downloadURL, digest, resultDigestString)
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		return fmt.Errorf("mkdir %s: %w", targetDir, err)
 	}
 
-	parsedURL, err := url.Parse(downloadURL)
+	tmpFile, err := os.Open(archive)
 	if err != nil {
 		return err
 	}
-
-	if _, err := tmpFile.Seek(0, 0); err != nil {
-		return err
-	}
+	defer tmpFile.Close()
 
 	format, input, err := archiver.Identify(filepath.Base(parsedURL.Path), tmpFile)
 	if err != nil {
@@ -80,21 +64,7 @@ func Extract(ctx context.Context, downloadURL, digest, targetDir string) error {
 		} else if f.LinkTarget != "" {
 			return os.Symlink(f.LinkTarget, target)
 		}
-		targetFile, err := os.Create(target)
-		if err != nil {
-			return fmt.Errorf("create %s: %w", target, err)
-		}
-		arc, err := f.Open()
-		if err != nil {
-			return err
-		}
-		if _, err := io.Copy(targetFile, arc); err != nil {
-			return err
-		}
-		if err := arc.Close(); err != nil {
-			return err
-		}
-		if err := targetFile.Close(); err != nil {
+		if err := writeFile(target, f); err != nil {
 			return err
 		}
 		if err := os.Chmod(target, f.Mode()); err != nil {
@@ -112,3 +82,152 @@ func Extract(ctx context.Context, downloadURL, digest, targetDir string) error {
 
 	return nil
 }
+
+// writeFile writes the content of the file f of an archive to target. A file that fails to close is an error, because
+// it may not have been fully written.
+func writeFile(target string, f archiver.File) (err error) {
+	arc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer arc.Close()
+
+	targetFile, err := os.Create(target)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", target, err)
+	}
+	defer func() {
+		if closeErr := targetFile.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("write %s: %w", target, closeErr)
+		}
+	}()
+
+	if _, err := io.Copy(targetFile, arc); err != nil {
+		return fmt.Errorf("write %s: %w", target, err)
+	}
+	return nil
+}
+
+const downloadAttempts = 3
+
+// retryInterval is how long download waits before its second attempt, doubling for every attempt after it
+var retryInterval = time.Second
+
+// download fetches downloadURL to a temporary file and returns its path once the digest of the complete file has been
+// verified, see Digester for the supported algorithms. If the connection drops or the server fails with a status 5xx,
+// the download is resumed with a Range request after a backoff, up to downloadAttempts times. The file is removed if
+// the download fails or the digest does not match, and a file that does not match is not downloaded again.
+func download(ctx context.Context, downloadURL, name, digest string) (_ string, err error) {
+	hasher, expected, err := Digester(digest)
+	if err != nil {
+		return "", err
+	}
+
+	tmpFile, err := os.CreateTemp("", "gptscript-download-*-"+name+".partial")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = tmpFile.Close()
+		if err != nil {
+			_ = os.Remove(tmpFile.Name())
+		}
+	}()
+
+	interval := retryInterval
+	for attempt := 1; ; attempt++ {
+		err := resume(ctx, downloadURL, tmpFile)
+		if err == nil {
+			break
+		}
+		var statusErr *statusError
+		if ctx.Err() != nil || attempt >= downloadAttempts || errors.As(err, &statusErr) && statusErr.code < http.StatusInternalServerError {
+			return "", &DownloadError{URL: downloadURL, Err: err}
+		}
+
+		log.InfofCtx(ctx, "Resuming download of %s in %v after error: %v", downloadURL, interval, err)
+		select {
+		case <-ctx.Done():
+			return "", &DownloadError{URL: downloadURL, Err: err}
+		case <-time.After(interval):
+		}
+		interval *= 2
+	}
+
+	if _, err := tmpFile.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	if _, err := io.Copy(hasher, tmpFile); err != nil {
+		return "", err
+	}
+
+	resultDigestString := hex.EncodeToString(hasher.Sum(nil))
+
+	if resultDigestString != expected {
+		return "", &ChecksumMismatchError{URL: downloadURL, Expected: digest, Actual: resultDigestString}
+	}
+
+	return tmpFile.Name(), tmpFile.Close()
+}
+
+type statusError struct {
+	status string
+	code   int
+}
+
+func (s *statusError) Error() string {
+	return s.status
+}
+
+// resume appends the rest of downloadURL to file, starting from the bytes already in file.
+func resume(ctx context.Context, downloadURL string, file *os.File) error {
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, downloadURL, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	client, err := HTTPClient()
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK && offset > 0:
+		// The server ignored the Range header and is sending the whole file again
+		if err := file.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	case resp.StatusCode == http.StatusOK, resp.StatusCode == http.StatusPartialContent && offset > 0:
+	default:
+		return &statusError{status: resp.Status, code: resp.StatusCode}
+	}
+
+	total := resp.ContentLength
+	if total > 0 && resp.StatusCode == http.StatusPartialContent {
+		total += offset
+	} else if resp.StatusCode == http.StatusOK {
+		offset = 0
+	}
+
+	body := newProgressReader(resp.Body, filepath.Base(req.URL.Path), offset, total, gcontext.GetProgressFuncFromCtx(ctx))
+	_, err = io.Copy(file, body)
+	return err
+}
@@ -0,0 +1,169 @@
+package download
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testZip returns a zip laid out like a Go release for Windows
+func testZip(t *testing.T) []byte {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	w := zip.NewWriter(buf)
+
+	dir := &zip.FileHeader{Name: "go/bin/"}
+	dir.SetMode(os.ModeDir | 0755)
+	_, err := w.CreateHeader(dir)
+	require.NoError(t, err)
+
+	file := &zip.FileHeader{Name: "go/bin/go.exe", Method: zip.Deflate}
+	file.SetMode(0755)
+	f, err := w.CreateHeader(file)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("go binary"))
+	require.NoError(t, err)
+
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestExtractZip(t *testing.T) {
+	data := testZip(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "go.zip", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	digest := sha256.Sum256(data)
+	target := t.TempDir()
+	require.NoError(t, Extract(context.Background(), srv.URL+"/go1.22.1.windows-amd64.zip", hex.EncodeToString(digest[:]), target))
+
+	content, err := os.ReadFile(filepath.Join(target, "go", "bin", "go.exe"))
+	require.NoError(t, err)
+	assert.Equal(t, "go binary", string(content))
+
+	if runtime.GOOS != "windows" {
+		stat, err := os.Stat(filepath.Join(target, "go", "bin", "go.exe"))
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0755), stat.Mode().Perm())
+	}
+}
+
+func TestExtractDigestMismatch(t *testing.T) {
+	data := testZip(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(data)
+	}))
+	defer srv.Close()
+
+	target := filepath.Join(t.TempDir(), "target")
+	err := Extract(context.Background(), srv.URL+"/go1.22.1.windows-amd64.zip", "0000", target)
+	assert.ErrorContains(t, err, "expected digest 0000")
+	assert.NoDirExists(t, target)
+}
+
+func TestExtractDigestAlgorithms(t *testing.T) {
+	data := testZip(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "go.zip", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	sha256Digest := sha256.Sum256(data)
+	sha512Digest := sha512.Sum512(data)
+	for _, digest := range []string{
+		"sha256:" + hex.EncodeToString(sha256Digest[:]),
+		hex.EncodeToString(sha512Digest[:]),
+		"SHA512:" + strings.ToUpper(hex.EncodeToString(sha512Digest[:])),
+	} {
+		t.Run(digest[:10], func(t *testing.T) {
+			require.NoError(t, Extract(context.Background(), srv.URL+"/go1.22.1.windows-amd64.zip", digest, t.TempDir()))
+		})
+	}
+
+	err := Extract(context.Background(), srv.URL+"/go1.22.1.windows-amd64.zip", "blake3:0000", t.TempDir())
+	assert.ErrorContains(t, err, "unsupported digest algorithm")
+}
+
+func TestExtractRetry(t *testing.T) {
+	defer func(interval time.Duration) { retryInterval = interval }(retryInterval)
+	retryInterval = time.Millisecond
+
+	data := testZip(t)
+	digest := sha256.Sum256(data)
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) < downloadAttempts {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		http.ServeContent(w, r, "go.zip", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	target := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(target, "partial"), []byte("left over"), 0644))
+	require.NoError(t, Extract(context.Background(), srv.URL+"/go1.22.1.windows-amd64.zip", hex.EncodeToString(digest[:]), target))
+	assert.Equal(t, int32(downloadAttempts), requests.Load())
+	assert.FileExists(t, filepath.Join(target, "go", "bin", "go.exe"))
+	assert.NoFileExists(t, filepath.Join(target, "partial"))
+}
+
+func TestExtractNoRetry(t *testing.T) {
+	defer func(interval time.Duration) { retryInterval = interval }(retryInterval)
+	retryInterval = time.Millisecond
+
+	data := testZip(t)
+	digest := sha256.Sum256(data)
+
+	for name, test := range map[string]struct {
+		status   int
+		digest   string
+		requests int32
+		mismatch bool
+	}{
+		"not found":         {status: http.StatusNotFound, digest: hex.EncodeToString(digest[:]), requests: 1},
+		"checksum mismatch": {status: http.StatusOK, digest: "0000", requests: 1, mismatch: true},
+		"server error":      {status: http.StatusBadGateway, digest: hex.EncodeToString(digest[:]), requests: downloadAttempts},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var requests atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.WriteHeader(test.status)
+				_, _ = w.Write(data)
+			}))
+			defer srv.Close()
+
+			target := filepath.Join(t.TempDir(), "target")
+			err := Extract(context.Background(), srv.URL+"/go1.22.1.windows-amd64.zip", test.digest, target)
+			if test.mismatch {
+				var mismatchErr *ChecksumMismatchError
+				assert.ErrorAs(t, err, &mismatchErr)
+			} else {
+				var downloadErr *DownloadError
+				assert.ErrorAs(t, err, &downloadErr)
+			}
+			assert.Equal(t, test.requests, requests.Load())
+			assert.NoDirExists(t, target)
+		})
+	}
+}
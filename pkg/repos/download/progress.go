@@ -0,0 +1,76 @@
+package download
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// progressSteps is how many times progress is reported for a download with a known size
+const progressSteps = 10
+
+// progressReader reports how much of a download has been read, at every tenth of the total size, or every
+// progressInterval if the size is not known.
+type progressReader struct {
+	r          io.Reader
+	name       string
+	read       int64
+	total      int64
+	start      time.Time
+	lastReport time.Time
+	lastStep   int64
+	report     func(string)
+}
+
+const progressInterval = 5 * time.Second
+
+func newProgressReader(r io.Reader, name string, offset, total int64, report func(string)) *progressReader {
+	now := time.Now()
+	p := &progressReader{
+		r:          r,
+		name:       name,
+		read:       offset,
+		total:      total,
+		start:      now,
+		lastReport: now,
+		report:     report,
+	}
+	if total > 0 {
+		p.lastStep = offset * progressSteps / total
+	}
+	return p
+}
+
+func (p *progressReader) Read(buf []byte) (int, error) {
+	n, err := p.r.Read(buf)
+	p.read += int64(n)
+
+	if p.total > 0 {
+		if step := p.read * progressSteps / p.total; step > p.lastStep {
+			p.lastStep = step
+			p.send()
+		}
+	} else if time.Since(p.lastReport) >= progressInterval {
+		p.send()
+	}
+
+	return n, err
+}
+
+func (p *progressReader) send() {
+	p.lastReport = time.Now()
+	rate := float64(p.read) / time.Since(p.start).Seconds()
+	if p.total > 0 {
+		p.report(fmt.Sprintf("Downloading %s: %s / %s (%d%%), %s/s", p.name, size(p.read), size(p.total), p.read*100/p.total, size(int64(rate))))
+	} else {
+		p.report(fmt.Sprintf("Downloading %s: %s, %s/s", p.name, size(p.read), size(int64(rate))))
+	}
+}
+
+func size(bytes int64) string {
+	const mb = 1024 * 1024
+	if bytes < mb {
+		return fmt.Sprintf("%d KB", bytes/1024)
+	}
+	return fmt.Sprintf("%.1f MB", float64(bytes)/mb)
+}
@@ -0,0 +1,21 @@
+package download
+
+import (
+	"fmt"
+)
+
+// CheckFreeSpace returns an error if the filesystem containing dir has less than required bytes available. If the
+// free space can not be determined on this platform no error is returned.
+func CheckFreeSpace(dir string, required uint64) error {
+	available, ok, err := freeSpace(dir)
+	if err != nil {
+		return fmt.Errorf("failed to check free space in %s: %w", dir, err)
+	} else if !ok {
+		return nil
+	}
+
+	if available < required {
+		return fmt.Errorf("not enough free space in %s: %s required but only %s available", dir, size(int64(required)), size(int64(available)))
+	}
+	return nil
+}
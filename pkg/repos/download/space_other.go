@@ -0,0 +1,7 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package download
+
+func freeSpace(string) (uint64, bool, error) {
+	return 0, false, nil
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package download
+
+import "golang.org/x/sys/windows"
+
+func freeSpace(dir string) (uint64, bool, error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, false, err
+	}
+
+	var available uint64
+	if err := windows.GetDiskFreeSpaceEx(path, &available, nil, nil); err != nil {
+		return 0, false, err
+	}
+	return available, true, nil
+}
@@ -0,0 +1,98 @@
+package repos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Evicter is implemented by runtimes that can remove what they downloaded to the data root, such as toolchains.
+type Evicter interface {
+	// Evict removes the downloads in dataRoot that inUse reports as unused and returns the removed paths
+	Evict(ctx context.Context, dataRoot string, inUse func(dir string) bool) ([]string, error)
+}
+
+// Evict removes downloaded runtimes that are not used by any tool that is set up. If all is true the tools and their
+// repos are removed too, and every tool is set up again on its next use. The cleanup hooks of the source resolvers that
+// fetched tools are called then. Tool setups in this process wait for Evict to finish, and Evict waits for the ones in
+// progress.
+func (m *Manager) Evict(ctx context.Context, all bool) ([]string, error) {
+	m.evictLock.Lock()
+	defer m.evictLock.Unlock()
+
+	if all {
+		if _, err := os.Stat(m.storageDir); errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		if err := m.cleanupSources(ctx); err != nil {
+			return nil, err
+		}
+		return []string{m.storageDir}, os.RemoveAll(m.storageDir)
+	}
+
+	paths, err := m.setupPaths()
+	if err != nil {
+		return nil, err
+	}
+
+	inUse := func(dir string) bool {
+		for _, path := range paths {
+			if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var removed []string
+	for _, runtime := range m.runtimes {
+		if e, ok := runtime.(Evicter); ok {
+			paths, err := e.Evict(ctx, m.runtimeDir, inUse)
+			removed = append(removed, paths...)
+			if err != nil {
+				return removed, err
+			}
+		}
+	}
+
+	return removed, nil
+}
+
+// setupPaths returns the PATH entries of all the tools that are set up, which is where they find their runtimes.
+func (m *Manager) setupPaths() (result []string, _ error) {
+	err := filepath.WalkDir(m.storageDir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if d.IsDir() && (path == m.gitDir || path == m.runtimeDir || d.Name() == ".git") {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".done") {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var savedEnv []string
+		if err := json.Unmarshal(data, &savedEnv); err != nil {
+			log.Warnf("Ignoring invalid %s: %v", path, err)
+			return nil
+		}
+		for _, env := range savedEnv {
+			key, value, _ := strings.Cut(env, "=")
+			if strings.EqualFold(key, "PATH") {
+				result = append(result, filepath.SplitList(value)...)
+			}
+		}
+		return nil
+	})
+	return result, err
+}
@@ -8,9 +8,16 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	goruntime "runtime"
+	"slices"
+	"strings"
+	"sync"
 
 	"github.com/BurntSushi/locker"
+	"github.com/gptscript-ai/gptscript/pkg/mvl"
 	"github.com/gptscript-ai/gptscript/pkg/repos/git"
+	"github.com/gptscript-ai/gptscript/pkg/repos/oci"
+	"github.com/gptscript-ai/gptscript/pkg/trace"
 	"github.com/gptscript-ai/gptscript/pkg/types"
 )
 
@@ -20,6 +27,17 @@ type Runtime interface {
 	Setup(ctx context.Context, dataRoot, toolSource string, env []string) ([]string, error)
 }
 
+// Verifier is implemented by runtimes that can check that what a previous Setup produced has not been modified since.
+type Verifier interface {
+	Verify(toolSource string) error
+}
+
+// LocalBuilder is implemented by runtimes that can build a tool that is not from a repo in its own directory, and skip
+// the build if the tool has not changed since it was last built.
+type LocalBuilder interface {
+	BuildLocal(ctx context.Context, dataRoot, toolDir string, env []string) ([]string, error)
+}
+
 type noopRuntime struct {
 }
 
@@ -40,6 +58,10 @@ type Manager struct {
 	gitDir     string
 	runtimeDir string
 	runtimes   []Runtime
+	// verify makes runtimes that implement Verifier check their previous Setup before it is reused
+	verify bool
+	// evictLock is held for reading by setup and for writing by Evict
+	evictLock sync.RWMutex
 }
 
 func New(cacheDir string, runtimes ...Runtime) *Manager {
@@ -49,32 +71,57 @@ func New(cacheDir string, runtimes ...Runtime) *Manager {
 		gitDir:     filepath.Join(root, "git"),
 		runtimeDir: filepath.Join(root, "runtimes"),
 		runtimes:   runtimes,
+		verify:     os.Getenv("GPTSCRIPT_VERIFY_TOOLS") == "true",
 	}
 }
 
-func (m *Manager) setup(ctx context.Context, runtime Runtime, tool types.Tool, env []string) (string, []string, error) {
+func (m *Manager) setup(ctx context.Context, runtime Runtime, tool types.Tool, env []string) (_ string, _ []string, err error) {
+	m.evictLock.RLock()
+	defer m.evictLock.RUnlock()
+
 	locker.Lock(tool.ID)
 	defer locker.Unlock(tool.ID)
 
-	target := filepath.Join(m.storageDir, tool.Source.Repo.Revision, tool.Source.Repo.Path, tool.Source.Repo.Name, runtime.ID())
-	targetFinal := filepath.Join(target, tool.Source.Repo.Path)
+	ctx, span := traceSetup(ctx, runtime, tool)
+	defer func() {
+		span.End(err)
+	}()
+
+	// Tag the log lines of the runtime so that they can be attributed when several tools are set up at once
+	ctx = mvl.WithFields(ctx, "tool", tool.ID)
+
+	target, targetFinal := m.paths(runtime, tool)
 	doneFile := targetFinal + ".done"
 	envData, err := os.ReadFile(doneFile)
 	if err == nil {
 		var savedEnv []string
 		if err := json.Unmarshal(envData, &savedEnv); err == nil {
-			return targetFinal, append(env, savedEnv...), nil
+			err := m.verifySetup(runtime, targetFinal)
+			if err == nil {
+				span.SetAttributes(trace.Bool("gptscript.setup.cache_hit", true))
+				return targetFinal, append(env, savedEnv...), nil
+			}
+			log.WarnfCtx(ctx, "Setup of %s failed verification, setting it up again: %v", tool.ID, err)
 		}
 	} else if !errors.Is(err, fs.ErrNotExist) {
 		return "", nil, err
 	}
 
+	span.SetAttributes(trace.Bool("gptscript.setup.cache_hit", false))
+
+	if isOffline(env) {
+		return "", nil, fmt.Errorf("tool %s is not set up and GPTSCRIPT_OFFLINE is set, run it once with network access to download it and its runtime", tool.ID)
+	}
+
 	// Cleanup previous failed runs
 	_ = os.RemoveAll(doneFile + ".tmp")
 	_ = os.RemoveAll(doneFile)
 	_ = os.RemoveAll(target)
+	if err := cleanupSource(ctx, target); err != nil {
+		log.WarnfCtx(ctx, "Failed to clean up the previous source of %s: %v", tool.ID, err)
+	}
 
-	if err := git.Checkout(ctx, m.gitDir, tool.Source.Repo.Root, tool.Source.Repo.Revision, target); err != nil {
+	if err := m.fetch(ctx, *tool.Source.Repo, target); err != nil {
 		return "", nil, err
 	}
 
@@ -100,21 +147,154 @@ func (m *Manager) setup(ctx context.Context, runtime Runtime, tool types.Tool, e
 	return targetFinal, append(env, newEnv...), os.Rename(doneFile+".tmp", doneFile)
 }
 
-func (m *Manager) GetContext(ctx context.Context, tool types.Tool, cmd, env []string) (string, []string, error) {
-	if tool.Source.Repo == nil {
-		return tool.WorkingDir, env, nil
+// traceSetup starts the span of the setup of the tool with runtime, and adds the runtime to the span of the call that
+// sets it up.
+func traceSetup(ctx context.Context, runtime Runtime, tool types.Tool) (context.Context, *trace.Span) {
+	if !trace.Enabled(ctx) {
+		return ctx, nil
+	}
+
+	trace.FromContext(ctx).SetAttributes(trace.String("gptscript.tool.runtime", runtime.ID()))
+	return trace.Start(ctx, "setup "+types.FirstSet(tool.Name, tool.ID), trace.SpanKindInternal,
+		trace.String("gptscript.tool.name", tool.Name),
+		trace.String("gptscript.tool.id", tool.ID),
+		trace.String("gptscript.tool.runtime", runtime.ID()))
+}
+
+// fetch writes the files of the revision of repo to target, with the source resolver registered for its VCS, a git
+// checkout or by pulling the OCI artifact.
+func (m *Manager) fetch(ctx context.Context, repo types.Repo, target string) error {
+	if resolver, ok := sourceResolver(repo.VCS); ok {
+		if err := saveSource(repo, target); err != nil {
+			return err
+		}
+		return resolver.Fetch(ctx, repo, target)
+	}
+	if repo.VCS == "oci" {
+		ref, err := oci.ParseReference(oci.Prefix + repo.Root + "@" + repo.Revision)
+		if err != nil {
+			return err
+		}
+		return oci.Pull(ctx, ref, target)
+	}
+	return git.Checkout(ctx, m.gitDir, repo.Root, repo.Revision, target)
+}
+
+// paths returns the directory the tool's repo is checked out to and the tool's directory within it.
+func (m *Manager) paths(runtime Runtime, tool types.Tool) (string, string) {
+	// Runtime IDs like go1.22.1 or python3.12 are not platform specific, but what Setup builds or installs in the
+	// checkout is, so the platform is part of the path for data roots shared between machines. Downloaded runtimes
+	// are stored by the hash of their platform specific URL, and git repos are platform neutral.
+	// Digests of OCI artifacts have a colon, which can't be in paths on Windows
+	revision := strings.ReplaceAll(tool.Source.Repo.Revision, ":", "-")
+	target := filepath.Join(m.storageDir, revision, tool.Source.Repo.Path, tool.Source.Repo.Name,
+		runtime.ID()+"-"+goruntime.GOOS+"-"+goruntime.GOARCH)
+	return target, filepath.Join(target, tool.Source.Repo.Path)
+}
+
+// isOffline returns true if GPTSCRIPT_OFFLINE=true is set in env. Offline, only tools that were already set up can
+// be used, because setup fetches the tool's repo and downloads its runtime and dependencies.
+func isOffline(env []string) bool {
+	return slices.Contains(env, "GPTSCRIPT_OFFLINE=true")
+}
+
+// buildLocal returns true if GPTSCRIPT_BUILD_LOCAL_TOOLS=true is set in env. Local tools are then built in their
+// directory before they run, as they are being developed.
+func buildLocal(env []string) bool {
+	return slices.Contains(env, "GPTSCRIPT_BUILD_LOCAL_TOOLS=true")
+}
+
+func (m *Manager) buildLocal(ctx context.Context, builder LocalBuilder, tool types.Tool, env []string) (_ string, _ []string, err error) {
+	m.evictLock.RLock()
+	defer m.evictLock.RUnlock()
+
+	// Tools in the same directory share their build
+	locker.Lock(tool.WorkingDir)
+	defer locker.Unlock(tool.WorkingDir)
+
+	ctx, span := traceSetup(ctx, builder.(Runtime), tool)
+	defer func() {
+		span.End(err)
+	}()
+
+	newEnv, err := builder.BuildLocal(mvl.WithFields(ctx, "tool", tool.ID), m.runtimeDir, tool.WorkingDir, env)
+	if err != nil {
+		return "", nil, err
 	}
+	return tool.WorkingDir, append(env, newEnv...), nil
+}
 
-	if tool.Source.Repo.VCS != "git" {
-		return "", nil, fmt.Errorf("only git is supported, found VCS %s for %s", tool.Source.Repo.VCS, tool.ID)
+func (m *Manager) verifySetup(runtime Runtime, toolSource string) error {
+	if !m.verify {
+		return nil
 	}
+	if v, ok := runtime.(Verifier); ok {
+		return v.Verify(toolSource)
+	}
+	return nil
+}
 
+func (m *Manager) runtimeFor(cmd []string) Runtime {
 	for _, runtime := range m.runtimes {
 		if runtime.Supports(cmd) {
 			log.Debugf("Runtime %s supports %v", runtime.ID(), cmd)
-			return m.setup(ctx, runtime, tool, env)
+			return runtime
+		}
+	}
+	return &noopRuntime{}
+}
+
+func (m *Manager) GetContext(ctx context.Context, tool types.Tool, cmd, env []string) (string, []string, error) {
+	if tool.Source.Repo == nil {
+		if builder, ok := m.runtimeFor(cmd).(LocalBuilder); ok && buildLocal(env) {
+			return m.buildLocal(ctx, builder, tool, env)
+		}
+		return tool.WorkingDir, env, nil
+	}
+
+	if !supportedVCS(tool.Source.Repo.VCS) {
+		return "", nil, fmt.Errorf("only git, oci and registered source resolvers are supported, found VCS %s for %s", tool.Source.Repo.VCS, tool.ID)
+	}
+
+	return m.setup(ctx, m.runtimeFor(cmd), tool, env)
+}
+
+// Prefetch sets up the tool and its runtime the same way GetContext does, without running anything, so that later
+// runs, including offline ones, find them in the cache. It returns true if the tool was already set up.
+func (m *Manager) Prefetch(ctx context.Context, tool types.Tool, cmd, env []string) (bool, error) {
+	if tool.Source.Repo == nil {
+		return true, nil
+	}
+
+	if supportedVCS(tool.Source.Repo.VCS) {
+		_, targetFinal := m.paths(m.runtimeFor(cmd), tool)
+		if _, err := os.Stat(targetFinal + ".done"); err == nil {
+			return true, nil
+		}
+	}
+
+	_, _, err := m.GetContext(ctx, tool, cmd, env)
+	return false, err
+}
+
+// Runtime returns the ID of the runtime GetContext sets up for the tool with cmd, without setting it up, and false if the
+// tool is run without one.
+func (m *Manager) Runtime(tool types.Tool, cmd, env []string) (string, bool) {
+	runtime := m.runtimeFor(cmd)
+	if _, ok := runtime.(*noopRuntime); ok {
+		return "", false
+	}
+	if tool.Source.Repo == nil {
+		if _, ok := runtime.(LocalBuilder); !ok || !buildLocal(env) {
+			return "", false
 		}
 	}
+	return runtime.ID(), true
+}
 
-	return m.setup(ctx, &noopRuntime{}, tool, env)
+func supportedVCS(vcs string) bool {
+	if _, ok := sourceResolver(vcs); ok {
+		return true
+	}
+	return vcs == "git" || vcs == "oci"
 }
@@ -2,11 +2,14 @@ package repos
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/adrg/xdg"
+	"github.com/gptscript-ai/gptscript/pkg/repos/runtimes/golang"
 	"github.com/gptscript-ai/gptscript/pkg/repos/runtimes/python"
 	"github.com/gptscript-ai/gptscript/pkg/types"
 	"github.com/samber/lo"
@@ -37,3 +40,182 @@ func TestManager_GetContext(t *testing.T) {
 	fmt.Print(cwd)
 	fmt.Print(env)
 }
+
+func TestManager_GetContextOffline(t *testing.T) {
+	m := New(t.TempDir())
+	_, _, err := m.GetContext(context.Background(), types.Tool{
+		ID: "offline-tool",
+		Source: types.ToolSource{
+			Repo: &types.Repo{
+				VCS:      "git",
+				Root:     "https://github.com/gptscript-ai/dalle-image-generation.git",
+				Revision: "b9d9ed60c25da7c0e01d504a7219d1c6e460fe80",
+			},
+		},
+	}, []string{"/usr/bin/env", "python3.11"}, []string{"GPTSCRIPT_OFFLINE=true"})
+	assert.ErrorContains(t, err, "GPTSCRIPT_OFFLINE")
+}
+
+func TestManager_Prefetch(t *testing.T) {
+	m := New(t.TempDir())
+	tool := types.Tool{
+		ID: "cached-tool",
+		Source: types.ToolSource{
+			Repo: &types.Repo{
+				VCS:      "git",
+				Root:     "https://github.com/gptscript-ai/dalle-image-generation.git",
+				Revision: "b9d9ed60c25da7c0e01d504a7219d1c6e460fe80",
+			},
+		},
+	}
+	cmd := []string{"/usr/bin/env", "bash"}
+
+	_, targetFinal := m.paths(m.runtimeFor(cmd), tool)
+	require.NoError(t, os.MkdirAll(filepath.Dir(targetFinal), 0755))
+	require.NoError(t, os.WriteFile(targetFinal+".done", []byte("[]"), 0644))
+
+	cached, err := m.Prefetch(context.Background(), tool, cmd, []string{"GPTSCRIPT_OFFLINE=true"})
+	require.NoError(t, err)
+	assert.True(t, cached)
+
+	cached, err = m.Prefetch(context.Background(), types.Tool{ID: "local-tool"}, cmd, nil)
+	require.NoError(t, err)
+	assert.True(t, cached)
+}
+
+func TestManager_Evict(t *testing.T) {
+	m := New(t.TempDir(), &golang.Runtime{Version: "1.22.1"})
+
+	used := filepath.Join(m.runtimeDir, "golang", "used")
+	unused := filepath.Join(m.runtimeDir, "golang", "unused")
+	downloading := filepath.Join(m.runtimeDir, "golang", "unused.download-1")
+	for _, dir := range []string{filepath.Join(used, "go", "bin"), unused, downloading} {
+		require.NoError(t, os.MkdirAll(dir, 0755))
+	}
+
+	doneFile := filepath.Join(m.storageDir, "rev", "tool", "go1.22.1-linux-amd64.done")
+	require.NoError(t, os.MkdirAll(filepath.Dir(doneFile), 0755))
+	savedEnv, err := json.Marshal([]string{"PATH=" + filepath.Join(used, "go", "bin") + string(os.PathListSeparator) + "/usr/bin"})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(doneFile, savedEnv, 0644))
+
+	removed, err := m.Evict(context.Background(), false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{unused}, removed)
+	assert.DirExists(t, used)
+	assert.DirExists(t, downloading)
+
+	removed, err = m.Evict(context.Background(), true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{m.storageDir}, removed)
+	assert.NoDirExists(t, m.storageDir)
+}
+
+type testLocalBuilder struct {
+	builtDirs []string
+}
+
+func (t *testLocalBuilder) ID() string {
+	return "test"
+}
+
+func (t *testLocalBuilder) Supports(cmd []string) bool {
+	return len(cmd) > 0 && cmd[0] == "test-tool"
+}
+
+func (t *testLocalBuilder) Setup(context.Context, string, string, []string) ([]string, error) {
+	return nil, fmt.Errorf("local tools are not set up")
+}
+
+func (t *testLocalBuilder) BuildLocal(_ context.Context, _, toolDir string, _ []string) ([]string, error) {
+	t.builtDirs = append(t.builtDirs, toolDir)
+	return []string{"BUILT=true"}, nil
+}
+
+func TestManager_GetContextBuildLocal(t *testing.T) {
+	builder := &testLocalBuilder{}
+	m := New(t.TempDir(), builder)
+	tool := types.Tool{
+		ID:         "local-tool",
+		WorkingDir: t.TempDir(),
+	}
+	cmd := []string{"test-tool"}
+
+	cwd, env, err := m.GetContext(context.Background(), tool, cmd, []string{"A=B"})
+	require.NoError(t, err)
+	assert.Equal(t, tool.WorkingDir, cwd)
+	assert.Equal(t, []string{"A=B"}, env)
+	assert.Empty(t, builder.builtDirs)
+
+	cwd, env, err = m.GetContext(context.Background(), tool, cmd, []string{"GPTSCRIPT_BUILD_LOCAL_TOOLS=true"})
+	require.NoError(t, err)
+	assert.Equal(t, tool.WorkingDir, cwd)
+	assert.Equal(t, []string{"GPTSCRIPT_BUILD_LOCAL_TOOLS=true", "BUILT=true"}, env)
+	assert.Equal(t, []string{tool.WorkingDir}, builder.builtDirs)
+}
+
+type testSourceResolver struct {
+	fetched []string
+	cleaned []string
+}
+
+func (t *testSourceResolver) Resolve(_ context.Context, url string) (*types.Repo, error) {
+	return &types.Repo{Root: url, Path: ".", Name: "tool.gpt", Revision: "v1"}, nil
+}
+
+func (t *testSourceResolver) Fetch(_ context.Context, repo types.Repo, targetDir string) error {
+	t.fetched = append(t.fetched, repo.Root)
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(targetDir, repo.Name), []byte("#!sys.echo hi"), 0644)
+}
+
+func (t *testSourceResolver) Cleanup(_ context.Context, _ types.Repo, targetDir string) error {
+	t.cleaned = append(t.cleaned, targetDir)
+	return nil
+}
+
+func TestManager_GetContextSourceResolver(t *testing.T) {
+	resolver := &testSourceResolver{}
+	AddSourceResolver("test-source", resolver)
+
+	m := New(t.TempDir())
+	tool := types.Tool{
+		ID: "resolved-tool",
+		Source: types.ToolSource{
+			Repo: &types.Repo{
+				VCS:      "test-source",
+				Root:     "test-source://bucket/tools",
+				Path:     ".",
+				Name:     "tool.gpt",
+				Revision: "v1",
+			},
+		},
+	}
+	cmd := []string{"/usr/bin/env", "bash"}
+
+	cwd, _, err := m.GetContext(context.Background(), tool, cmd, nil)
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(cwd, "tool.gpt"))
+	assert.Equal(t, []string{"test-source://bucket/tools"}, resolver.fetched)
+
+	cached, err := m.Prefetch(context.Background(), tool, cmd, nil)
+	require.NoError(t, err)
+	assert.True(t, cached)
+	assert.Len(t, resolver.fetched, 1)
+
+	target, _ := m.paths(m.runtimeFor(cmd), tool)
+	_, err = m.Evict(context.Background(), true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{target}, resolver.cleaned)
+	assert.NoDirExists(t, m.storageDir)
+
+	_, _, err = m.GetContext(context.Background(), types.Tool{
+		ID: "unknown-tool",
+		Source: types.ToolSource{
+			Repo: &types.Repo{VCS: "unknown", Root: "unknown://tools", Revision: "v1"},
+		},
+	}, cmd, nil)
+	assert.ErrorContains(t, err, "found VCS unknown")
+}
@@ -34,7 +34,11 @@ func Checkout(ctx context.Context, base, repo, commit, toDir string) error {
 	}
 
 	log.Infof("Checking out %s to %s", commit, toDir)
-	return gitWorktreeAdd(ctx, gitDir(base, repo), toDir, commit)
+	if err := gitWorktreeAdd(ctx, gitDir(base, repo), toDir, commit); err != nil {
+		return err
+	}
+
+	return pullLFS(ctx, toDir)
 }
 
 func gitDir(base, repo string) string {
@@ -32,3 +32,23 @@ func TestCheckout(t *testing.T) {
 		testCommit, commitDir)
 	require.NoError(t, err)
 }
+
+func TestUsesLFS(t *testing.T) {
+	dir := t.TempDir()
+	lfs, err := usesLFS(dir)
+	require.NoError(t, err)
+	require.False(t, lfs)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".gitattributes"), []byte("# *.bin filter=lfs\n*.go text\n"), 0644))
+	lfs, err = usesLFS(dir)
+	require.NoError(t, err)
+	require.False(t, lfs)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".gitattributes"), []byte("*.bin filter=lfs diff=lfs merge=lfs -text\n"), 0644))
+	lfs, err = usesLFS(dir)
+	require.NoError(t, err)
+	require.True(t, lfs)
+
+	// Without GPTSCRIPT_GIT_LFS the pointers are kept and git lfs is never run
+	require.NoError(t, pullLFS(context.Background(), dir))
+}
@@ -0,0 +1,67 @@
+package git
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// lfsEnabled returns true if GPTSCRIPT_GIT_LFS=true is set. Only then are git LFS files of checked out tools fetched,
+// so that git lfs is not needed by tools that do not use it.
+func lfsEnabled() bool {
+	return os.Getenv("GPTSCRIPT_GIT_LFS") == "true"
+}
+
+// usesLFS returns true if the .gitattributes in the root of dir tracks any files with git LFS.
+func usesLFS(dir string) (bool, error) {
+	f, err := os.Open(filepath.Join(dir, ".gitattributes"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, attr := range strings.Fields(line) {
+			if attr == "filter=lfs" {
+				return true, nil
+			}
+		}
+	}
+	return false, scanner.Err()
+}
+
+// pullLFS replaces the git LFS pointers in the checkout in dir with the files they point to.
+func pullLFS(ctx context.Context, dir string) error {
+	if lfs, err := usesLFS(dir); err != nil || !lfs {
+		return err
+	}
+
+	if !lfsEnabled() {
+		log.Warnf("%s tracks files with git LFS, set GPTSCRIPT_GIT_LFS=true to fetch them instead of using the LFS pointers", dir)
+		return nil
+	}
+
+	if err := newGitCommand(ctx, "lfs", "version").Run(); err != nil {
+		return fmt.Errorf("%s tracks files with git LFS, but git lfs is not available: %w", dir, err)
+	}
+
+	log.Infof("Pulling git LFS files in %s", dir)
+	cmd := newGitCommand(ctx, "lfs", "pull")
+	cmd.Dir = dir
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to pull git LFS files in %s: %w", dir, err)
+	}
+	return nil
+}
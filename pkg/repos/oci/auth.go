@@ -0,0 +1,146 @@
+package oci
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// credential is the login of a registry from the docker config.
+type credential struct {
+	Username string
+	Password string
+	// IdentityToken is a refresh token to get access tokens of the registry with, used instead of the password.
+	IdentityToken string
+}
+
+type dockerConfig struct {
+	Auths map[string]struct {
+		Auth          string `json:"auth,omitempty"`
+		Username      string `json:"username,omitempty"`
+		Password      string `json:"password,omitempty"`
+		IdentityToken string `json:"identitytoken,omitempty"`
+	} `json:"auths,omitempty"`
+	CredHelpers map[string]string `json:"credHelpers,omitempty"`
+	CredsStore  string            `json:"credsStore,omitempty"`
+}
+
+// dockerConfigFile returns the path of the docker config, which is config.json in $DOCKER_CONFIG or ~/.docker.
+func dockerConfigFile() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".docker", "config.json")
+}
+
+// lookupCredential returns the login of registry that `docker login` saved, from the credential helper of the registry,
+// the credential store, or the auths of the docker config, in that order. It returns no credential and no error if
+// there is no login.
+func lookupCredential(ctx context.Context, registry string) (credential, error) {
+	file := dockerConfigFile()
+	if file == "" {
+		return credential{}, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return credential{}, nil
+	} else if err != nil {
+		return credential{}, err
+	}
+
+	var config dockerConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return credential{}, fmt.Errorf("failed to parse docker config %s: %w", file, err)
+	}
+
+	keys := configKeys(registry)
+
+	for _, key := range keys {
+		if helper := config.CredHelpers[key]; helper != "" {
+			return helperCredential(ctx, helper, key)
+		}
+	}
+
+	for _, key := range keys {
+		auth, ok := config.Auths[key]
+		if !ok {
+			continue
+		}
+		cred := credential{
+			Username:      auth.Username,
+			Password:      auth.Password,
+			IdentityToken: auth.IdentityToken,
+		}
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return credential{}, fmt.Errorf("invalid auth of %s in docker config %s: %w", key, file, err)
+			}
+			cred.Username, cred.Password, _ = strings.Cut(string(decoded), ":")
+		}
+		if cred != (credential{}) {
+			return cred, nil
+		}
+	}
+
+	if config.CredsStore != "" {
+		return helperCredential(ctx, config.CredsStore, keys[0])
+	}
+
+	return credential{}, nil
+}
+
+// configKeys returns the keys the login of registry can have in the docker config. Docker Hub logins are saved
+// under the URL of its old index.
+func configKeys(registry string) []string {
+	if registry == "docker.io" || registry == "registry-1.docker.io" {
+		return []string{"https://index.docker.io/v1/", "docker.io", "registry-1.docker.io"}
+	}
+	return []string{registry, "https://" + registry, "http://" + registry}
+}
+
+// helperCredential gets the login of registry from docker-credential-<helper>. Helpers return no login with an error
+// that says the credentials were not found.
+func helperCredential(ctx context.Context, helper, registry string) (credential, error) {
+	cmd := exec.CommandContext(ctx, "docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(registry)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if strings.Contains(string(out)+stderr.String(), "credentials not found") {
+			return credential{}, nil
+		}
+		return credential{}, fmt.Errorf("failed to get credentials of %s from docker-credential-%s: %w: %s", registry, helper, err, stderr)
+	}
+
+	var result struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		return credential{}, fmt.Errorf("invalid credentials of %s from docker-credential-%s: %w", registry, helper, err)
+	}
+
+	if result.Username == "<token>" {
+		return credential{IdentityToken: result.Secret}, nil
+	}
+	return credential{
+		Username: result.Username,
+		Password: result.Secret,
+	}, nil
+}
@@ -0,0 +1,324 @@
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/repos/download"
+)
+
+const (
+	mediaTypeOCIManifest    = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIIndex       = "application/vnd.oci.image.index.v1+json"
+	mediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerList     = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+	maxManifestSize = 4 << 20
+)
+
+type descriptor struct {
+	MediaType   string            `json:"mediaType,omitempty"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+	} `json:"platform,omitempty"`
+}
+
+// manifest is an image manifest, with the layers of an artifact, or an index of the manifests of several platforms.
+type manifest struct {
+	MediaType string       `json:"mediaType,omitempty"`
+	Manifests []descriptor `json:"manifests,omitempty"`
+	Layers    []descriptor `json:"layers,omitempty"`
+}
+
+func (m manifest) isIndex() bool {
+	return m.MediaType == mediaTypeOCIIndex || m.MediaType == mediaTypeDockerList || m.MediaType == "" && len(m.Manifests) > 0
+}
+
+// client talks to the registry API of the repository of an artifact.
+type client struct {
+	http *http.Client
+	// base is the URL of the repository in the API, such as https://registry.example.com/v2/tools/search
+	base string
+	// repository is the repository in the API, which is not the one of the reference on Docker Hub
+	repository    string
+	ref           Reference
+	authorization string
+}
+
+func newClient(ref Reference) (*client, error) {
+	httpClient, err := download.HTTPClient()
+	if err != nil {
+		return nil, err
+	}
+
+	registry, repository := ref.Registry, ref.Repository
+	if registry == "docker.io" {
+		registry = "registry-1.docker.io"
+		if !strings.Contains(repository, "/") {
+			repository = "library/" + repository
+		}
+	}
+
+	// Registries on the local machine, such as one run for development, usually don't have TLS
+	scheme := "https"
+	host := registry
+	if h, _, err := net.SplitHostPort(registry); err == nil {
+		host = h
+	}
+	if host == "localhost" || net.ParseIP(host).IsLoopback() {
+		scheme = "http"
+	}
+
+	return &client{
+		http:       httpClient,
+		base:       fmt.Sprintf("%s://%s/v2/%s", scheme, registry, repository),
+		repository: repository,
+		ref:        ref,
+	}, nil
+}
+
+// get requests path of the repository, authorizing with the registry the first time it asks to.
+func (c *client) get(ctx context.Context, path string, accept ...string) (*http.Response, error) {
+	for authorized := false; ; authorized = true {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(accept) > 0 {
+			req.Header.Set("Accept", strings.Join(accept, ", "))
+		}
+		if c.authorization != "" {
+			req.Header.Set("Authorization", c.authorization)
+		}
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode == http.StatusUnauthorized && !authorized {
+			challenge := resp.Header.Get("WWW-Authenticate")
+			resp.Body.Close()
+			if err := c.authorize(ctx, challenge); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+			resp.Body.Close()
+			return nil, fmt.Errorf("failed to get %s%s: %s %s", c.base, path, resp.Status, strings.TrimSpace(string(body)))
+		}
+		return resp, nil
+	}
+}
+
+// authorize sets the authorization for the challenge of the registry, with the login of the registry in the docker
+// config. Bearer challenges are answered with a token from the realm of the challenge, which works without a login
+// for public repositories.
+func (c *client) authorize(ctx context.Context, challenge string) error {
+	cred, err := lookupCredential(ctx, c.ref.Registry)
+	if err != nil {
+		return err
+	}
+
+	scheme, params := parseChallenge(challenge)
+	switch scheme {
+	case "basic":
+		if cred.Username == "" {
+			return fmt.Errorf("registry %s requires a login, run docker login %s", c.ref.Registry, c.ref.Registry)
+		}
+		c.authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(cred.Username+":"+cred.Password))
+		return nil
+	case "bearer":
+		token, err := c.token(ctx, params, cred)
+		if err != nil {
+			return err
+		}
+		c.authorization = "Bearer " + token
+		return nil
+	default:
+		return fmt.Errorf("registry %s requires unsupported authentication %q", c.ref.Registry, challenge)
+	}
+}
+
+// token gets a token to pull the repository from the token server of the registry.
+func (c *client) token(ctx context.Context, params map[string]string, cred credential) (string, error) {
+	realm := params["realm"]
+	if realm == "" {
+		return "", fmt.Errorf("registry %s has no realm in its authentication challenge", c.ref.Registry)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + c.repository + ":pull"
+	}
+
+	var (
+		req *http.Request
+		err error
+	)
+	if cred.IdentityToken != "" {
+		form := url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {cred.IdentityToken},
+			"service":       {params["service"]},
+			"scope":         {scope},
+			"client_id":     {"gptscript"},
+		}
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, realm, strings.NewReader(form.Encode()))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		query := url.Values{
+			"scope": {scope},
+		}
+		if service := params["service"]; service != "" {
+			query.Set("service", service)
+		}
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, realm+"?"+query.Encode(), nil)
+		if err != nil {
+			return "", err
+		}
+		if cred.Username != "" {
+			req.SetBasicAuth(cred.Username, cred.Password)
+		}
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get token of registry %s: %w", c.ref.Registry, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return "", fmt.Errorf("failed to get token of registry %s: %s %s", c.ref.Registry, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var result struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("invalid token response of registry %s: %w", c.ref.Registry, err)
+	}
+	if result.Token != "" {
+		return result.Token, nil
+	}
+	if result.AccessToken != "" {
+		return result.AccessToken, nil
+	}
+	return "", fmt.Errorf("no token in token response of registry %s", c.ref.Registry)
+}
+
+// parseChallenge parses a WWW-Authenticate header such as Bearer realm="https://auth.example.com/token",service="x".
+func parseChallenge(challenge string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+	params := map[string]string{}
+	for rest != "" {
+		var key, value string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, ", "), "=")
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		if key != "" {
+			params[strings.ToLower(strings.TrimSpace(key))] = value
+		}
+	}
+	return strings.ToLower(scheme), params
+}
+
+// manifest returns the manifest of reference, a tag or digest, and its digest. A manifest requested by digest must
+// match it.
+func (c *client) manifest(ctx context.Context, reference string) (manifest, string, error) {
+	resp, err := c.get(ctx, "/manifests/"+reference, mediaTypeOCIManifest, mediaTypeOCIIndex, mediaTypeDockerManifest, mediaTypeDockerList)
+	if err != nil {
+		return manifest{}, "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize+1))
+	if err != nil {
+		return manifest{}, "", err
+	}
+	if len(data) > maxManifestSize {
+		return manifest{}, "", fmt.Errorf("manifest %s of %s is too large", reference, c.ref.Name())
+	}
+
+	sum := sha256.Sum256(data)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	if strings.HasPrefix(reference, "sha256:") && digest != reference {
+		return manifest{}, "", &download.ChecksumMismatchError{URL: c.ref.Name() + "@" + reference, Expected: reference, Actual: digest}
+	}
+	if header := resp.Header.Get("Docker-Content-Digest"); header != "" && header != digest {
+		return manifest{}, "", fmt.Errorf("manifest of %s has digest %s, but the registry says %s", c.ref.Name(), digest, header)
+	}
+
+	var result manifest
+	if err := json.Unmarshal(data, &result); err != nil {
+		return manifest{}, "", fmt.Errorf("invalid manifest %s of %s: %w", reference, c.ref.Name(), err)
+	}
+	if result.MediaType == "" {
+		result.MediaType = resp.Header.Get("Content-Type")
+	}
+	return result, digest, nil
+}
+
+// blob downloads a layer to a temporary file and returns its path once its digest and size are verified. The caller
+// removes the file.
+func (c *client) blob(ctx context.Context, layer descriptor) (_ string, err error) {
+	hasher, expected, err := download.Digester(layer.Digest)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.get(ctx, "/blobs/"+layer.Digest)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	file, err := os.CreateTemp("", "gptscript-oci-*.blob")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = file.Close()
+		if err != nil {
+			_ = os.Remove(file.Name())
+		}
+	}()
+
+	n, err := io.Copy(io.MultiWriter(file, hasher), resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to download layer %s of %s: %w", layer.Digest, c.ref.Name(), err)
+	}
+	if n != layer.Size {
+		return "", fmt.Errorf("downloaded layer %s of %s has %d bytes, expected %d", layer.Digest, c.ref.Name(), n, layer.Size)
+	}
+	if sum := hex.EncodeToString(hasher.Sum(nil)); sum != expected {
+		algorithm, _, _ := strings.Cut(layer.Digest, ":")
+		return "", &download.ChecksumMismatchError{URL: c.ref.Name() + "@" + layer.Digest, Expected: layer.Digest, Actual: algorithm + ":" + sum}
+	}
+
+	return file.Name(), file.Close()
+}
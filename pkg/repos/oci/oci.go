@@ -0,0 +1,264 @@
+// Package oci pulls tools that are distributed as OCI artifacts, such as ones pushed with oras, from a registry.
+//
+// Each layer of an artifact with an org.opencontainers.image.title annotation is a file at that path, or a directory
+// if it is a tar archive of the directory with the io.deis.oras.content.unpack annotation, which is how oras pushes
+// directories. Layers without a title are tar archives that are extracted into the root of the artifact, as in images.
+// Only tar archives keep the mode of files, so prebuilt binaries have to be pushed in a directory to be executable.
+package oci
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const (
+	annotationTitle  = "org.opencontainers.image.title"
+	annotationUnpack = "io.deis.oras.content.unpack"
+)
+
+// Resolve returns the digest of the manifest of the artifact, which pins its content. A reference with a digest is
+// returned as is.
+func Resolve(ctx context.Context, ref Reference) (string, error) {
+	if ref.Digest != "" {
+		return ref.Digest, nil
+	}
+
+	c, err := newClient(ref)
+	if err != nil {
+		return "", err
+	}
+
+	_, digest, err := c.manifest(ctx, ref.Tag)
+	if err != nil {
+		return "", err
+	}
+
+	log.Debugf("resolved %s:%s to %s", ref.Name(), ref.Tag, digest)
+	return digest, nil
+}
+
+// ReadFile returns the content of the file at the path of the reference in the artifact, which must be pinned by a
+// digest.
+func ReadFile(ctx context.Context, ref Reference) ([]byte, error) {
+	c, layers, err := open(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, layer := range layers {
+		title, unpack := layer.Annotations[annotationTitle], layer.Annotations[annotationUnpack] == "true"
+		if title != "" && !unpack {
+			if path.Clean(title) != ref.Path {
+				continue
+			}
+			file, err := c.blob(ctx, layer)
+			if err != nil {
+				return nil, err
+			}
+			defer os.Remove(file)
+			return os.ReadFile(file)
+		}
+
+		if title != "" && !strings.HasPrefix(ref.Path, path.Clean(title)+"/") {
+			continue
+		}
+
+		data, ok, err := readFromTar(ctx, c, layer, ref.Path)
+		if err != nil || ok {
+			return data, err
+		}
+	}
+
+	return nil, fmt.Errorf("file %s not found in %s", ref.Path, ref.Name()+"@"+ref.Digest)
+}
+
+// Pull writes the files of the artifact, which must be pinned by a digest, to targetDir.
+func Pull(ctx context.Context, ref Reference, targetDir string) error {
+	c, layers, err := open(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		return err
+	}
+
+	for _, layer := range layers {
+		if err := pullLayer(ctx, c, layer, targetDir); err != nil {
+			return err
+		}
+	}
+
+	log.Debugf("pulled %s@%s to %s", ref.Name(), ref.Digest, targetDir)
+	return nil
+}
+
+// open returns the layers of the manifest of the artifact that has the digest of the reference. Of an index of
+// manifests of several platforms, the manifest of the current platform is used.
+func open(ctx context.Context, ref Reference) (*client, []descriptor, error) {
+	if ref.Digest == "" {
+		return nil, nil, fmt.Errorf("OCI reference %s must be resolved to a digest", ref)
+	}
+
+	c, err := newClient(ref)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	m, _, err := c.manifest(ctx, ref.Digest)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if m.isIndex() {
+		var platform *descriptor
+		for i, desc := range m.Manifests {
+			if desc.Platform == nil || desc.Platform.OS == runtime.GOOS && desc.Platform.Architecture == runtime.GOARCH {
+				platform = &m.Manifests[i]
+				break
+			}
+		}
+		if platform == nil {
+			return nil, nil, fmt.Errorf("%s@%s has no manifest for %s/%s", ref.Name(), ref.Digest, runtime.GOOS, runtime.GOARCH)
+		}
+		if m, _, err = c.manifest(ctx, platform.Digest); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return c, m.Layers, nil
+}
+
+func pullLayer(ctx context.Context, c *client, layer descriptor, targetDir string) error {
+	title, unpack := layer.Annotations[annotationTitle], layer.Annotations[annotationUnpack] == "true"
+	if title != "" {
+		title = path.Clean(title)
+		if !isLocal(title) {
+			return fmt.Errorf("layer %s of %s has invalid title %s", layer.Digest, c.ref.Name(), title)
+		}
+	} else if !strings.Contains(layer.MediaType, "tar") {
+		log.Debugf("skipping layer %s of %s of type %s without a title", layer.Digest, c.ref.Name(), layer.MediaType)
+		return nil
+	}
+
+	file, err := c.blob(ctx, layer)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file)
+
+	if title != "" && !unpack {
+		target := filepath.Join(targetDir, filepath.FromSlash(title))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, 0644)
+	}
+
+	return walkTar(file, func(header *tar.Header, r io.Reader) (bool, error) {
+		return false, extractEntry(targetDir, title, header, r)
+	})
+}
+
+// readFromTar returns the content of the file name in the tar archive of the layer, and false if it is not in it.
+func readFromTar(ctx context.Context, c *client, layer descriptor, name string) (data []byte, found bool, _ error) {
+	file, err := c.blob(ctx, layer)
+	if err != nil {
+		return nil, false, err
+	}
+	defer os.Remove(file)
+
+	err = walkTar(file, func(header *tar.Header, r io.Reader) (bool, error) {
+		if header.Typeflag != tar.TypeReg || path.Clean(strings.TrimPrefix(header.Name, "/")) != name {
+			return false, nil
+		}
+		data, err = io.ReadAll(r)
+		found = true
+		return true, err
+	})
+	return data, found, err
+}
+
+// walkTar calls fn for each entry of the tar archive in file, which can be gzip compressed, until fn returns true.
+func walkTar(file string, fn func(*tar.Header, io.Reader) (bool, error)) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = bufio.NewReader(f)
+	if magic, err := r.(*bufio.Reader).Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("invalid tar archive: %w", err)
+		}
+		if done, err := fn(header, tr); err != nil || done {
+			return err
+		}
+	}
+}
+
+// extractEntry writes an entry of a tar archive to targetDir. Entries of the archive of a directory, whose layer has the
+// title of the directory, have to be in the directory.
+func extractEntry(targetDir, dir string, header *tar.Header, r io.Reader) error {
+	name := path.Clean(strings.TrimPrefix(header.Name, "/"))
+	if !isLocal(name) || dir != "" && name != dir && !strings.HasPrefix(name, dir+"/") {
+		return fmt.Errorf("invalid path %s in tar archive", header.Name)
+	}
+	target := filepath.Join(targetDir, filepath.FromSlash(name))
+
+	switch header.Typeflag {
+	case tar.TypeDir:
+		return os.MkdirAll(target, 0755)
+	case tar.TypeReg:
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(header.Mode).Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, r); err != nil {
+			_ = f.Close()
+			return fmt.Errorf("write %s: %w", target, err)
+		}
+		return f.Close()
+	case tar.TypeSymlink:
+		if path.IsAbs(header.Linkname) || !isLocal(path.Join(path.Dir(name), header.Linkname)) {
+			return fmt.Errorf("symlink %s in tar archive points outside of it", header.Name)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		return os.Symlink(header.Linkname, target)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,210 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func digestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func tarGzip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0755,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+type testRegistry struct {
+	blobs    map[string][]byte
+	manifest []byte
+	// tamper changes the content of blobs that are served
+	tamper bool
+}
+
+// newTestRegistry serves an artifact as tools/test:v1 in the way oras pushes a file and a directory, behind a token
+// server that only gives tokens to the login user:pass.
+func newTestRegistry(t *testing.T) (*testRegistry, *httptest.Server) {
+	t.Helper()
+	r := &testRegistry{
+		blobs: map[string][]byte{},
+	}
+
+	toolGPT := []byte("#!${GPTSCRIPT_TOOL_DIR}/bin/tool\n")
+	bin := tarGzip(t, map[string]string{"bin/tool": "#!/bin/sh\necho hi\n"})
+	config := []byte("{}")
+	for _, blob := range [][]byte{toolGPT, bin, config} {
+		r.blobs[digestOf(blob)] = blob
+	}
+
+	manifest, err := json.Marshal(map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     mediaTypeOCIManifest,
+		"config": map[string]any{
+			"mediaType": "application/vnd.oci.empty.v1+json",
+			"digest":    digestOf(config),
+			"size":      len(config),
+		},
+		"layers": []map[string]any{
+			{
+				"mediaType":   "application/vnd.oci.image.layer.v1.tar",
+				"digest":      digestOf(toolGPT),
+				"size":        len(toolGPT),
+				"annotations": map[string]string{annotationTitle: "tool.gpt"},
+			},
+			{
+				"mediaType":   "application/vnd.oci.image.layer.v1.tar+gzip",
+				"digest":      digestOf(bin),
+				"size":        len(bin),
+				"annotations": map[string]string{annotationTitle: "bin", annotationUnpack: "true"},
+			},
+		},
+	})
+	require.NoError(t, err)
+	r.manifest = manifest
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	mux.HandleFunc("/token", func(w http.ResponseWriter, req *http.Request) {
+		if user, pass, _ := req.BasicAuth(); user != "user" || pass != "pass" || req.URL.Query().Get("scope") != "repository:tools/test:pull" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = fmt.Fprint(w, `{"token": "secret-token"}`)
+	})
+	mux.HandleFunc("/v2/tools/test/", func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer secret-token" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		kind, reference, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/v2/tools/test/"), "/")
+		switch {
+		case kind == "manifests" && (reference == "v1" || reference == digestOf(r.manifest)):
+			w.Header().Set("Content-Type", mediaTypeOCIManifest)
+			_, _ = w.Write(r.manifest)
+		case kind == "blobs" && r.blobs[reference] != nil:
+			blob := r.blobs[reference]
+			if r.tamper {
+				blob = bytes.ToUpper(blob)
+			}
+			_, _ = w.Write(blob)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	dockerConfig := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", dockerConfig)
+	registry := strings.TrimPrefix(srv.URL, "http://")
+	require.NoError(t, os.WriteFile(filepath.Join(dockerConfig, "config.json"), []byte(fmt.Sprintf(`{"auths": {%q: {"auth": %q}}}`,
+		registry, base64.StdEncoding.EncodeToString([]byte("user:pass")))), 0600))
+
+	return r, srv
+}
+
+func TestParseReference(t *testing.T) {
+	ref, err := ParseReference("oci://registry.example.com/tools/search:v1/sub/tool.gpt")
+	require.NoError(t, err)
+	assert.Equal(t, Reference{Registry: "registry.example.com", Repository: "tools/search", Tag: "v1", Path: "sub/tool.gpt"}, ref)
+
+	ref, err = ParseReference("oci://localhost:5000/search")
+	require.NoError(t, err)
+	assert.Equal(t, Reference{Registry: "localhost:5000", Repository: "search", Tag: "latest"}, ref)
+
+	digest := "sha256:" + strings.Repeat("a", 64)
+	ref, err = ParseReference("oci://registry.example.com/tools/search@" + digest + "/tool.gpt")
+	require.NoError(t, err)
+	assert.Equal(t, Reference{Registry: "registry.example.com", Repository: "tools/search", Digest: digest, Path: "tool.gpt"}, ref)
+	assert.Equal(t, "oci://registry.example.com/tools/search@"+digest+"/tool.gpt", ref.String())
+
+	for _, invalid := range []string{
+		"registry.example.com/tools/search",
+		"oci://registry.example.com",
+		"oci://registry.example.com/tools/search@md5:abc",
+		"oci://registry.example.com/tools/search:v1/../../etc/passwd",
+	} {
+		_, err := ParseReference(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestPull(t *testing.T) {
+	r, srv := newTestRegistry(t)
+	ctx := context.Background()
+
+	ref, err := ParseReference("oci://" + strings.TrimPrefix(srv.URL, "http://") + "/tools/test:v1")
+	require.NoError(t, err)
+
+	ref.Digest, err = Resolve(ctx, ref)
+	require.NoError(t, err)
+	assert.Equal(t, digestOf(r.manifest), ref.Digest)
+
+	ref.Path = "tool.gpt"
+	data, err := ReadFile(ctx, ref)
+	require.NoError(t, err)
+	assert.Equal(t, "#!${GPTSCRIPT_TOOL_DIR}/bin/tool\n", string(data))
+
+	ref.Path = "bin/tool"
+	data, err = ReadFile(ctx, ref)
+	require.NoError(t, err)
+	assert.Equal(t, "#!/bin/sh\necho hi\n", string(data))
+
+	target := filepath.Join(t.TempDir(), "tool")
+	require.NoError(t, Pull(ctx, ref, target))
+
+	data, err = os.ReadFile(filepath.Join(target, "tool.gpt"))
+	require.NoError(t, err)
+	assert.Equal(t, "#!${GPTSCRIPT_TOOL_DIR}/bin/tool\n", string(data))
+
+	stat, err := os.Stat(filepath.Join(target, "bin", "tool"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), stat.Mode().Perm())
+}
+
+func TestPullDigestMismatch(t *testing.T) {
+	r, srv := newTestRegistry(t)
+	r.tamper = true
+
+	ref, err := ParseReference("oci://" + strings.TrimPrefix(srv.URL, "http://") + "/tools/test@" + digestOf(r.manifest))
+	require.NoError(t, err)
+
+	target := filepath.Join(t.TempDir(), "tool")
+	err = Pull(context.Background(), ref, target)
+	require.ErrorContains(t, err, "expected digest")
+	assert.NoFileExists(t, filepath.Join(target, "tool.gpt"))
+}
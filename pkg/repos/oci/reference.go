@@ -0,0 +1,97 @@
+package oci
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+const Prefix = "oci://"
+
+// Reference is an artifact in a registry, such as registry.example.com/tools/search:v1, and the path of a file in it.
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	// Digest pins the manifest of the artifact, such as sha256:..., and is used instead of Tag if set.
+	Digest string
+	// Path is the path of a file in the artifact.
+	Path string
+}
+
+// ParseReference parses oci://<registry>/<repository>[:<tag>|@<digest>][/<path>]. The path of a file in the artifact
+// can only be given after a tag or digest, as it can't be told apart from the repository otherwise. The tag defaults to
+// latest.
+func ParseReference(ref string) (Reference, error) {
+	rest, ok := strings.CutPrefix(ref, Prefix)
+	if !ok {
+		return Reference{}, fmt.Errorf("invalid OCI reference %s, must start with %s", ref, Prefix)
+	}
+
+	registry, rest, _ := strings.Cut(rest, "/")
+	if registry == "" || rest == "" {
+		return Reference{}, fmt.Errorf("invalid OCI reference %s, must have a registry and repository", ref)
+	}
+
+	result := Reference{
+		Registry: registry,
+		Tag:      "latest",
+	}
+
+	// Digests have a colon too, so they are looked for first
+	if repository, digest, ok := strings.Cut(rest, "@"); ok {
+		digest, result.Path, _ = strings.Cut(digest, "/")
+		result.Repository, result.Tag, result.Digest = repository, "", digest
+		if !strings.HasPrefix(digest, "sha256:") {
+			return Reference{}, fmt.Errorf("invalid OCI reference %s, only sha256 digests are supported", ref)
+		}
+	} else if repository, tag, ok := strings.Cut(rest, ":"); ok {
+		result.Repository = repository
+		tag, result.Path, _ = strings.Cut(tag, "/")
+		result.Tag = tag
+	} else {
+		result.Repository = rest
+	}
+
+	if result.Repository == "" || result.Tag == "" && result.Digest == "" {
+		return Reference{}, fmt.Errorf("invalid OCI reference %s", ref)
+	}
+	if result.Path != "" {
+		result.Path = path.Clean(result.Path)
+		if !isLocal(result.Path) {
+			return Reference{}, fmt.Errorf("invalid OCI reference %s, path must be in the artifact", ref)
+		}
+	}
+
+	return result, nil
+}
+
+// Name returns the registry and repository of the artifact.
+func (r Reference) Name() string {
+	return r.Registry + "/" + r.Repository
+}
+
+// Version is the digest of the artifact, or its tag if it has no digest.
+func (r Reference) Version() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+func (r Reference) String() string {
+	sep := ":"
+	if r.Digest != "" {
+		sep = "@"
+	}
+	s := Prefix + r.Name() + sep + r.Version()
+	if r.Path != "" {
+		s += "/" + r.Path
+	}
+	return s
+}
+
+// isLocal returns true if name, a slash separated path, doesn't leave the directory it is relative to.
+func isLocal(name string) bool {
+	return name != ".." && !strings.HasPrefix(name, "../") && !strings.HasPrefix(name, "/")
+}
@@ -0,0 +1,140 @@
+package repos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// SourceResolver fetches tools from a source gptscript does not support itself, such as an artifact service or a
+// bucket. A resolver is registered with AddSourceResolver for a URL scheme, and the repos of tools it resolves have the
+// scheme as their VCS.
+type SourceResolver interface {
+	// Resolve returns the repo of the tool at url, which starts with the scheme of the resolver. The Root of the repo
+	// is the URL of the directory that Fetch writes, Path and Name are the tool file in it, and Revision pins the
+	// content that the URL has now, so that it is fetched again when it changes.
+	Resolve(ctx context.Context, url string) (*types.Repo, error)
+	// Fetch writes the files of the revision of repo to targetDir.
+	Fetch(ctx context.Context, repo types.Repo, targetDir string) error
+}
+
+// SourceCleaner is implemented by source resolvers that keep something for a fetched source outside of the directory
+// it was fetched to, such as a download cache or a lease, and have to release it when the directory is removed.
+type SourceCleaner interface {
+	// Cleanup is called after targetDir, which Fetch wrote repo to, was removed.
+	Cleanup(ctx context.Context, repo types.Repo, targetDir string) error
+}
+
+var (
+	sourceResolversLock sync.RWMutex
+	sourceResolvers     = map[string]SourceResolver{}
+)
+
+// AddSourceResolver registers resolver for the tools with URLs of scheme, such as "s3" for s3://bucket/tool.gpt. It is
+// used instead of the git and OCI handling of gptscript for repos whose VCS is scheme, so it should be called at
+// startup, before tools are loaded.
+func AddSourceResolver(scheme string, resolver SourceResolver) {
+	sourceResolversLock.Lock()
+	defer sourceResolversLock.Unlock()
+	sourceResolvers[scheme] = resolver
+}
+
+// SourceResolvers returns the registered source resolvers by their scheme.
+func SourceResolvers() map[string]SourceResolver {
+	sourceResolversLock.RLock()
+	defer sourceResolversLock.RUnlock()
+	result := make(map[string]SourceResolver, len(sourceResolvers))
+	for scheme, resolver := range sourceResolvers {
+		result[scheme] = resolver
+	}
+	return result
+}
+
+func sourceResolver(vcs string) (SourceResolver, bool) {
+	sourceResolversLock.RLock()
+	defer sourceResolversLock.RUnlock()
+	resolver, ok := sourceResolvers[vcs]
+	return resolver, ok
+}
+
+// sourceFile is written next to a directory a source resolver fetched to, with the repo it fetched, so that the
+// resolver can clean up after the directory when it is removed.
+func sourceFile(target string) string {
+	return target + ".source"
+}
+
+func saveSource(repo types.Repo, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(repo)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(sourceFile(target), data, 0644)
+}
+
+// cleanupSource calls the cleanup hook of the resolver that fetched target, which must have been removed, if a resolver
+// fetched it.
+func cleanupSource(ctx context.Context, target string) error {
+	data, err := os.ReadFile(sourceFile(target))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var repo types.Repo
+	if err := json.Unmarshal(data, &repo); err != nil {
+		return err
+	}
+
+	if resolver, ok := sourceResolver(repo.VCS); ok {
+		if cleaner, ok := resolver.(SourceCleaner); ok {
+			if err := cleaner.Cleanup(ctx, repo, target); err != nil {
+				return err
+			}
+		}
+	}
+	return os.Remove(sourceFile(target))
+}
+
+// cleanupSources removes the directories that source resolvers fetched tools to and calls their cleanup hooks, before
+// all tools are removed.
+func (m *Manager) cleanupSources(ctx context.Context) error {
+	var targets []string
+	err := filepath.WalkDir(m.storageDir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if d.IsDir() && (path == m.gitDir || path == m.runtimeDir) {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() && strings.HasSuffix(path, ".source") {
+			targets = append(targets, strings.TrimSuffix(path, ".source"))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, target := range targets {
+		if err := os.RemoveAll(target); err != nil {
+			errs = append(errs, err)
+		} else if err := cleanupSource(ctx, target); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -28,6 +28,28 @@ var Runtimes = []repos.Runtime{
 	},
 }
 
-func Default(cacheDir string) engine.RuntimeManager {
-	return repos.New(cacheDir, Runtimes...)
+type Options struct {
+	// GoMetrics, if set, receives an event for every Go toolchain download and Go tool build
+	GoMetrics golang.Metrics
+}
+
+func Default(cacheDir string, opts ...Options) engine.RuntimeManager {
+	var opt Options
+	for _, o := range opts {
+		if o.GoMetrics != nil {
+			opt.GoMetrics = o.GoMetrics
+		}
+	}
+
+	result := make([]repos.Runtime, 0, len(Runtimes))
+	for _, runtime := range Runtimes {
+		// The runtimes are shared, so the metrics are set on a copy
+		if goRuntime, ok := runtime.(*golang.Runtime); ok && opt.GoMetrics != nil {
+			withMetrics := *goRuntime
+			withMetrics.Metrics = opt.GoMetrics
+			runtime = &withMetrics
+		}
+		result = append(result, runtime)
+	}
+	return repos.New(cacheDir, result...)
 }
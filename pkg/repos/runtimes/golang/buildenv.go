@@ -0,0 +1,148 @@
+package golang
+
+import (
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// baseEnv are the variables go build needs to find its caches, temp dirs, proxies and git credentials. Every other
+// variable is left out of the build so that a developer's environment can not silently change how a tool is built.
+var baseEnv = []string{
+	"HOME",
+	"HTTP_PROXY",
+	"HTTPS_PROXY",
+	"NO_PROXY",
+	"PATH",
+	"SSH_AUTH_SOCK",
+	"SSL_CERT_DIR",
+	"SSL_CERT_FILE",
+	"TMPDIR",
+	"USER",
+	"XDG_CACHE_HOME",
+	"XDG_CONFIG_HOME",
+	"http_proxy",
+	"https_proxy",
+	"no_proxy",
+	// Windows
+	"APPDATA",
+	"COMSPEC",
+	"LOCALAPPDATA",
+	"PATHEXT",
+	"SYSTEMROOT",
+	"TEMP",
+	"TMP",
+	"USERPROFILE",
+}
+
+// cgoEnv are the variables passed to the build when the tool enables cgo, in addition to any starting with CGO_.
+var cgoEnv = []string{
+	"AR",
+	"CC",
+	"CXX",
+	"PKG_CONFIG",
+	"PKG_CONFIG_PATH",
+}
+
+// defaultPassthroughEnv is the set of GO prefixed variables that are passed to go build. These are needed to build in
+// environments that use a private module proxy or checksum database. The list can be replaced by setting
+// GPTSCRIPT_GO_PASSTHROUGH to a comma separated list of variable names.
+var defaultPassthroughEnv = []string{
+	"GOFLAGS",
+	"GOINSECURE",
+	"GONOPROXY",
+	"GONOSUMCHECK",
+	"GONOSUMDB",
+	"GOPRIVATE",
+	"GOPROXY",
+	"GOSUMDB",
+}
+
+// neverPassthroughEnv are variables that would change where or for what platform the tool is built, so they are never
+// passed, even if listed in GPTSCRIPT_GO_PASSTHROUGH or opted in by the tool.
+var neverPassthroughEnv = []string{
+	"GOARCH",
+	"GOBIN",
+	"GOOS",
+	"GOPATH",
+	"GOROOT",
+	"GOTOOLCHAIN",
+}
+
+// cacheEnv are the variables that point go build at a build and module cache, for example a persistent directory that is
+// shared between CI runs, and the variables they set. Unlike GOCACHE and GOMODCACHE themselves they can be set without
+// passing other GO variables from the environment. The caches do not change what is built, so they are not part of
+// the build stamp.
+var cacheEnv = [][2]string{
+	{"GPTSCRIPT_GO_CACHE", "GOCACHE"},
+	{"GPTSCRIPT_GO_MODCACHE", "GOMODCACHE"},
+}
+
+func passthroughEnv(env []string) []string {
+	for _, env := range env {
+		if v, ok := strings.CutPrefix(env, "GPTSCRIPT_GO_PASSTHROUGH="); ok {
+			var result []string
+			for _, key := range strings.Split(v, ",") {
+				if key = strings.TrimSpace(key); key != "" {
+					result = append(result, key)
+				}
+			}
+			return result
+		}
+	}
+	return defaultPassthroughEnv
+}
+
+// buildEnv returns the environment for go build. It only contains the variables in baseEnv, the GO variables from
+// passthroughEnv, the caches from cacheEnv, the cgo variables if the tool enables cgo and the variables the tool opts in
+// to with a "// gptscript:env" directive.
+func buildEnv(env []string, config toolConfig) (result []string) {
+	passthrough := passthroughEnv(env)
+	for _, env := range env {
+		key, _, _ := strings.Cut(env, "=")
+		if allowedBuildEnv(normalizeEnvKey(key), passthrough, config) {
+			result = append(result, env)
+		}
+	}
+	for _, cache := range cacheEnv {
+		for _, env := range env {
+			if v, ok := strings.CutPrefix(env, cache[0]+"="); ok && v != "" {
+				result = append(result, cache[1]+"="+v)
+			}
+		}
+	}
+	if config.CGO {
+		result = append(result, "CGO_ENABLED=1")
+	}
+	return
+}
+
+func isCacheEnv(key string) bool {
+	for _, cache := range cacheEnv {
+		if key == cache[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func allowedBuildEnv(key string, passthrough []string, config toolConfig) bool {
+	switch {
+	case slices.Contains(neverPassthroughEnv, key):
+		return false
+	case slices.Contains(baseEnv, key), slices.Contains(passthrough, key), slices.Contains(config.Env, key):
+		return true
+	case config.CGO:
+		return slices.Contains(cgoEnv, key) || strings.HasPrefix(key, "CGO_")
+	}
+	return false
+}
+
+// normalizeEnvKey upper cases key on Windows, where variable names are case-insensitive and commonly written like
+// Path or SystemRoot.
+func normalizeEnvKey(key string) string {
+	if runtime.GOOS == "windows" {
+		return strings.ToUpper(key)
+	}
+	return key
+}
@@ -0,0 +1,87 @@
+package golang
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// releaseDigest is a line of digests.txt, the sha256 of a file published at https://go.dev/dl/.
+type releaseDigest struct {
+	Digest string
+	File   string
+}
+
+// releaseDigests returns the embedded digests followed by the ones in the file named by GPTSCRIPT_GO_DIGESTS_FILE,
+// if set. The extra file supplements the embedded list with releases published after gptscript was built. Embedded
+// entries take precedence, so an extra entry for an already known file is ignored.
+func releaseDigests() ([]releaseDigest, error) {
+	result, err := parseDigests(releasesData)
+	if err != nil {
+		return nil, fmt.Errorf("invalid embedded digests: %w", err)
+	}
+
+	extraFile := os.Getenv("GPTSCRIPT_GO_DIGESTS_FILE")
+	if extraFile == "" {
+		return result, nil
+	}
+
+	data, err := os.ReadFile(extraFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GPTSCRIPT_GO_DIGESTS_FILE: %w", err)
+	}
+
+	extra, err := parseDigests(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid digests in %s: %w", extraFile, err)
+	}
+
+	known := map[string]string{}
+	for _, entry := range result {
+		known[entry.File] = entry.Digest
+	}
+	for _, entry := range extra {
+		if digest, ok := known[entry.File]; ok {
+			if digest != entry.Digest {
+				log.Warnf("Ignoring digest of %s in %s, it does not match the embedded digest", entry.File, extraFile)
+			}
+			continue
+		}
+		known[entry.File] = entry.Digest
+		result = append(result, entry)
+	}
+
+	return result, nil
+}
+
+// parseDigests parses lines in the format of sha256sum, "<digest>  <file>". Blank lines are skipped.
+func parseDigests(data []byte) (result []releaseDigest, _ error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for i := 1; scanner.Scan(); i++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		digest, file, ok := strings.Cut(line, "  ")
+		file = strings.TrimSpace(file)
+		if !ok || file == "" {
+			return nil, fmt.Errorf("line %d: expected \"<digest>  <file>\": %q", i, line)
+		}
+		if _, err := hex.DecodeString(digest); err != nil || len(digest) != 64 {
+			return nil, fmt.Errorf("line %d: %q is not a sha256 digest", i, digest)
+		}
+		if !strings.HasPrefix(file, "go") || strings.ContainsAny(file, `/\`) {
+			return nil, fmt.Errorf("line %d: %q is not the name of a Go release file", i, file)
+		}
+
+		result = append(result, releaseDigest{
+			Digest: strings.ToLower(digest),
+			File:   file,
+		})
+	}
+	return result, scanner.Err()
+}
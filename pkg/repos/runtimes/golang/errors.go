@@ -0,0 +1,43 @@
+package golang
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrModuleVerification is wrapped by the BuildError of a go build that failed because a module does not match go.sum
+// or is missing from it.
+var ErrModuleVerification = errors.New("failed to verify modules against go.sum")
+
+// ToolchainDownloadError is returned by Setup when the Go toolchain could not be downloaded from any mirror. Err joins
+// the errors of the mirrors, which are download.DownloadError or download.ChecksumMismatchError.
+type ToolchainDownloadError struct {
+	Version string
+	Err     error
+}
+
+func (t *ToolchainDownloadError) Error() string {
+	return fmt.Sprintf("failed to download Go %s: %v", t.Version, t.Err)
+}
+
+func (t *ToolchainDownloadError) Unwrap() error {
+	return t.Err
+}
+
+// BuildError is returned by Setup when go build, go mod verify with GPTSCRIPT_GO_MOD_VERIFY, or a post-build command
+// fails for a tool. Stderr is everything the command wrote to stderr, such as the compiler errors. Use errors.Is with
+// ErrModuleVerification to tell if the build failed to verify modules.
+type BuildError struct {
+	Command    string
+	ToolSource string
+	Stderr     string
+	Err        error
+}
+
+func (b *BuildError) Error() string {
+	return fmt.Sprintf("%s in %s failed: %v", b.Command, b.ToolSource, b.Err)
+}
+
+func (b *BuildError) Unwrap() error {
+	return b.Err
+}
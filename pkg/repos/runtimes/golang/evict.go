@@ -0,0 +1,54 @@
+package golang
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/locker"
+)
+
+// Evict removes the Go toolchains in dataRoot that inUse reports as unused. Each toolchain is locked like it is while
+// it is downloaded, so a download of the same release in this process finishes before it is checked. Downloads in
+// progress are left for cleanupStaleDownloads.
+func (r *Runtime) Evict(ctx context.Context, dataRoot string, inUse func(dir string) bool) (removed []string, _ error) {
+	dir := filepath.Join(dataRoot, "golang")
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.Contains(entry.Name(), ".download") {
+			continue
+		}
+
+		target := filepath.Join(dir, entry.Name())
+		evicted, err := evictToolchain(ctx, target, inUse)
+		if err != nil {
+			return removed, err
+		}
+		if evicted {
+			removed = append(removed, target)
+		}
+	}
+
+	return removed, nil
+}
+
+func evictToolchain(ctx context.Context, target string, inUse func(dir string) bool) (bool, error) {
+	locker.Lock(target)
+	defer locker.Unlock(target)
+
+	if inUse(target) {
+		return false, nil
+	}
+
+	log.InfofCtx(ctx, "Removing unused Go toolchain %s", target)
+	return true, os.RemoveAll(target)
+}
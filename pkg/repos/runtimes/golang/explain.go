@@ -0,0 +1,68 @@
+package golang
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// Explanation describes what Setup would do for a tool, so that it is possible to see why a tool is built the way it
+// is without downloading or building anything.
+type Explanation struct {
+	ToolSource string `json:"toolSource,omitempty"`
+	// RequestedVersion is the version from the toolchain line of the tool's go.mod, if any
+	RequestedVersion string `json:"requestedVersion,omitempty"`
+	// Version is the Go version that would be used to build the tool
+	Version         string `json:"version,omitempty"`
+	DownloadURL     string `json:"downloadURL,omitempty"`
+	Digest          string `json:"digest,omitempty"`
+	ToolchainDir    string `json:"toolchainDir,omitempty"`
+	ToolchainCached bool   `json:"toolchainCached,omitempty"`
+	// Arch is the architecture the tool is built for
+	Arch string `json:"arch,omitempty"`
+	// BuildDir is the directory the builds run in, relative to ToolSource
+	BuildDir string `json:"buildDir,omitempty"`
+	// Builds are the arguments of each go build that would be run
+	Builds [][]string `json:"builds,omitempty"`
+	CGO    bool       `json:"cgo,omitempty"`
+	// PostBuild are the commands that would be run after the builds
+	PostBuild [][]string `json:"postBuild,omitempty"`
+}
+
+// Explain runs the same resolution as Setup for the tool in toolSource and reports the result.
+func (r *Runtime) Explain(dataRoot, toolSource string) (Explanation, error) {
+	result := Explanation{
+		ToolSource: toolSource,
+	}
+
+	config, err := readToolConfig(toolSource)
+	if err != nil {
+		return result, err
+	}
+
+	resolved := r.forTool(toolSource, config.Toolchain)
+	result.RequestedVersion = config.Toolchain
+	result.Version = resolved.Version
+	for _, target := range config.targets() {
+		result.Builds = append(result.Builds, buildArgs(config, target))
+	}
+	result.Arch = toolArch()
+	result.BuildDir = config.Dir
+	result.CGO = config.CGO
+	result.PostBuild = config.PostBuild
+
+	result.DownloadURL, result.Digest, result.ToolchainDir, err = resolved.toolchainDir(dataRoot)
+	if err != nil {
+		return result, err
+	}
+
+	result.DownloadURL = mirrorURLs(result.DownloadURL)[0]
+
+	if _, err := os.Stat(result.ToolchainDir); err == nil {
+		result.ToolchainCached = true
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return result, err
+	}
+
+	return result, nil
+}
@@ -1,125 +1,560 @@
 package golang
 
 import (
-	"bufio"
-	"bytes"
 	"context"
+	"crypto/sha256"
 	_ "embed"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/BurntSushi/locker"
 	"github.com/gptscript-ai/gptscript/pkg/debugcmd"
 	runtimeEnv "github.com/gptscript-ai/gptscript/pkg/env"
 	"github.com/gptscript-ai/gptscript/pkg/hash"
 	"github.com/gptscript-ai/gptscript/pkg/repos/download"
+	"github.com/gptscript-ai/gptscript/pkg/trace"
+	"golang.org/x/sync/semaphore"
 )
 
 //go:embed digests.txt
 var releasesData []byte
 
-const downloadURL = "https://go.dev/dl/"
+const (
+	downloadURL         = "https://go.dev/dl/"
+	defaultArtifact     = "gptscript-go-tool"
+	artifactPrefix      = "gptscript-go-"
+	defaultBuildTimeout = 5 * time.Minute
+
+	// archiveSize and extractedSize are upper bounds of the disk space used by a Go release archive and its
+	// extracted tree, checked before downloading.
+	archiveSize   = 100 * 1024 * 1024
+	extractedSize = 400 * 1024 * 1024
+)
 
 type Runtime struct {
 	// version something like "1.22.1"
 	Version string
+	// Metrics, if set, records the duration and outcome of downloads and builds
+	Metrics Metrics
 }
 
 func (r *Runtime) ID() string {
 	return "go" + r.Version
 }
 
+// Supports returns true for commands that run a binary built by this runtime, which are
+// ${GPTSCRIPT_TOOL_DIR}/bin/gptscript-go-tool or another name in bin that starts with gptscript-go- and is declared
+// with a "// gptscript:build" directive in the tool's go.mod.
 func (r *Runtime) Supports(cmd []string) bool {
-	return len(cmd) > 0 && cmd[0] == "${GPTSCRIPT_TOOL_DIR}/bin/gptscript-go-tool"
+	if len(cmd) == 0 {
+		return false
+	}
+	name, ok := strings.CutPrefix(cmd[0], "${GPTSCRIPT_TOOL_DIR}/bin/")
+	return ok && strings.HasPrefix(name, artifactPrefix)
 }
 
-func (r *Runtime) Setup(ctx context.Context, dataRoot, toolSource string, env []string) ([]string, error) {
-	binPath, err := r.getRuntime(ctx, dataRoot)
+func (r *Runtime) Setup(ctx context.Context, dataRoot, toolSource string, env []string) (_ []string, err error) {
+	config, err := readToolConfig(toolSource)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved := r.forTool(toolSource, config.Toolchain)
+	binPath, err := resolved.getRuntime(ctx, dataRoot)
 	if err != nil {
 		return nil, err
 	}
 
 	newEnv := runtimeEnv.AppendPath(env, binPath)
-	if err := r.runBuild(ctx, toolSource, binPath, append(env, newEnv...)); err != nil {
+
+	stamp, err := buildStamp(toolSource, resolved.Version, config, env)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, span := trace.Start(ctx, "go build", trace.SpanKindInternal,
+		trace.String("gptscript.go.version", resolved.Version))
+	defer func() {
+		span.End(err)
+	}()
+
+	if upToDate(toolSource, stamp, config) {
+		span.SetAttributes(trace.Bool("gptscript.build.cache_hit", true))
+		resolved.observe(OperationBuild, toolSource)(OutcomeCacheHit, nil)
+		log.DebugfCtx(ctx, "Skipping go build in %s, the tool has not changed since it was built", toolSource)
+		// The binaries did not change, but gptscript may have been downgraded since they were built
+		return newEnv, checkProtocol(ctx, toolSource, append(env, newEnv...), config)
+	}
+
+	span.SetAttributes(trace.Bool("gptscript.build.cache_hit", false))
+	done := resolved.observe(OperationBuild, toolSource)
+	err = r.runBuild(ctx, toolSource, binPath, append(env, newEnv...), config)
+	done(OutcomeBuilt, err)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(config.PostBuild) > 0 {
+		if err := runPostBuild(ctx, toolSource, binPath, append(env, newEnv...), config); err != nil {
+			return nil, err
+		}
+		// Files that the commands wrote to the tool are part of the source the next setup finds, so the stamp is taken
+		// from the tool as they left it
+		if stamp, err = buildStamp(toolSource, resolved.Version, config, env); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := signArtifacts(ctx, toolSource, config); err != nil {
+		return nil, err
+	}
+
+	if err := writeArtifactDigests(toolSource, config); err != nil {
+		return nil, err
+	}
+
+	if err := checkProtocol(ctx, toolSource, append(env, newEnv...), config); err != nil {
+		return nil, err
+	}
+
+	if err := writeStamp(toolSource, stamp); err != nil {
 		return nil, err
 	}
 
 	return newEnv, nil
 }
 
+// BuildLocal builds a tool that is not from a repo in its directory, which Setup only does if the tool changed since
+// the last build.
+func (r *Runtime) BuildLocal(ctx context.Context, dataRoot, toolDir string, env []string) ([]string, error) {
+	return r.Setup(ctx, dataRoot, toolDir, env)
+}
+
+// signArtifacts signs the built binaries on macOS with the identity in GPTSCRIPT_CODESIGN_IDENTITY, so that
+// Gatekeeper does not block them. If GPTSCRIPT_CODESIGN_REMOVE_QUARANTINE is true the quarantine attribute is also
+// removed. Nothing is done on other platforms or when no identity is set.
+func signArtifacts(ctx context.Context, toolSource string, config toolConfig) error {
+	identity := os.Getenv("GPTSCRIPT_CODESIGN_IDENTITY")
+	if runtime.GOOS != "darwin" || identity == "" {
+		return nil
+	}
+
+	for _, target := range config.targets() {
+		artifact := filepath.Join(toolSource, artifactName(target.Name))
+		log.InfofCtx(ctx, "Signing %s", artifact)
+		if err := debugcmd.New(ctx, "codesign", "--force", "--sign", identity, artifact).Run(); err != nil {
+			return fmt.Errorf("failed to sign %s: %w", artifact, err)
+		}
+
+		if os.Getenv("GPTSCRIPT_CODESIGN_REMOVE_QUARANTINE") == "true" {
+			// xattr fails if the attribute is not set, which is the normal case for a binary built locally
+			_ = debugcmd.New(ctx, "xattr", "-d", "com.apple.quarantine", artifact).Run()
+		}
+	}
+
+	return nil
+}
+
+// Verify checks that the binaries built in toolSource still match the digests recorded after they were built.
+func (r *Runtime) Verify(toolSource string) error {
+	config, err := readToolConfig(toolSource)
+	if err != nil {
+		return err
+	}
+
+	for _, target := range config.targets() {
+		artifact := filepath.Join(toolSource, artifactName(target.Name))
+		expected, err := os.ReadFile(artifact + ".sha256")
+		if err != nil {
+			return err
+		}
+
+		actual, err := artifactDigest(artifact)
+		if err != nil {
+			return err
+		}
+
+		if strings.TrimSpace(string(expected)) != actual {
+			return fmt.Errorf("%s has digest %s but %s was recorded when it was built", artifact, actual, strings.TrimSpace(string(expected)))
+		}
+	}
+	return nil
+}
+
+func writeArtifactDigests(toolSource string, config toolConfig) error {
+	for _, target := range config.targets() {
+		artifact := filepath.Join(toolSource, artifactName(target.Name))
+		digest, err := artifactDigest(artifact)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(artifact+".sha256", []byte(digest+"\n"), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func artifactDigest(artifact string) (string, error) {
+	f, err := os.Open(artifact)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	digest := sha256.New()
+	if _, err := io.Copy(digest, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(digest.Sum(nil)), nil
+}
+
+// forTool returns the runtime that should be used to build a tool with the given go.mod toolchain version. If the
+// version is known it is used, otherwise r is returned.
+func (r *Runtime) forTool(toolSource, version string) *Runtime {
+	if version == "" || version == r.Version {
+		return r
+	}
+
+	pinned := *r
+	pinned.Version = version
+	if _, _, err := pinned.getReleaseAndDigest(); err != nil {
+		log.Warnf("Go %s requested by %s is not available, using Go %s: %v", version, toolSource, r.Version, err)
+		return r
+	}
+
+	return &pinned
+}
+
 func (r *Runtime) getReleaseAndDigest() (string, string, error) {
-	scanner := bufio.NewScanner(bytes.NewReader(releasesData))
-	key := r.ID() + "." + runtime.GOOS + "-" + runtime.GOARCH
-	for scanner.Scan() {
-		line := strings.Split(scanner.Text(), "  ")
-		file, digest := strings.TrimSpace(line[1]), strings.TrimSpace(line[0])
-		if strings.HasPrefix(file, key) {
-			return downloadURL + file, digest, nil
+	digests, err := releaseDigests()
+	if err != nil {
+		return "", "", err
+	}
+
+	key := r.ID() + "." + runtime.GOOS + "-" + releaseArch()
+	for _, entry := range digests {
+		// Match the archive exactly, a prefix match would pick linux-arm64 for linux-arm
+		if entry.File == key+".tar.gz" || entry.File == key+".zip" {
+			return downloadURL + entry.File, entry.Digest, nil
 		}
 	}
 
-	return "", "", fmt.Errorf("failed to find %s release for os=%s arch=%s", r.ID(), runtime.GOOS, runtime.GOARCH)
+	return "", "", fmt.Errorf("failed to find %s release for os=%s arch=%s, available versions are %v", r.ID(), runtime.GOOS, releaseArch(),
+		versionsFor(runtime.GOOS, releaseArch()))
 }
 
-func stripGo(env []string) (result []string) {
-	for _, env := range env {
-		if strings.HasPrefix(env, "GO") {
-			continue
+// releaseArch returns the architecture as named in Go release archives.
+func releaseArch() string {
+	arch := toolArch()
+	if arch == "arm" {
+		// Go only publishes armv6l releases for 32-bit ARM, they also run on ARMv7 boards like the Raspberry Pi 2 and later
+		return "armv6l"
+	}
+	return arch
+}
+
+var isTranslated = sync.OnceValue(translated)
+
+// toolArch is the architecture that tools are built for, which is the one of the toolchain that is downloaded. It is
+// the architecture of gptscript, except for an amd64 gptscript running under Rosetta on Apple Silicon, where the
+// native arm64 toolchain is used so that tools do not run emulated. GPTSCRIPT_GO_NATIVE_ARCH=false turns this off.
+func toolArch() string {
+	if runtime.GOOS == "darwin" && runtime.GOARCH == "amd64" && os.Getenv("GPTSCRIPT_GO_NATIVE_ARCH") != "false" && isTranslated() {
+		return "arm64"
+	}
+	return runtime.GOARCH
+}
+
+// buildSlots bounds the number of go builds that run at the same time. It defaults to the number of CPUs and can be
+// set with GPTSCRIPT_GO_BUILD_CONCURRENCY.
+var buildSlots = semaphore.NewWeighted(buildConcurrency())
+
+func buildConcurrency() int64 {
+	if v, err := strconv.ParseInt(os.Getenv("GPTSCRIPT_GO_BUILD_CONCURRENCY"), 10, 64); err == nil && v > 0 {
+		return v
+	}
+	return int64(runtime.NumCPU())
+}
+
+func (r *Runtime) runBuild(ctx context.Context, toolSource, binDir string, env []string, config toolConfig) error {
+	if err := buildSlots.Acquire(ctx, 1); err != nil {
+		return err
+	}
+	defer buildSlots.Release(1)
+
+	timeout := buildTimeout()
+	buildCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if slices.Contains(env, "GPTSCRIPT_GO_MOD_VERIFY=true") && config.ModFlag == "-mod=readonly" {
+		log.InfofCtx(ctx, "Running go mod verify in %s", filepath.Join(toolSource, config.Dir))
+		cmd := debugcmd.New(buildCtx, filepath.Join(binDir, "go"), "mod", "verify")
+		cmd.Env = buildEnv(env, config)
+		cmd.Dir = filepath.Join(toolSource, config.Dir)
+		cmd.KillTreeOnCancel()
+		if err := cmd.Run(); err != nil {
+			return &BuildError{Command: "go mod verify", ToolSource: toolSource, Stderr: cmd.Stderr(), Err: err}
+		}
+	}
+
+	for _, target := range config.targets() {
+		log.InfofCtx(ctx, "Running go build in %s", filepath.Join(toolSource, config.Dir))
+		cmd := debugcmd.New(buildCtx, filepath.Join(binDir, "go"), buildArgs(config, target)...)
+		cmd.Env = buildEnv(env, config)
+		cmd.Dir = filepath.Join(toolSource, config.Dir)
+		cmd.KillTreeOnCancel()
+		if err := cmd.Run(); err != nil {
+			buildErr := &BuildError{Command: "go build", ToolSource: toolSource, Stderr: cmd.Stderr(), Err: err}
+			if ctx.Err() == nil && errors.Is(buildCtx.Err(), context.DeadlineExceeded) {
+				buildErr.Err = fmt.Errorf("timed out after %s, the timeout can be changed with GPTSCRIPT_GO_BUILD_TIMEOUT: %w", timeout, context.DeadlineExceeded)
+			} else if exitErr := (*exec.ExitError)(nil); errors.As(err, &exitErr) && failedModuleVerification(cmd.Stderr()) {
+				buildErr.Err = fmt.Errorf("%w: %w", ErrModuleVerification, err)
+			}
+			return buildErr
+		}
+	}
+	return nil
+}
+
+// failedModuleVerification returns true if the stderr of a go build that exited with an error has the errors it
+// reports when a module does not match go.sum, or when -mod=readonly prevents a missing go.sum entry from being added.
+// go build only reports them in its output, not in its exit code.
+func failedModuleVerification(stderr string) bool {
+	for _, line := range strings.Split(stderr, "\n") {
+		if strings.HasPrefix(line, "SECURITY ERROR") || strings.Contains(line, ": checksum mismatch") ||
+			strings.Contains(line, "missing go.sum entry") {
+			return true
 		}
-		result = append(result, env)
 	}
-	return
+	return false
+}
+
+// buildTimeout is how long a single go build may run before it is killed, set with GPTSCRIPT_GO_BUILD_TIMEOUT.
+func buildTimeout() time.Duration {
+	v := os.Getenv("GPTSCRIPT_GO_BUILD_TIMEOUT")
+	if v == "" {
+		return defaultBuildTimeout
+	}
+	timeout, err := time.ParseDuration(v)
+	if err != nil || timeout <= 0 {
+		log.Warnf("Invalid GPTSCRIPT_GO_BUILD_TIMEOUT %q, using %s", v, defaultBuildTimeout)
+		return defaultBuildTimeout
+	}
+	return timeout
 }
 
-func (r *Runtime) runBuild(ctx context.Context, toolSource, binDir string, env []string) error {
-	log.Infof("Running go build in %s", toolSource)
-	cmd := debugcmd.New(ctx, filepath.Join(binDir, "go"), "build", "-buildvcs=false", "-o", artifactName())
-	cmd.Env = stripGo(env)
-	cmd.Dir = toolSource
-	return cmd.Run()
+func buildArgs(config toolConfig, target buildTarget) []string {
+	output := artifactName(target.Name)
+	if config.Dir != "" {
+		// go build runs in config.Dir, but Supports expects the binaries in the bin directory of the tool
+		toTool, _ := filepath.Rel(config.Dir, ".")
+		output = filepath.Join(toTool, output)
+	}
+	args := []string{"build", "-buildvcs=false"}
+	if config.ModFlag != "" {
+		args = append(args, config.ModFlag)
+	}
+	args = append(append(args, "-o", output), config.BuildFlags...)
+	if target.Package != "" {
+		args = append(args, target.Package)
+	}
+	return args
 }
 
-func artifactName() string {
+func artifactName(name string) string {
 	if runtime.GOOS == "windows" {
-		return filepath.Join("bin", "gptscript-go-tool.exe")
+		return filepath.Join("bin", name+".exe")
 	}
-	return filepath.Join("bin", "gptscript-go-tool")
+	return filepath.Join("bin", name)
 }
 
 func (r *Runtime) binDir(rel string) string {
 	return filepath.Join(rel, "go", "bin")
 }
 
-func (r *Runtime) getRuntime(ctx context.Context, cwd string) (string, error) {
+// mirrorURLs returns the URLs to download a Go release from, in the order they are tried. GPTSCRIPT_GO_DL_MIRROR can be
+// set to a comma separated list of base URLs that serve the same files as https://go.dev/dl/, where "direct" stands
+// for https://go.dev/dl/ itself, for example "https://mirror.example.com/golang,direct". Downloads from a mirror are
+// still verified against the embedded digests.
+func mirrorURLs(url string) (result []string) {
+	mirrors := os.Getenv("GPTSCRIPT_GO_DL_MIRROR")
+	if mirrors == "" {
+		return []string{url}
+	}
+	for _, mirror := range strings.Split(mirrors, ",") {
+		switch mirror = strings.TrimSpace(mirror); mirror {
+		case "":
+		case "direct":
+			result = append(result, url)
+		default:
+			result = append(result, strings.TrimSuffix(mirror, "/")+"/"+strings.TrimPrefix(url, downloadURL))
+		}
+	}
+	if len(result) == 0 {
+		return []string{url}
+	}
+	return result
+}
+
+// extractFromMirrors downloads and extracts the release from the first of urls that serves a file with the expected
+// digest, into a new directory in tmp, and returns that directory.
+func extractFromMirrors(ctx context.Context, urls []string, sha, tmp string) (string, error) {
+	var errs []error
+	for i, url := range urls {
+		dir := filepath.Join(tmp, strconv.Itoa(i))
+		err := download.Extract(ctx, url, sha, dir)
+		if err == nil {
+			if i > 0 {
+				log.InfofCtx(ctx, "Downloaded Go from %s", url)
+			}
+			return dir, nil
+		}
+		if ctx.Err() != nil {
+			return "", err
+		}
+		if i < len(urls)-1 {
+			log.WarnfCtx(ctx, "Failed to download Go from %s, trying the next mirror: %v", url, err)
+		}
+		errs = append(errs, err)
+	}
+	return "", errors.Join(errs...)
+}
+
+// toolchainDir returns the download URL and digest of the Go release and the directory it is extracted to.
+func (r *Runtime) toolchainDir(cwd string) (string, string, string, error) {
 	url, sha, err := r.getReleaseAndDigest()
+	if err != nil {
+		return "", "", "", err
+	}
+	return url, sha, filepath.Join(cwd, "golang", hash.ID(url, sha)), nil
+}
+
+// checkToolchain verifies that binDir contains a go binary that can be executed, so that a toolchain left behind by
+// an interrupted extraction is not trusted.
+func checkToolchain(binDir string) error {
+	goBin := filepath.Join(binDir, "go")
+	if runtime.GOOS == "windows" {
+		goBin += ".exe"
+	}
+
+	stat, err := os.Stat(goBin)
+	if err != nil {
+		return err
+	}
+	if !stat.Mode().IsRegular() || stat.Size() == 0 {
+		return fmt.Errorf("%s is not a valid executable", goBin)
+	}
+	if runtime.GOOS != "windows" && stat.Mode().Perm()&0111 == 0 {
+		return fmt.Errorf("%s is not executable", goBin)
+	}
+
+	return nil
+}
+
+// staleDownloadAge is how old a download temp dir must be before it is considered abandoned. A download that is still
+// in progress in another process is never this old.
+const staleDownloadAge = 24 * time.Hour
+
+var cleanupOnce sync.Once
+
+// cleanupStaleDownloads removes temp dirs of downloads that were never finished, for example because the process was
+// killed while extracting.
+func cleanupStaleDownloads(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.Contains(entry.Name(), ".download") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < staleDownloadAge {
+			continue
+		}
+		log.Debugf("Removing stale download %s", filepath.Join(dir, entry.Name()))
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			log.Warnf("Failed to remove stale download %s: %v", filepath.Join(dir, entry.Name()), err)
+		}
+	}
+}
+
+func (r *Runtime) getRuntime(ctx context.Context, cwd string) (_ string, err error) {
+	outcome, done := OutcomeCacheHit, r.observe(OperationDownload, "")
+	defer func() {
+		done(outcome, err)
+	}()
+
+	url, sha, target, err := r.toolchainDir(cwd)
 	if err != nil {
 		return "", err
 	}
 
-	target := filepath.Join(cwd, "golang", hash.ID(url, sha))
+	cleanupOnce.Do(func() {
+		cleanupStaleDownloads(filepath.Dir(target))
+	})
+
+	// Tools that need the same Go release share a single download
+	locker.Lock(target)
+	defer locker.Unlock(target)
+
 	if _, err := os.Stat(target); err == nil {
-		return r.binDir(target), nil
+		err := checkToolchain(r.binDir(target))
+		if err == nil {
+			return r.binDir(target), nil
+		}
+		log.WarnfCtx(ctx, "Go %s in %s is not usable, downloading it again: %v", r.Version, target, err)
+		if err := os.RemoveAll(target); err != nil {
+			return "", err
+		}
 	} else if !errors.Is(err, fs.ErrNotExist) {
 		return "", err
 	}
 
-	log.Infof("Downloading Go %s", r.Version)
-	tmp := target + ".download"
-	defer os.RemoveAll(tmp)
-
-	if err := os.MkdirAll(tmp, 0755); err != nil {
+	outcome = OutcomeDownloaded
+	log.InfofCtx(ctx, "Downloading Go %s", r.Version)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
 		return "", err
 	}
 
-	if err := download.Extract(ctx, url, sha, tmp); err != nil {
+	if err := download.CheckFreeSpace(os.TempDir(), archiveSize); err != nil {
+		return "", fmt.Errorf("can not download Go %s: %w", r.Version, err)
+	}
+	if err := download.CheckFreeSpace(filepath.Dir(target), archiveSize+extractedSize); err != nil {
+		return "", fmt.Errorf("can not install Go %s: %w", r.Version, err)
+	}
+
+	// Each download gets its own temp dir so that another process downloading the same release can not write into it.
+	tmp, err := os.MkdirTemp(filepath.Dir(target), filepath.Base(target)+".download-")
+	if err != nil {
 		return "", err
 	}
+	defer os.RemoveAll(tmp)
 
-	if err := os.Rename(tmp, target); err != nil {
+	extracted, err := extractFromMirrors(ctx, mirrorURLs(url), sha, tmp)
+	if err != nil {
+		return "", &ToolchainDownloadError{Version: r.Version, Err: err}
+	}
+
+	if err := os.Rename(extracted, target); err != nil {
+		if _, statErr := os.Stat(target); statErr == nil {
+			// Another process finished the same download first
+			return r.binDir(target), nil
+		}
 		return "", err
 	}
 
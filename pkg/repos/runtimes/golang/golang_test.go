@@ -1,15 +1,25 @@
 package golang
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"io/fs"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/adrg/xdg"
+	"github.com/gptscript-ai/gptscript/pkg/repos/download"
 	"github.com/samber/lo"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -38,3 +48,448 @@ func TestRuntime(t *testing.T) {
 	}
 	assert.NoError(t, err)
 }
+
+func TestReadToolConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	c, err := readToolConfig(dir)
+	require.NoError(t, err)
+	assert.Equal(t, toolConfig{}, c)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte(`module example.com
+
+// gptscript:build-flags -tags sqlite_fts5 -ldflags "-s -w"
+// gptscript:cgo
+// gptscript:build . gptscript-go-tool
+// gptscript:build ./cmd/daemon gptscript-go-daemon
+
+go 1.22.1
+
+toolchain go1.22.1
+`), 0644))
+	c, err = readToolConfig(dir)
+	require.NoError(t, err)
+	assert.Equal(t, toolConfig{
+		Toolchain:  "1.22.1",
+		BuildFlags: []string{"-tags", "sqlite_fts5", "-ldflags", "-s -w"},
+		CGO:        true,
+		Builds: []buildTarget{
+			{Package: ".", Name: "gptscript-go-tool"},
+			{Package: "./cmd/daemon", Name: "gptscript-go-daemon"},
+		},
+		ModFlag: "-mod=readonly",
+	}, c)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com\n\n// gptscript:build ./cmd/daemon ../daemon\n"), 0644))
+	_, err = readToolConfig(dir)
+	assert.Error(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com\n\n// gptscript:dir ../other\n"), 0644))
+	_, err = readToolConfig(dir)
+	assert.Error(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com\n\n// gptscript:dir tools/foo\n"), 0644))
+	_, err = readToolConfig(dir)
+	assert.ErrorContains(t, err, "gptscript:dir")
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "tools", "foo"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tools", "foo", "go.mod"), []byte("module example.com/foo\n\ntoolchain go1.22.1\n"), 0644))
+	c, err = readToolConfig(dir)
+	require.NoError(t, err)
+	assert.Equal(t, toolConfig{Toolchain: "1.22.1", Dir: filepath.Join("tools", "foo"), ModFlag: "-mod=readonly"}, c)
+	assert.Equal(t, []string{"build", "-buildvcs=false", "-mod=readonly", "-o", filepath.Join("..", "..", artifactName(defaultArtifact))}, buildArgs(c, c.targets()[0]))
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "tools", "foo", "vendor"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tools", "foo", "vendor", "modules.txt"), nil, 0644))
+	c, err = readToolConfig(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "-mod=vendor", c.ModFlag)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com\n\n// gptscript:build-flags -mod=mod\n"), 0644))
+	_, err = readToolConfig(dir)
+	assert.ErrorContains(t, err, "-mod=mod is set by gptscript")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com\n\n// gptscript:post-build go run ./cmd/gen \"default config\"\n// gptscript:post-build ./bin/gptscript-go-tool --init\n"), 0644))
+	c, err = readToolConfig(dir)
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"go", "run", "./cmd/gen", "default config"}, {"./bin/gptscript-go-tool", "--init"}}, c.PostBuild)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com\n\n// gptscript:post-build\n"), 0644))
+	_, err = readToolConfig(dir)
+	assert.ErrorContains(t, err, "expected a command")
+}
+
+func TestForTool(t *testing.T) {
+	r := &Runtime{
+		Version: "1.22.1",
+	}
+
+	assert.Equal(t, "1.22.1", r.forTool("testdata", "1.0.0").Version)
+	assert.Equal(t, "1.22.1", r.forTool("testdata", "").Version)
+}
+
+func TestBuildEnv(t *testing.T) {
+	env := []string{"PATH=/bin", "GOPATH=/go", "GOPROXY=https://proxy.example.com", "GOCACHE=/cache", "GOOS=plan9", "CC=clang", "EDITOR=vi"}
+	assert.Equal(t, []string{"PATH=/bin", "GOPROXY=https://proxy.example.com"}, buildEnv(env, toolConfig{}))
+
+	assert.Equal(t, []string{"PATH=/bin", "GOPROXY=https://proxy.example.com", "CC=clang", "EDITOR=vi", "CGO_ENABLED=1"},
+		buildEnv(env, toolConfig{CGO: true, Env: []string{"EDITOR", "GOOS"}}))
+
+	env = append(env, "GPTSCRIPT_GO_PASSTHROUGH=GOCACHE, GOOS")
+	assert.Equal(t, []string{"PATH=/bin", "GOCACHE=/cache"}, buildEnv(env, toolConfig{}))
+	env = []string{"PATH=/bin", "GOCACHE=/cache", "GPTSCRIPT_GO_CACHE=/ci/go-build", "GPTSCRIPT_GO_MODCACHE=/ci/mod"}
+	assert.Equal(t, []string{"PATH=/bin", "GOCACHE=/ci/go-build", "GOMODCACHE=/ci/mod"}, buildEnv(env, toolConfig{}))
+}
+
+func TestBuildTimeout(t *testing.T) {
+	assert.Equal(t, defaultBuildTimeout, buildTimeout())
+
+	t.Setenv("GPTSCRIPT_GO_BUILD_TIMEOUT", "30s")
+	assert.Equal(t, 30*time.Second, buildTimeout())
+
+	t.Setenv("GPTSCRIPT_GO_BUILD_TIMEOUT", "soon")
+	assert.Equal(t, defaultBuildTimeout, buildTimeout())
+}
+
+func TestExplain(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com\n\n// gptscript:build-flags -tags fts5\n\ntoolchain go1.0.0\n"), 0644))
+
+	r := &Runtime{
+		Version: "1.22.1",
+	}
+
+	e, err := r.Explain(t.TempDir(), dir)
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.0", e.RequestedVersion)
+	assert.Equal(t, "1.22.1", e.Version)
+	assert.Equal(t, [][]string{{"build", "-buildvcs=false", "-mod=readonly", "-o", artifactName(defaultArtifact), "-tags", "fts5"}}, e.Builds)
+	assert.Contains(t, e.DownloadURL, "go1.22.1.")
+	assert.False(t, e.ToolchainCached)
+}
+
+func TestCheckToolchain(t *testing.T) {
+	dir := t.TempDir()
+	goBin := filepath.Join(dir, "go")
+	if runtime.GOOS == "windows" {
+		goBin += ".exe"
+	}
+
+	assert.Error(t, checkToolchain(dir))
+
+	require.NoError(t, os.WriteFile(goBin, nil, 0755))
+	assert.Error(t, checkToolchain(dir))
+
+	require.NoError(t, os.WriteFile(goBin, []byte("binary"), 0755))
+	assert.NoError(t, checkToolchain(dir))
+}
+
+func TestCleanupStaleDownloads(t *testing.T) {
+	dir := t.TempDir()
+	stale := filepath.Join(dir, "abc.download-1")
+	active := filepath.Join(dir, "abc.download-2")
+	done := filepath.Join(dir, "abc")
+	for _, d := range []string{stale, active, done} {
+		require.NoError(t, os.Mkdir(d, 0755))
+	}
+	old := time.Now().Add(-2 * staleDownloadAge)
+	require.NoError(t, os.Chtimes(stale, old, old))
+	require.NoError(t, os.Chtimes(done, old, old))
+
+	cleanupStaleDownloads(dir)
+
+	assert.NoDirExists(t, stale)
+	assert.DirExists(t, active)
+	assert.DirExists(t, done)
+}
+
+func TestMirrorURLs(t *testing.T) {
+	url := "https://go.dev/dl/go1.22.1.linux-amd64.tar.gz"
+	assert.Equal(t, []string{url}, mirrorURLs(url))
+
+	t.Setenv("GPTSCRIPT_GO_DL_MIRROR", "https://mirror.example.com/golang/")
+	assert.Equal(t, []string{"https://mirror.example.com/golang/go1.22.1.linux-amd64.tar.gz"}, mirrorURLs(url))
+
+	t.Setenv("GPTSCRIPT_GO_DL_MIRROR", "https://mirror.example.com/golang, https://backup.example.com,direct")
+	assert.Equal(t, []string{
+		"https://mirror.example.com/golang/go1.22.1.linux-amd64.tar.gz",
+		"https://backup.example.com/go1.22.1.linux-amd64.tar.gz",
+		url,
+	}, mirrorURLs(url))
+}
+
+func TestExtractFromMirrors(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "go/VERSION", Mode: 0644, Size: 2}))
+	_, err := tw.Write([]byte("go"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	digest := sha256.Sum256(buf.Bytes())
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/broken/") {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(buf.Bytes())
+	}))
+	defer srv.Close()
+
+	tmp := t.TempDir()
+	dir, err := extractFromMirrors(context.Background(), []string{
+		srv.URL + "/broken/go1.22.1.linux-amd64.tar.gz",
+		srv.URL + "/good/go1.22.1.linux-amd64.tar.gz",
+	}, hex.EncodeToString(digest[:]), tmp)
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dir, "go", "VERSION"))
+
+	_, err = extractFromMirrors(context.Background(), []string{srv.URL + "/broken/go1.22.1.linux-amd64.tar.gz"}, hex.EncodeToString(digest[:]), tmp)
+	assert.ErrorContains(t, err, "404")
+	var downloadErr *download.DownloadError
+	assert.ErrorAs(t, err, &downloadErr)
+
+	_, err = extractFromMirrors(context.Background(), []string{srv.URL + "/good/go1.22.1.linux-amd64.tar.gz"}, strings.Repeat("0", 64), tmp)
+	var checksumErr *download.ChecksumMismatchError
+	require.ErrorAs(t, err, &checksumErr)
+	assert.Equal(t, hex.EncodeToString(digest[:]), checksumErr.Actual)
+}
+
+func TestRunBuildError(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as the go binary")
+	}
+
+	binDir := t.TempDir()
+	writeGo := func(stderr string) {
+		require.NoError(t, os.WriteFile(filepath.Join(binDir, "go"), []byte("#!/bin/sh\necho '"+stderr+"' >&2\nexit 1\n"), 0755))
+	}
+
+	writeGo("./main.go:3:1: syntax error")
+	err := (&Runtime{}).runBuild(context.Background(), t.TempDir(), binDir, nil, toolConfig{})
+	var buildErr *BuildError
+	require.ErrorAs(t, err, &buildErr)
+	assert.Equal(t, "go build", buildErr.Command)
+	assert.Equal(t, "./main.go:3:1: syntax error\n", buildErr.Stderr)
+	assert.NotErrorIs(t, err, ErrModuleVerification)
+
+	writeGo("verifying example.com/mod@v1.0.0: checksum mismatch")
+	err = (&Runtime{}).runBuild(context.Background(), t.TempDir(), binDir, nil, toolConfig{})
+	require.ErrorAs(t, err, &buildErr)
+	assert.ErrorIs(t, err, ErrModuleVerification)
+	assert.ErrorContains(t, err, "failed to verify modules against go.sum")
+
+	// A go mod verify that is enabled in the env of the tool runs, and fails, before the build
+	err = (&Runtime{}).runBuild(context.Background(), t.TempDir(), binDir, []string{"GPTSCRIPT_GO_MOD_VERIFY=true"}, toolConfig{ModFlag: "-mod=readonly"})
+	require.ErrorAs(t, err, &buildErr)
+	assert.Equal(t, "go mod verify", buildErr.Command)
+}
+
+func TestGetReleaseAndDigest(t *testing.T) {
+	r := &Runtime{
+		Version: "1.22.1",
+	}
+
+	url, digest, err := r.getReleaseAndDigest()
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(url, ".tar.gz") || strings.HasSuffix(url, ".zip"), url)
+	assert.Contains(t, url, runtime.GOOS+"-"+releaseArch()+".")
+	assert.Len(t, digest, 64)
+}
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	r := &Runtime{}
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "bin"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, artifactName(defaultArtifact)), []byte("binary"), 0755))
+	assert.Error(t, r.Verify(dir))
+
+	require.NoError(t, writeArtifactDigests(dir, toolConfig{}))
+	assert.NoError(t, r.Verify(dir))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, artifactName(defaultArtifact)), []byte("tampered"), 0755))
+	assert.Error(t, r.Verify(dir))
+}
+
+func TestBuildStamp(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0644))
+
+	stamp, err := buildStamp(dir, "1.22.1", toolConfig{}, nil)
+	require.NoError(t, err)
+	assert.False(t, upToDate(dir, stamp, toolConfig{}))
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "bin"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, artifactName(defaultArtifact)), []byte("binary"), 0755))
+	require.NoError(t, writeStamp(dir, stamp))
+	assert.True(t, upToDate(dir, stamp, toolConfig{}))
+
+	// The build output does not change the stamp
+	again, err := buildStamp(dir, "1.22.1", toolConfig{}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, stamp, again)
+
+	// Neither does the location of the caches
+	again, err = buildStamp(dir, "1.22.1", toolConfig{}, []string{"GPTSCRIPT_GO_CACHE=/ci/go-build", "GPTSCRIPT_GO_MODCACHE=/ci/mod"})
+	require.NoError(t, err)
+	assert.Equal(t, stamp, again)
+
+	changed, err := buildStamp(dir, "1.22.1", toolConfig{BuildFlags: []string{"-tags", "foo"}}, nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, stamp, changed)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644))
+	changed, err = buildStamp(dir, "1.22.1", toolConfig{}, nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, stamp, changed)
+}
+
+func TestSupports(t *testing.T) {
+	r := &Runtime{}
+	assert.True(t, r.Supports([]string{"${GPTSCRIPT_TOOL_DIR}/bin/gptscript-go-tool"}))
+	assert.True(t, r.Supports([]string{"${GPTSCRIPT_TOOL_DIR}/bin/gptscript-go-daemon", "serve"}))
+	assert.False(t, r.Supports([]string{"${GPTSCRIPT_TOOL_DIR}/bin/run.sh"}))
+	assert.False(t, r.Supports(nil))
+}
+
+func TestListAvailableVersions(t *testing.T) {
+	releases := ListAvailableVersions()
+	assert.Contains(t, releases, Release{Version: "1.22.1", OS: "linux", Arch: "amd64"})
+	assert.Contains(t, releases, Release{Version: "1.22.1", OS: "windows", Arch: "amd64"})
+	assert.Contains(t, releases, Release{Version: "1.22.1", OS: "linux", Arch: "armv6l"})
+	for _, release := range releases {
+		assert.NotEqual(t, "pkg", release.Arch)
+	}
+	assert.Len(t, releases, 8)
+}
+
+func TestReleaseDigestsFile(t *testing.T) {
+	embedded, err := parseDigests(releasesData)
+	require.NoError(t, err)
+
+	extraFile := filepath.Join(t.TempDir(), "digests.txt")
+	newDigest := strings.Repeat("ab", 32)
+	require.NoError(t, os.WriteFile(extraFile, []byte(strings.Repeat("00", 32)+"  "+embedded[0].File+"\n\n"+
+		newDigest+"  go1.99.0.linux-amd64.tar.gz\n"), 0644))
+	t.Setenv("GPTSCRIPT_GO_DIGESTS_FILE", extraFile)
+
+	digests, err := releaseDigests()
+	require.NoError(t, err)
+	assert.Len(t, digests, len(embedded)+1)
+	assert.Equal(t, embedded[0], digests[0])
+	assert.Equal(t, releaseDigest{Digest: newDigest, File: "go1.99.0.linux-amd64.tar.gz"}, digests[len(digests)-1])
+	assert.Contains(t, ListAvailableVersions(), Release{Version: "1.99.0", OS: "linux", Arch: "amd64"})
+
+	for _, invalid := range []string{
+		"go1.99.0.linux-amd64.tar.gz\n",
+		"1234  go1.99.0.linux-amd64.tar.gz\n",
+		newDigest + "  ../go1.99.0.linux-amd64.tar.gz\n",
+	} {
+		require.NoError(t, os.WriteFile(extraFile, []byte(invalid), 0644))
+		_, err := releaseDigests()
+		assert.ErrorContains(t, err, "line 1", invalid)
+	}
+}
+
+func TestToolArch(t *testing.T) {
+	if runtime.GOOS == "darwin" && runtime.GOARCH == "amd64" && translated() {
+		assert.Equal(t, "arm64", toolArch())
+		t.Setenv("GPTSCRIPT_GO_NATIVE_ARCH", "false")
+	}
+	assert.Equal(t, runtime.GOARCH, toolArch())
+}
+
+func TestRunPostBuild(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as the go binary")
+	}
+
+	binDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "go"), []byte("#!/bin/sh\necho \"$@\" > \"$GPTSCRIPT_TOOL_DIR/config\"\n"), 0755))
+
+	toolSource := t.TempDir()
+	assert.NoError(t, runPostBuild(context.Background(), toolSource, binDir, nil, toolConfig{}))
+	assert.NoFileExists(t, filepath.Join(toolSource, "config"))
+
+	require.NoError(t, runPostBuild(context.Background(), toolSource, binDir, []string{"SECRET=value"}, toolConfig{
+		PostBuild: [][]string{{"go", "run", "./cmd/gen"}},
+	}))
+	data, err := os.ReadFile(filepath.Join(toolSource, "config"))
+	require.NoError(t, err)
+	assert.Equal(t, "run ./cmd/gen\n", string(data))
+
+	require.NoError(t, os.MkdirAll(filepath.Join(toolSource, "bin"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(toolSource, "bin", "init"), []byte("#!/bin/sh\necho \"secret is $SECRET\" >&2\nexit 1\n"), 0755))
+	err = runPostBuild(context.Background(), toolSource, binDir, []string{"SECRET=value"}, toolConfig{
+		PostBuild: [][]string{{"go", "run", "./cmd/gen"}, {"./bin/init"}},
+	})
+	var buildErr *BuildError
+	require.ErrorAs(t, err, &buildErr)
+	assert.Equal(t, "post-build ./bin/init", buildErr.Command)
+	// Variables that go build does not get are not passed to post-build commands either
+	assert.Equal(t, "secret is \n", buildErr.Stderr)
+}
+
+func TestCheckProtocol(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as the tool binary")
+	}
+
+	dir := t.TempDir()
+	assert.NoError(t, checkProtocol(context.Background(), dir, nil, toolConfig{}))
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "bin"), 0755))
+	writeTool := func(version string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, artifactName(defaultArtifact)), []byte("#!/bin/sh\necho "+version+"\n"), 0755))
+	}
+
+	writeTool("1")
+	assert.NoError(t, checkProtocol(context.Background(), dir, nil, toolConfig{Protocol: true}))
+
+	writeTool("2")
+	assert.ErrorContains(t, checkProtocol(context.Background(), dir, nil, toolConfig{Protocol: true}), "needs gptscript protocol version 2")
+
+	writeTool("unknown")
+	assert.ErrorContains(t, checkProtocol(context.Background(), dir, nil, toolConfig{Protocol: true}), "invalid protocol version")
+}
+
+type testMetrics []Event
+
+func (m *testMetrics) Record(event Event) {
+	*m = append(*m, event)
+}
+
+func TestMetrics(t *testing.T) {
+	metrics := &testMetrics{}
+	r := &Runtime{
+		Version: "1.22.1",
+		Metrics: metrics,
+	}
+
+	dataRoot := t.TempDir()
+	_, _, target, err := r.toolchainDir(dataRoot)
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(r.binDir(target), 0755))
+	goBin := filepath.Join(r.binDir(target), "go")
+	if runtime.GOOS == "windows" {
+		goBin += ".exe"
+	}
+	require.NoError(t, os.WriteFile(goBin, []byte("go binary"), 0755))
+
+	_, err = r.getRuntime(context.Background(), dataRoot)
+	require.NoError(t, err)
+
+	missing := &Runtime{Version: "1.0.0", Metrics: metrics}
+	_, err = missing.getRuntime(context.Background(), dataRoot)
+	require.Error(t, err)
+
+	require.Len(t, *metrics, 2)
+	assert.Equal(t, OperationDownload, (*metrics)[0].Operation)
+	assert.Equal(t, OutcomeCacheHit, (*metrics)[0].Outcome)
+	assert.Equal(t, "1.22.1", (*metrics)[0].Version)
+	assert.Equal(t, OutcomeFailed, (*metrics)[1].Outcome)
+	assert.Equal(t, err, (*metrics)[1].Err)
+}
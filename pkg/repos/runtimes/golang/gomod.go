@@ -0,0 +1,204 @@
+package golang
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/shlex"
+)
+
+const directivePrefix = "gptscript:"
+
+// toolConfig is how a tool is built, as read from its go.mod. Besides the toolchain line, options are set with
+// comment directives, for example:
+//
+//	// gptscript:build-flags -tags sqlite_fts5 -ldflags "-s -w"
+//	// gptscript:cgo
+//	// gptscript:build ./cmd/daemon gptscript-go-daemon
+//	// gptscript:env LIBRARY_PATH SQLITE_VERSION
+//	// gptscript:dir tools/foo
+//	// gptscript:protocol
+//	// gptscript:post-build go run ./cmd/gen-config
+type toolConfig struct {
+	// Toolchain is the version from the toolchain line, such as "1.22.1" for "toolchain go1.22.1"
+	Toolchain string
+	// BuildFlags are passed to go build as separate arguments, they are never interpreted by a shell
+	BuildFlags []string
+	// CGO enables cgo for the build
+	CGO bool
+	// Builds are the packages to build and the names of their binaries in bin. If empty the package in the root of
+	// the tool is built as gptscript-go-tool.
+	Builds []buildTarget
+	// Env are the names of extra variables that are passed from the environment to go build
+	Env []string
+	// Dir is the directory go build runs in, relative to the tool, for tools whose Go module is in a subdirectory.
+	// Packages in Builds are relative to it, and binaries are still written to the bin directory of the tool.
+	Dir string
+	// ModFlag is the -mod flag of go build, -mod=vendor for tools with a vendor directory and -mod=readonly otherwise
+	ModFlag string
+	// Protocol makes Setup ask the built binaries which protocol version they need, see checkProtocol
+	Protocol bool
+	// PostBuild are the commands, with their arguments, that Setup runs after the build, see runPostBuild
+	PostBuild [][]string
+}
+
+type buildTarget struct {
+	// Package is passed to go build, an empty string builds the package in the current directory
+	Package string
+	// Name is the file name of the binary in the bin directory, without the .exe suffix on Windows
+	Name string
+}
+
+func (t toolConfig) targets() []buildTarget {
+	if len(t.Builds) == 0 {
+		return []buildTarget{{Name: defaultArtifact}}
+	}
+	return t.Builds
+}
+
+// readToolConfig reads the toolConfig from the go.mod in toolSource. An empty config is returned if there is no go.mod.
+func readToolConfig(toolSource string) (result toolConfig, _ error) {
+	data, err := os.ReadFile(filepath.Join(toolSource, "go.mod"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return result, nil
+	} else if err != nil {
+		return result, err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if comment, ok := strings.CutPrefix(line, "//"); ok {
+			if err := result.applyDirective(strings.TrimSpace(comment)); err != nil {
+				return result, fmt.Errorf("invalid directive in %s: %w", filepath.Join(toolSource, "go.mod"), err)
+			}
+			continue
+		}
+
+		if toolchain, ok := toolchainVersion(line); ok {
+			result.Toolchain = toolchain
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return result, err
+	}
+
+	if result.Dir != "" {
+		if err := result.readDir(toolSource); err != nil {
+			return result, err
+		}
+	}
+
+	// Always build with the module files as they are, so a build can never add or change go.sum entries, and a module
+	// that does not match go.sum fails the build.
+	result.ModFlag = "-mod=readonly"
+	if _, err := os.Stat(filepath.Join(toolSource, result.Dir, "vendor", "modules.txt")); err == nil {
+		result.ModFlag = "-mod=vendor"
+	}
+	for _, flag := range result.BuildFlags {
+		if strings.HasPrefix(flag, "-mod=") || flag == "-mod" {
+			return result, fmt.Errorf("invalid %sbuild-flags in %s: %s is set by gptscript", directivePrefix, filepath.Join(toolSource, "go.mod"), flag)
+		}
+	}
+
+	return result, nil
+}
+
+// readDir checks the directory set with gptscript:dir and reads the toolchain from its go.mod.
+func (t *toolConfig) readDir(toolSource string) error {
+	dir := filepath.Join(toolSource, t.Dir)
+	if stat, err := os.Stat(dir); err != nil {
+		return fmt.Errorf("invalid %sdir in %s: %w", directivePrefix, filepath.Join(toolSource, "go.mod"), err)
+	} else if !stat.IsDir() {
+		return fmt.Errorf("invalid %sdir in %s: %s is not a directory", directivePrefix, filepath.Join(toolSource, "go.mod"), t.Dir)
+	}
+
+	// The module that is built decides the toolchain, unless the tool's go.mod asks for one
+	if t.Toolchain == "" {
+		data, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if toolchain, ok := toolchainVersion(line); ok {
+				t.Toolchain = toolchain
+			}
+		}
+	}
+
+	return nil
+}
+
+// toolchainVersion returns the version of a toolchain line, such as "1.22.1" for "toolchain go1.22.1".
+func toolchainVersion(line string) (string, bool) {
+	fields := strings.Fields(line)
+	if len(fields) >= 2 && fields[0] == "toolchain" {
+		return strings.TrimPrefix(fields[1], "go"), true
+	}
+	return "", false
+}
+
+func (t *toolConfig) applyDirective(comment string) error {
+	directive, ok := strings.CutPrefix(comment, directivePrefix)
+	if !ok {
+		return nil
+	}
+
+	name, value, _ := strings.Cut(directive, " ")
+	value = strings.TrimSpace(value)
+
+	switch name {
+	case "build-flags":
+		flags, err := shlex.Split(value)
+		if err != nil {
+			return fmt.Errorf("%s%s: %w", directivePrefix, name, err)
+		}
+		t.BuildFlags = append(t.BuildFlags, flags...)
+	case "cgo":
+		t.CGO = true
+	case "env":
+		t.Env = append(t.Env, strings.Fields(value)...)
+	case "build":
+		args, err := shlex.Split(value)
+		if err != nil {
+			return fmt.Errorf("%s%s: %w", directivePrefix, name, err)
+		}
+		if len(args) != 2 {
+			return fmt.Errorf("%s%s: expected a package and a binary name, got %q", directivePrefix, name, value)
+		}
+		if !strings.HasPrefix(args[1], artifactPrefix) || strings.ContainsAny(args[1], `/\`) {
+			return fmt.Errorf("%s%s: binary name %q must start with %s and can not contain a path", directivePrefix, name, args[1], artifactPrefix)
+		}
+		t.Builds = append(t.Builds, buildTarget{
+			Package: args[0],
+			Name:    args[1],
+		})
+	case "protocol":
+		t.Protocol = true
+	case "post-build":
+		args, err := shlex.Split(value)
+		if err != nil {
+			return fmt.Errorf("%s%s: %w", directivePrefix, name, err)
+		}
+		if len(args) == 0 {
+			return fmt.Errorf("%s%s: expected a command", directivePrefix, name)
+		}
+		t.PostBuild = append(t.PostBuild, args)
+	case "dir":
+		dir := filepath.Clean(filepath.FromSlash(value))
+		if value == "" || !filepath.IsLocal(dir) {
+			return fmt.Errorf("%s%s: %q must be a directory inside the tool", directivePrefix, name, value)
+		}
+		t.Dir = dir
+	default:
+		log.Warnf("Ignoring unknown go.mod directive %s%s", directivePrefix, name)
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package golang
+
+import "time"
+
+// Metrics receives an Event for every toolchain download and tool build of the runtime, for example to export how
+// long they take to a monitoring system. Record is called synchronously, so it should not block.
+type Metrics interface {
+	Record(event Event)
+}
+
+// Operation is what an Event measures.
+type Operation string
+
+const (
+	// OperationDownload is getting the Go toolchain, from the cache or by downloading it
+	OperationDownload Operation = "download"
+	// OperationBuild is building the tool, or finding that the binaries from a previous build are up to date
+	OperationBuild Operation = "build"
+)
+
+// Outcome is the result of an Operation.
+type Outcome string
+
+const (
+	OutcomeCacheHit   Outcome = "cache-hit"
+	OutcomeDownloaded Outcome = "downloaded"
+	OutcomeBuilt      Outcome = "built"
+	OutcomeFailed     Outcome = "failed"
+)
+
+type Event struct {
+	Operation Operation
+	Outcome   Outcome
+	// Version is the Go version used
+	Version string
+	// ToolSource is the directory of the tool for builds, it is empty for downloads that are shared by tools
+	ToolSource string
+	Duration   time.Duration
+	// Err is set if Outcome is OutcomeFailed
+	Err error
+}
+
+func noopObserver(Outcome, error) {}
+
+// observe starts measuring an operation and returns the func that records its outcome. Without Metrics nothing is
+// measured.
+func (r *Runtime) observe(operation Operation, toolSource string) func(Outcome, error) {
+	if r.Metrics == nil {
+		return noopObserver
+	}
+
+	start := time.Now()
+	return func(outcome Outcome, err error) {
+		if err != nil {
+			outcome = OutcomeFailed
+		}
+		r.Metrics.Record(Event{
+			Operation:  operation,
+			Outcome:    outcome,
+			Version:    r.Version,
+			ToolSource: toolSource,
+			Duration:   time.Since(start),
+			Err:        err,
+		})
+	}
+}
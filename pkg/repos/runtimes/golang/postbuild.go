@@ -0,0 +1,50 @@
+package golang
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/debugcmd"
+)
+
+// runPostBuild runs the commands of the gptscript:post-build directives in order, after every binary of the tool in
+// toolSource was built. Each command runs in the directory go build runs in, with the same environment as go build and
+// GPTSCRIPT_TOOL_DIR set to toolSource, and must finish within the build timeout. The commands are not run by a shell,
+// and a command named go runs the go binary of the toolchain in binDir. The first command that fails fails the setup.
+func runPostBuild(ctx context.Context, toolSource, binDir string, env []string, config toolConfig) error {
+	for _, args := range config.PostBuild {
+		if err := runPostBuildCommand(ctx, toolSource, binDir, env, config, args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runPostBuildCommand(ctx context.Context, toolSource, binDir string, env []string, config toolConfig, args []string) error {
+	timeout := buildTimeout()
+	cmdCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	name := args[0]
+	if name == "go" {
+		name = filepath.Join(binDir, "go")
+	}
+
+	log.InfofCtx(ctx, "Running post-build command %s in %s", strings.Join(args, " "), filepath.Join(toolSource, config.Dir))
+	cmd := debugcmd.New(cmdCtx, name, args[1:]...)
+	cmd.Env = append(buildEnv(env, config), "GPTSCRIPT_TOOL_DIR="+toolSource)
+	// Relative commands, like ./bin/gptscript-go-tool, are relative to the directory they run in
+	cmd.Dir = filepath.Join(toolSource, config.Dir)
+	cmd.KillTreeOnCancel()
+	if err := cmd.Run(); err != nil {
+		buildErr := &BuildError{Command: "post-build " + strings.Join(args, " "), ToolSource: toolSource, Stderr: cmd.Stderr(), Err: err}
+		if ctx.Err() == nil && errors.Is(cmdCtx.Err(), context.DeadlineExceeded) {
+			buildErr.Err = fmt.Errorf("timed out after %s, the timeout can be changed with GPTSCRIPT_GO_BUILD_TIMEOUT: %w", timeout, context.DeadlineExceeded)
+		}
+		return buildErr
+	}
+	return nil
+}
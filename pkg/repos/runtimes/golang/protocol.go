@@ -0,0 +1,52 @@
+package golang
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gptscript-ai/gptscript/pkg/debugcmd"
+)
+
+// protocolVersion is the newest version of the protocol between gptscript and tools that this gptscript supports.
+// Tools that set the gptscript:protocol directive are asked for the version they need before they are used.
+const protocolVersion = 1
+
+const protocolTimeout = 10 * time.Second
+
+// checkProtocol runs each binary of the tool with --protocol-version and fails if one needs a newer protocol than
+// protocolVersion. The binary must print a single integer and exit successfully.
+func checkProtocol(ctx context.Context, toolSource string, env []string, config toolConfig) error {
+	if !config.Protocol {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, protocolTimeout)
+	defer cancel()
+
+	for _, target := range config.targets() {
+		artifact := filepath.Join(toolSource, artifactName(target.Name))
+		cmd := debugcmd.New(ctx, artifact, "--protocol-version")
+		cmd.Env = env
+		cmd.Dir = toolSource
+		cmd.KillTreeOnCancel()
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to get the protocol version of %s: %w", artifact, err)
+		}
+
+		out := strings.TrimSpace(cmd.Stdout())
+		version, err := strconv.Atoi(out)
+		if err != nil {
+			return fmt.Errorf("invalid protocol version %q from %s", out, artifact)
+		}
+		if version > protocolVersion {
+			return fmt.Errorf("%s needs gptscript protocol version %d, but this gptscript only supports up to %d, upgrade gptscript or use an older revision of the tool",
+				artifact, version, protocolVersion)
+		}
+	}
+
+	return nil
+}
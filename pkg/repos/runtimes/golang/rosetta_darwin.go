@@ -0,0 +1,11 @@
+//go:build darwin
+
+package golang
+
+import "golang.org/x/sys/unix"
+
+// translated reports whether this process is an amd64 binary translated by Rosetta on Apple Silicon.
+func translated() bool {
+	v, err := unix.SysctlUint32("sysctl.proc_translated")
+	return err == nil && v == 1
+}
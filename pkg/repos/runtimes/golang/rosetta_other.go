@@ -0,0 +1,7 @@
+//go:build !darwin
+
+package golang
+
+func translated() bool {
+	return false
+}
@@ -0,0 +1,108 @@
+package golang
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/hash"
+)
+
+// buildStamp identifies everything that goes into a build of the tool in toolSource: its source files, the Go version,
+// the platform, the build arguments and the variables passed to go build other than baseEnv. If the stamp recorded for
+// an existing binary matches, the build is skipped. Only local tools, which BuildLocal builds in their directory, can
+// have one, as tools from a repo are set up once, in a fresh checkout.
+func buildStamp(toolSource, version string, config toolConfig, env []string) (string, error) {
+	source, err := sourceHash(toolSource)
+	if err != nil {
+		return "", err
+	}
+
+	parts := []string{source, version, runtime.GOOS, toolArch(), strconv.FormatBool(config.CGO), filepath.ToSlash(config.Dir)}
+	for _, target := range config.targets() {
+		parts = append(parts, buildArgs(config, target)...)
+	}
+	for _, env := range buildEnv(env, config) {
+		// The base variables like PATH and HOME and the cache locations don't change the result of a build and some,
+		// like SSH_AUTH_SOCK, change on every login.
+		if key, _, _ := strings.Cut(env, "="); !slices.Contains(baseEnv, normalizeEnvKey(key)) && !isCacheEnv(normalizeEnvKey(key)) {
+			parts = append(parts, env)
+		}
+	}
+
+	return hash.ID(parts...), nil
+}
+
+// sourceHash hashes the names and contents of the files in toolSource, except for the bin directory that the tool is
+// built into and any .git directory.
+func sourceHash(toolSource string) (string, error) {
+	digest := sha256.New()
+	err := filepath.WalkDir(toolSource, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(toolSource, path)
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if rel == "bin" || d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		} else if !d.Type().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		digest.Write([]byte(filepath.ToSlash(rel)))
+		digest.Write([]byte{0x00})
+		if _, err := io.Copy(digest, f); err != nil {
+			return err
+		}
+		digest.Write([]byte{0x00})
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(digest.Sum(nil)), nil
+}
+
+func stampFile(toolSource string) string {
+	return filepath.Join(toolSource, "bin", ".gptscript-go-build.stamp")
+}
+
+// upToDate returns true if all binaries of the tool exist and were built with the given stamp.
+func upToDate(toolSource, stamp string, config toolConfig) bool {
+	data, err := os.ReadFile(stampFile(toolSource))
+	if err != nil {
+		return false
+	}
+	for _, target := range config.targets() {
+		if _, err := os.Stat(filepath.Join(toolSource, artifactName(target.Name))); errors.Is(err, fs.ErrNotExist) {
+			return false
+		}
+	}
+	return strings.TrimSpace(string(data)) == stamp
+}
+
+func writeStamp(toolSource, stamp string) error {
+	return os.WriteFile(stampFile(toolSource), []byte(stamp+"\n"), 0644)
+}
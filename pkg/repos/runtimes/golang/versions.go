@@ -0,0 +1,78 @@
+package golang
+
+import (
+	"sort"
+	"strings"
+)
+
+// Release is a Go toolchain that can be downloaded and used to build tools.
+type Release struct {
+	// Version something like "1.22.1"
+	Version string `json:"version,omitempty"`
+	OS      string `json:"os,omitempty"`
+	// Arch is the architecture as named by go.dev, such as amd64 or armv6l
+	Arch string `json:"arch,omitempty"`
+}
+
+// ListAvailableVersions returns the Go releases with a known digest, including those in GPTSCRIPT_GO_DIGESTS_FILE, sorted by version, OS and architecture.
+func ListAvailableVersions() []Release {
+	var result []Release
+
+	digests, err := releaseDigests()
+	if err != nil {
+		log.Warnf("Listing only the embedded Go releases: %v", err)
+		digests, _ = parseDigests(releasesData)
+	}
+
+	for _, entry := range digests {
+		name, ok := archiveName(entry.File)
+		if !ok {
+			continue
+		}
+
+		// go1.22.1.linux-amd64
+		i := strings.LastIndex(name, ".")
+		if i < 0 {
+			continue
+		}
+		goos, goarch, ok := strings.Cut(name[i+1:], "-")
+		if !ok {
+			continue
+		}
+		version := strings.TrimPrefix(name[:i], "go")
+		result = append(result, Release{
+			Version: version,
+			OS:      goos,
+			Arch:    goarch,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Version != result[j].Version {
+			return result[i].Version < result[j].Version
+		}
+		if result[i].OS != result[j].OS {
+			return result[i].OS < result[j].OS
+		}
+		return result[i].Arch < result[j].Arch
+	})
+	return result
+}
+
+// archiveName strips the extension of a release archive, other files like the macOS .pkg installers are skipped.
+func archiveName(file string) (string, bool) {
+	if name, ok := strings.CutSuffix(file, ".tar.gz"); ok {
+		return name, true
+	}
+	return strings.CutSuffix(file, ".zip")
+}
+
+// versionsFor returns the versions in ListAvailableVersions for the given platform.
+func versionsFor(goos, goarch string) (result []string) {
+	for _, release := range ListAvailableVersions() {
+		if release.OS == goos && release.Arch == goarch {
+			result = append(result, release.Version)
+		}
+	}
+	return
+}
@@ -101,9 +101,16 @@ func (r *Runtime) getReleaseAndDigest() (string, string, error) {
 }
 
 func (r *Runtime) runNPM(ctx context.Context, toolSource, binDir string, env []string) error {
-	log.Infof("Running npm in %s", toolSource)
-	cmd := debugcmd.New(ctx, filepath.Join(binDir, "npm"), "install")
-	cmd.Env = env
+	packageManager, err := packageManager(toolSource)
+	if err != nil {
+		return err
+	}
+
+	args := installArgs(packageManager, toolSource)
+	log.InfofCtx(ctx, "Running %s in %s", packageManager, toolSource)
+	cmd := debugcmd.New(ctx, filepath.Join(binDir, args[0]), args[1:]...)
+	// corepack would otherwise ask before it downloads pnpm or yarn
+	cmd.Env = append(env, "COREPACK_ENABLE_DOWNLOAD_PROMPT=0")
 	cmd.Dir = toolSource
 	return cmd.Run()
 }
@@ -141,7 +148,7 @@ func (r *Runtime) getRuntime(ctx context.Context, cwd string) (string, error) {
 		return "", err
 	}
 
-	log.Infof("Downloading Node %s.x", r.Version)
+	log.InfofCtx(ctx, "Downloading Node %s.x", r.Version)
 	tmp := target + ".download"
 	defer os.RemoveAll(tmp)
 
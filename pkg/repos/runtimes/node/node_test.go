@@ -50,3 +50,34 @@ func TestRuntime21(t *testing.T) {
 	}
 	require.NoError(t, err)
 }
+
+func TestPackageManager(t *testing.T) {
+	dir := t.TempDir()
+	pm, err := packageManager(dir)
+	require.NoError(t, err)
+	require.Equal(t, "npm", pm)
+	require.Equal(t, []string{"npm", "install"}, installArgs(pm, dir))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "package-lock.json"), []byte("{}"), 0644))
+	require.Equal(t, []string{"npm", "ci"}, installArgs(pm, dir))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "yarn.lock"), nil, 0644))
+	pm, err = packageManager(dir)
+	require.NoError(t, err)
+	require.Equal(t, "yarn", pm)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pnpm-lock.yaml"), nil, 0644))
+	pm, err = packageManager(dir)
+	require.NoError(t, err)
+	require.Equal(t, "pnpm", pm)
+	require.Equal(t, []string{"corepack", "pnpm", "install", "--frozen-lockfile"}, installArgs(pm, dir))
+
+	t.Setenv("GPTSCRIPT_NODE_PACKAGE_MANAGER", "npm")
+	pm, err = packageManager(dir)
+	require.NoError(t, err)
+	require.Equal(t, "npm", pm)
+
+	t.Setenv("GPTSCRIPT_NODE_PACKAGE_MANAGER", "bun")
+	_, err = packageManager(dir)
+	require.Error(t, err)
+}
@@ -0,0 +1,48 @@
+package node
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// packageManager returns the package manager that installs the dependencies of the tool in toolSource. It is set with
+// GPTSCRIPT_NODE_PACKAGE_MANAGER, or else found from the lockfile of the tool, defaulting to npm.
+func packageManager(toolSource string) (string, error) {
+	if v := os.Getenv("GPTSCRIPT_NODE_PACKAGE_MANAGER"); v != "" {
+		switch v {
+		case "npm", "pnpm", "yarn":
+			return v, nil
+		default:
+			return "", fmt.Errorf("invalid GPTSCRIPT_NODE_PACKAGE_MANAGER %q, expected npm, pnpm or yarn", v)
+		}
+	}
+
+	for _, lockfile := range []struct {
+		file, packageManager string
+	}{
+		{"pnpm-lock.yaml", "pnpm"},
+		{"yarn.lock", "yarn"},
+	} {
+		if _, err := os.Stat(filepath.Join(toolSource, lockfile.file)); err == nil {
+			return lockfile.packageManager, nil
+		}
+	}
+	return "npm", nil
+}
+
+// installArgs returns the command, relative to the bin dir of the runtime, that installs the dependencies of the tool
+// with packageManager. Installs never change the lockfile of a tool that has one. pnpm and yarn are run with corepack,
+// which comes with Node.js and downloads the version the tool asks for in the packageManager field of its package.json.
+func installArgs(packageManager, toolSource string) []string {
+	switch packageManager {
+	case "pnpm":
+		return []string{"corepack", "pnpm", "install", "--frozen-lockfile"}
+	case "yarn":
+		return []string{"corepack", "yarn", "install", "--frozen-lockfile"}
+	}
+	if _, err := os.Stat(filepath.Join(toolSource, "package-lock.json")); err == nil {
+		return []string{"npm", "ci"}
+	}
+	return []string{"npm", "install"}
+}
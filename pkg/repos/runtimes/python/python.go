@@ -13,6 +13,7 @@ import (
 	"path/filepath"
 	"runtime"
 
+	"github.com/BurntSushi/locker"
 	"github.com/gptscript-ai/gptscript/pkg/debugcmd"
 	runtimeEnv "github.com/gptscript-ai/gptscript/pkg/env"
 	"github.com/gptscript-ai/gptscript/pkg/hash"
@@ -75,13 +76,38 @@ func uvBin(binDir string) string {
 	return filepath.Join(binDir, "uv")
 }
 
-func (r *Runtime) installVenv(ctx context.Context, binDir, venvPath string) error {
-	log.Infof("Creating virtualenv in %s", venvPath)
+// installer returns the tool that creates venvs and installs requirements, set with GPTSCRIPT_PYTHON_INSTALLER. uv is
+// used by default because it is much faster than pip, but pip is used if uv is not installed in the Python runtime.
+func installer(ctx context.Context, binDir string) string {
+	switch v := os.Getenv("GPTSCRIPT_PYTHON_INSTALLER"); v {
+	case "pip":
+		return "pip"
+	case "", "uv":
+	default:
+		log.WarnfCtx(ctx, "Unknown GPTSCRIPT_PYTHON_INSTALLER %q, using uv", v)
+	}
+
+	uv := uvBin(binDir)
+	if runtime.GOOS == "windows" {
+		uv += ".exe"
+	}
+	if _, err := os.Stat(uv); err != nil {
+		log.WarnfCtx(ctx, "uv is not installed in %s, using pip", binDir)
+		return "pip"
+	}
+	return "uv"
+}
+
+func (r *Runtime) installVenv(ctx context.Context, installer, binDir, venvPath string) error {
+	log.InfofCtx(ctx, "Creating virtualenv in %s", venvPath)
+	if installer == "pip" {
+		return debugcmd.New(ctx, pythonCmd(binDir), "-m", "venv", venvPath).Run()
+	}
 	cmd := debugcmd.New(ctx, uvBin(binDir), "venv", "-p", pythonCmd(binDir), venvPath)
 	return cmd.Run()
 }
 
-func copyFile(to, from string) error {
+func copyFile(to, from string) (err error) {
 	in, err := os.Open(from)
 	if err != nil {
 		return err
@@ -90,13 +116,17 @@ func copyFile(to, from string) error {
 
 	out, err := os.Create(to)
 	if err != nil {
-		_ = out.Close()
 		return err
 	}
-	defer out.Close()
+	// A failed close can mean the data was never fully written
+	defer func() {
+		if closeErr := out.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("copying %s => %s: %w", from, to, closeErr)
+		}
+	}()
 
 	if _, err := io.Copy(out, in); err != nil {
-		return fmt.Errorf("copying %s => %s", from, to)
+		return fmt.Errorf("copying %s => %s: %w", from, to, err)
 	}
 
 	return nil
@@ -113,43 +143,87 @@ func (r *Runtime) copyPythonForWindows(binDir string) error {
 }
 
 func (r *Runtime) Setup(ctx context.Context, dataRoot, toolSource string, env []string) ([]string, error) {
-	binPath, err := r.getRuntime(ctx, dataRoot)
+	resolved := r.forTool(toolSource)
+	binPath, err := resolved.getRuntime(ctx, dataRoot)
 	if err != nil {
 		return nil, err
 	}
 
-	venvPath := filepath.Join(dataRoot, "venv", hash.ID(binPath, toolSource))
+	venvKey, err := requirementsHash(toolSource)
+	if err != nil {
+		return nil, err
+	}
+
+	installer := installer(ctx, binPath)
+	venvPath := filepath.Join(venvDir(dataRoot), hash.ID(binPath, uvVersion, installer, venvKey))
 	venvBinPath := filepath.Join(venvPath, "bin")
 	if runtime.GOOS == "windows" {
 		venvBinPath = filepath.Join(venvPath, "Scripts")
 	}
 
+	newEnv := runtimeEnv.AppendPath(env, venvBinPath)
+	if runtime.GOOS == "windows" && os.Getenv("PYTHONIOENCODING") == "" {
+		newEnv = append(newEnv, "PYTHONIOENCODING=utf-8")
+	}
+	newEnv = append(newEnv, "VIRTUAL_ENV="+venvPath)
+
+	// Tools with the same interpreter and requirements share a venv
+	locker.Lock(venvPath)
+	defer locker.Unlock(venvPath)
+
+	if _, err := os.Stat(filepath.Join(venvPath, venvDoneFile)); err == nil {
+		log.DebugfCtx(ctx, "Using existing virtualenv %s", venvPath)
+		return newEnv, nil
+	}
+
 	// Cleanup failed runs
 	if err := os.RemoveAll(venvPath); err != nil {
 		return nil, err
 	}
 
-	if err := r.installVenv(ctx, binPath, venvPath); err != nil {
+	if err := resolved.installVenv(ctx, installer, binPath, venvPath); err != nil {
 		return nil, err
 	}
 
-	newEnv := runtimeEnv.AppendPath(env, venvBinPath)
-	if runtime.GOOS == "windows" && os.Getenv("PYTHONIOENCODING") == "" {
-		newEnv = append(newEnv, "PYTHONIOENCODING=utf-8")
-	}
-	newEnv = append(newEnv, "VIRTUAL_ENV="+venvPath)
-
 	if runtime.GOOS == "windows" {
-		if err := r.copyPythonForWindows(venvBinPath); err != nil {
+		if err := resolved.copyPythonForWindows(venvBinPath); err != nil {
 			return nil, err
 		}
 	}
 
-	if err := r.runPip(ctx, toolSource, binPath, append(env, newEnv...)); err != nil {
+	if err := resolved.runPip(ctx, installer, toolSource, binPath, venvBinPath, append(env, newEnv...)); err != nil {
 		return nil, err
 	}
 
-	return newEnv, nil
+	return newEnv, os.WriteFile(filepath.Join(venvPath, venvDoneFile), nil, 0644)
+}
+
+// venvDoneFile is written to a venv once its requirements are installed, a venv without it is created again.
+const venvDoneFile = ".gptscript-venv.done"
+
+// venvDir is where the venvs of tools are created. It is in dataRoot unless GPTSCRIPT_PYTHON_VENV_DIR is set, for
+// example to a directory that CI keeps between jobs.
+func venvDir(dataRoot string) string {
+	if dir := os.Getenv("GPTSCRIPT_PYTHON_VENV_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(dataRoot, "venv")
+}
+
+// requirementsHash hashes the files that decide what is installed in the venv of the tool in toolSource. A tool with
+// other requirements gets a new venv instead of changing one that other tools may use.
+func requirementsHash(toolSource string) (string, error) {
+	var parts []string
+	for _, file := range []string{"requirements-gptscript.txt", "requirements.txt", "pyproject.toml"} {
+		data, err := os.ReadFile(filepath.Join(toolSource, file))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		parts = append(parts, file, string(data))
+	}
+	return hash.ID(parts...), nil
 }
 
 func readRelease() (result []Release) {
@@ -170,12 +244,15 @@ func (r *Runtime) getReleaseAndDigest() (string, string, error) {
 	return "", "", fmt.Errorf("failed to find an python runtime for %s", r.Version)
 }
 
-func (r *Runtime) runPip(ctx context.Context, toolSource, binDir string, env []string) error {
-	log.Infof("Running pip in %s", toolSource)
+func (r *Runtime) runPip(ctx context.Context, installer, toolSource, binDir, venvBinDir string, env []string) error {
+	log.InfofCtx(ctx, "Running pip in %s", toolSource)
 	for _, req := range []string{"requirements-gptscript.txt", "requirements.txt"} {
 		reqFile := filepath.Join(toolSource, req)
 		if s, err := os.Stat(reqFile); err == nil && !s.IsDir() {
 			cmd := debugcmd.New(ctx, uvBin(binDir), "pip", "install", "-r", reqFile)
+			if installer == "pip" {
+				cmd = debugcmd.New(ctx, pythonCmd(venvBinDir), "-m", "pip", "install", "-r", reqFile)
+			}
 			cmd.Env = env
 			return cmd.Run()
 		}
@@ -203,7 +280,7 @@ func (r *Runtime) getRuntime(ctx context.Context, cwd string) (string, error) {
 		return "", err
 	}
 
-	log.Infof("Downloading Python %s.x", r.Version)
+	log.InfofCtx(ctx, "Downloading Python %s.x", r.Version)
 	tmp := target + ".download"
 	defer os.RemoveAll(tmp)
 
@@ -216,7 +293,8 @@ func (r *Runtime) getRuntime(ctx context.Context, cwd string) (string, error) {
 	}
 
 	if err := r.setupUV(ctx, pythonBin(tmp)); err != nil {
-		return "", err
+		// Venvs can still be created with pip, see installer
+		log.WarnfCtx(ctx, "Failed to install uv in Python %s.x, tools will be set up with pip: %v", r.Version, err)
 	}
 
 	return binDir, os.Rename(tmp, target)
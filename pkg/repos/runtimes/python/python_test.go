@@ -5,11 +5,13 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 
 	"github.com/adrg/xdg"
 	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -35,3 +37,91 @@ func TestRuntime(t *testing.T) {
 	}
 	require.NoError(t, err)
 }
+
+func TestMatchesSpec(t *testing.T) {
+	for spec, want := range map[string]bool{
+		">=3.10":         true,
+		">=3.11.4":       true,
+		">=3.10,<3.12":   true,
+		"<3.11":          false,
+		"==3.11.*":       true,
+		"!=3.11":         false,
+		"~=3.9":          true,
+		"~=3.10.2":       false,
+		"~=3.11.2":       true,
+		"invalid":        false,
+		">=3.8, <=3.11 ": true,
+	} {
+		assert.Equal(t, want, matchesSpec("3.11", spec), spec)
+	}
+}
+
+func TestForTool(t *testing.T) {
+	r := &Runtime{
+		Version: "3.12",
+		Default: true,
+	}
+
+	dir := t.TempDir()
+	assert.Equal(t, "3.12", r.forTool(dir).Version)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "pyproject.toml"), []byte(`[tool.black]
+requires-python = ">=3.12"
+
+[project]
+name = "tool"
+requires-python = ">=3.10,<3.12" # not 3.12 yet
+`), 0644))
+	assert.Equal(t, "3.11", r.forTool(dir).Version)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".python-version"), []byte("3.10.14\n"), 0644))
+	assert.Equal(t, "3.10", r.forTool(dir).Version)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".python-version"), []byte("3.7\n"), 0644))
+	assert.Equal(t, "3.12", r.forTool(dir).Version)
+
+	// Runtimes for a specific version, like python3.11, do not follow the tool
+	assert.Equal(t, "3.11", (&Runtime{Version: "3.11"}).forTool(dir).Version)
+}
+
+func TestRequirementsHash(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	for _, dir := range []string{a, b} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "requirements.txt"), []byte("requests==2.31.0\n"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "tool.py"), []byte("print('"+dir+"')\n"), 0644))
+	}
+
+	hashA, err := requirementsHash(a)
+	require.NoError(t, err)
+	hashB, err := requirementsHash(b)
+	require.NoError(t, err)
+	assert.Equal(t, hashA, hashB)
+
+	require.NoError(t, os.WriteFile(filepath.Join(b, "requirements.txt"), []byte("requests==2.32.0\n"), 0644))
+	hashB, err = requirementsHash(b)
+	require.NoError(t, err)
+	assert.NotEqual(t, hashA, hashB)
+}
+
+func TestVenvDir(t *testing.T) {
+	assert.Equal(t, filepath.Join("data", "venv"), venvDir("data"))
+
+	t.Setenv("GPTSCRIPT_PYTHON_VENV_DIR", filepath.Join("ci", "venvs"))
+	assert.Equal(t, filepath.Join("ci", "venvs"), venvDir("data"))
+}
+
+func TestInstaller(t *testing.T) {
+	binDir := t.TempDir()
+	assert.Equal(t, "pip", installer(context.Background(), binDir))
+
+	uv := uvBin(binDir)
+	if runtime.GOOS == "windows" {
+		uv += ".exe"
+	}
+	require.NoError(t, os.MkdirAll(filepath.Dir(uv), 0755))
+	require.NoError(t, os.WriteFile(uv, nil, 0755))
+	assert.Equal(t, "uv", installer(context.Background(), binDir))
+
+	t.Setenv("GPTSCRIPT_PYTHON_INSTALLER", "pip")
+	assert.Equal(t, "pip", installer(context.Background(), binDir))
+}
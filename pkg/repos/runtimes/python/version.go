@@ -0,0 +1,181 @@
+package python
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// forTool returns the runtime for the Python version the tool in toolSource asks for in its .python-version or in
+// requires-python in its pyproject.toml. Only the default runtime, which runs tools with python or python3, follows
+// the tool. If the tool does not declare a version, or no available version matches, r is returned.
+func (r *Runtime) forTool(toolSource string) *Runtime {
+	if !r.Default {
+		return r
+	}
+
+	spec, file := declaredVersion(toolSource)
+	if spec == "" {
+		return r
+	}
+
+	// Prefer the version of this runtime, then the newest one that matches
+	versions := append([]string{r.Version}, availableVersions()...)
+	for _, version := range versions {
+		if matchesSpec(version, spec) {
+			if version == r.Version {
+				return r
+			}
+			pinned := *r
+			pinned.Version = version
+			return &pinned
+		}
+	}
+
+	log.Warnf("Python %s requested by %s is not available, using Python %s", spec, file, r.Version)
+	return r
+}
+
+// declaredVersion returns the version specifier the tool declares and the file it is declared in. A .python-version
+// like "3.11" or "3.11.4" is turned into "==3.11".
+func declaredVersion(toolSource string) (string, string) {
+	file := filepath.Join(toolSource, ".python-version")
+	if data, err := os.ReadFile(file); err == nil {
+		line, _, _ := strings.Cut(strings.TrimSpace(string(data)), "\n")
+		version := strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(line), "cpython-"), "python")
+		if major, minor, ok := parseVersion(version); ok {
+			return "==" + strconv.Itoa(major) + "." + strconv.Itoa(minor), file
+		}
+		log.Warnf("Ignoring unsupported Python version %q in %s", line, file)
+	}
+
+	file = filepath.Join(toolSource, "pyproject.toml")
+	if data, err := os.ReadFile(file); err == nil {
+		if spec := requiresPython(data); spec != "" {
+			return spec, file
+		}
+	}
+
+	return "", ""
+}
+
+// requiresPython returns the requires-python of the [project] table of a pyproject.toml.
+func requiresPython(data []byte) string {
+	var inProject bool
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			inProject = line == "[project]"
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !inProject || !ok || strings.TrimSpace(key) != "requires-python" {
+			continue
+		}
+		value, _, _ = strings.Cut(strings.TrimSpace(value), "#")
+		return strings.Trim(strings.TrimSpace(value), `"'`)
+	}
+	return ""
+}
+
+// availableVersions returns the versions that can be downloaded for this platform, newest first.
+func availableVersions() (result []string) {
+	for _, release := range readRelease() {
+		if release.OS == runtime.GOOS && release.Arch == runtime.GOARCH {
+			result = append(result, release.Version)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return compareVersions(result[i], result[j]) > 0
+	})
+	return
+}
+
+// matchesSpec reports whether a major.minor version satisfies a PEP 440 version specifier like ">=3.10,<3.13". The
+// releases are only known by their minor version, so patch versions in the specifier are ignored.
+func matchesSpec(version, spec string) bool {
+	for _, clause := range strings.Split(spec, ",") {
+		clause = strings.TrimSpace(clause)
+		if clause == "" {
+			continue
+		}
+
+		var op string
+		for _, prefix := range []string{"~=", "==", "!=", ">=", "<=", ">", "<"} {
+			if strings.HasPrefix(clause, prefix) {
+				op = prefix
+				break
+			}
+		}
+		if op == "" {
+			return false
+		}
+
+		want := strings.TrimSuffix(strings.TrimSpace(clause[len(op):]), ".*")
+		if _, _, ok := parseVersion(want); !ok {
+			return false
+		}
+		cmp := compareVersions(version, want)
+
+		var ok bool
+		switch op {
+		case "==":
+			ok = cmp == 0
+		case "!=":
+			ok = cmp != 0
+		case ">=":
+			ok = cmp >= 0
+		case "<=":
+			ok = cmp <= 0
+		case ">":
+			ok = cmp > 0
+		case "<":
+			ok = cmp < 0
+		case "~=":
+			// ~=3.10 allows any 3.x from 3.10, ~=3.10.2 allows any 3.10.x from 3.10.2
+			major, minor, _ := parseVersion(version)
+			wantMajor, wantMinor, _ := parseVersion(want)
+			ok = cmp >= 0 && major == wantMajor
+			if strings.Count(want, ".") >= 2 {
+				ok = ok && minor == wantMinor
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// compareVersions compares the major and minor parts of two versions.
+func compareVersions(a, b string) int {
+	aMajor, aMinor, _ := parseVersion(a)
+	bMajor, bMinor, _ := parseVersion(b)
+	if aMajor != bMajor {
+		return aMajor - bMajor
+	}
+	return aMinor - bMinor
+}
+
+// parseVersion returns the major and minor version of a version like 3.11 or 3.11.4.
+func parseVersion(version string) (int, int, bool) {
+	parts := strings.Split(version, ".")
+	if len(parts) < 2 {
+		return 0, 0, false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, false
+	}
+	return major, minor, true
+}
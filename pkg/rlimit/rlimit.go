@@ -0,0 +1,90 @@
+// Package rlimit limits the memory and CPU time a command can use with the resource limits of Linux. Like for landlock,
+// a limited command is run through gptscript itself, which sets the limits of its own process and then executes the
+// command, which inherits them, so that a command that hits a limit is killed without gptscript.
+package rlimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gptscript-ai/gptscript/pkg/system"
+)
+
+// Command is the argument that runs gptscript as the wrapper of a limited command.
+const Command = "sys.rlimit"
+
+// Limits are the resources a limited command can use. Zero means no limit.
+type Limits struct {
+	// Memory is the number of bytes of data, such as the heap, the command can allocate.
+	Memory int64 `json:"memory,omitempty"`
+	// CPUTime is how long the command can run on the CPU, rounded up to seconds.
+	CPUTime time.Duration `json:"cpuTime,omitempty"`
+}
+
+// DefaultLimits are the limits of command tools that neither the CLI flags nor the tools themselves set. As they are not
+// zero, every command tool of the CLI is run through the wrapper, unless both limits are turned off.
+var DefaultLimits = Limits{
+	Memory:  4 << 30,
+	CPUTime: 30 * time.Minute,
+}
+
+func (l Limits) IsZero() bool {
+	return l.Memory == 0 && l.CPUTime == 0
+}
+
+// Wrap changes cmd to run through gptscript, which sets the limits before executing the command.
+func Wrap(cmd *exec.Cmd, limits Limits) error {
+	data, err := json.Marshal(limits)
+	if err != nil {
+		return err
+	}
+	cmd.Args = append([]string{system.Bin(), Command, string(data), cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = system.Bin()
+	return nil
+}
+
+var memoryUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"kib", 1 << 10}, {"mib", 1 << 20}, {"gib", 1 << 30},
+	{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+	{"k", 1 << 10}, {"m", 1 << 20}, {"g", 1 << 30},
+	{"b", 1},
+}
+
+// ParseMemory parses an amount of memory, in bytes or with a unit such as 512MB or 2G. Units are powers of 1024, as
+// they are for container runtimes.
+func ParseMemory(s string) (int64, error) {
+	value := strings.ToLower(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range memoryUnits {
+		if number, ok := strings.CutSuffix(value, unit.suffix); ok {
+			value, multiplier = strings.TrimSpace(number), unit.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid amount of memory %q, must be a number of bytes or have a unit such as 512MB", s)
+	}
+	return n * multiplier, nil
+}
+
+// FormatMemory formats an amount of memory in the largest unit it is a whole number of.
+func FormatMemory(n int64) string {
+	switch {
+	case n != 0 && n%(1<<30) == 0:
+		return fmt.Sprintf("%dGB", n>>30)
+	case n != 0 && n%(1<<20) == 0:
+		return fmt.Sprintf("%dMB", n>>20)
+	case n != 0 && n%(1<<10) == 0:
+		return fmt.Sprintf("%dKB", n>>10)
+	}
+	return fmt.Sprintf("%dB", n)
+}
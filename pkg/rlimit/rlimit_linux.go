@@ -0,0 +1,89 @@
+package rlimit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// Supported returns true, as resource limits are supported on Linux.
+func Supported() bool {
+	return true
+}
+
+// SysRlimit is the wrapper of a limited command, run as "gptscript sys.rlimit <limits> <command> <args>...". It sets
+// the limits of its process and replaces it with the command, which keeps them.
+func SysRlimit() error {
+	var limits Limits
+	if err := json.Unmarshal([]byte(os.Args[2]), &limits); err != nil {
+		return fmt.Errorf("invalid resource limits: %w", err)
+	}
+	if err := set(limits); err != nil {
+		return err
+	}
+	return syscall.Exec(os.Args[3], os.Args[3:], os.Environ())
+}
+
+func set(limits Limits) error {
+	if limits.Memory > 0 {
+		// The data limit, unlike the address space limit, leaves out memory that runtimes like V8 and Go only reserve
+		if err := unix.Setrlimit(unix.RLIMIT_DATA, &unix.Rlimit{Cur: uint64(limits.Memory), Max: uint64(limits.Memory)}); err != nil {
+			return fmt.Errorf("failed to limit memory: %w", err)
+		}
+	}
+	if limits.CPUTime > 0 {
+		seconds := uint64((limits.CPUTime + 999_999_999) / 1_000_000_000)
+		// The command gets SIGXCPU at the limit and is killed a second later if it handles it
+		if err := unix.Setrlimit(unix.RLIMIT_CPU, &unix.Rlimit{Cur: seconds, Max: seconds + 1}); err != nil {
+			return fmt.Errorf("failed to limit CPU time: %w", err)
+		}
+	}
+	return nil
+}
+
+// Exceeded returns the limit a command that failed with err hit, "memory" or "CPU time", if it hit one, which is told
+// from how the command ended and the resources it used. A command that uses up its CPU time is killed with SIGXCPU, or
+// with SIGKILL if it handles that. One that can't allocate memory past its limit is aborted, or crashes on the memory
+// it did not get, as programs of C and C++ do, or is killed by the kernel. That is only put down to the limit if the
+// command used a good part of it, so that other crashes and kills are not. A command that handles a failed allocation
+// and exits on its own can't be told apart from other failures.
+func Exceeded(limits Limits, err error) (string, bool) {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return "", false
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return "", false
+	}
+
+	switch signal := status.Signal(); {
+	case limits.CPUTime > 0 && (signal == syscall.SIGXCPU ||
+		signal == syscall.SIGKILL && exitErr.UserTime()+exitErr.SystemTime() >= limits.CPUTime):
+		return "CPU time", true
+	case limits.Memory > 0 && slices.Contains(memorySignals, signal) && usedMemory(exitErr, limits.Memory):
+		return "memory", true
+	}
+	return "", false
+}
+
+// memorySignals are the signals that a command that can't allocate memory ends with.
+var memorySignals = []syscall.Signal{syscall.SIGABRT, syscall.SIGSEGV, syscall.SIGBUS, syscall.SIGKILL}
+
+// usedMemory returns true if the peak resident memory of the command that ended with exitErr is near memory, its
+// limit. The resident memory of a command is less than the data it allocated, such as when a buffer is grown and
+// copied, so near is at least half of it.
+func usedMemory(exitErr *exec.ExitError, memory int64) bool {
+	usage, ok := exitErr.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return false
+	}
+	// Maxrss is in kilobytes on Linux
+	return usage.Maxrss<<10 >= memory/2
+}
@@ -0,0 +1,95 @@
+package rlimit
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"runtime/debug"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var sink []byte
+
+// TestMain sets the limits in GPTSCRIPT_TEST_RLIMIT for the test binary and then allocates memory or spins the CPU, as
+// its argument says, to hit them. The binary uses the memory it allocates and aborts when it can't allocate more, as a
+// program of C would.
+func TestMain(m *testing.M) {
+	if data := os.Getenv("GPTSCRIPT_TEST_RLIMIT"); data != "" {
+		var limits Limits
+		if err := json.Unmarshal([]byte(data), &limits); err != nil {
+			panic(err)
+		}
+		if err := set(limits); err != nil {
+			panic(err)
+		}
+		switch os.Args[1] {
+		case "memory":
+			debug.SetTraceback("crash")
+			for i := 0; i < 64; i++ {
+				chunk := make([]byte, 16<<20)
+				for j := range chunk {
+					chunk[j] = 1
+				}
+				sink = append(sink, chunk...)
+			}
+		case "exit":
+			os.Exit(1)
+		case "cpu":
+			for start := time.Now(); time.Since(start) < time.Minute; {
+			}
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func runLimited(t *testing.T, limits Limits, arg string) (string, bool) {
+	t.Helper()
+
+	data, err := json.Marshal(limits)
+	require.NoError(t, err)
+
+	cmd := exec.Command(os.Args[0], arg)
+	cmd.Env = append(os.Environ(), "GPTSCRIPT_TEST_RLIMIT="+string(data))
+	out, err := cmd.CombinedOutput()
+	require.Error(t, err, string(out))
+	return Exceeded(limits, err)
+}
+
+func TestMemoryLimit(t *testing.T) {
+	limit, ok := runLimited(t, Limits{Memory: 256 << 20}, "memory")
+	assert.True(t, ok)
+	assert.Equal(t, "memory", limit)
+}
+
+func TestCPUTimeLimit(t *testing.T) {
+	limit, ok := runLimited(t, Limits{CPUTime: time.Second}, "cpu")
+	assert.True(t, ok)
+	assert.Equal(t, "CPU time", limit)
+}
+
+func TestExceededOtherFailure(t *testing.T) {
+	err := exec.Command("false").Run()
+	require.Error(t, err)
+
+	_, ok := Exceeded(Limits{Memory: 64 << 20, CPUTime: time.Second}, err)
+	assert.False(t, ok)
+
+	// A limited command that fails on its own did not hit a limit
+	_, ok = runLimited(t, Limits{Memory: 64 << 20}, "exit")
+	assert.False(t, ok)
+
+	// Nor did one that is killed before it used much of its memory
+	cmd := exec.Command("sleep", "60")
+	require.NoError(t, cmd.Start())
+	require.NoError(t, cmd.Process.Kill())
+	err = cmd.Wait()
+	require.Error(t, err)
+
+	_, ok = Exceeded(Limits{Memory: 64 << 20}, err)
+	assert.False(t, ok)
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package rlimit
+
+import "fmt"
+
+// Supported returns false, as resource limits are only supported on Linux.
+func Supported() bool {
+	return false
+}
+
+func SysRlimit() error {
+	return fmt.Errorf("resource limits are only supported on Linux")
+}
+
+// Exceeded returns false, as commands are not limited on this system.
+func Exceeded(Limits, error) (string, bool) {
+	return "", false
+}
@@ -0,0 +1,38 @@
+package rlimit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMemory(t *testing.T) {
+	for in, expected := range map[string]int64{
+		"1024":   1024,
+		"512MB":  512 << 20,
+		"512m":   512 << 20,
+		"2 GiB":  2 << 30,
+		"64k":    64 << 10,
+		"100b":   100,
+		"0":      0,
+		" 1G  ":  1 << 30,
+		"256mib": 256 << 20,
+	} {
+		n, err := ParseMemory(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, expected, n, in)
+	}
+
+	for _, invalid := range []string{"", "MB", "-1MB", "1.5GB", "1TB", "lots"} {
+		_, err := ParseMemory(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestFormatMemory(t *testing.T) {
+	assert.Equal(t, "512MB", FormatMemory(512<<20))
+	assert.Equal(t, "2GB", FormatMemory(2<<30))
+	assert.Equal(t, "1536KB", FormatMemory(1536<<10))
+	assert.Equal(t, "100B", FormatMemory(100))
+}
@@ -0,0 +1,64 @@
+package runner
+
+import (
+	"strings"
+
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// authorize asks the authorizer to confirm the call of the tool in callCtx, unless the tool is trusted or was always
+// allowed by an earlier confirmation of the runner.
+func (r *Runner) authorize(callCtx engine.Context, input string) (AuthorizerResponse, error) {
+	if IsTrusted(callCtx.Tool, r.trustedTools) {
+		return AuthorizerResponse{Accept: true}, nil
+	}
+
+	r.allowedLock.Lock()
+	_, allowed := r.allowedTools[callCtx.Tool.ID]
+	r.allowedLock.Unlock()
+	if allowed {
+		return AuthorizerResponse{Accept: true}, nil
+	}
+
+	resp, err := r.auth(callCtx, input)
+	if err != nil {
+		return resp, err
+	}
+
+	if resp.Accept && resp.Always {
+		r.allowedLock.Lock()
+		r.allowedTools[callCtx.Tool.ID] = struct{}{}
+		r.allowedLock.Unlock()
+	}
+	return resp, nil
+}
+
+// IsTrusted returns true if one of patterns matches the ID or the source of tool. A pattern that ends with ... matches
+// any of them that starts with the rest of the pattern, like github.com/gptscript-ai/... for all the tools in the repos
+// of an organization. The name of a tool is not matched, because the author of the program chooses it, and a tool
+// could be named like a trusted source.
+func IsTrusted(tool types.Tool, patterns []string) bool {
+	if len(patterns) == 0 {
+		return false
+	}
+
+	candidates := []string{tool.ID, tool.Source.Location}
+	if tool.Source.Repo != nil {
+		root := strings.TrimSuffix(strings.TrimPrefix(tool.Source.Repo.Root, "https://"), ".git")
+		candidates = append(candidates, root, root+"/"+strings.TrimPrefix(tool.Source.Repo.Path+"/"+tool.Source.Repo.Name, "/"))
+	}
+
+	for _, pattern := range patterns {
+		prefix, isPrefix := strings.CutSuffix(pattern, "...")
+		for _, candidate := range candidates {
+			if candidate == "" {
+				continue
+			}
+			if candidate == pattern || (isPrefix && prefix != "" && strings.HasPrefix(candidate, prefix)) {
+				return true
+			}
+		}
+	}
+	return false
+}
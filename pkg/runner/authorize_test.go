@@ -0,0 +1,47 @@
+package runner
+
+import (
+	"testing"
+
+	"github.com/gptscript-ai/gptscript/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTrusted(t *testing.T) {
+	local := types.Tool{
+		ToolDef: types.ToolDef{Parameters: types.Parameters{Name: "hello"}},
+		ID:      "/home/user/tools/hello.gpt:hello",
+		Source: types.ToolSource{
+			Location: "/home/user/tools/hello.gpt",
+		},
+	}
+	remote := types.Tool{
+		ToolDef: types.ToolDef{Parameters: types.Parameters{Name: "browse"}},
+		ID:      "https://github.com/gptscript-ai/browser/tool.gpt:browse",
+		Source: types.ToolSource{
+			Location: "https://github.com/gptscript-ai/browser/tool.gpt",
+			Repo: &types.Repo{
+				Root: "https://github.com/gptscript-ai/browser.git",
+				Name: "tool.gpt",
+			},
+		},
+	}
+
+	assert.False(t, IsTrusted(local, nil))
+	assert.False(t, IsTrusted(local, []string{"hello"}))
+	assert.True(t, IsTrusted(local, []string{"/home/user/tools/hello.gpt:hello"}))
+	assert.True(t, IsTrusted(local, []string{"/home/user/tools/..."}))
+	assert.False(t, IsTrusted(local, []string{"hell", "..."}))
+
+	assert.True(t, IsTrusted(remote, []string{"github.com/gptscript-ai/..."}))
+	assert.True(t, IsTrusted(remote, []string{"github.com/gptscript-ai/browser"}))
+	assert.True(t, IsTrusted(remote, []string{"github.com/gptscript-ai/browser/tool.gpt"}))
+	assert.False(t, IsTrusted(remote, []string{"github.com/gptscript-ai/browse"}))
+	assert.False(t, IsTrusted(remote, []string{"hello", "github.com/other/..."}))
+
+	// A local tool named like a trusted source is still confirmed
+	impostor := local
+	impostor.Name = "github.com/gptscript-ai/evil"
+	assert.False(t, IsTrusted(impostor, []string{"github.com/gptscript-ai/..."}))
+	assert.False(t, IsTrusted(impostor, []string{"github.com/gptscript-ai/evil"}))
+}
@@ -38,8 +38,13 @@ type parallelDispatcher struct {
 	eg  *errgroup.Group
 }
 
-func newParallelDispatcher(ctx context.Context) *parallelDispatcher {
+// newParallelDispatcher returns a dispatcher that runs up to limit functions at the same time, or all of them if limit
+// is 0. Run blocks while limit functions are running.
+func newParallelDispatcher(ctx context.Context, limit int) *parallelDispatcher {
 	eg, ctx := errgroup.WithContext(ctx)
+	if limit > 0 {
+		eg.SetLimit(limit)
+	}
 	return &parallelDispatcher{
 		ctx: ctx,
 		eg:  eg,
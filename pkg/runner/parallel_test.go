@@ -0,0 +1,32 @@
+package runner
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParallelDispatcherLimit(t *testing.T) {
+	var running, maxRunning atomic.Int32
+	d := newParallelDispatcher(context.Background(), 2)
+	for i := 0; i < 6; i++ {
+		d.Run(func(context.Context) error {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				current := maxRunning.Load()
+				if n <= current || maxRunning.CompareAndSwap(current, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		})
+	}
+	require.NoError(t, d.Wait())
+	assert.Equal(t, int32(2), maxRunning.Load())
+}
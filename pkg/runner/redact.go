@@ -0,0 +1,51 @@
+package runner
+
+import (
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/redact"
+)
+
+// redactingMonitor removes the known secrets, such as the credentials of the run, from events before they are sent to
+// the monitor. Only what is reported is changed, the tools and the model still get the real values.
+type redactingMonitor struct {
+	Monitor
+}
+
+func (r redactingMonitor) Event(event Event) {
+	if event.CallContext != nil {
+		callContext := *event.CallContext
+		callContext.DisplayText = redact.String(callContext.DisplayText)
+		event.CallContext = &callContext
+	}
+	if len(event.ToolSubCalls) > 0 {
+		subCalls := make(map[string]engine.Call, len(event.ToolSubCalls))
+		for id, call := range event.ToolSubCalls {
+			call.Input = redact.String(call.Input)
+			subCalls[id] = call
+		}
+		event.ToolSubCalls = subCalls
+	}
+	event.ChatRequest = redact.Value(event.ChatRequest)
+	event.ChatResponse = redact.Value(event.ChatResponse)
+	event.Content = redact.String(event.Content)
+	r.Monitor.Event(event)
+}
+
+func (r redactingMonitor) Stop(output string, err error) {
+	if err != nil {
+		err = redactedError{err}
+	}
+	r.Monitor.Stop(redact.String(output), err)
+}
+
+type redactedError struct {
+	err error
+}
+
+func (r redactedError) Error() string {
+	return redact.String(r.err.Error())
+}
+
+func (r redactedError) Unwrap() error {
+	return r.err
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
@@ -15,6 +16,9 @@ import (
 	context2 "github.com/gptscript-ai/gptscript/pkg/context"
 	"github.com/gptscript-ai/gptscript/pkg/credentials"
 	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/redact"
+	"github.com/gptscript-ai/gptscript/pkg/rlimit"
+	"github.com/gptscript-ai/gptscript/pkg/trace"
 	"github.com/gptscript-ai/gptscript/pkg/types"
 	"golang.org/x/exp/maps"
 )
@@ -31,18 +35,32 @@ type Monitor interface {
 }
 
 type Options struct {
-	MonitorFactory     MonitorFactory        `usage:"-"`
-	RuntimeManager     engine.RuntimeManager `usage:"-"`
-	StartPort          int64                 `usage:"-"`
-	EndPort            int64                 `usage:"-"`
-	CredentialOverride string                `usage:"-"`
-	Sequential         bool                  `usage:"-"`
-	Authorizer         AuthorizerFunc        `usage:"-"`
+	MonitorFactory     MonitorFactory         `usage:"-"`
+	RuntimeManager     engine.RuntimeManager  `usage:"-"`
+	StartPort          int64                  `usage:"-"`
+	EndPort            int64                  `usage:"-"`
+	DaemonGracePeriod  time.Duration          `usage:"-"`
+	CredentialOverride string                 `usage:"-"`
+	Sequential         bool                   `usage:"-"`
+	MaxConcurrency     int                    `usage:"-"`
+	StreamToolOutput   bool                   `usage:"-"`
+	Sandbox            *engine.SandboxOptions `usage:"-"`
+	Landlock           bool                   `usage:"-"`
+	ToolLimits         rlimit.Limits          `usage:"-"`
+	History            *engine.HistoryOptions `usage:"-"`
+	Recording          *engine.Recording      `usage:"-"`
+	AuditLog           *engine.AuditLog       `usage:"-"`
+	Tracer             *trace.Tracer          `usage:"-"`
+	Authorizer         AuthorizerFunc         `usage:"-"`
+	// TrustedTools are the tools the authorizer is not asked to confirm, see IsTrusted
+	TrustedTools []string `usage:"-"`
 }
 
 type AuthorizerResponse struct {
 	Accept  bool
 	Message string
+	// Always allows the tool for the rest of the runner's runs without asking again
+	Always bool
 }
 
 type AuthorizerFunc func(ctx engine.Context, input string) (AuthorizerResponse, error)
@@ -59,11 +77,22 @@ func complete(opts ...Options) (result Options) {
 		result.RuntimeManager = types.FirstSet(opt.RuntimeManager, result.RuntimeManager)
 		result.StartPort = types.FirstSet(opt.StartPort, result.StartPort)
 		result.EndPort = types.FirstSet(opt.EndPort, result.EndPort)
+		result.DaemonGracePeriod = types.FirstSet(opt.DaemonGracePeriod, result.DaemonGracePeriod)
 		result.CredentialOverride = types.FirstSet(opt.CredentialOverride, result.CredentialOverride)
 		result.Sequential = types.FirstSet(opt.Sequential, result.Sequential)
+		result.MaxConcurrency = types.FirstSet(opt.MaxConcurrency, result.MaxConcurrency)
+		result.StreamToolOutput = types.FirstSet(opt.StreamToolOutput, result.StreamToolOutput)
+		result.Sandbox = types.FirstSet(opt.Sandbox, result.Sandbox)
+		result.Landlock = types.FirstSet(opt.Landlock, result.Landlock)
+		result.ToolLimits = types.FirstSet(opt.ToolLimits, result.ToolLimits)
+		result.History = types.FirstSet(opt.History, result.History)
+		result.Recording = types.FirstSet(opt.Recording, result.Recording)
+		result.AuditLog = types.FirstSet(opt.AuditLog, result.AuditLog)
+		result.Tracer = types.FirstSet(opt.Tracer, result.Tracer)
 		if opt.Authorizer != nil {
 			result.Authorizer = opt.Authorizer
 		}
+		result.TrustedTools = append(result.TrustedTools, opt.TrustedTools...)
 	}
 	if result.MonitorFactory == nil {
 		result.MonitorFactory = noopFactory{}
@@ -87,8 +116,23 @@ type Runner struct {
 	runtimeManager engine.RuntimeManager
 	credCtx        string
 	credMutex      sync.Mutex
+	// credentials are the last credentials of the credential tools of the run, by their ID, which are kept to refresh
+	// them when a call is unauthorized. They are guarded by credMutex.
+	credentials    map[string]*credentials.Credential
 	credOverrides  string
 	sequential     bool
+	maxConcurrency int
+	streamOutput   bool
+	sandbox        *engine.SandboxOptions
+	landlock       bool
+	toolLimits     rlimit.Limits
+	history        *engine.HistoryOptions
+	recording      *engine.Recording
+	auditLog       *engine.AuditLog
+	tracer         *trace.Tracer
+	trustedTools   []string
+	allowedTools   map[string]struct{}
+	allowedLock    sync.Mutex
 }
 
 func New(client engine.Model, credCtx string, opts ...Options) (*Runner, error) {
@@ -100,9 +144,27 @@ func New(client engine.Model, credCtx string, opts ...Options) (*Runner, error)
 		runtimeManager: opt.RuntimeManager,
 		credCtx:        credCtx,
 		credMutex:      sync.Mutex{},
+		credentials:    map[string]*credentials.Credential{},
 		credOverrides:  opt.CredentialOverride,
 		sequential:     opt.Sequential,
+		maxConcurrency: opt.MaxConcurrency,
+		streamOutput:   opt.StreamToolOutput,
+		sandbox:        opt.Sandbox,
+		landlock:       opt.Landlock,
+		toolLimits:     opt.ToolLimits,
+		history:        opt.History,
+		recording:      opt.Recording,
+		auditLog:       opt.AuditLog,
+		tracer:         opt.Tracer,
 		auth:           opt.Authorizer,
+		trustedTools:   opt.TrustedTools,
+		allowedTools:   map[string]struct{}{},
+	}
+
+	if opt.History != nil {
+		if err := opt.History.Validate(); err != nil {
+			return nil, err
+		}
 	}
 
 	if opt.StartPort != 0 {
@@ -112,6 +174,10 @@ func New(client engine.Model, credCtx string, opts ...Options) (*Runner, error)
 		engine.SetPorts(opt.StartPort, opt.EndPort)
 	}
 
+	if opt.DaemonGracePeriod != 0 {
+		engine.SetDaemonGracePeriod(opt.DaemonGracePeriod)
+	}
+
 	return runner, nil
 }
 
@@ -143,15 +209,30 @@ func (r *Runner) Chat(ctx context.Context, prevState ChatState, prg types.Progra
 		}
 	}
 
-	monitor, err := r.factory.Start(ctx, &prg, env, input)
+	// The credentials of the run are only redacted until it is done, after its monitor is stopped
+	redactScope := redact.NewScope()
+	defer redactScope.Close()
+	ctx = redact.WithScope(ctx, redactScope)
+
+	m, err := r.factory.Start(ctx, &prg, env, input)
 	if err != nil {
 		return resp, err
 	}
+	monitor := redactingMonitor{m}
 	defer func() {
 		monitor.Stop(resp.Content, err)
 	}()
+	defer engine.AddDaemonListener(daemonEvents(&prg, monitor))()
 
-	callCtx := engine.NewContext(ctx, &prg, input)
+	ctx, span := r.startRun(ctx, prg)
+	defer func() {
+		span.End(err)
+	}()
+
+	callCtx, endCall := traceCall(engine.NewContext(ctx, &prg, input))
+	defer func() {
+		endCall(err)
+	}()
 	if state == nil || state.StartContinuation {
 		if state != nil {
 			state = state.WithResumeInput(&input)
@@ -217,6 +298,8 @@ type Event struct {
 	Usage              types.Usage            `json:"usage,omitempty"`
 	ChatResponseCached bool                   `json:"chatResponseCached,omitempty"`
 	Content            string                 `json:"content,omitempty"`
+	// Daemon is the lifecycle event of a daemon of the program, for the daemon event types
+	Daemon *engine.DaemonEvent `json:"daemon,omitempty"`
 }
 
 type EventType string
@@ -230,8 +313,27 @@ var (
 	EventTypeChat         EventType = "callChat"
 	EventTypeCallFinish   EventType = "callFinish"
 	EventTypeRunFinish    EventType = "runFinish"
+
+	EventTypeDaemonStarted  = EventType(engine.DaemonStarted)
+	EventTypeDaemonStopping = EventType(engine.DaemonStopping)
+	EventTypeDaemonStopped  = EventType(engine.DaemonStopped)
 )
 
+// daemonEvents returns a listener that sends the lifecycle events of the daemons of the tools of prg to monitor. Daemons
+// are shared by the runs of a process and outlive them, so a run only sees the events of its daemons while it runs.
+func daemonEvents(prg *types.Program, monitor Monitor) func(engine.DaemonEvent) {
+	return func(event engine.DaemonEvent) {
+		if _, ok := prg.ToolSet[event.ToolID]; !ok {
+			return
+		}
+		monitor.Event(Event{
+			Time:   event.Time,
+			Type:   EventType(event.Type),
+			Daemon: &event,
+		})
+	}
+}
+
 func getContextInput(prg *types.Program, ref types.ToolReference, input string) (string, error) {
 	if ref.Arg == "" {
 		return "", nil
@@ -394,18 +496,13 @@ func (r *Runner) start(callCtx engine.Context, state *State, monitor Monitor, en
 		Content:     input,
 	})
 
-	if len(callCtx.Tool.Credentials) > 0 {
-		var err error
-		env, err = r.handleCredentials(callCtx, monitor, env)
-		if err != nil {
-			return nil, err
-		}
+	credEnv, err := r.handleCredentials(callCtx, monitor, env)
+	if err != nil {
+		return nil, err
 	}
+	callCtx.CredentialEnv = credEnv
 
-	var (
-		err      error
-		newState *State
-	)
+	var newState *State
 	callCtx.InputContext, newState, err = r.getContext(callCtx, state, monitor, env, input)
 	if err != nil {
 		return nil, err
@@ -420,13 +517,21 @@ func (r *Runner) start(callCtx engine.Context, state *State, monitor Monitor, en
 		RuntimeManager: r.runtimeManager,
 		Progress:       progress,
 		Env:            env,
+		CredentialEnv:  credEnv,
+		StreamOutput:   r.streamOutput,
+		Sandbox:        r.sandbox,
+		Landlock:       r.landlock,
+		ToolLimits:     r.toolLimits,
+		History:        r.history,
+		Recording:      r.recording,
+		Audit:          r.auditLog,
 	}
 
 	callCtx.Ctx = context2.AddPauseFuncToCtx(callCtx.Ctx, monitor.Pause)
 
 	_, safe := builtin.SafeTools[callCtx.Tool.ID]
 	if callCtx.Tool.IsCommand() && !safe {
-		authResp, err := r.auth(callCtx, input)
+		authResp, err := r.authorize(callCtx, input)
 		if err != nil {
 			return nil, err
 		}
@@ -442,6 +547,9 @@ func (r *Runner) start(callCtx engine.Context, state *State, monitor Monitor, en
 	}
 
 	ret, err := e.Start(callCtx, input)
+	if credentials.IsUnauthorized(err) {
+		ret, err = r.retryUnauthorized(callCtx, monitor, env, &e, input, err)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -523,13 +631,11 @@ func (r *Runner) resume(callCtx engine.Context, monitor Monitor, env []string, s
 	progress, progressClose := streamProgress(&callCtx, monitor)
 	defer progressClose()
 
-	if len(callCtx.Tool.Credentials) > 0 {
-		var err error
-		env, err = r.handleCredentials(callCtx, monitor, env)
-		if err != nil {
-			return nil, err
-		}
+	credEnv, err := r.handleCredentials(callCtx, monitor, env)
+	if err != nil {
+		return nil, err
 	}
+	callCtx.CredentialEnv = credEnv
 
 	for {
 		if state.Continuation.Result != nil && len(state.Continuation.Calls) == 0 && state.SubCallID == "" && state.ResumeInput == nil {
@@ -601,6 +707,14 @@ func (r *Runner) resume(callCtx engine.Context, monitor Monitor, env []string, s
 			RuntimeManager: r.runtimeManager,
 			Progress:       progress,
 			Env:            env,
+			CredentialEnv:  credEnv,
+			StreamOutput:   r.streamOutput,
+			Sandbox:        r.sandbox,
+			Landlock:       r.landlock,
+			ToolLimits:     r.toolLimits,
+			History:        r.history,
+			Recording:      r.recording,
+			Audit:          r.auditLog,
 		}
 
 		var (
@@ -680,7 +794,10 @@ func (r *Runner) subCall(ctx context.Context, parentContext engine.Context, moni
 		return nil, err
 	}
 
-	return r.call(callCtx, monitor, env, input)
+	callCtx, endCall := traceCall(callCtx)
+	state, err := r.call(callCtx, monitor, env, input)
+	endCall(err)
+	return state, err
 }
 
 func (r *Runner) subCallResume(ctx context.Context, parentContext engine.Context, monitor Monitor, env []string, toolID, callID string, state *State, toolCategory engine.ToolCategory) (*State, error) {
@@ -689,7 +806,10 @@ func (r *Runner) subCallResume(ctx context.Context, parentContext engine.Context
 		return nil, err
 	}
 
-	return r.resume(callCtx, monitor, env, state)
+	callCtx, endCall := traceCall(callCtx)
+	state, err = r.resume(callCtx, monitor, env, state)
+	endCall(err)
+	return state, err
 }
 
 type SubCallResult struct {
@@ -702,14 +822,10 @@ func (r *Runner) newDispatcher(ctx context.Context) dispatcher {
 	if r.sequential {
 		return newSerialDispatcher(ctx)
 	}
-	return newParallelDispatcher(ctx)
+	return newParallelDispatcher(ctx, r.maxConcurrency)
 }
 
 func (r *Runner) subCalls(callCtx engine.Context, monitor Monitor, env []string, state *State, toolCategory engine.ToolCategory) (_ *State, callResults []SubCallResult, _ error) {
-	var (
-		resultLock sync.Mutex
-	)
-
 	if state.Continuation != nil {
 		callCtx.LastReturn = state.Continuation
 	}
@@ -751,11 +867,12 @@ func (r *Runner) subCalls(callCtx engine.Context, monitor Monitor, env []string,
 
 	d := r.newDispatcher(callCtx.Ctx)
 
-	// Sort the id so if sequential the results are predictable
+	// Sort the id so the calls start and their results are returned in the same order, however long each call takes
 	ids := maps.Keys(state.Continuation.Calls)
 	sort.Strings(ids)
 
-	for _, id := range ids {
+	callResults = make([]SubCallResult, len(ids))
+	for i, id := range ids {
 		call := state.Continuation.Calls[id]
 		d.Run(func(ctx context.Context) error {
 			result, err := r.subCall(ctx, callCtx, monitor, env, call.ToolID, call.Input, id, toolCategory)
@@ -763,13 +880,11 @@ func (r *Runner) subCalls(callCtx engine.Context, monitor Monitor, env []string,
 				return err
 			}
 
-			resultLock.Lock()
-			defer resultLock.Unlock()
-			callResults = append(callResults, SubCallResult{
+			callResults[i] = SubCallResult{
 				ToolID: call.ToolID,
 				CallID: id,
 				State:  result,
-			})
+			}
 
 			return nil
 		})
@@ -782,36 +897,29 @@ func (r *Runner) subCalls(callCtx engine.Context, monitor Monitor, env []string,
 	return state, callResults, nil
 }
 
-func (r *Runner) handleCredentials(callCtx engine.Context, monitor Monitor, env []string) ([]string, error) {
+// handleCredentials returns the env of the credentials of the tool in callCtx, and of the credentials that the tool
+// calling it shares with it. It is only given to that tool, and not to its sub calls, context tools or other credential
+// tools, which each get the credentials they declare themselves or that the tool shares with them.
+func (r *Runner) handleCredentials(callCtx engine.Context, monitor Monitor, env []string) (credEnv []string, _ error) {
+	credEnv, err := sharedCredentialEnv(callCtx)
+	if err != nil || len(callCtx.Tool.Credentials) == 0 {
+		return credEnv, err
+	}
+
 	// Since credential tools (usually) prompt the user, we want to only run one at a time.
 	r.credMutex.Lock()
 	defer r.credMutex.Unlock()
 
-	// Set up the credential store.
-	c, err := config.ReadCLIConfig("")
-	if err != nil {
-		return nil, fmt.Errorf("failed to read CLI config: %w", err)
-	}
-
-	store, err := credentials.NewStore(c, r.credCtx)
+	store, credOverrides, err := r.credentialStore()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create credentials store: %w", err)
-	}
-
-	// Parse the credential overrides from the command line argument, if there are any.
-	var credOverrides map[string]map[string]string
-	if r.credOverrides != "" {
-		credOverrides, err = parseCredentialOverrides(r.credOverrides)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse credential overrides: %w", err)
-		}
+		return nil, err
 	}
 
 	for _, credToolName := range callCtx.Tool.Credentials {
 		// Check whether the credential was overridden before we attempt to find it in the store or run the tool.
 		if override, exists := credOverrides[credToolName]; exists {
 			for k, v := range override {
-				env = append(env, fmt.Sprintf("%s=%s", k, v))
+				credEnv = append(credEnv, fmt.Sprintf("%s=%s", k, v))
 			}
 			continue
 		}
@@ -830,66 +938,251 @@ func (r *Runner) handleCredentials(callCtx engine.Context, monitor Monitor, env
 			}
 		}
 
+		// An expired credential is renewed by running its tool again, which is given the credential to refresh it.
+		var expired *credentials.Credential
+		if exists && cred.IsExpired() {
+			expired = cred
+			exists = false
+		}
+
 		// If the credential doesn't already exist in the store, run the credential tool in order to get the value,
 		// and save it in the store.
 		if !exists {
-			credToolRefs, ok := callCtx.Tool.ToolMapping[credToolName]
-			if !ok || len(credToolRefs) != 1 {
-				return nil, fmt.Errorf("failed to find ID for tool %s", credToolName)
-			}
-
-			subCtx, err := callCtx.SubCall(callCtx.Ctx, "", credToolRefs[0].ToolID, "", engine.CredentialToolCategory) // leaving callID as "" will cause it to be set by the engine
+			cred, err = r.runCredentialTool(callCtx, monitor, store, env, credToolName, expired)
 			if err != nil {
-				return nil, fmt.Errorf("failed to create subcall context for tool %s: %w", credToolName, err)
+				return nil, err
 			}
+		}
 
-			res, err := r.call(subCtx, monitor, env, "")
+		r.credentials[credToolID(callCtx, credToolName)] = cred
+		for k, v := range cred.Env {
+			credEnv = append(credEnv, fmt.Sprintf("%s=%s", k, v))
+		}
+	}
+
+	for _, env := range credEnv {
+		_, v, _ := strings.Cut(env, "=")
+		redact.AddContextValues(callCtx.Ctx, v)
+	}
+
+	return credEnv, nil
+}
+
+// sharedCredentialEnv returns the env of the credentials of the tool calling the tool in callCtx, if that tool lists it
+// in Share Credentials.
+func sharedCredentialEnv(callCtx engine.Context) ([]string, error) {
+	parent := callCtx.Parent
+	if parent == nil || len(parent.Tool.ShareCredentials) == 0 || len(parent.CredentialEnv) == 0 {
+		return nil, nil
+	}
+
+	refs, err := parent.Tool.GetToolRefsFromNames(parent.Tool.ShareCredentials)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range refs {
+		if ref.ToolID == callCtx.Tool.ID {
+			return slices.Clone(parent.CredentialEnv), nil
+		}
+	}
+	return nil, nil
+}
+
+// retryUnauthorized refreshes the credentials of a tool whose call failed with callErr because it was unauthorized,
+// and calls it once more with the refreshed credentials. If no credential could be refreshed, or the call is still
+// unauthorized, an OpenAPI tool returns the response and a command tool its output, like for any other failure, and
+// other tools fail with the error.
+func (r *Runner) retryUnauthorized(callCtx engine.Context, monitor Monitor, env []string, e *engine.Engine, input string, callErr error) (*engine.Return, error) {
+	credEnv, refreshed, err := r.refreshCredentials(callCtx, monitor, env, e.CredentialEnv)
+	if err != nil {
+		return nil, err
+	}
+
+	if refreshed {
+		e.CredentialEnv = credEnv
+		ret, err := e.Start(callCtx, input)
+		if !credentials.IsUnauthorized(err) {
+			return ret, err
+		}
+		callErr = err
+	}
+
+	var (
+		statusErr *engine.HTTPStatusError
+		cmdErr    *engine.CommandUnauthorizedError
+	)
+	if callCtx.Tool.IsOpenAPI() && errors.As(callErr, &statusErr) {
+		return &engine.Return{
+			Result: &statusErr.Body,
+		}, nil
+	}
+	if callCtx.ToolCategory == engine.NoCategory && errors.As(callErr, &cmdErr) {
+		result := fmt.Sprintf("ERROR: got (%v) while running tool, OUTPUT: %s", cmdErr.Err, cmdErr.Output)
+		return &engine.Return{
+			Result: &result,
+		}, nil
+	}
+	return nil, callErr
+}
+
+// refreshCredentials renews the credentials of the tool that can be refreshed, because a call of the tool was
+// unauthorized with them, and returns credEnv with their new values. Each credential tool is given the credential it
+// returned before, to renew it without prompting the user, such as with a refresh token. Credentials that can't be
+// refreshed, because they have neither an expiry nor a refresh token, and overridden credentials are kept, so that the
+// user is not prompted for them again. It returns false if no credential was refreshed.
+func (r *Runner) refreshCredentials(callCtx engine.Context, monitor Monitor, env, credEnv []string) ([]string, bool, error) {
+	r.credMutex.Lock()
+	defer r.credMutex.Unlock()
+
+	store, credOverrides, err := r.credentialStore()
+	if err != nil {
+		return nil, false, err
+	}
+
+	var refreshed bool
+	for _, credToolName := range callCtx.Tool.Credentials {
+		if _, overridden := credOverrides[credToolName]; overridden {
+			continue
+		}
+
+		// Only credentials of tools on GitHub are stored, the ones of other tools are the ones of this run
+		id := credToolID(callCtx, credToolName)
+		cred := r.credentials[id]
+		if isGitHubTool(credToolName) {
+			stored, exists, err := store.Get(credToolName)
 			if err != nil {
-				return nil, fmt.Errorf("failed to run credential tool %s: %w", credToolName, err)
+				return nil, false, fmt.Errorf("failed to get credentials for tool %s: %w", credToolName, err)
+			} else if exists {
+				cred = stored
 			}
+		}
+		if cred == nil || !cred.Refreshable() {
+			continue
+		}
 
-			if res.Result == nil {
-				return nil, fmt.Errorf("invalid state: credential tool [%s] can not result in a continuation", credToolName)
-			}
+		log.Debugf("Refreshing credential %s after an unauthorized call of %s", credToolName, callCtx.Tool.Name)
+		newCred, err := r.runCredentialTool(callCtx, monitor, store, env, credToolName, cred)
+		if err != nil {
+			return nil, false, err
+		}
 
-			var envMap struct {
-				Env map[string]string `json:"env"`
-			}
-			if err := json.Unmarshal([]byte(*res.Result), &envMap); err != nil {
-				return nil, fmt.Errorf("failed to unmarshal credential tool %s response: %w", credToolName, err)
-			}
+		credEnv = slices.DeleteFunc(slices.Clone(credEnv), func(env string) bool {
+			k, _, _ := strings.Cut(env, "=")
+			_, old := cred.Env[k]
+			_, renewed := newCred.Env[k]
+			return old || renewed
+		})
+		for k, v := range newCred.Env {
+			credEnv = append(credEnv, fmt.Sprintf("%s=%s", k, v))
+			redact.AddContextValues(callCtx.Ctx, v)
+		}
+		r.credentials[id] = newCred
+		refreshed = true
+	}
 
-			cred = &credentials.Credential{
-				ToolName: credToolName,
-				Env:      envMap.Env,
-			}
+	return credEnv, refreshed, nil
+}
 
-			isEmpty := true
-			for _, v := range cred.Env {
-				if v != "" {
-					isEmpty = false
-					break
-				}
-			}
+// credToolID returns the ID of the credential tool credToolName of the tool in callCtx, or the name if it has none.
+func credToolID(callCtx engine.Context, credToolName string) string {
+	if refs := callCtx.Tool.ToolMapping[credToolName]; len(refs) == 1 {
+		return refs[0].ToolID
+	}
+	return credToolName
+}
 
-			// Only store the credential if the tool is on GitHub, and the credential is non-empty.
-			if isGitHubTool(credToolName) && callCtx.Program.ToolSet[credToolRefs[0].ToolID].Source.Repo != nil {
-				if isEmpty {
-					log.Warnf("Not saving empty credential for tool %s", credToolName)
-				} else if err := store.Add(*cred); err != nil {
-					return nil, fmt.Errorf("failed to add credential for tool %s: %w", credToolName, err)
-				}
-			} else {
-				log.Warnf("Not saving credential for local tool %s - credentials will only be saved for tools from GitHub.", credToolName)
-			}
+// credentialStore returns the credential store of the credential context of the runner and the credential overrides.
+func (r *Runner) credentialStore() (*credentials.Store, map[string]map[string]string, error) {
+	c, err := config.ReadCLIConfig("")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read CLI config: %w", err)
+	}
+
+	store, err := credentials.NewStore(c, r.credCtx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create credentials store: %w", err)
+	}
+
+	// Parse the credential overrides from the command line argument, if there are any.
+	var credOverrides map[string]map[string]string
+	if r.credOverrides != "" {
+		credOverrides, err = parseCredentialOverrides(r.credOverrides)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse credential overrides: %w", err)
 		}
+	}
 
-		for k, v := range cred.Env {
-			env = append(env, fmt.Sprintf("%s=%s", k, v))
+	return store, credOverrides, nil
+}
+
+// runCredentialTool runs the credential tool of credToolName and saves the credential it returns in the store. The tool
+// is given existing, if it is not nil, to renew it.
+func (r *Runner) runCredentialTool(callCtx engine.Context, monitor Monitor, store *credentials.Store, env []string, credToolName string, existing *credentials.Credential) (*credentials.Credential, error) {
+	credToolRefs, ok := callCtx.Tool.ToolMapping[credToolName]
+	if !ok || len(credToolRefs) != 1 {
+		return nil, fmt.Errorf("failed to find ID for tool %s", credToolName)
+	}
+
+	if existing != nil {
+		data, err := json.Marshal(existing)
+		if err != nil {
+			return nil, err
 		}
+		env = append(slices.Clone(env), types.ExistingCredentialEnvVar+"="+string(data))
+	}
+
+	subCtx, err := callCtx.SubCall(callCtx.Ctx, "", credToolRefs[0].ToolID, "", engine.CredentialToolCategory) // leaving callID as "" will cause it to be set by the engine
+	if err != nil {
+		return nil, fmt.Errorf("failed to create subcall context for tool %s: %w", credToolName, err)
+	}
+
+	subCtx, endCall := traceCall(subCtx)
+	res, err := r.call(subCtx, monitor, env, "")
+	endCall(err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run credential tool %s: %w", credToolName, err)
+	}
+
+	if res.Result == nil {
+		return nil, fmt.Errorf("invalid state: credential tool [%s] can not result in a continuation", credToolName)
+	}
+
+	var envMap struct {
+		Env          map[string]string `json:"env"`
+		ExpiresAt    *time.Time        `json:"expiresAt"`
+		RefreshToken string            `json:"refreshToken"`
+	}
+	if err := json.Unmarshal([]byte(*res.Result), &envMap); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal credential tool %s response: %w", credToolName, err)
+	}
+
+	cred := &credentials.Credential{
+		ToolName:     credToolName,
+		Env:          envMap.Env,
+		ExpiresAt:    envMap.ExpiresAt,
+		RefreshToken: envMap.RefreshToken,
+	}
+
+	isEmpty := true
+	for _, v := range cred.Env {
+		if v != "" {
+			isEmpty = false
+			break
+		}
+	}
+
+	// Only store the credential if the tool is on GitHub, and the credential is non-empty.
+	if isGitHubTool(credToolName) && callCtx.Program.ToolSet[credToolRefs[0].ToolID].Source.Repo != nil {
+		if isEmpty {
+			log.Warnf("Not saving empty credential for tool %s", credToolName)
+		} else if err := store.Add(*cred); err != nil {
+			return nil, fmt.Errorf("failed to add credential for tool %s: %w", credToolName, err)
+		}
+	} else {
+		log.Warnf("Not saving credential for local tool %s - credentials will only be saved for tools from GitHub.", credToolName)
 	}
 
-	return env, nil
+	return cred, nil
 }
 
 func isGitHubTool(toolName string) bool {
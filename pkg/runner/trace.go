@@ -0,0 +1,45 @@
+package runner
+
+import (
+	"context"
+
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/trace"
+	"github.com/gptscript-ai/gptscript/pkg/types"
+)
+
+// startRun starts the span of a run of prg, which the spans of all its calls are children of.
+func (r *Runner) startRun(ctx context.Context, prg types.Program) (context.Context, *trace.Span) {
+	ctx = trace.WithTracer(ctx, r.tracer)
+	if !trace.Enabled(ctx) {
+		return ctx, nil
+	}
+
+	entry := prg.ToolSet[prg.EntryToolID]
+	return trace.Start(ctx, "run "+types.FirstSet(prg.Name, entry.Name, entry.ID), trace.SpanKindInternal,
+		trace.String("gptscript.program", prg.Name),
+		trace.String("gptscript.tool.name", entry.Name),
+		trace.String("gptscript.tool.id", entry.ID))
+}
+
+// traceCall starts the span of a call of a tool, from its start until it returns its result, and returns the context
+// of the call with the span, so that the spans of its model calls, setup and sub calls are children of it.
+func traceCall(callCtx engine.Context) (engine.Context, func(error)) {
+	if !trace.Enabled(callCtx.Ctx) {
+		return callCtx, func(error) {}
+	}
+
+	toolType := "prompt"
+	if callCtx.Tool.IsCommand() {
+		toolType = "command"
+	}
+
+	ctx, span := trace.Start(callCtx.Ctx, "tool "+types.FirstSet(callCtx.Tool.Name, callCtx.Tool.ID), trace.SpanKindInternal,
+		trace.String("gptscript.tool.name", callCtx.Tool.Name),
+		trace.String("gptscript.tool.id", callCtx.Tool.ID),
+		trace.String("gptscript.tool.type", toolType),
+		trace.String("gptscript.tool.category", string(callCtx.ToolCategory)),
+		trace.String("gptscript.call.id", callCtx.ID))
+	callCtx.Ctx = ctx
+	return callCtx, span.End
+}
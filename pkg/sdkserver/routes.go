@@ -152,6 +152,15 @@ func (s *server) execHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var timeout time.Duration
+	if reqObject.Timeout != "" {
+		timeout, err = time.ParseDuration(reqObject.Timeout)
+		if err != nil {
+			writeError(logger, w, http.StatusBadRequest, fmt.Errorf("invalid timeout %q: %w", reqObject.Timeout, err))
+			return
+		}
+	}
+
 	ctx := gserver.ContextWithNewRunID(r.Context())
 	runID := gserver.RunIDFromContext(ctx)
 	ctx, cancel := context.WithTimeout(ctx, toolRunTimeout)
@@ -182,14 +191,20 @@ func (s *server) execHandler(w http.ResponseWriter, r *http.Request) {
 		Env:               append(os.Environ(), reqObject.Env...),
 		Workspace:         reqObject.Workspace,
 		CredentialContext: reqObject.CredentialContext,
+		Timeout:           timeout,
+		OutputSchema:      reqObject.OutputSchema,
 		Runner: runner.Options{
 			// Set the monitor factory so that we can get events from the server.
-			MonitorFactory: NewSessionFactory(s.events),
+			MonitorFactory:   NewSessionFactory(s.events),
+			StreamToolOutput: reqObject.StreamToolOutput,
+			MaxConcurrency:   reqObject.MaxConcurrency,
+			History:          reqObject.History,
 		},
 	}
 
 	if reqObject.Confirm {
 		opts.Runner.Authorizer = s.authorize
+		opts.Runner.TrustedTools = reqObject.TrustedTools
 	}
 
 	s.execAndStream(ctx, programLoader, logger, w, opts, reqObject.ChatState, reqObject.Input, reqObject.SubTool, def)
@@ -3,8 +3,10 @@ package sdkserver
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 
 	"github.com/gptscript-ai/gptscript/pkg/gptscript"
 	"github.com/gptscript-ai/gptscript/pkg/loader"
@@ -24,7 +26,7 @@ func (s *server) execAndStream(ctx context.Context, programLoader loaderFunc, lo
 	}
 	defer g.Close(false)
 
-	prg, err := programLoader(ctx, toolDef.String(), subTool, loader.Options{Cache: g.Cache})
+	prg, err := programLoader(ctx, toolDef.String(), subTool, loader.Options{Cache: g.Cache, Offline: slices.Contains(opts.Env, "GPTSCRIPT_OFFLINE=true")})
 	if err != nil {
 		writeError(logger, w, http.StatusInternalServerError, fmt.Errorf("failed to load program: %w", err))
 		return
@@ -67,7 +69,16 @@ func processEventStreamOutput(ctx context.Context, logger mvl.Logger, w http.Res
 			"stdout": out,
 		})
 	case err := <-errChan:
-		writeError(logger, w, http.StatusInternalServerError, fmt.Errorf("failed to run file: %w", err))
+		var timeoutErr *gptscript.TimeoutError
+		if errors.As(err, &timeoutErr) {
+			// Let clients tell a run that timed out apart from one that failed
+			writeServerSentEvent(logger, w, map[string]any{
+				"stderr":  timeoutErr.Error(),
+				"timeout": true,
+			})
+		} else {
+			writeError(logger, w, http.StatusInternalServerError, fmt.Errorf("failed to run file: %w", err))
+		}
 	}
 
 	// Now that we have received all events, send the DONE event.
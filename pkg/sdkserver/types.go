@@ -4,6 +4,7 @@ import (
 	"maps"
 	"time"
 
+	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/gptscript-ai/gptscript/pkg/cache"
 	"github.com/gptscript-ai/gptscript/pkg/engine"
 	"github.com/gptscript-ai/gptscript/pkg/parser"
@@ -38,6 +39,17 @@ type toolOrFileRequest struct {
 	Env               []string `json:"env"`
 	CredentialContext string   `json:"credentialContext"`
 	Confirm           bool     `json:"confirm"`
+	StreamToolOutput  bool     `json:"streamToolOutput"`
+	// TrustedTools are the tools that run without a confirmation with confirm, see runner.IsTrusted.
+	TrustedTools []string `json:"trustedTools"`
+	// OutputSchema is a JSON schema the output of the run must be valid against.
+	OutputSchema *openapi3.Schema `json:"outputSchema"`
+	// History shortens long conversations before each LLM call.
+	History *engine.HistoryOptions `json:"history"`
+	// MaxConcurrency limits how many tool calls of a turn run at the same time, 0 for no limit.
+	MaxConcurrency int `json:"maxConcurrency"`
+	// Timeout is a duration, like "120s", that bounds the whole run.
+	Timeout string `json:"timeout"`
 }
 
 type content struct {
@@ -78,6 +90,7 @@ type runInfo struct {
 	End       time.Time       `json:"end"`
 	State     runState        `json:"state"`
 	ChatState any             `json:"chatState"`
+	Usage     types.Usage     `json:"usage"`
 }
 
 func newRun(id string) *runInfo {
@@ -102,6 +115,8 @@ func (r *runInfo) process(e event) map[string]any {
 			Type:   e.Type,
 			Time:   e.Time,
 		}}
+	case runner.EventTypeDaemonStarted, runner.EventTypeDaemonStopping, runner.EventTypeDaemonStopped:
+		return map[string]any{"daemon": e.Daemon}
 	case runner.EventTypeRunStart:
 		r.Start = e.Time
 		r.Program = *e.Program
@@ -144,6 +159,10 @@ func (r *runInfo) process(e event) map[string]any {
 		call.setOutput(e.Content)
 
 	case runner.EventTypeChat:
+		call.Usage = call.Usage.Add(e.Usage)
+		call.TotalUsage = call.TotalUsage.Add(e.Usage)
+		r.Usage = r.Usage.Add(e.Usage)
+		r.addToParents(call.ParentID, e.Usage)
 		if e.ChatRequest != nil {
 			call.LLMRequest = e.ChatRequest
 		}
@@ -156,6 +175,19 @@ func (r *runInfo) process(e event) map[string]any {
 	return map[string]any{"call": call}
 }
 
+// addToParents adds usage to the total usage of the call with parentID and all of the calls above it.
+func (r *runInfo) addToParents(parentID string, usage types.Usage) {
+	for parentID != "" {
+		parent, ok := r.Calls[parentID]
+		if !ok {
+			return
+		}
+		parent.TotalUsage = parent.TotalUsage.Add(usage)
+		r.Calls[parentID] = parent
+		parentID = parent.ParentID
+	}
+}
+
 func (r *runInfo) processStdout(cs runner.ChatResponse) {
 	if cs.Done {
 		r.State = Finished
@@ -169,14 +201,16 @@ func (r *runInfo) processStdout(cs runner.ChatResponse) {
 type call struct {
 	engine.CallContext `json:",inline"`
 
-	Type        runner.EventType `json:"type"`
-	Start       time.Time        `json:"start"`
-	End         time.Time        `json:"end"`
-	Input       string           `json:"input"`
-	Output      []output         `json:"output"`
-	Usage       types.Usage      `json:"usage"`
-	LLMRequest  any              `json:"llmRequest"`
-	LLMResponse any              `json:"llmResponse"`
+	Type   runner.EventType `json:"type"`
+	Start  time.Time        `json:"start"`
+	End    time.Time        `json:"end"`
+	Input  string           `json:"input"`
+	Output []output         `json:"output"`
+	// Usage is the token usage of the model calls of this call, and TotalUsage also counts all of its sub calls.
+	Usage       types.Usage `json:"usage"`
+	TotalUsage  types.Usage `json:"totalUsage"`
+	LLMRequest  any         `json:"llmRequest"`
+	LLMResponse any         `json:"llmResponse"`
 }
 
 func (c *call) setSubCalls(subCalls map[string]engine.Call) {
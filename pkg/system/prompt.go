@@ -58,3 +58,13 @@ func IsDefaultPrompt(content string) (string, bool) {
 	}
 	return content, false
 }
+
+// JSONSchemaPrompt asks the model to respond with JSON that is valid against schema, for models that can't be
+// constrained to a schema by the provider.
+func JSONSchemaPrompt(schema *openapi3.Schema) string {
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return ""
+	}
+	return "Respond only with JSON, without any other text, that is valid against this JSON schema:\n" + string(data)
+}
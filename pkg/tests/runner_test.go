@@ -3,17 +3,47 @@ package tests
 import (
 	"context"
 	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gptscript-ai/gptscript/pkg/daemon"
+	"github.com/gptscript-ai/gptscript/pkg/engine"
+	"github.com/gptscript-ai/gptscript/pkg/redact"
+	"github.com/gptscript-ai/gptscript/pkg/runner"
 	"github.com/gptscript-ai/gptscript/pkg/tests/tester"
+	"github.com/gptscript-ai/gptscript/pkg/trace"
 	"github.com/gptscript-ai/gptscript/pkg/types"
 	"github.com/hexops/autogold/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// When this variable is set the test binary runs as a daemon tool that serves on PORT, for the tests of daemons.
+const daemonEnv = "GPTSCRIPT_TEST_DAEMON"
+
+func TestMain(m *testing.M) {
+	// Daemons are started by running gptscript sys.daemon, which is the test binary here
+	if len(os.Args) > 2 && os.Args[1] == "sys.daemon" {
+		_ = daemon.SysDaemon()
+		os.Exit(0)
+	}
+	if os.Getenv(daemonEnv) != "" {
+		_ = http.ListenAndServe("127.0.0.1:"+os.Getenv("PORT"), http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte("hello from the daemon"))
+		}))
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
 func toJSONString(t *testing.T, v interface{}) string {
 	t.Helper()
 	x, err := json.MarshalIndent(v, "", "  ")
@@ -766,6 +796,70 @@ func TestCwd(t *testing.T) {
 	assert.Equal(t, "TEST RESULT CALL: 3", x)
 }
 
+func TestCredentialScope(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+
+	runner := tester.NewRunner(t)
+
+	runner.RespondWith(tester.Result{
+		Func: types.CompletionFunctionCall{
+			Name: "reader",
+		},
+	}, tester.Result{
+		Func: types.CompletionFunctionCall{
+			Name: "owner",
+		},
+	}, tester.Result{
+		Func: types.CompletionFunctionCall{
+			Name: "helper",
+		},
+	})
+	x := runner.RunDefault()
+	assert.Equal(t, "TEST RESULT CALL: 4", x)
+}
+
+func TestRetryUnauthorized(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+
+	var requests []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		if r.URL.Path != "/token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte("fetched"))
+	}))
+	defer s.Close()
+	t.Setenv("TEST_SERVER", strings.TrimPrefix(s.URL, "http://"))
+	t.Setenv("TEST_COUNT", filepath.Join(t.TempDir(), "count"))
+	staticCount := filepath.Join(t.TempDir(), "static")
+	t.Setenv("TEST_STATIC_COUNT", staticCount)
+
+	runner := tester.NewRunner(t)
+	runner.RespondWith(tester.Result{
+		Func: types.CompletionFunctionCall{Name: "fetch"},
+	}, tester.Result{
+		Func: types.CompletionFunctionCall{Name: "list"},
+	}, tester.Result{
+		Text: "done",
+	})
+	assert.Equal(t, "done", runner.RunDefault())
+	runner.AssertResponded(t)
+
+	// Each call is unauthorized with the first token it is given and retried once with a refreshed one
+	assert.Equal(t, []string{"/token-1", "/token-2"}, requests)
+
+	// A credential without an expiry or a refresh token is only run when list starts and resumes, not to refresh it
+	data, err := os.ReadFile(staticCount)
+	require.NoError(t, err)
+	assert.Equal(t, "run\nrun\n", string(data))
+}
+
 func TestExport(t *testing.T) {
 	runner := tester.NewRunner(t)
 
@@ -778,3 +872,391 @@ func TestExport(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "TEST RESULT CALL: 3", x)
 }
+
+func TestOutputSchema(t *testing.T) {
+	runner := tester.NewRunner(t)
+
+	runner.RespondWith(tester.Result{
+		Text: "I am Bob",
+	}, tester.Result{
+		Text: `{"nickname": "Bob"}`,
+	}, tester.Result{
+		Text: `{"name": "Bob"}`,
+	})
+	x := runner.RunDefault()
+	assert.Equal(t, `{"name": "Bob"}`, x)
+	runner.AssertResponded(t)
+}
+
+func TestOutputSchemaInvalid(t *testing.T) {
+	runner := tester.NewRunner(t)
+
+	runner.RespondWith(tester.Result{
+		Text: "I am Bob",
+	}, tester.Result{
+		Text: "Bob",
+	}, tester.Result{
+		Text: "Still Bob",
+	})
+	_, err := runner.Run("", "")
+	var schemaErr *engine.OutputSchemaError
+	require.ErrorAs(t, err, &schemaErr)
+	assert.Equal(t, "Still Bob", schemaErr.Output)
+}
+
+func TestProgramOutputSchema(t *testing.T) {
+	r := tester.NewRunner(t)
+	prg, err := r.Load("")
+	require.NoError(t, err)
+
+	schema := &openapi3.Schema{}
+	require.NoError(t, json.Unmarshal([]byte(`{"type": "object", "properties": {"name": {"type": "string"}}, "required": ["name"]}`), schema))
+
+	r.RespondWith(tester.Result{
+		Text: "I am Bob",
+	}, tester.Result{
+		Text: `{"name": "Bob"}`,
+	})
+	x, err := r.Runner.Run(context.Background(), prg.SetOutputSchema(schema), os.Environ(), "")
+	require.NoError(t, err)
+	assert.Equal(t, `{"name": "Bob"}`, x)
+	r.AssertResponded(t)
+}
+
+type failingModel struct {
+	t *testing.T
+}
+
+func (f failingModel) Call(context.Context, types.CompletionRequest, chan<- types.CompletionStatus) (*types.CompletionMessage, error) {
+	f.t.Fatal("the model must not be called in replay mode")
+	return nil, nil
+}
+
+func TestRecordReplay(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+
+	counterFile := filepath.Join(t.TempDir(), "counter")
+	t.Setenv("COUNTER_FILE", counterFile)
+	recordingFile := filepath.Join(t.TempDir(), "recording.json")
+
+	record, err := engine.NewRecording(recordingFile, false)
+	require.NoError(t, err)
+
+	r := tester.NewRunner(t)
+	run, err := runner.New(r.Client, "default", runner.Options{
+		Sequential: true,
+		Recording:  record,
+	})
+	require.NoError(t, err)
+	r.Runner = run
+
+	r.RespondWith(tester.Result{
+		Func: types.CompletionFunctionCall{
+			Name: "counter",
+		},
+	}, tester.Result{
+		Text: "counted",
+	})
+	recorded := r.RunDefault()
+	r.AssertResponded(t)
+	assert.Equal(t, "counted", recorded)
+
+	data, err := os.ReadFile(recordingFile)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "recorded-secret-value")
+	assert.Contains(t, string(data), redact.Replacement)
+
+	replay, err := engine.NewRecording(recordingFile, true)
+	require.NoError(t, err)
+
+	run, err = runner.New(failingModel{t: t}, "default", runner.Options{
+		Sequential: true,
+		Recording:  replay,
+	})
+	require.NoError(t, err)
+	r.Runner = run
+
+	replayed := r.RunDefault()
+	assert.Equal(t, recorded, replayed)
+
+	data, err = os.ReadFile(counterFile)
+	require.NoError(t, err)
+	assert.Equal(t, "run\n", string(data), "the tool must only run while recording")
+
+	// The recording has one response for each request, so a second replay misses
+	_, err = r.Run("", "")
+	var miss *engine.ReplayMissError
+	assert.ErrorAs(t, err, &miss)
+}
+
+func TestAuditLog(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+
+	auditFile := filepath.Join(t.TempDir(), "audit.jsonl")
+	auditLog, err := engine.NewAuditLog(auditFile)
+	require.NoError(t, err)
+	redact.AddValues("audited-secret-token")
+
+	r := tester.NewRunner(t)
+	run, err := runner.New(r.Client, "default", runner.Options{
+		Sequential: true,
+		AuditLog:   auditLog,
+	})
+	require.NoError(t, err)
+	r.Runner = run
+
+	r.RespondWith(tester.Result{
+		Func: types.CompletionFunctionCall{
+			Name:      "fail",
+			Arguments: `{"token": "audited-secret-token"}`,
+		},
+	}, tester.Result{
+		Text: "failed",
+	})
+	assert.Equal(t, "failed", r.RunDefault())
+	r.AssertResponded(t)
+
+	data, err := os.ReadFile(auditFile)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "audited-secret-token")
+
+	var entries []engine.AuditEntry
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var entry engine.AuditEntry
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		entries = append(entries, entry)
+	}
+	require.Len(t, entries, 3)
+
+	assert.Equal(t, engine.AuditTypeModel, entries[0].Type)
+	assert.Equal(t, engine.AuditStatusOK, entries[0].Status)
+	assert.NotEmpty(t, entries[0].CallID)
+
+	assert.Equal(t, engine.AuditTypeTool, entries[1].Type)
+	assert.Equal(t, "fail", entries[1].ToolName)
+	assert.Equal(t, entries[0].CallID, entries[1].ParentCallID)
+	assert.Equal(t, `{"token": "[redacted]"}`, entries[1].Input)
+	assert.Equal(t, engine.AuditStatusError, entries[1].Status)
+	require.NotNil(t, entries[1].ExitCode)
+	assert.Equal(t, 3, *entries[1].ExitCode)
+
+	assert.Equal(t, engine.AuditTypeModel, entries[2].Type)
+	assert.Equal(t, entries[0].CallID, entries[2].CallID)
+}
+
+func TestTrace(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+
+	var exports []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var export map[string]any
+		if assert.NoError(t, json.NewDecoder(r.Body).Decode(&export)) {
+			exports = append(exports, export)
+		}
+	}))
+	defer srv.Close()
+
+	tracer, err := trace.NewTracerFromEnv(srv.URL, nil)
+	require.NoError(t, err)
+
+	r := tester.NewRunner(t)
+	run, err := runner.New(r.Client, "default", runner.Options{
+		Sequential: true,
+		Tracer:     tracer,
+	})
+	require.NoError(t, err)
+	r.Runner = run
+
+	r.RespondWith(tester.Result{
+		Func: types.CompletionFunctionCall{
+			Name: "hello",
+		},
+	}, tester.Result{
+		Text: "done",
+	})
+	assert.Equal(t, "done", r.RunDefault())
+	r.AssertResponded(t)
+
+	require.Len(t, exports, 1)
+	spans := exports[0]["resourceSpans"].([]any)[0].(map[string]any)["scopeSpans"].([]any)[0].(map[string]any)["spans"].([]any)
+
+	ids := map[string]string{}
+	parents := map[string]string{}
+	for _, span := range spans {
+		span := span.(map[string]any)
+		name := span["name"].(string)
+		ids[name] = span["spanId"].(string)
+		parents[name], _ = span["parentSpanId"].(string)
+	}
+
+	// The model is called twice by the entry tool, before and after the call of hello
+	// The model is called twice by the entry tool, before and after the call of hello
+	assert.Len(t, spans, 5)
+	assert.Contains(t, ids, "run testdata/TestTrace/test.gpt")
+	assert.Empty(t, parents["run testdata/TestTrace/test.gpt"])
+	// The entry tool has no name, so its span is named by its ID
+	assert.Equal(t, ids["run testdata/TestTrace/test.gpt"], parents["tool testdata/TestTrace/test.gpt:"])
+	assert.Equal(t, ids["tool testdata/TestTrace/test.gpt:"], parents["tool hello"])
+	assert.Equal(t, ids["tool testdata/TestTrace/test.gpt:"], parents["model gpt-4o"])
+}
+
+func TestConfirm(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+
+	var asked []string
+	r := tester.NewRunner(t)
+	run, err := runner.New(r.Client, "default", runner.Options{
+		Sequential: true,
+		Authorizer: func(ctx engine.Context, _ string) (runner.AuthorizerResponse, error) {
+			asked = append(asked, ctx.Tool.Name)
+			return runner.AuthorizerResponse{
+				Accept:  ctx.Tool.Name == "hello",
+				Always:  true,
+				Message: "not allowed",
+			}, nil
+		},
+		TrustedTools: []string{"hello", "testdata/TestConfirm/test.gpt:date"},
+	})
+	require.NoError(t, err)
+	r.Runner = run
+
+	r.RespondWith(tester.Result{
+		Func: types.CompletionFunctionCall{Name: "hello"},
+	}, tester.Result{
+		Func: types.CompletionFunctionCall{Name: "hello"},
+	}, tester.Result{
+		Func: types.CompletionFunctionCall{Name: "date"},
+	}, tester.Result{
+		Text: "done",
+	})
+	assert.Equal(t, "done", r.RunDefault())
+	r.AssertResponded(t)
+	// hello is always allowed after it was confirmed once, and date is trusted by its ID, not by the name of hello
+	assert.Equal(t, []string{"hello"}, asked)
+
+	asked = nil
+	run, err = runner.New(r.Client, "default", runner.Options{
+		Sequential: true,
+		Authorizer: func(ctx engine.Context, _ string) (runner.AuthorizerResponse, error) {
+			asked = append(asked, ctx.Tool.Name)
+			return runner.AuthorizerResponse{
+				Message: "not allowed",
+			}, nil
+		},
+	})
+	require.NoError(t, err)
+	r.Runner = run
+
+	r.RespondWith(tester.Result{
+		Func: types.CompletionFunctionCall{Name: "date"},
+	}, tester.Result{
+		Func: types.CompletionFunctionCall{Name: "date"},
+	}, tester.Result{
+		Text: "denied",
+	})
+	assert.Equal(t, "denied", r.RunDefault())
+	r.AssertResponded(t)
+	// A denied tool is asked again, and the model gets the denial as the result of the call
+	assert.Equal(t, []string{"date", "date"}, asked)
+}
+
+type eventMonitor struct {
+	lock   sync.Mutex
+	events []runner.Event
+}
+
+func (e *eventMonitor) Start(context.Context, *types.Program, []string, string) (runner.Monitor, error) {
+	return e, nil
+}
+
+func (e *eventMonitor) Event(event runner.Event) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.events = append(e.events, event)
+}
+
+func (e *eventMonitor) Pause() func() {
+	return func() {}
+}
+
+func (e *eventMonitor) Stop(string, error) {}
+
+func TestDaemonEvents(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+
+	t.Setenv(daemonEnv, "true")
+	t.Setenv("GPTSCRIPT_TEST_DAEMON_BIN", os.Args[0])
+	defer engine.CloseDaemons()
+
+	monitor := &eventMonitor{}
+	r := tester.NewRunner(t)
+	run, err := runner.New(r.Client, "default", runner.Options{
+		Sequential:     true,
+		MonitorFactory: monitor,
+	})
+	require.NoError(t, err)
+	r.Runner = run
+
+	r.RespondWith(tester.Result{
+		Func: types.CompletionFunctionCall{Name: "hello"},
+	}, tester.Result{
+		Text: "done",
+	})
+	assert.Equal(t, "done", r.RunDefault())
+	r.AssertResponded(t)
+
+	var daemons []engine.DaemonEvent
+	for _, event := range monitor.events {
+		if event.Daemon != nil {
+			assert.Equal(t, runner.EventTypeDaemonStarted, event.Type)
+			daemons = append(daemons, *event.Daemon)
+		}
+	}
+	require.Len(t, daemons, 1)
+	assert.Equal(t, "testdata/TestDaemonEvents/test.gpt:daemon", daemons[0].ToolID)
+	assert.Equal(t, "daemon", daemons[0].ToolName)
+	assert.NotZero(t, daemons[0].Port)
+}
+
+func TestDaemonNotReady(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+
+	t.Setenv(daemonEnv, "true")
+	t.Setenv("GPTSCRIPT_TEST_DAEMON_BIN", os.Args[0])
+	defer engine.CloseDaemons()
+
+	stopped := make(chan engine.DaemonEvent, 1)
+	defer engine.AddDaemonListener(func(event engine.DaemonEvent) {
+		if event.Type == engine.DaemonStopped {
+			stopped <- event
+		}
+	})()
+
+	r := tester.NewRunner(t)
+	r.RespondWith(tester.Result{
+		Func: types.CompletionFunctionCall{Name: "hello"},
+	})
+	_, err := r.Run("", "")
+	var notReady *engine.DaemonNotReadyError
+	require.ErrorAs(t, err, &notReady)
+
+	// A daemon that is not ready is stopped, without waiting for the program to exit
+	select {
+	case event := <-stopped:
+		assert.Equal(t, "testdata/TestDaemonNotReady/test.gpt:daemon", event.ToolID)
+	case <-time.After(10 * time.Second):
+		t.Fatal("the daemon that is not ready was not stopped")
+	}
+}
@@ -0,0 +1,272 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gptscript-ai/gptscript/pkg/version"
+)
+
+const exportTimeout = 10 * time.Second
+
+// Tracer exports the spans of runs to an OpenTelemetry collector with OTLP over HTTP, encoded as JSON, so that the
+// calls of a run can be viewed as a tree with their timings in tools like Jaeger.
+type Tracer struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+	client   *http.Client
+
+	lock    sync.Mutex
+	pending []*Span
+}
+
+// NewTracer returns a tracer that exports spans to endpoint, the full URL that traces are posted to, such as
+// http://localhost:4318/v1/traces, with the headers in headers.
+func NewTracer(endpoint string, headers map[string]string, service string) (*Tracer, error) {
+	if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q, expected an http or https URL", endpoint)
+	}
+	if service == "" {
+		service = version.ProgramName
+	}
+	return &Tracer{
+		endpoint: endpoint,
+		headers:  headers,
+		service:  service,
+		client:   &http.Client{Timeout: exportTimeout},
+	}, nil
+}
+
+// NewTracerFromEnv returns a tracer configured with the standard OTEL_EXPORTER_OTLP_* and OTEL_SERVICE_NAME variables in
+// env, or nil if no endpoint is set or OTEL_SDK_DISABLED is true. endpoint is a base URL like
+// OTEL_EXPORTER_OTLP_ENDPOINT and, if it is not empty, takes precedence over both endpoint variables.
+func NewTracerFromEnv(endpoint string, env []string) (*Tracer, error) {
+	vars := map[string]string{}
+	for _, env := range env {
+		if k, v, ok := strings.Cut(env, "="); ok {
+			vars[k] = v
+		}
+	}
+
+	if vars["OTEL_SDK_DISABLED"] == "true" {
+		return nil, nil
+	}
+
+	tracesEndpoint := vars["OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"]
+	if endpoint == "" && tracesEndpoint == "" {
+		endpoint = vars["OTEL_EXPORTER_OTLP_ENDPOINT"]
+	}
+	if endpoint != "" {
+		// Like the SDKs, a base endpoint gets the path of traces, and the traces endpoint is used as it is
+		tracesEndpoint = strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	}
+	if tracesEndpoint == "" {
+		return nil, nil
+	}
+
+	headers := parseHeaders(vars["OTEL_EXPORTER_OTLP_HEADERS"])
+	for k, v := range parseHeaders(vars["OTEL_EXPORTER_OTLP_TRACES_HEADERS"]) {
+		headers[k] = v
+	}
+
+	return NewTracer(tracesEndpoint, headers, vars["OTEL_SERVICE_NAME"])
+}
+
+// parseHeaders parses headers in the format of OTEL_EXPORTER_OTLP_HEADERS, key=value pairs separated by commas, with
+// URL encoded values.
+func parseHeaders(s string) map[string]string {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		if decoded, err := url.QueryUnescape(v); err == nil {
+			v = decoded
+		}
+		headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return headers
+}
+
+func (t *Tracer) add(span *Span) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.pending = append(t.pending, span)
+}
+
+// flush exports the spans that ended since the last export. Failures are logged, tracing never fails a run.
+func (t *Tracer) flush() {
+	if err := t.Flush(context.Background()); err != nil {
+		log.Warnf("Failed to export traces to %s: %v", t.endpoint, err)
+	}
+}
+
+// Flush exports the spans that ended since the last export.
+func (t *Tracer) Flush(ctx context.Context) error {
+	t.lock.Lock()
+	spans := t.pending
+	t.pending = nil
+	t.lock.Unlock()
+
+	if len(spans) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(t.request(spans))
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, exportTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// The types below are the JSON encoding of an OTLP ExportTraceServiceRequest, with only the fields that are used
+
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope      `json:"scope"`
+	Spans []spanData `json:"spans"`
+}
+
+type scope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type spanData struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              SpanKind   `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            status     `json:"status"`
+}
+
+type status struct {
+	Message string `json:"message,omitempty"`
+	// Code is 1 for ok and 2 for error
+	Code int `json:"code"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	// IntValue is a string, as 64 bit integers are encoded in OTLP JSON
+	IntValue    *string  `json:"intValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func (t *Tracer) request(spans []*Span) exportRequest {
+	data := make([]spanData, 0, len(spans))
+	for _, span := range spans {
+		span.lock.Lock()
+		s := spanData{
+			TraceID:           span.traceID,
+			SpanID:            span.spanID,
+			ParentSpanID:      span.parentID,
+			Name:              span.name,
+			Kind:              span.kind,
+			StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+			Attributes:        keyValues(span.attrs),
+			Status:            status{Code: 1},
+		}
+		if span.err != nil {
+			s.Status = status{Code: 2, Message: span.err.Error()}
+		}
+		span.lock.Unlock()
+		data = append(data, s)
+	}
+
+	return exportRequest{
+		ResourceSpans: []resourceSpans{{
+			Resource: resource{
+				Attributes: keyValues([]Attribute{
+					String("service.name", t.service),
+					String("service.version", version.Tag),
+				}),
+			},
+			ScopeSpans: []scopeSpans{{
+				Scope: scope{
+					Name:    "github.com/gptscript-ai/gptscript",
+					Version: version.Tag,
+				},
+				Spans: data,
+			}},
+		}},
+	}
+}
+
+func keyValues(attrs []Attribute) []keyValue {
+	result := make([]keyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		var value anyValue
+		switch v := attr.Value.(type) {
+		case string:
+			value.StringValue = &v
+		case int64:
+			s := strconv.FormatInt(v, 10)
+			value.IntValue = &s
+		case bool:
+			value.BoolValue = &v
+		case float64:
+			value.DoubleValue = &v
+		default:
+			s := fmt.Sprint(v)
+			value.StringValue = &s
+		}
+		result = append(result, keyValue{Key: attr.Key, Value: value})
+	}
+	return result
+}
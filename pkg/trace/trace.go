@@ -0,0 +1,153 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+type SpanKind int
+
+// The kinds of spans, as numbered by OTLP
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindClient   SpanKind = 3
+)
+
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: int64(value)}
+}
+
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+type tracerKey struct{}
+
+type spanKey struct{}
+
+// WithTracer returns a context in which Start records spans with tracer. A nil tracer returns ctx as it is, so that
+// Start does nothing.
+func WithTracer(ctx context.Context, tracer *Tracer) context.Context {
+	if tracer == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, tracerKey{}, tracer)
+}
+
+// Enabled returns true if spans started with ctx are recorded, so that callers can skip preparing the name and
+// attributes of a span that would not be.
+func Enabled(ctx context.Context) bool {
+	_, ok := ctx.Value(tracerKey{}).(*Tracer)
+	return ok
+}
+
+// Start starts a span that is a child of the span in ctx, if there is one, and returns a context with the new span.
+// Without a tracer in ctx, ctx is returned with a nil span, whose methods do nothing.
+func Start(ctx context.Context, name string, kind SpanKind, attrs ...Attribute) (context.Context, *Span) {
+	tracer, ok := ctx.Value(tracerKey{}).(*Tracer)
+	if !ok {
+		return ctx, nil
+	}
+
+	span := &Span{
+		tracer: tracer,
+		name:   name,
+		kind:   kind,
+		spanID: newID(8),
+		start:  time.Now(),
+		attrs:  attrs,
+	}
+	if parent := FromContext(ctx); parent != nil {
+		span.traceID = parent.traceID
+		span.parentID = parent.spanID
+	} else {
+		span.traceID = newID(16)
+	}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// FromContext returns the span in ctx, or nil if there is none.
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Span is an operation of a run, such as a call of a tool or the model. It is exported when the span that started
+// its trace ends.
+type Span struct {
+	tracer   *Tracer
+	name     string
+	kind     SpanKind
+	traceID  string
+	spanID   string
+	parentID string
+	start    time.Time
+
+	lock  sync.Mutex
+	end   time.Time
+	attrs []Attribute
+	err   error
+}
+
+// SetAttributes adds attributes to the span, replacing the ones with the same keys.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, attr := range attrs {
+		replaced := false
+		for i := range s.attrs {
+			if s.attrs[i].Key == attr.Key {
+				s.attrs[i] = attr
+				replaced = true
+			}
+		}
+		if !replaced {
+			s.attrs = append(s.attrs, attr)
+		}
+	}
+}
+
+// End ends the span, with an error status if err is not nil. Ending the first span of a trace exports the spans that
+// ended so far.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	if !s.end.IsZero() {
+		s.lock.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.err = err
+	s.lock.Unlock()
+
+	s.tracer.add(s)
+	if s.parentID == "" {
+		s.tracer.flush()
+	}
+}
+
+func newID(size int) string {
+	id := make([]byte, size)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
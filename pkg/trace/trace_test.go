@@ -0,0 +1,130 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type collector struct {
+	lock     sync.Mutex
+	paths    []string
+	headers  []http.Header
+	requests []exportRequest
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req exportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.paths = append(c.paths, r.URL.Path)
+	c.headers = append(c.headers, r.Header)
+	c.requests = append(c.requests, req)
+}
+
+func TestDisabled(t *testing.T) {
+	ctx := context.Background()
+	assert.False(t, Enabled(ctx))
+	assert.Equal(t, ctx, WithTracer(ctx, nil))
+
+	spanCtx, span := Start(ctx, "run", SpanKindInternal)
+	assert.Nil(t, span)
+	assert.Equal(t, ctx, spanCtx)
+	assert.Nil(t, FromContext(spanCtx))
+
+	// The methods of a nil span do nothing
+	span.SetAttributes(String("key", "value"))
+	span.End(errors.New("failed"))
+}
+
+func TestExport(t *testing.T) {
+	c := &collector{}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	tracer, err := NewTracerFromEnv("", []string{
+		"OTEL_EXPORTER_OTLP_ENDPOINT=" + srv.URL + "/",
+		"OTEL_EXPORTER_OTLP_HEADERS=Authorization=Bearer%20token,X-Team=tools",
+		"OTEL_SERVICE_NAME=test",
+	})
+	require.NoError(t, err)
+
+	ctx := WithTracer(context.Background(), tracer)
+	assert.True(t, Enabled(ctx))
+
+	runCtx, run := Start(ctx, "run", SpanKindInternal, String("gptscript.program", "test.gpt"))
+	_, model := Start(runCtx, "model gpt-4o", SpanKindClient)
+	model.SetAttributes(Int("gen_ai.usage.input_tokens", 10), Bool("gptscript.model.cache_hit", true), Int("gen_ai.usage.input_tokens", 12))
+	model.End(errors.New("rate limited"))
+	assert.Empty(t, c.requests, "spans are only exported when the trace ends")
+
+	run.End(nil)
+	require.Len(t, c.requests, 1)
+	assert.Equal(t, "/v1/traces", c.paths[0])
+	assert.Equal(t, "Bearer token", c.headers[0].Get("Authorization"))
+	assert.Equal(t, "tools", c.headers[0].Get("X-Team"))
+	assert.Equal(t, "application/json", c.headers[0].Get("Content-Type"))
+
+	resource := c.requests[0].ResourceSpans[0]
+	assert.Equal(t, "service.name", resource.Resource.Attributes[0].Key)
+	assert.Equal(t, "test", *resource.Resource.Attributes[0].Value.StringValue)
+
+	spans := resource.ScopeSpans[0].Spans
+	require.Len(t, spans, 2)
+	modelSpan, runSpan := spans[0], spans[1]
+
+	assert.Equal(t, "run", runSpan.Name)
+	assert.Len(t, runSpan.TraceID, 32)
+	assert.Len(t, runSpan.SpanID, 16)
+	assert.Empty(t, runSpan.ParentSpanID)
+	assert.Equal(t, status{Code: 1}, runSpan.Status)
+	assert.Equal(t, "test.gpt", *runSpan.Attributes[0].Value.StringValue)
+
+	assert.Equal(t, "model gpt-4o", modelSpan.Name)
+	assert.Equal(t, SpanKindClient, modelSpan.Kind)
+	assert.Equal(t, runSpan.TraceID, modelSpan.TraceID)
+	assert.Equal(t, runSpan.SpanID, modelSpan.ParentSpanID)
+	assert.Equal(t, status{Code: 2, Message: "rate limited"}, modelSpan.Status)
+	require.Len(t, modelSpan.Attributes, 2)
+	assert.Equal(t, "12", *modelSpan.Attributes[0].Value.IntValue)
+	assert.True(t, *modelSpan.Attributes[1].Value.BoolValue)
+	assert.LessOrEqual(t, runSpan.StartTimeUnixNano, modelSpan.StartTimeUnixNano)
+
+	// Ending a span again changes nothing
+	run.End(errors.New("ignored"))
+	assert.Len(t, c.requests, 1)
+}
+
+func TestNewTracerFromEnv(t *testing.T) {
+	tracer, err := NewTracerFromEnv("", nil)
+	require.NoError(t, err)
+	assert.Nil(t, tracer)
+
+	tracer, err = NewTracerFromEnv("", []string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT=http://traces:4318/custom", "OTEL_EXPORTER_OTLP_ENDPOINT=http://base:4318"})
+	require.NoError(t, err)
+	assert.Equal(t, "http://traces:4318/custom", tracer.endpoint)
+	assert.Equal(t, "gptscript", tracer.service)
+
+	tracer, err = NewTracerFromEnv("http://flag:4318", []string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT=http://traces:4318/custom"})
+	require.NoError(t, err)
+	assert.Equal(t, "http://flag:4318/v1/traces", tracer.endpoint)
+
+	tracer, err = NewTracerFromEnv("http://flag:4318", []string{"OTEL_SDK_DISABLED=true"})
+	require.NoError(t, err)
+	assert.Nil(t, tracer)
+
+	_, err = NewTracerFromEnv("localhost:4318", nil)
+	assert.ErrorContains(t, err, "invalid OTLP endpoint")
+}
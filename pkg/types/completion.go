@@ -16,6 +16,7 @@ type CompletionRequest struct {
 	MaxTokens            int                 `json:"maxTokens,omitempty"`
 	Temperature          *float32            `json:"temperature,omitempty"`
 	JSONResponse         bool                `json:"jsonResponse,omitempty"`
+	OutputSchema         *openapi3.Schema    `json:"outputSchema,omitempty"`
 	Cache                *bool               `json:"cache,omitempty"`
 }
 
@@ -76,6 +77,15 @@ type Usage struct {
 	TotalTokens      int `json:"totalTokens,omitempty"`
 }
 
+// Add returns the sum of u and other.
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+		TotalTokens:      u.TotalTokens + other.TotalTokens,
+	}
+}
+
 type CompletionStatus struct {
 	CompletionID    string
 	Request         any
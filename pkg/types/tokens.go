@@ -0,0 +1,66 @@
+package types
+
+// EstimateTokens roughly estimates the number of tokens of messages, at four characters per token. It is the estimate
+// both the history of a conversation and the context window of a model are fitted with, so that they agree.
+func EstimateTokens(msgs ...CompletionMessage) int {
+	total := 0
+	for _, msg := range msgs {
+		chars := 0
+		for _, part := range msg.Content {
+			chars += len(part.Text)
+			if part.ToolCall != nil {
+				chars += len(part.ToolCall.Function.Name) + len(part.ToolCall.Function.Arguments)
+			}
+		}
+		total += chars/4 + 4
+	}
+	return total
+}
+
+// GroupMessages splits messages into groups that have to be kept or dropped together, which are messages with the
+// results of the tool calls they made.
+func GroupMessages(msgs []CompletionMessage) (groups [][]CompletionMessage) {
+	for _, msg := range msgs {
+		if msg.Role == CompletionMessageRoleTypeTool && len(groups) > 0 {
+			groups[len(groups)-1] = append(groups[len(groups)-1], msg)
+			continue
+		}
+		groups = append(groups, []CompletionMessage{msg})
+	}
+	return
+}
+
+// FitGroups returns how many of the last groups fit in maxTokens together, by EstimateTokens. The last group is always
+// kept, even if it doesn't fit.
+func FitGroups(groups [][]CompletionMessage, maxTokens int) int {
+	total := 0
+	for i := len(groups) - 1; i >= 0; i-- {
+		total += EstimateTokens(groups[i]...)
+		if total > maxTokens && i < len(groups)-1 {
+			return len(groups) - 1 - i
+		}
+	}
+	return len(groups)
+}
+
+// DropOldest drops the oldest messages after the system messages at the start of msgs, until the estimated tokens of
+// the messages are at most maxTokens. The last message is always kept, and tool results are only kept together with the
+// message with their tool call.
+func DropOldest(msgs []CompletionMessage, maxTokens int) []CompletionMessage {
+	head := 0
+	for head < len(msgs) && msgs[head].Role == CompletionMessageRoleTypeSystem {
+		head++
+	}
+
+	groups := GroupMessages(msgs[head:])
+	keep := FitGroups(groups, maxTokens-EstimateTokens(msgs[:head]...))
+	if keep == len(groups) {
+		return msgs
+	}
+
+	result := append([]CompletionMessage{}, msgs[:head]...)
+	for _, group := range groups[len(groups)-keep:] {
+		result = append(result, group...)
+	}
+	return result
+}
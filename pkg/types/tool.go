@@ -2,6 +2,7 @@ package types
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"path/filepath"
 	"slices"
@@ -17,7 +18,20 @@ const (
 	DaemonPrefix  = "#!sys.daemon"
 	OpenAPIPrefix = "#!sys.openapi"
 	EchoPrefix    = "#!sys.echo"
-	CommandPrefix = "#!"
+	// OAuthDevicePrefix starts a credential tool that gets an OAuth token with the device authorization grant. The
+	// rest of its instructions is the JSON of a credentials.OAuthDeviceConfig.
+	OAuthDevicePrefix = "#!sys.oauth.device"
+	// MCPPrefix starts the instructions of a tool that calls a tool of an MCP server, followed by the JSON of
+	// mcp.ToolInstructions.
+	MCPPrefix = "#!sys.mcp"
+	// OpenAPICredentialPrefix starts a credential tool that was generated for the security schemes of OpenAPI
+	// operations, followed by the JSON of engine.OpenAPICredentialInstructions.
+	OpenAPICredentialPrefix = "#!sys.credential.openapi"
+	CommandPrefix           = "#!"
+
+	// ExistingCredentialEnvVar is set for a credential tool that is run again to renew an expired credential. It
+	// holds the JSON of the credential, including its refresh token.
+	ExistingCredentialEnvVar = "GPTSCRIPT_EXISTING_CREDENTIAL"
 )
 
 type ErrToolNotFound struct {
@@ -95,6 +109,16 @@ func (p Program) TopLevelTools() (result []Tool) {
 	return
 }
 
+// SetOutputSchema returns a copy of the program whose entry tool has the output schema, in place of its own.
+func (p Program) SetOutputSchema(schema *openapi3.Schema) Program {
+	tool := p.ToolSet[p.EntryToolID]
+	tool.Parameters.OutputSchema = schema
+	tools := maps.Clone(p.ToolSet)
+	tools[p.EntryToolID] = tool
+	p.ToolSet = tools
+	return p
+}
+
 func (p Program) SetBlocking() Program {
 	tool := p.ToolSet[p.EntryToolID]
 	tool.Blocking = true
@@ -107,25 +131,31 @@ func (p Program) SetBlocking() Program {
 type BuiltinFunc func(ctx context.Context, env []string, input string) (string, error)
 
 type Parameters struct {
-	Name            string           `json:"name,omitempty"`
-	Description     string           `json:"description,omitempty"`
-	MaxTokens       int              `json:"maxTokens,omitempty"`
-	ModelName       string           `json:"modelName,omitempty"`
-	ModelProvider   bool             `json:"modelProvider,omitempty"`
-	JSONResponse    bool             `json:"jsonResponse,omitempty"`
-	Chat            bool             `json:"chat,omitempty"`
-	Temperature     *float32         `json:"temperature,omitempty"`
-	Cache           *bool            `json:"cache,omitempty"`
-	InternalPrompt  *bool            `json:"internalPrompt"`
-	Arguments       *openapi3.Schema `json:"arguments,omitempty"`
-	Tools           []string         `json:"tools,omitempty"`
-	GlobalTools     []string         `json:"globalTools,omitempty"`
-	GlobalModelName string           `json:"globalModelName,omitempty"`
-	Context         []string         `json:"context,omitempty"`
-	ExportContext   []string         `json:"exportContext,omitempty"`
-	Export          []string         `json:"export,omitempty"`
-	Credentials     []string         `json:"credentials,omitempty"`
-	Blocking        bool             `json:"-"`
+	Name             string           `json:"name,omitempty"`
+	Description      string           `json:"description,omitempty"`
+	MaxTokens        int              `json:"maxTokens,omitempty"`
+	ModelName        string           `json:"modelName,omitempty"`
+	ModelProvider    bool             `json:"modelProvider,omitempty"`
+	JSONResponse     bool             `json:"jsonResponse,omitempty"`
+	Chat             bool             `json:"chat,omitempty"`
+	Temperature      *float32         `json:"temperature,omitempty"`
+	Cache            *bool            `json:"cache,omitempty"`
+	InternalPrompt   *bool            `json:"internalPrompt"`
+	Arguments        *openapi3.Schema `json:"arguments,omitempty"`
+	OutputSchema     *openapi3.Schema `json:"outputSchema,omitempty"`
+	Tools            []string         `json:"tools,omitempty"`
+	GlobalTools      []string         `json:"globalTools,omitempty"`
+	GlobalModelName  string           `json:"globalModelName,omitempty"`
+	Context          []string         `json:"context,omitempty"`
+	ExportContext    []string         `json:"exportContext,omitempty"`
+	Export           []string         `json:"export,omitempty"`
+	Credentials      []string         `json:"credentials,omitempty"`
+	ShareCredentials []string         `json:"shareCredentials,omitempty"`
+	AllowedPaths     []string         `json:"allowedPaths,omitempty"`
+	Network          *bool            `json:"network,omitempty"`
+	MaxMemory        string           `json:"maxMemory,omitempty"`
+	MaxCPUTime       string           `json:"maxCPUTime,omitempty"`
+	Blocking         bool             `json:"-"`
 }
 
 type ToolDef struct {
@@ -277,12 +307,33 @@ func (t ToolDef) String() string {
 			_, _ = fmt.Fprintf(buf, "Args: %s: %s\n", key, prop.Value.Description)
 		}
 	}
+	if t.Parameters.OutputSchema != nil {
+		schema, err := json.Marshal(t.Parameters.OutputSchema)
+		if err == nil {
+			_, _ = fmt.Fprintf(buf, "Output Schema: %s\n", schema)
+		}
+	}
 	if t.Parameters.InternalPrompt != nil {
 		_, _ = fmt.Fprintf(buf, "Internal Prompt: %v\n", *t.Parameters.InternalPrompt)
 	}
 	if len(t.Parameters.Credentials) > 0 {
 		_, _ = fmt.Fprintf(buf, "Credentials: %s\n", strings.Join(t.Parameters.Credentials, ", "))
 	}
+	if len(t.Parameters.ShareCredentials) > 0 {
+		_, _ = fmt.Fprintf(buf, "Share Credentials: %s\n", strings.Join(t.Parameters.ShareCredentials, ", "))
+	}
+	if len(t.Parameters.AllowedPaths) > 0 {
+		_, _ = fmt.Fprintf(buf, "Allowed Paths: %s\n", strings.Join(t.Parameters.AllowedPaths, ", "))
+	}
+	if t.Parameters.Network != nil {
+		_, _ = fmt.Fprintf(buf, "Network: %v\n", *t.Parameters.Network)
+	}
+	if t.Parameters.MaxMemory != "" {
+		_, _ = fmt.Fprintf(buf, "Max Memory: %s\n", t.Parameters.MaxMemory)
+	}
+	if t.Parameters.MaxCPUTime != "" {
+		_, _ = fmt.Fprintf(buf, "Max CPU Time: %s\n", t.Parameters.MaxCPUTime)
+	}
 	if t.Parameters.Chat {
 		_, _ = fmt.Fprintf(buf, "Chat: true\n")
 	}
@@ -484,6 +535,18 @@ func (t Tool) IsEcho() bool {
 	return strings.HasPrefix(t.Instructions, EchoPrefix)
 }
 
+func (t Tool) IsOAuthDevice() bool {
+	return strings.HasPrefix(t.Instructions, OAuthDevicePrefix)
+}
+
+func (t Tool) IsOpenAPICredential() bool {
+	return strings.HasPrefix(t.Instructions, OpenAPICredentialPrefix)
+}
+
+func (t Tool) IsMCP() bool {
+	return strings.HasPrefix(t.Instructions, MCPPrefix)
+}
+
 func (t Tool) IsHTTP() bool {
 	return strings.HasPrefix(t.Instructions, "#!http://") ||
 		strings.HasPrefix(t.Instructions, "#!https://")
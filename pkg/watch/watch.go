@@ -0,0 +1,99 @@
+// Package watch reports changes to the files of directories by polling them, so that it works the same on every
+// platform and file system.
+package watch
+
+import (
+	"context"
+	"io/fs"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+type fileState struct {
+	modTime int64
+	size    int64
+}
+
+// Dirs polls the files of dirs every interval and calls changed with the dirs whose files changed, once no file of
+// them changed for debounce, so that a burst of writes, such as an editor saving a file or several files being
+// saved, is reported once. It returns when ctx is done.
+func Dirs(ctx context.Context, dirs []string, interval, debounce time.Duration, changed func(dirs []string)) {
+	snapshots := make(map[string]map[string]fileState, len(dirs))
+	for _, dir := range dirs {
+		snapshots[dir] = snapshot(dir)
+	}
+
+	var (
+		dirty      []string
+		lastChange time.Time
+		ticker     = time.NewTicker(interval)
+	)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, dir := range dirs {
+			current := snapshot(dir)
+			if !maps.Equal(snapshots[dir], current) {
+				snapshots[dir] = current
+				lastChange = time.Now()
+				if !slices.Contains(dirty, dir) {
+					dirty = append(dirty, dir)
+				}
+			}
+		}
+
+		if len(dirty) > 0 && time.Since(lastChange) >= debounce {
+			changed(dirty)
+			dirty = nil
+		}
+	}
+}
+
+// snapshot returns the modification time and size of the files in dir. Build output in bin, hidden files and
+// directories such as .git, and node_modules are skipped, as they are not sources and bin is written by the build
+// itself. A dir that can't be read has no files.
+func snapshot(dir string) map[string]fileState {
+	files := map[string]fileState{}
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return nil
+		}
+
+		name := d.Name()
+		if path != dir && (strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~")) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if name == "node_modules" || path == filepath.Join(dir, "bin") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		files[path] = fileState{
+			modTime: info.ModTime().UnixNano(),
+			size:    info.Size(),
+		}
+		return nil
+	})
+	return files
+}
@@ -0,0 +1,55 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirs(t *testing.T) {
+	dir, other := t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main"), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "bin"), 0755))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan []string, 10)
+	go Dirs(ctx, []string{dir, other}, 10*time.Millisecond, 100*time.Millisecond, func(dirs []string) {
+		changes <- dirs
+	})
+	time.Sleep(50 * time.Millisecond)
+
+	// Build output and hidden files are not changes
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bin", "gptscript-go-tool"), []byte("binary"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".main.go.swp"), []byte("swap"), 0644))
+	select {
+	case dirs := <-changes:
+		t.Fatalf("unexpected change of %v", dirs)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	// Writes in quick succession are reported once
+	for i := 0; i < 5; i++ {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"+string(rune('a'+i))), 0644))
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	select {
+	case dirs := <-changes:
+		assert.Equal(t, []string{dir}, dirs)
+	case <-time.After(2 * time.Second):
+		t.Fatal("change was not reported")
+	}
+
+	select {
+	case dirs := <-changes:
+		t.Fatalf("change was reported again for %v", dirs)
+	case <-time.After(200 * time.Millisecond):
+	}
+}